@@ -1,9 +1,20 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/solunara/isb/src/server"
 )
 
 func main() {
-	server.Start()
+	switch flag.Arg(0) {
+	case "import":
+		server.Import(flag.Args()[1:])
+	case "region":
+		server.Region(flag.Args()[1:])
+	case "rekey":
+		server.Rekey(flag.Args()[1:])
+	default:
+		server.Start()
+	}
 }
@@ -0,0 +1,127 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 密文格式为 enc:<密钥 id>:<base64(nonce + 密文)>
+const prefix = "enc:"
+
+var (
+	ErrUnknownKey = errors.New("fieldcrypt: unknown key")
+	ErrMalformed  = errors.New("fieldcrypt: malformed ciphertext")
+	ErrNoKeyring  = errors.New("fieldcrypt: keyring not configured")
+)
+
+// Keyring 用当前密钥加密, 按密文中的密钥 id 解密
+// 轮换密钥时新增一个密钥并设为当前密钥, 旧密钥保留到数据全部重新加密以后
+type Keyring struct {
+	current  string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring secrets 为密钥 id 到密钥的映射, 密钥经 sha256 后作为 AES-256-GCM 的密钥
+// indexSecret 是 Index 使用的 HMAC 密钥, 不参与轮换, 修改后需要重建全部索引
+func NewKeyring(current string, secrets map[string]string, indexSecret string) (*Keyring, error) {
+	if _, ok := secrets[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %q", ErrUnknownKey, current)
+	}
+	if indexSecret == "" {
+		return nil, errors.New("fieldcrypt: empty index secret")
+	}
+	k := &Keyring{
+		current:  current,
+		aeads:    make(map[string]cipher.AEAD, len(secrets)),
+		indexKey: []byte(indexSecret),
+	}
+	for id, secret := range secrets {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("fieldcrypt: invalid key id %q", id)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("fieldcrypt: empty secret for key %q", id)
+		}
+		sum := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// Current 当前用于加密的密钥 id
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Encrypt 空字符串不加密
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 不是密文的值原样返回, 兼容加密前写入的数据
+func (k *Keyring) Decrypt(s string) (string, error) {
+	id, data, ok := split(s)
+	if !ok {
+		return s, nil
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plain), nil
+}
+
+// Index 明文的 HMAC-SHA256, 加密后的字段用它做唯一索引和等值查询
+func (k *Keyring) Index(plain string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(plain))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// KeyId 密文使用的密钥 id, 不是密文时 ok 为 false
+func KeyId(s string) (string, bool) {
+	id, _, ok := split(s)
+	return id, ok
+}
+
+func split(s string) (id, data string, ok bool) {
+	rest, ok := strings.CutPrefix(s, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
@@ -0,0 +1,44 @@
+package fieldcrypt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring_Rotate(t *testing.T) {
+	oldKeyring, err := NewKeyring("k1", map[string]string{"k1": "old-secret"}, "index")
+	require.NoError(t, err)
+	old, err := oldKeyring.Encrypt("13800138000")
+	require.NoError(t, err)
+	id, ok := KeyId(old)
+	require.True(t, ok)
+	assert.Equal(t, "k1", id)
+
+	keyring, err := NewKeyring("k2", map[string]string{"k1": "old-secret", "k2": "new-secret"}, "index")
+	require.NoError(t, err)
+	plain, err := keyring.Decrypt(old)
+	require.NoError(t, err)
+	assert.Equal(t, "13800138000", plain)
+
+	rotated, err := keyring.Encrypt(plain)
+	require.NoError(t, err)
+	id, _ = KeyId(rotated)
+	assert.Equal(t, "k2", id)
+	_, err = oldKeyring.Decrypt(rotated)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// 加密前写入的明文原样返回, 空值不加密
+	plain, err = keyring.Decrypt("13800138000")
+	require.NoError(t, err)
+	assert.Equal(t, "13800138000", plain)
+	empty, err := keyring.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	_, err = keyring.Decrypt(rotated[:len(rotated)-2])
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = NewKeyring("k3", map[string]string{"k1": "old-secret"}, "index")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,77 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName 字段的 gorm 标签写 serializer:encrypt 时读写自动解密和加密
+const SerializerName = "encrypt"
+
+var defaultKeyring atomic.Pointer[Keyring]
+
+func init() {
+	schema.RegisterSerializer(SerializerName, Serializer{})
+}
+
+// SetDefault 设置 Serializer 使用的密钥, 服务启动时调用
+func SetDefault(k *Keyring) {
+	defaultKeyring.Store(k)
+}
+
+// Index 用 SetDefault 设置的密钥计算索引, 没有设置密钥时使用不带密钥的 sha256
+func Index(plain string) string {
+	if k := defaultKeyring.Load(); k != nil {
+		return k.Index(plain)
+	}
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Serializer 加密 string 类型的字段
+// 没有设置密钥时按明文写入, 读到密文时返回 ErrNoKeyring
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var s string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("fieldcrypt: unsupported value type %T for %s", dbValue, field.Name)
+	}
+	if _, ok := KeyId(s); ok {
+		k := defaultKeyring.Load()
+		if k == nil {
+			return ErrNoKeyring
+		}
+		plain, err := k.Decrypt(s)
+		if err != nil {
+			return err
+		}
+		s = plain
+	}
+	field.ReflectValueOf(ctx, dst).SetString(s)
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	s, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("fieldcrypt: unsupported field type %T for %s", fieldValue, field.Name)
+	}
+	k := defaultKeyring.Load()
+	if k == nil {
+		return s, nil
+	}
+	return k.Encrypt(s)
+}
@@ -0,0 +1,21 @@
+package startup
+
+import (
+	"log"
+
+	"github.com/solunara/isb/src/server"
+	"gorm.io/gorm"
+)
+
+func InitDB(data []byte) *gorm.DB {
+	err := server.InitConfig(data)
+	if err != nil {
+		log.Fatalf("[Err] init config: %v", err)
+	}
+
+	dbCli, err := server.InitDB(server.InitLogger())
+	if err != nil {
+		log.Fatalf("[Err] init db client: %v", err)
+	}
+	return dbCli
+}
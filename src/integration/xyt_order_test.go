@@ -0,0 +1,158 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/solunara/isb/src/integration/startup"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/web/xytweb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testHosId     = "it_hos_001"
+	testDeptId    = "it_dept_001"
+	testDocId     = "it_doc_001"
+	testPatientId = "it_patient_001"
+	testUserId    = "it_user_001"
+	testScheId    = "it_sche_001"
+)
+
+func prepareXytOrderData(t *testing.T, db *gorm.DB, maxPatients int) {
+	require.NoError(t, db.AutoMigrate(
+		&xytmodel.Hospital{},
+		&xytmodel.Department{},
+		&xytmodel.Doctor{},
+		&xytmodel.Patient{},
+		&xytmodel.Schedule{},
+		&xytmodel.RegisterOrder{},
+	))
+	cleanXytOrderData(t, db)
+	require.NoError(t, db.Create(&xytmodel.Hospital{UID: testHosId, FullName: "集成测试医院"}).Error)
+	require.NoError(t, db.Create(&xytmodel.Department{UID: testDeptId, HospitalID: testHosId, Name: "集成测试科室"}).Error)
+	require.NoError(t, db.Create(&xytmodel.Doctor{Id: testDocId, Name: "集成测试医生", DeptId: testDeptId, HosId: testHosId}).Error)
+	require.NoError(t, db.Create(&xytmodel.Patient{Id: testPatientId, Name: "集成测试", UserId: testUserId}).Error)
+	require.NoError(t, db.Create(&xytmodel.Schedule{
+		ScheId:      testScheId,
+		DocId:       testDocId,
+		HosID:       testHosId,
+		DeptID:      testDeptId,
+		WorkDate:    "2030-01-01",
+		TimeSlot:    "上午",
+		Amount:      10,
+		MaxPatients: maxPatients,
+	}).Error)
+}
+
+func newXytOrderService(db *gorm.DB) service.OrderService {
+	hospitalRepo := repository.NewHospitalRepository(dao.NewHospitalDAO(db))
+	scheduleRepo := repository.NewScheduleRepository(dao.NewScheduleDAO(db))
+	scheduleSvc := service.NewScheduleService(scheduleRepo, hospitalRepo)
+	pricingSvc := service.NewPricingService(repository.NewPricingRepository(dao.NewPricingDAO(db)), scheduleRepo)
+	return service.NewOrderService(repository.NewOrderRepository(dao.NewOrderDAO(db)),
+		repository.NewPatientRepository(dao.NewPatientDAO(db)), scheduleSvc, pricingSvc)
+}
+
+func cleanXytOrderData(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.Where("sche_id = ?", testScheId).Delete(&xytmodel.RegisterOrder{}).Error)
+	require.NoError(t, db.Where("sche_id = ?", testScheId).Delete(&xytmodel.Schedule{}).Error)
+	require.NoError(t, db.Where("id = ?", testPatientId).Delete(&xytmodel.Patient{}).Error)
+	require.NoError(t, db.Where("id = ?", testDocId).Delete(&xytmodel.Doctor{}).Error)
+	require.NoError(t, db.Where("uid = ?", testDeptId).Delete(&xytmodel.Department{}).Error)
+	require.NoError(t, db.Where("uid = ?", testHosId).Delete(&xytmodel.Hospital{}).Error)
+}
+
+func TestCreateOrder_Concurrent(t *testing.T) {
+	db := startup.InitDB([]byte(defaultYAML))
+	const maxPatients = 20
+	const concurrency = 300
+	prepareXytOrderData(t, db, maxPatients)
+	defer cleanXytOrderData(t, db)
+	orderSvc := newXytOrderService(db)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		success int
+		full    int
+		others  []error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := xytweb.CreateOrder(context.Background(), orderSvc, service.OrderReq{
+				UserId:    testUserId,
+				PatientId: testPatientId,
+				ScheId:    testScheId,
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				success++
+			case errors.Is(err, app.ErrScheduleFull):
+				full++
+			default:
+				others = append(others, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, others)
+	assert.Equal(t, maxPatients, success)
+	assert.Equal(t, concurrency-maxPatients, full)
+
+	var sche xytmodel.Schedule
+	require.NoError(t, db.Where("sche_id = ?", testScheId).Take(&sche).Error)
+	assert.Equal(t, maxPatients, sche.Registered)
+
+	var orders int64
+	require.NoError(t, db.Model(&xytmodel.RegisterOrder{}).Where("sche_id = ?", testScheId).Count(&orders).Error)
+	assert.Equal(t, int64(maxPatients), orders)
+}
+
+func TestCreateOrder_Idempotent(t *testing.T) {
+	db := startup.InitDB([]byte(defaultYAML))
+	prepareXytOrderData(t, db, 20)
+	defer cleanXytOrderData(t, db)
+	orderSvc := newXytOrderService(db)
+
+	const retries = 50
+	var wg sync.WaitGroup
+	orderIds := make([]string, retries)
+	errs := make([]error, retries)
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			orderIds[i], errs[i] = xytweb.CreateOrder(context.Background(), orderSvc, service.OrderReq{
+				UserId:         testUserId,
+				PatientId:      testPatientId,
+				ScheId:         testScheId,
+				IdempotencyKey: fmt.Sprintf("%s-retry", testUserId),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < retries; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, orderIds[0], orderIds[i])
+	}
+
+	var sche xytmodel.Schedule
+	require.NoError(t, db.Where("sche_id = ?", testScheId).Take(&sche).Error)
+	assert.Equal(t, 1, sche.Registered)
+}
@@ -9,6 +9,13 @@ const (
 	TableHllUser = "hll_user"
 )
 
+// 后台用户角色, 管理员可以访问挂号平台的管理后台, 审核员只能审核实名认证, 医生只能使用诊室的叫号工作站
+const (
+	RoleAdmin    = "admin"
+	RoleReviewer = "reviewer"
+	RoleDoctor   = "doctor"
+)
+
 type HllUser struct {
 	Id int64 `gorm:"primaryKey,autoIncrement" json:"id"`
 
@@ -22,6 +29,9 @@ type HllUser struct {
 	Password string `gorm:"type=varchar(256)" json:"password"`
 
 	State string `gorm:"type=varchar(12)" json:"state"`
+	Role  string `gorm:"size:16;default:''" json:"role"`
+	// 医生账号绑定的医生, 只能操作这个医生出诊的排班和订单
+	DocId string `gorm:"size:24;default:''" json:"docId"`
 
 	Reserve int `gorm:"" json:"reserve"`
 
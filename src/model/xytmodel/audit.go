@@ -0,0 +1,21 @@
+package xytmodel
+
+const TableAdminAuditLog = "admin_audit_log"
+
+// 管理后台操作审计表, 记录每一次写操作和它的结果
+type AdminAuditLog struct {
+	Id         int    `gorm:"column:id;primaryKey" json:"id"`
+	OperatorId string `gorm:"column:operator_id;not null;size:128;index" json:"operatorId"`
+	Method     string `gorm:"column:method;size:8" json:"method"`
+	Path       string `gorm:"column:path;size:128;index" json:"path"`
+	Query      string `gorm:"column:query;size:512" json:"query"`
+	ReqBody    string `gorm:"column:req_body;type:text" json:"reqBody"`
+	IP         string `gorm:"column:ip;size:64" json:"ip"`
+	Code       int    `gorm:"column:code;comment:响应的业务code" json:"code"`
+	Msg        string `gorm:"column:msg;size:128" json:"msg"`
+	CreatedAt  int64  `gorm:"index" json:"created_at"`
+}
+
+func (AdminAuditLog) TableName() string {
+	return TableAdminAuditLog
+}
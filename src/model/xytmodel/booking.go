@@ -0,0 +1,39 @@
+package xytmodel
+
+const (
+	TableBookingBan       = "booking_ban"
+	TableBookingViolation = "booking_violation"
+)
+
+// 就诊人预约封禁表, 到期自动失效, 医院工作人员也可以提前解除
+type BookingBan struct {
+	Id        int    `gorm:"column:id;primaryKey" json:"id"`
+	UserId    string `gorm:"column:user_id;not null;size:64;" json:"userId"`
+	PatientId string `gorm:"column:patient_id;not null;size:64;index" json:"patientId"`
+	Rule      string `gorm:"column:rule;not null;size:32;" json:"rule"`
+	Reason    string `gorm:"column:reason;size:128;" json:"reason"`
+	ExpiresAt int64  `gorm:"column:expires_at;not null;comment:封禁到期时间(毫秒)" json:"expiresAt"`
+	LiftedAt  int64  `gorm:"column:lifted_at;default:0;comment:提前解除的时间(毫秒)" json:"liftedAt"`
+	LiftedBy  string `gorm:"column:lifted_by;size:64;" json:"liftedBy"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (BookingBan) TableName() string {
+	return TableBookingBan
+}
+
+// 预约规则的违规记录表
+type BookingViolation struct {
+	Id        int    `gorm:"column:id;primaryKey" json:"id"`
+	UserId    string `gorm:"column:user_id;not null;size:64;index" json:"userId"`
+	PatientId string `gorm:"column:patient_id;not null;size:64;index" json:"patientId"`
+	ScheId    string `gorm:"column:sche_id;size:24;" json:"scheId"`
+	Rule      string `gorm:"column:rule;not null;size:32;" json:"rule"`
+	Reason    string `gorm:"column:reason;size:128;" json:"reason"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (BookingViolation) TableName() string {
+	return TableBookingViolation
+}
@@ -0,0 +1,34 @@
+package xytmodel
+
+const (
+	TableCertification = "certification"
+)
+
+// 实名认证状态
+const (
+	CertificationSubmitted int8 = 0 // 待审核
+	CertificationApproved  int8 = 1 // 已通过
+	CertificationRejected  int8 = 2 // 已驳回
+)
+
+// 用户的实名认证申请, 证件照片保存在对象存储中, 被驳回后可以重新提交
+type Certification struct {
+	Id           int    `gorm:"column:id;primaryKey" json:"id"`
+	UserId       string `gorm:"column:user_id;not null;size:128;index:idx_certification_user_state,priority:1" json:"userId"`
+	Name         string `gorm:"column:name;not null;size:64" json:"name"`
+	IdType       string `gorm:"column:id_type;size:24" json:"idType"`
+	IdNumber     string `gorm:"column:id_number;not null;size:128;serializer:encrypt" json:"idNumber"`
+	ImageKey     string `gorm:"column:image_key;size:256;comment:证件照片在对象存储中的key" json:"-"`
+	ImageType    string `gorm:"column:image_type;size:32" json:"-"`
+	State        int8   `gorm:"column:state;default:0;index:idx_certification_user_state,priority:2;index:idx_certification_state" json:"state"`
+	VerifyResult string `gorm:"column:verify_result;size:256;comment:实名核验服务的结果" json:"verifyResult"`
+	Reviewer     string `gorm:"column:reviewer;size:128" json:"reviewer"`
+	RejectReason string `gorm:"column:reject_reason;size:256" json:"rejectReason"`
+	ReviewedAt   int64  `gorm:"column:reviewed_at;default:0" json:"reviewedAt"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+func (Certification) TableName() string {
+	return TableCertification
+}
@@ -3,9 +3,11 @@ package xytmodel
 import "time"
 
 const (
-	TableProvince = "province"
-	TableCity     = "city"
-	TableDistrict = "district"
+	TableProvince        = "province"
+	TableCity            = "city"
+	TableDistrict        = "district"
+	TableRegionVersion   = "region_version"
+	TableRegionCodeRemap = "region_code_remap"
 )
 
 // 省表
@@ -46,6 +48,30 @@ type District struct {
 	UpdatedAt    int64  `json:"updated_at"`
 }
 
+// 行政区划数据版本表, 每次导入新版本的数据记录一行
+type RegionVersion struct {
+	Id       int    `json:"id" gorm:"column:id;primaryKey"`
+	Version  string `json:"version" gorm:"column:version;size:32;not null;uniqueIndex;comment:数据版本"`
+	Checksum string `json:"checksum" gorm:"column:checksum;size:64;comment:数据文件sha256"`
+	Added    int    `json:"added" gorm:"column:added;comment:新增的编码数"`
+	Updated  int    `json:"updated" gorm:"column:updated;comment:名称或上级变化的编码数"`
+	Retired  int    `json:"retired" gorm:"column:retired;comment:撤销的编码数"`
+	// 医院和就诊人中被替换的编码数
+	Remapped  int64  `json:"remapped" gorm:"column:remapped"`
+	Operator  string `json:"operator" gorm:"column:operator;size:64"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// 撤销的行政区划编码和代替它的编码
+type RegionCodeRemap struct {
+	Id        int    `json:"id" gorm:"column:id;primaryKey"`
+	Version   string `json:"version" gorm:"column:version;size:32;not null;index"`
+	Level     int8   `json:"level" gorm:"column:level;comment:1:省 2:市 3:区县"`
+	OldCode   string `json:"old_code" gorm:"column:old_code;size:12;not null;index"`
+	NewCode   string `json:"new_code" gorm:"column:new_code;size:12;comment:为空表示直接撤销"`
+	CreatedAt int64  `json:"created_at"`
+}
+
 func (Province) TableName() string {
 	return TableProvince
 }
@@ -57,3 +83,11 @@ func (City) TableName() string {
 func (District) TableName() string {
 	return TableDistrict
 }
+
+func (RegionVersion) TableName() string {
+	return TableRegionVersion
+}
+
+func (RegionCodeRemap) TableName() string {
+	return TableRegionCodeRemap
+}
@@ -1,6 +1,13 @@
 package xytmodel
 
-import "time"
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	// 注册就诊人敏感字段使用的 encrypt serializer
+	_ "github.com/solunara/isb/pkg/fieldcrypt"
+)
 
 const (
 	TableHospital      = "hospital"
@@ -10,8 +17,59 @@ const (
 	TableDoctor        = "doctor"
 	TablePatient       = "patient"
 	TableOrder         = "register_order"
+	TableOrderHistory  = "register_order_history"
+	TableOrderPayment  = "register_order_payment"
+)
+
+// 挂号订单状态
+const (
+	OrderStateCancelled int8 = -1 // 已取消
+	OrderStatePending   int8 = 0  // 待支付
+	OrderStatePaid      int8 = 1  // 已支付
+	OrderStateCompleted int8 = 2  // 已完成
+	OrderStateRefunding int8 = 3  // 退款中
+	OrderStateRefunded  int8 = 4  // 已退款
+	OrderStateCheckedIn int8 = 5  // 已签到, 候诊中
+	OrderStateCalling   int8 = 6  // 已叫号, 就诊中
+	OrderStateNoShow    int8 = 7  // 爽约, 超过就诊时间未签到
 )
 
+// SeqHoldingStates 占用号序的订单状态, 取消和退款后号序可以重新分配
+var SeqHoldingStates = []int8{
+	OrderStatePending,
+	OrderStatePaid,
+	OrderStateCompleted,
+	OrderStateRefunding,
+	OrderStateCheckedIn,
+	OrderStateCalling,
+	OrderStateNoShow,
+}
+
+// ActiveOrderStates 还没有就诊的订单状态
+var ActiveOrderStates = []int8{OrderStatePending, OrderStatePaid, OrderStateCheckedIn, OrderStateCalling}
+
+// 订单状态机: 允许的状态迁移
+var orderTransitions = map[int8][]int8{
+	OrderStatePending:   {OrderStatePaid, OrderStateCancelled},
+	OrderStatePaid:      {OrderStateCompleted, OrderStateRefunding, OrderStateCheckedIn, OrderStateNoShow},
+	OrderStateRefunding: {OrderStateRefunded, OrderStatePaid},
+	OrderStateCheckedIn: {OrderStateCalling},
+	// 过号的就诊人回到候诊队列
+	OrderStateCalling: {OrderStateCompleted, OrderStateCheckedIn},
+}
+
+func CanTransitOrder(from, to int8) bool {
+	for _, state := range orderTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 订单状态变更的操作人, 用户操作时为用户id
+const OrderActorSystem = "system"
+
 // 医院表
 type Hospital struct {
 	UID                 string  `json:"uid" gorm:"column:uid;primaryKey;size:64;not null;comment:医院唯一编码/卫健委登记号"`
@@ -27,7 +85,7 @@ type Hospital struct {
 	ProvinceName        string  `json:"province_name" gorm:"column:province_name;size:64;comment:省份名称"`
 	CityCode            string  `json:"city_code" gorm:"column:city_code;size:6;comment:城市编码"`
 	CityName            string  `json:"city_name" gorm:"column:city_name;size:64;comment:城市名称"`
-	DistrictCode        string  `json:"district_code" gorm:"column:district_code;size:6;comment:区县编码"`
+	DistrictCode        string  `json:"district_code" gorm:"column:district_code;size:12;comment:区县编码"`
 	DistrictName        string  `json:"district_name" gorm:"column:district_name;size:64;comment:区县名称"`
 	Address             string  `json:"address" gorm:"column:address;size:256;comment:详细地址"`
 	Telephone           string  `json:"telephone" gorm:"column:telephone;size:50;comment:联系电话"`
@@ -44,6 +102,8 @@ type Hospital struct {
 	UpdatedAt           int64   `json:"updated_at" gorm:"column:updated_at;autoUpdateTime;comment:更新时间"`
 	IsMedicalInsurance  bool    `json:"is_medical_insurance" gorm:"column:is_medical_insurance;comment:是否支持医保"`
 	IsActive            bool    `json:"is_active" gorm:"column:is_active;default:true;comment:是否启用"`
+	// 开启后只有实名认证通过的用户才能预约
+	RequireCertification bool `json:"require_certification" gorm:"column:require_certification;default:false;comment:预约是否需要实名认证"`
 }
 
 // 医院等级表
@@ -75,18 +135,34 @@ type Doctor struct {
 	DeptId    string `gorm:"column:dept_id;size:64;not null" json:"deptId"`
 	HosId     string `gorm:"column:hos_id;size:24;not null" json:"hosId"`
 	Profile   string `gorm:"column:profile;size:300" json:"profile"`
+	Specialty string `gorm:"column:specialty;size:200;comment:擅长" json:"specialty"`
 	Phone     string `gorm:"column:phone;size:15" json:"phone"`
 	Email     string `gorm:"column:email;size:100" json:"email"`
-	CreatedAt int64  `json:"created_at"`
-	UpdatedAt int64  `json:"updated_at"`
+	// 评价数和评分总和, 提交评价时累加
+	RatingCount int   `gorm:"column:rating_count;default:0" json:"ratingCount"`
+	RatingSum   int   `gorm:"column:rating_sum;default:0" json:"-"`
+	CreatedAt   int64 `json:"created_at"`
+	UpdatedAt   int64 `json:"updated_at"`
+}
+
+// Rating 平均评分, 保留一位小数, 没有评价时为 0
+func (d Doctor) Rating() float64 {
+	if d.RatingCount == 0 {
+		return 0
+	}
+	return math.Round(float64(d.RatingSum)/float64(d.RatingCount)*10) / 10
 }
 
-// 挂号类型表
+// 挂号类型表, 每个医院配置自己的挂号类型, 例如普通门诊, 专家门诊
 type RegistrationType struct {
-	Id          uint    `gorm:"primaryKey;autoIncrement;" json:"id"`
-	Name        string  `gorm:"size:50;not null" json:"name"`
-	Fee         float64 `gorm:"type:decimal(10,2);default:0.00" json:"fee"`
-	Description string  `gorm:"type:text" json:"description"`
+	Id    uint   `gorm:"primaryKey;autoIncrement;" json:"id"`
+	HosId string `gorm:"column:hos_id;size:24;index" json:"hosId"`
+	Name  string `gorm:"size:50;not null" json:"name"`
+	// 没有按医生或职称配置挂号费时使用的挂号费(元)
+	Fee int `gorm:"column:fee;not null;default:0" json:"fee"`
+	// 医保报销的金额(元), 医院支持医保并且就诊人是医保用户时从挂号费中扣除
+	InsuranceCover int    `gorm:"column:insurance_cover;default:0" json:"insuranceCover"`
+	Description    string `gorm:"type:text" json:"description"`
 }
 
 // 挂号表
@@ -107,61 +183,117 @@ type Registration struct {
 
 // 排班表
 type Schedule struct {
-	Id          int    `gorm:"column:id;primaryKey" json:"id"`
-	ScheId      string `gorm:"column:sche_id;not null;size:24;" json:"scheId"`
-	DocId       string `gorm:"column:doc_id;not null;size:24;" json:"docId"`
-	HosID       string `gorm:"column:hos_id;size:24;" json:"hosId"`
-	DeptID      string `gorm:"column:dept_id;size:64;" json:"deptId"`
-	WorkDate    string `gorm:"column:work_date;size:12;" json:"workDate"`
-	TimeSlot    string `gorm:"column:time_slot;type:enum('上午','下午','晚上');not null" json:"timeSlot"`
-	Amount      int    `gorm:"column:amount;not null" json:"amount"`
-	WorkWeek    int    `gorm:"column:work_week;not null" json:"workWeek"`
-	MaxPatients int    `gorm:"column:max_patients;default:20" json:"maxPatients"`
-	Registered  int    `gorm:"column:registered;default:0" json:"registered"`
-}
-
-// 就诊人表
+	Id           int    `gorm:"column:id;primaryKey" json:"id"`
+	ScheId       string `gorm:"column:sche_id;not null;size:24;" json:"scheId"`
+	DocId        string `gorm:"column:doc_id;not null;size:24;" json:"docId"`
+	HosID        string `gorm:"column:hos_id;size:24;" json:"hosId"`
+	DeptID       string `gorm:"column:dept_id;size:64;" json:"deptId"`
+	WorkDate     string `gorm:"column:work_date;size:12;index:idx_sche_template_date,priority:2" json:"workDate"`
+	TimeSlot     string `gorm:"column:time_slot;type:enum('上午','下午','晚上');not null" json:"timeSlot"`
+	Amount       int    `gorm:"column:amount;not null" json:"amount"`
+	WorkWeek     int    `gorm:"column:work_week;not null" json:"workWeek"`
+	MaxPatients  int    `gorm:"column:max_patients;default:20" json:"maxPatients"`
+	Registered   int    `gorm:"column:registered;default:0" json:"registered"`
+	TemplateId   int    `gorm:"column:template_id;index:idx_sche_template_date,priority:1;comment:生成该排班的出诊模板" json:"templateId"`
+	RegTypeId    uint   `gorm:"column:reg_type_id;comment:挂号类型" json:"regTypeId"`
+	Status       int8   `gorm:"column:status;default:0;comment:0:正常 1:停诊" json:"status"`
+	OrigDocId    string `gorm:"column:orig_doc_id;size:24;comment:替诊前的医生" json:"origDocId"`
+	SlotMinutes  int    `gorm:"column:slot_minutes;default:10;comment:每个号段的分钟数" json:"slotMinutes"`
+	SlotPatients int    `gorm:"column:slot_patients;default:1;comment:每个号段的号数" json:"slotPatients"`
+}
+
+// 就诊人表, 实名号, 手机号和地址加密保存
 type Patient struct {
-	Id                       string    `gorm:"column:id;primaryKey;size:64;common:就诊人唯一id" json:"id"`
-	Name                     string    `gorm:"column:name;not null;size:64;common:就诊人姓名" json:"name"`
-	UserId                   string    `gorm:"column:user_id;not null;size:64;common:就诊人所属用户id" json:"userId"`
-	ProvinceCode             string    `gorm:"column:province_code;not null;size:6;common:所在省份编码" json:"provinceCode"`
-	CityCode                 string    `gorm:"column:city_code;not null;size:6;common:所在市编码" json:"cityCode"`
-	DistrictCode             string    `gorm:"column:district_code;not null;size:6;common:所在区县编码" json:"districtCode"`
-	CertificatesNo           string    `gorm:"column:certificates_no;not null;size:24;common:实名号" json:"certificatesNo"`
-	Address                  string    `gorm:"column:address;not null;size:128;common:详细地址" json:"address"`
-	ContactsName             string    `gorm:"column:contacts_name;size:64;common:联系人姓名" json:"contactsName"`
-	ContactsCertificatesNo   string    `gorm:"column:contacts_certificates_no;size:24;common:联系人实名号" json:"contactsCertificatesNo"`
-	ContactsPhone            string    `gorm:"column:contacts_phone;size:16;common:联系人手机号" json:"contactsPhone"`
-	Birthday                 string    `gorm:"column:birthday;size:20;" json:"birthday"`
-	Phone                    string    `gorm:"column:phone;not null;size:16;" json:"phone"`
-	CertificatesType         uint8     `gorm:"column:certificates_type;not null;common:实名认证类型" json:"certificatesType"`            // 0: 身份证 1:户口本
-	ContactsCertificatesType uint8     `gorm:"column:contacts_certificates_type;common:联系人实名认证类型" json:"contactsCertificatesType"` // 0: 身份证 1:户口本
-	Sex                      uint8     `gorm:"column:sex;not null;common:性别" json:"sex"`                                           // 0:女性 1: 男性
-	IsMarry                  uint8     `gorm:"column:is_marry;common:是否已婚" json:"isMarry"`                                         // 0: 未婚 1:已婚
-	IsInsure                 uint8     `gorm:"column:is_insure;common:是否是医保用户" json:"isInsure"`                                    // 0: 医保 1:自费
-	CreatedAt                time.Time `json:"created_at"`
-	UpdatedAt                time.Time `json:"updated_at"`
+	Id                       string         `gorm:"column:id;primaryKey;size:64;common:就诊人唯一id" json:"id"`
+	Name                     string         `gorm:"column:name;not null;size:64;common:就诊人姓名" json:"name"`
+	UserId                   string         `gorm:"column:user_id;not null;size:64;common:就诊人所属用户id" json:"userId"`
+	ProvinceCode             string         `gorm:"column:province_code;not null;size:6;common:所在省份编码" json:"provinceCode"`
+	CityCode                 string         `gorm:"column:city_code;not null;size:6;common:所在市编码" json:"cityCode"`
+	DistrictCode             string         `gorm:"column:district_code;not null;size:12;common:所在区县编码" json:"districtCode"`
+	CertificatesNo           string         `gorm:"column:certificates_no;not null;size:128;serializer:encrypt;common:实名号" json:"certificatesNo"`
+	CertificatesHash         sql.NullString `gorm:"column:certificates_hash;size:64;uniqueIndex" json:"-"` // 实名号的 HMAC, 同一个实名号只能绑定到一个账号
+	Address                  string         `gorm:"column:address;not null;size:1024;serializer:encrypt;common:详细地址" json:"address"`
+	ContactsName             string         `gorm:"column:contacts_name;size:64;common:联系人姓名" json:"contactsName"`
+	ContactsCertificatesNo   string         `gorm:"column:contacts_certificates_no;size:128;serializer:encrypt;common:联系人实名号" json:"contactsCertificatesNo"`
+	ContactsPhone            string         `gorm:"column:contacts_phone;size:128;serializer:encrypt;common:联系人手机号" json:"contactsPhone"`
+	Birthday                 string         `gorm:"column:birthday;size:20;" json:"birthday"`
+	Phone                    string         `gorm:"column:phone;not null;size:128;serializer:encrypt;" json:"phone"`
+	CertificatesType         uint8          `gorm:"column:certificates_type;not null;common:实名认证类型" json:"certificatesType"`            // 0: 身份证 1:户口本
+	ContactsCertificatesType uint8          `gorm:"column:contacts_certificates_type;common:联系人实名认证类型" json:"contactsCertificatesType"` // 0: 身份证 1:户口本
+	Sex                      uint8          `gorm:"column:sex;not null;common:性别" json:"sex"`                                           // 0:女性 1: 男性
+	IsMarry                  uint8          `gorm:"column:is_marry;common:是否已婚" json:"isMarry"`                                         // 0: 未婚 1:已婚
+	IsInsure                 uint8          `gorm:"column:is_insure;common:是否是医保用户" json:"isInsure"`                                    // 0: 医保 1:自费
+	Relation                 uint8          `gorm:"column:relation;default:0;common:与账号持有人的关系" json:"relation"`                         // 1: 本人 2: 配偶 3: 子女 4: 父母
+	IsDefault                bool           `gorm:"column:is_default;default:false;common:是否是默认就诊人" json:"isDefault"`
+	CreatedAt                time.Time      `json:"created_at"`
+	UpdatedAt                time.Time      `json:"updated_at"`
 }
 
+// 就诊人与账号持有人的关系, 0 是添加关系之前的就诊人, 没有填写
+const (
+	PatientRelationSelf   uint8 = 1 // 本人
+	PatientRelationSpouse uint8 = 2 // 配偶
+	PatientRelationChild  uint8 = 3 // 子女
+	PatientRelationParent uint8 = 4 // 父母
+)
+
 // 挂号订单表
 type RegisterOrder struct {
+	Id           int    `gorm:"column:id;primaryKey" json:"id"`
+	UserId       string `gorm:"column:user_id;not null;size:64;uniqueIndex:idx_order_idempotency,priority:1" json:"userId"`
+	OrderId      string `gorm:"column:order_id;not null;size:64;unique;" json:"orderId"`
+	ScheId       string `gorm:"column:sche_id;not null;size:24;" json:"scheId"`
+	PatientId    string `gorm:"column:patient_id;not null;size:64;" json:"patientId"`
+	HosID        string `gorm:"column:hos_id;size:24;" json:"hosId"`
+	DeptID       string `gorm:"column:dept_id;size:64;" json:"deptId"`
+	DocId        string `gorm:"column:doc_id;not null;size:24;" json:"docId"`
+	HosName      string `gorm:"column:hos_name;size:128;not null;" json:"hosName"`
+	DeptName     string `gorm:"column:dept_name;size:32;not null;" json:"deptName"`
+	DocName      string `gorm:"column:doc_name;size:24;not null;" json:"docName"`
+	PatientName  string `gorm:"column:patient_name;size:24;not null;" json:"patientName"`
+	VisitTime    string `gorm:"column:visit_time;not null;size:24;" json:"visitTime"`
+	Amount       int    `gorm:"column:amount;not null;comment:自付金额(元)" json:"amount"`
+	State        int8   `gorm:"column:state;" json:"state"` // -1: 已取消  0: 待支付  1:已支付  2:已完成  3:退款中  4:已退款  5:已签到  6:就诊中  7:爽约
+	RegisterTime string `gorm:"column:register_time;not null;size:24;" json:"registerTime"`
+	// 客户端提供的幂等键, 同一用户重复提交相同的键只会生成一个订单
+	IdempotencyKey sql.NullString `gorm:"column:idempotency_key;size:64;uniqueIndex:idx_order_idempotency,priority:2" json:"-"`
+	// 候补递补的订单需要在这个时间(毫秒)前支付, 0 表示使用默认的支付时限
+	ConfirmDeadline int64 `gorm:"column:confirm_deadline;default:0" json:"confirmDeadline"`
+	// 号序和预计就诊时间段, 例如 3 和 "2024-06-18 08:20-08:30"
+	SeqNo       int    `gorm:"column:seq_no;default:0" json:"seqNo"`
+	VisitPeriod string `gorm:"column:visit_period;size:32" json:"visitPeriod"`
+	// 签到时间(毫秒)和过号次数, 候诊队列先按过号次数再按号序排队
+	CheckinAt int64 `gorm:"column:checkin_at;default:0" json:"checkinAt"`
+	SkipCount int   `gorm:"column:skip_count;default:0" json:"skipCount"`
+	// 下单时的挂号费明细, 之后修改挂号费不影响已有的订单
+	Price     OrderPrice `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// 挂号订单状态变更记录表
+type OrderHistory struct {
+	Id        int       `gorm:"column:id;primaryKey" json:"id"`
+	OrderId   string    `gorm:"column:order_id;not null;size:64;index" json:"orderId"`
+	FromState int8      `gorm:"column:from_state;not null" json:"fromState"`
+	ToState   int8      `gorm:"column:to_state;not null" json:"toState"`
+	Actor     string    `gorm:"column:actor;not null;size:64;comment:操作人, 用户id或system" json:"actor"`
+	Reason    string    `gorm:"column:reason;size:128" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 挂号订单支付单表
+type OrderPayment struct {
 	Id           int       `gorm:"column:id;primaryKey" json:"id"`
-	UserId       string    `gorm:"column:user_id;not null;size:64;" json:"userId"`
-	OrderId      string    `gorm:"column:order_id;not null;size:64;unique;" json:"orderId"`
-	ScheId       string    `gorm:"column:sche_id;not null;size:24;" json:"scheId"`
-	PatientId    string    `gorm:"column:patient_id;not null;size:64;" json:"patientId"`
-	HosID        string    `gorm:"column:hos_id;size:24;" json:"hosId"`
-	DeptID       string    `gorm:"column:dept_id;size:64;" json:"deptId"`
-	DocId        string    `gorm:"column:doc_id;not null;size:24;" json:"docId"`
-	HosName      string    `gorm:"column:hos_name;size:128;not null;" json:"hosName"`
-	DeptName     string    `gorm:"column:dept_name;size:32;not null;" json:"deptName"`
-	DocName      string    `gorm:"column:doc_name;size:24;not null;" json:"docName"`
-	PatientName  string    `gorm:"column:patient_name;size:24;not null;" json:"patientName"`
-	VisitTime    string    `gorm:"column:visit_time;not null;size:24;" json:"visitTime"`
-	Amount       int       `gorm:"column:amount;not null" json:"amount"`
-	State        int8      `gorm:"column:state;" json:"state"` // -1: 已取消  0: 待支付  1:已支付  2:已完成
-	RegisterTime string    `gorm:"column:register_time;not null;size:24;" json:"registerTime"`
+	OrderId      string    `gorm:"column:order_id;not null;size:64;unique" json:"orderId"`
+	Provider     string    `gorm:"column:provider;not null;size:32;comment:支付渠道" json:"provider"`
+	TradeNo      string    `gorm:"column:trade_no;size:64;comment:渠道支付单号" json:"tradeNo"`
+	Amount       int64     `gorm:"column:amount;not null;comment:支付金额(分)" json:"amount"`
+	Status       string    `gorm:"column:status;not null;size:16" json:"status"`
+	PaidAt       int64     `gorm:"column:paid_at;comment:支付完成时间(毫秒)" json:"paidAt"`
+	RefundNo     string    `gorm:"column:refund_no;size:64;comment:渠道退款单号" json:"refundNo"`
+	RefundAmount int64     `gorm:"column:refund_amount;comment:退款金额(分)" json:"refundAmount"`
+	RefundedAt   int64     `gorm:"column:refunded_at;comment:退款完成时间(毫秒)" json:"refundedAt"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -193,3 +325,11 @@ func (Patient) TableName() string {
 func (RegisterOrder) TableName() string {
 	return TableOrder
 }
+
+func (OrderHistory) TableName() string {
+	return TableOrderHistory
+}
+
+func (OrderPayment) TableName() string {
+	return TableOrderPayment
+}
@@ -0,0 +1,58 @@
+package xytmodel
+
+const (
+	TableMedicalRecord           = "medical_record"
+	TableMedicalRecordAttachment = "medical_record_attachment"
+)
+
+// 处方中的一种药品
+type Prescription struct {
+	Drug     string `json:"drug"`
+	Spec     string `json:"spec"`  // 规格, 例如 0.25g*24粒
+	Usage    string `json:"usage"` // 用法用量, 例如 口服 一次2粒 一日3次
+	Quantity int    `json:"quantity"`
+	Unit     string `json:"unit"`
+}
+
+// 就诊记录, 每个挂号订单就诊后由医生填写一份, 可以修改
+type MedicalRecord struct {
+	Id          int    `gorm:"column:id;primaryKey" json:"id"`
+	OrderId     string `gorm:"column:order_id;not null;size:64;unique" json:"orderId"`
+	UserId      string `gorm:"column:user_id;not null;size:64;index" json:"userId"`
+	PatientId   string `gorm:"column:patient_id;not null;size:64;index" json:"patientId"`
+	PatientName string `gorm:"column:patient_name;size:20" json:"patientName"`
+	HosName     string `gorm:"column:hos_name;size:64" json:"hosName"`
+	DeptName    string `gorm:"column:dept_name;size:64" json:"deptName"`
+	DocId       string `gorm:"column:doc_id;not null;size:24;index" json:"docId"`
+	DocName     string `gorm:"column:doc_name;size:20" json:"docName"`
+	VisitTime   string `gorm:"column:visit_time;size:64" json:"visitTime"`
+	// 诊断, 加密保存
+	Diagnosis     string         `gorm:"column:diagnosis;not null;type:text;serializer:encrypt" json:"diagnosis"`
+	Prescriptions []Prescription `gorm:"column:prescriptions;type:text;serializer:json" json:"prescriptions"`
+	Advice        string         `gorm:"column:advice;size:1024;comment:医嘱" json:"advice"`
+	// 最后填写的医生账号
+	Author      string                    `gorm:"column:author;size:128" json:"-"`
+	Attachments []MedicalRecordAttachment `gorm:"-" json:"attachments"`
+	CreatedAt   int64                     `json:"created_at"`
+	UpdatedAt   int64                     `json:"updated_at"`
+}
+
+func (MedicalRecord) TableName() string {
+	return TableMedicalRecord
+}
+
+// 就诊记录的附件, 例如检查报告, 文件保存在对象存储中
+type MedicalRecordAttachment struct {
+	Id          int    `gorm:"column:id;primaryKey" json:"id"`
+	RecordId    int    `gorm:"column:record_id;not null;index" json:"recordId"`
+	Name        string `gorm:"column:name;size:128" json:"name"`
+	ObjectKey   string `gorm:"column:object_key;not null;size:256;comment:附件在对象存储中的key" json:"-"`
+	ContentType string `gorm:"column:content_type;size:64" json:"contentType"`
+	Size        int    `gorm:"column:size" json:"size"`
+	CreatedBy   string `gorm:"column:created_by;size:128" json:"-"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+func (MedicalRecordAttachment) TableName() string {
+	return TableMedicalRecordAttachment
+}
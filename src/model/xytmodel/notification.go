@@ -0,0 +1,67 @@
+package xytmodel
+
+const (
+	TableNotification           = "notification"
+	TableNotificationPreference = "notification_preference"
+)
+
+// 通知类型
+const (
+	NotifyOrderCreated   = "order_created"
+	NotifyOrderPaid      = "order_paid"
+	NotifyOrderCancelled = "order_cancelled"
+	NotifyOrderRefunded  = "order_refunded"
+	NotifyRemindEve      = "remind_eve"  // 就诊前一天晚上提醒
+	NotifyRemindSoon     = "remind_soon" // 就诊前几个小时提醒
+)
+
+// 短信发送状态
+const (
+	NotifySmsPending int8 = 0 // 等待发送
+	NotifySmsSending int8 = 1 // 发送中
+	NotifySmsSent    int8 = 2 // 已发送
+	NotifySmsSkipped int8 = 3 // 用户关闭了短信, 或者提醒已经过期
+	NotifySmsFailed  int8 = 4 // 重试多次仍然失败
+)
+
+// 站内通知表, 每条通知同时按用户的设置发送短信
+type Notification struct {
+	Id      int    `gorm:"column:id;primaryKey" json:"id"`
+	UserId  string `gorm:"column:user_id;not null;size:64;index:idx_notification_user,priority:1" json:"userId"`
+	OrderId string `gorm:"column:order_id;size:64" json:"orderId"`
+	Kind    string `gorm:"column:kind;not null;size:32" json:"kind"`
+	Title   string `gorm:"column:title;not null;size:64" json:"title"`
+	Content string `gorm:"column:content;size:256" json:"content"`
+	// 同一订单的同一类通知只有一条, 重复生成时忽略
+	DedupKey string `gorm:"column:dedup_key;not null;size:128;unique" json:"-"`
+	// 通知时间(毫秒), 到了这个时间才出现在站内信里
+	NotifyAt int64 `gorm:"column:notify_at;not null;index:idx_notification_user,priority:2" json:"notifyAt"`
+	// 过期时间(毫秒), 过期后不再发送短信, 0 表示不过期
+	ExpiresAt int64 `gorm:"column:expires_at;default:0" json:"-"`
+	SmsState  int8  `gorm:"column:sms_state;default:0;index:idx_notification_sms,priority:1" json:"-"`
+	// 下一次发送短信的时间(毫秒), 免打扰时段和发送失败时推迟
+	SmsAt       int64 `gorm:"column:sms_at;not null;index:idx_notification_sms,priority:2" json:"-"`
+	SmsAttempts int   `gorm:"column:sms_attempts;default:0" json:"-"`
+	ReadAt      int64 `gorm:"column:read_at;default:0" json:"readAt"`
+	CreatedAt   int64 `json:"created_at"`
+	UpdatedAt   int64 `json:"updated_at"`
+}
+
+func (Notification) TableName() string {
+	return TableNotification
+}
+
+// 用户的通知设置, 没有设置时使用默认值
+type NotificationPreference struct {
+	UserId      string `gorm:"column:user_id;primaryKey;size:64" json:"-"`
+	SmsReminder bool   `gorm:"column:sms_reminder;not null" json:"smsReminder"` // 就诊提醒是否发送短信
+	SmsOrder    bool   `gorm:"column:sms_order;not null" json:"smsOrder"`       // 订单状态变化是否发送短信
+	// 免打扰时段, 例如 22:00 到 08:00, 期间的短信推迟到结束后发送, 都为空表示不设置
+	QuietStart string `gorm:"column:quiet_start;size:5" json:"quietStart"`
+	QuietEnd   string `gorm:"column:quiet_end;size:5" json:"quietEnd"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+func (NotificationPreference) TableName() string {
+	return TableNotificationPreference
+}
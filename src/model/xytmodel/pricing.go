@@ -0,0 +1,46 @@
+package xytmodel
+
+const (
+	TableRegistrationType = "registration_types"
+	TableRegistrationFee  = "registration_fee"
+)
+
+// 就诊人的医保类型, 对应 Patient.IsInsure
+const (
+	PatientInsured uint8 = 0 // 医保
+	PatientSelfPay uint8 = 1 // 自费
+)
+
+// 挂号费的来源
+const (
+	PriceSourceDoctor   = "doctor"   // 按医生配置的挂号费
+	PriceSourceRank     = "rank"     // 按职称配置的挂号费
+	PriceSourceType     = "type"     // 挂号类型的默认挂号费
+	PriceSourceSchedule = "schedule" // 排班没有挂号类型, 使用排班的挂号费
+)
+
+// 挂号类型下按医生或职称配置的挂号费, DocId 不为空时只对这个医生生效, 优先于职称
+type RegistrationFee struct {
+	Id        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	HosId     string `gorm:"column:hos_id;not null;size:24;index" json:"hosId"`
+	RegTypeId uint   `gorm:"column:reg_type_id;not null;uniqueIndex:idx_reg_fee,priority:1" json:"regTypeId"`
+	Rank      string `gorm:"column:rank;size:50;uniqueIndex:idx_reg_fee,priority:2" json:"rank"`
+	DocId     string `gorm:"column:doc_id;size:24;uniqueIndex:idx_reg_fee,priority:3" json:"docId"`
+	Fee       int    `gorm:"column:fee;not null;comment:挂号费(元)" json:"fee"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (RegistrationFee) TableName() string {
+	return TableRegistrationFee
+}
+
+// 挂号费明细(元), 自付金额 = 挂号费 - 医保报销
+type OrderPrice struct {
+	RegTypeId   uint   `gorm:"column:reg_type_id;default:0" json:"regTypeId"`
+	RegTypeName string `gorm:"column:reg_type_name;size:50" json:"regTypeName"`
+	Source      string `gorm:"column:source;size:16" json:"source"`
+	Total       int    `gorm:"column:total;default:0" json:"total"`
+	Insurance   int    `gorm:"column:insurance;default:0" json:"insurance"`
+	Payable     int    `gorm:"column:payable;default:0" json:"payable"`
+}
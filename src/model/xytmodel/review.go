@@ -0,0 +1,21 @@
+package xytmodel
+
+const TableDoctorReview = "doctor_review"
+
+// 医生评价表, 每个已完成的订单只能评价一次
+type DoctorReview struct {
+	Id        int    `gorm:"column:id;primaryKey" json:"id"`
+	OrderId   string `gorm:"column:order_id;not null;size:64;unique" json:"orderId"`
+	DocId     string `gorm:"column:doc_id;not null;size:24;index" json:"docId"`
+	UserId    string `gorm:"column:user_id;not null;size:64;" json:"-"`
+	PatientId string `gorm:"column:patient_id;not null;size:64;" json:"-"`
+	// 就诊人姓名脱敏后保存, 例如 张*
+	PatientName string `gorm:"column:patient_name;size:24;" json:"patientName"`
+	Rating      int8   `gorm:"column:rating;not null;comment:1-5 分" json:"rating"`
+	Content     string `gorm:"column:content;size:500" json:"content"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+func (DoctorReview) TableName() string {
+	return TableDoctorReview
+}
@@ -0,0 +1,33 @@
+package xytmodel
+
+const (
+	TableRosterTemplate = "roster_template"
+)
+
+// 排班状态
+const (
+	ScheduleStatusNormal    int8 = 0 // 正常出诊
+	ScheduleStatusSuspended int8 = 1 // 停诊
+)
+
+// 医生每周出诊模板表, 排班按模板提前生成
+type RosterTemplate struct {
+	Id           int    `gorm:"column:id;primaryKey" json:"id"`
+	HosID        string `gorm:"column:hos_id;not null;size:24;index" json:"hosId"`
+	DeptID       string `gorm:"column:dept_id;not null;size:64;" json:"deptId"`
+	DocId        string `gorm:"column:doc_id;not null;size:24;uniqueIndex:idx_roster_doc_slot,priority:1" json:"docId"`
+	Weekday      int    `gorm:"column:weekday;not null;uniqueIndex:idx_roster_doc_slot,priority:2;comment:0:周日 1:周一 ..." json:"weekday"`
+	TimeSlot     string `gorm:"column:time_slot;type:enum('上午','下午','晚上');not null;uniqueIndex:idx_roster_doc_slot,priority:3" json:"timeSlot"`
+	MaxPatients  int    `gorm:"column:max_patients;not null" json:"maxPatients"`
+	Amount       int    `gorm:"column:amount;not null;comment:挂号费" json:"amount"`
+	RegTypeId    uint   `gorm:"column:reg_type_id;comment:挂号类型" json:"regTypeId"`
+	SlotMinutes  int    `gorm:"column:slot_minutes;default:10;comment:每个号段的分钟数" json:"slotMinutes"`
+	SlotPatients int    `gorm:"column:slot_patients;default:1;comment:每个号段的号数" json:"slotPatients"`
+	Enabled      bool   `gorm:"column:enabled;default:true" json:"enabled"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+func (RosterTemplate) TableName() string {
+	return TableRosterTemplate
+}
@@ -22,14 +22,12 @@ type XytUser struct {
 	Name    string `gorm:"type=varchar(128)" json:"name"`
 	Profile string `gorm:"type=varchar(4096)" json:"profile"`
 
-	//
+	// 实名认证通过后写入, 证件照片保存在 certification 表对应的对象存储中
 	IdTyper  string `gorm:"type=varchar(24)" json:"idType"`
-	IdNumber string `gorm:"type=varchar(24)" json:"idNumber"`
+	IdNumber string `gorm:"size:128;serializer:encrypt" json:"idNumber"`
 
 	Birthday string `gorm:"type=varchar(24)" json:"birthday"`
 
-	Image []byte `json:"image"`
-
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,30 @@
+package xytmodel
+
+const (
+	TableWaitlist = "schedule_waitlist"
+)
+
+// 候补状态
+const (
+	WaitlistStateWaiting  int8 = 0 // 候补中
+	WaitlistStatePromoted int8 = 1 // 已递补为订单
+	WaitlistStateLeft     int8 = 2 // 用户退出候补
+	WaitlistStateInvalid  int8 = 3 // 排班停诊或就诊人失效
+)
+
+// 约满排班的候补队列表, 按 id 先后递补
+type WaitlistEntry struct {
+	Id         int    `gorm:"column:id;primaryKey" json:"id"`
+	ScheId     string `gorm:"column:sche_id;not null;size:24;index:idx_waitlist_sche_state,priority:1" json:"scheId"`
+	UserId     string `gorm:"column:user_id;not null;size:64;index:idx_waitlist_user_state,priority:1" json:"userId"`
+	PatientId  string `gorm:"column:patient_id;not null;size:64;" json:"patientId"`
+	State      int8   `gorm:"column:state;default:0;index:idx_waitlist_sche_state,priority:2;index:idx_waitlist_user_state,priority:2" json:"state"`
+	OrderId    string `gorm:"column:order_id;size:64;comment:递补生成的订单" json:"orderId"`
+	PromotedAt int64  `gorm:"column:promoted_at" json:"promotedAt"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+func (WaitlistEntry) TableName() string {
+	return TableWaitlist
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/solunara/isb/src/model/xytmodel"
+)
+
+// DepartmentCache 缓存每个医院的全部科室, 科室层级变化时删除
+type DepartmentCache interface {
+	Get(ctx context.Context, hosId string) ([]xytmodel.Department, error)
+	Set(ctx context.Context, hosId string, depts []xytmodel.Department, expiration time.Duration) error
+	Delete(ctx context.Context, hosId string) error
+}
+
+type RedisDepartmentCache struct {
+	cmd redis.Cmdable
+}
+
+func NewDepartmentCache(cmd redis.Cmdable) DepartmentCache {
+	return &RedisDepartmentCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisDepartmentCache) Get(ctx context.Context, hosId string) ([]xytmodel.Department, error) {
+	data, err := c.cmd.Get(ctx, c.key(hosId)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var depts []xytmodel.Department
+	err = json.Unmarshal(data, &depts)
+	return depts, err
+}
+
+func (c *RedisDepartmentCache) Set(ctx context.Context, hosId string, depts []xytmodel.Department, expiration time.Duration) error {
+	data, err := json.Marshal(depts)
+	if err != nil {
+		return err
+	}
+	return c.cmd.Set(ctx, c.key(hosId), data, expiration).Err()
+}
+
+func (c *RedisDepartmentCache) Delete(ctx context.Context, hosId string) error {
+	return c.cmd.Del(ctx, c.key(hosId)).Err()
+}
+
+func (c *RedisDepartmentCache) key(hosId string) string {
+	return fmt.Sprintf("hospital_department:%s", hosId)
+}
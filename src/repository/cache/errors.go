@@ -17,5 +17,9 @@ var (
 
 	ErrUnknownCode = errors.New("unknown for code")
 
+	ErrInventorySoldOut = errors.New("inventory sold out")
+
+	ErrInventoryNotLoaded = errors.New("inventory not loaded")
+
 	ErrKeyNotExist = redis.Nil
 )
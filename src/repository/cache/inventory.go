@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed lua/deductInventory.lua
+var luaDeductInventory string
+
+//go:embed lua/releaseInventory.lua
+var luaReleaseInventory string
+
+//go:embed lua/reconcileInventory.lua
+var luaReconcileInventory string
+
+const (
+	// 等待落库的订单队列和消费组
+	bookingStream = "order_booking"
+	bookingGroup  = "order_booking_persister"
+	// 落库队列为空时读取阻塞的时间
+	bookingReadBlock = time.Second
+	// 订单落库状态的保留时间, 落库后查询订单直接查数据库
+	bookingStatusExpiration = 24 * time.Hour
+)
+
+// Booking 预扣号源时一起写入落库队列的订单
+type Booking struct {
+	ScheId  string
+	UserId  string
+	OrderId string
+	// Order 序列化后的订单
+	Order []byte
+}
+
+// QueuedBooking 从落库队列中读取的订单
+type QueuedBooking struct {
+	// Id 订单在落库队列中的消息 id, 确认时使用
+	Id    string
+	Order []byte
+}
+
+// InventoryCache 排班号源在 redis 中的预扣库存
+type InventoryCache interface {
+	// Load 加载排班剩余号源, 已经加载过的不会被覆盖
+	Load(ctx context.Context, scheId string, remain int, expiration time.Duration) error
+	// Deduct 为订单预扣一个号源, 预扣成功的订单同时写入落库队列
+	Deduct(ctx context.Context, booking Booking) error
+	// Confirm 订单 orderId 预扣的号源已经落库
+	Confirm(ctx context.Context, scheId, orderId string) error
+	// Release 归还一个号源, orderId 不为空时表示归还的是该订单尚未落库的预扣
+	Release(ctx context.Context, scheId, orderId string) error
+	// Reconcile 以数据库剩余号源为准修正 redis, 早于 staleBefore 还没有落库的预扣视为已经丢失,
+	// 返回是否发生了修正
+	Reconcile(ctx context.Context, scheId string, remain int, staleBefore time.Time) (bool, error)
+	// ReadBookings 读取落库队列中的订单, 已经被读取但超过 minIdle 没有确认的订单会被重新读取
+	ReadBookings(ctx context.Context, consumer string, count int64, minIdle time.Duration) ([]QueuedBooking, error)
+	// AckBooking 订单已经落库或者确定不能落库, 从落库队列中删除
+	AckBooking(ctx context.Context, id string) error
+	// FailBooking 记录订单不能落库的原因
+	FailBooking(ctx context.Context, userId, orderId, reason string) error
+	// BookingStatus 查询还没有落库的订单, 在落库队列中的返回空字符串, 不能落库的返回原因,
+	// 都不是时返回 ErrKeyNotExist
+	BookingStatus(ctx context.Context, userId, orderId string) (string, error)
+	// BindIdempotencyKey 绑定幂等键和订单号, 已经绑定过的返回之前的订单号
+	BindIdempotencyKey(ctx context.Context, userId, key, orderId string, expiration time.Duration) (string, error)
+	UnbindIdempotencyKey(ctx context.Context, userId, key string) error
+}
+
+type RedisInventoryCache struct {
+	cmd redis.Cmdable
+}
+
+func NewInventoryCache(cmd redis.Cmdable) InventoryCache {
+	return &RedisInventoryCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisInventoryCache) Load(ctx context.Context, scheId string, remain int, expiration time.Duration) error {
+	if remain < 0 {
+		remain = 0
+	}
+	return c.cmd.SetNX(ctx, c.key(scheId), remain, expiration).Err()
+}
+
+func (c *RedisInventoryCache) Deduct(ctx context.Context, booking Booking) error {
+	res, err := c.cmd.Eval(ctx, luaDeductInventory,
+		[]string{c.key(booking.ScheId), bookingStream, c.bookingKey(booking.UserId, booking.OrderId)},
+		booking.OrderId, time.Now().UnixMilli(), booking.Order, int64(bookingStatusExpiration/time.Second)).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return nil
+	case -1:
+		return ErrInventorySoldOut
+	case -2:
+		return ErrInventoryNotLoaded
+	default:
+		return ErrSystemError
+	}
+}
+
+func (c *RedisInventoryCache) Confirm(ctx context.Context, scheId, orderId string) error {
+	return c.cmd.Eval(ctx, luaReleaseInventory, []string{c.key(scheId)}, orderId, "0").Err()
+}
+
+func (c *RedisInventoryCache) Release(ctx context.Context, scheId, orderId string) error {
+	return c.cmd.Eval(ctx, luaReleaseInventory, []string{c.key(scheId)}, orderId, "1").Err()
+}
+
+func (c *RedisInventoryCache) Reconcile(ctx context.Context, scheId string, remain int, staleBefore time.Time) (bool, error) {
+	res, err := c.cmd.Eval(ctx, luaReconcileInventory, []string{c.key(scheId)}, remain, staleBefore.UnixMilli()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (c *RedisInventoryCache) ReadBookings(ctx context.Context, consumer string, count int64, minIdle time.Duration) ([]QueuedBooking, error) {
+	bookings, err := c.readBookings(ctx, consumer, count, minIdle)
+	if err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		return bookings, err
+	}
+	// 第一次读取时创建消费组, 多个实例同时创建时只有一个能成功
+	err = c.cmd.XGroupCreateMkStream(ctx, bookingStream, bookingGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+	return c.readBookings(ctx, consumer, count, minIdle)
+}
+
+func (c *RedisInventoryCache) readBookings(ctx context.Context, consumer string, count int64, minIdle time.Duration) ([]QueuedBooking, error) {
+	// 先领取超时没有确认的订单, 落库失败等待重试的和消费者崩溃时没有处理完的订单都在这里
+	msgs, _, err := c.cmd.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   bookingStream,
+		Group:    bookingGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		var streams []redis.XStream
+		streams, err = c.cmd.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    bookingGroup,
+			Consumer: consumer,
+			Streams:  []string{bookingStream, ">"},
+			Count:    count,
+			Block:    bookingReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, stream := range streams {
+			msgs = append(msgs, stream.Messages...)
+		}
+	}
+	var bookings = make([]QueuedBooking, 0, len(msgs))
+	for _, msg := range msgs {
+		order, _ := msg.Values["order"].(string)
+		bookings = append(bookings, QueuedBooking{Id: msg.ID, Order: []byte(order)})
+	}
+	return bookings, nil
+}
+
+func (c *RedisInventoryCache) AckBooking(ctx context.Context, id string) error {
+	err := c.cmd.XAck(ctx, bookingStream, bookingGroup, id).Err()
+	if err != nil {
+		return err
+	}
+	// 删除只是为了控制队列长度, 确认过的订单不会再被读取
+	return c.cmd.XDel(ctx, bookingStream, id).Err()
+}
+
+func (c *RedisInventoryCache) FailBooking(ctx context.Context, userId, orderId, reason string) error {
+	return c.cmd.Set(ctx, c.bookingKey(userId, orderId), reason, bookingStatusExpiration).Err()
+}
+
+func (c *RedisInventoryCache) BookingStatus(ctx context.Context, userId, orderId string) (string, error) {
+	return c.cmd.Get(ctx, c.bookingKey(userId, orderId)).Result()
+}
+
+func (c *RedisInventoryCache) BindIdempotencyKey(ctx context.Context, userId, key, orderId string, expiration time.Duration) (string, error) {
+	idemKey := c.idempotencyKey(userId, key)
+	ok, err := c.cmd.SetNX(ctx, idemKey, orderId, expiration).Result()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return orderId, nil
+	}
+	return c.cmd.Get(ctx, idemKey).Result()
+}
+
+func (c *RedisInventoryCache) UnbindIdempotencyKey(ctx context.Context, userId, key string) error {
+	return c.cmd.Del(ctx, c.idempotencyKey(userId, key)).Err()
+}
+
+func (c *RedisInventoryCache) key(scheId string) string {
+	return fmt.Sprintf("schedule_inventory:%s", scheId)
+}
+
+func (c *RedisInventoryCache) bookingKey(userId, orderId string) string {
+	return fmt.Sprintf("order_booking_status:%s:%s", userId, orderId)
+}
+
+func (c *RedisInventoryCache) idempotencyKey(userId, key string) string {
+	return fmt.Sprintf("order_idempotency:%s:%s", userId, key)
+}
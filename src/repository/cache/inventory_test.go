@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/solunara/isb/src/repository/cache/redismocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRedisInventoryCache_Deduct(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		ctx     context.Context
+		booking Booking
+
+		wantErr error
+	}{
+		{
+			name: "预扣成功",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(0))
+				res.EXPECT().Eval(gomock.Any(), luaDeductInventory,
+					[]string{"schedule_inventory:123", "order_booking", "order_booking_status:u1:o1"},
+					"o1", gomock.Any(), []byte(`{}`), int64(86400)).Return(cmd)
+				return res
+			},
+			ctx:     context.Background(),
+			booking: Booking{ScheId: "123", UserId: "u1", OrderId: "o1", Order: []byte(`{}`)},
+		},
+		{
+			name: "已约满",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(-1))
+				res.EXPECT().Eval(gomock.Any(), luaDeductInventory,
+					[]string{"schedule_inventory:123", "order_booking", "order_booking_status:u1:o1"},
+					"o1", gomock.Any(), []byte(`{}`), int64(86400)).Return(cmd)
+				return res
+			},
+			ctx:     context.Background(),
+			booking: Booking{ScheId: "123", UserId: "u1", OrderId: "o1", Order: []byte(`{}`)},
+			wantErr: ErrInventorySoldOut,
+		},
+		{
+			name: "号源未加载",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(-2))
+				res.EXPECT().Eval(gomock.Any(), luaDeductInventory,
+					[]string{"schedule_inventory:123", "order_booking", "order_booking_status:u1:o1"},
+					"o1", gomock.Any(), []byte(`{}`), int64(86400)).Return(cmd)
+				return res
+			},
+			ctx:     context.Background(),
+			booking: Booking{ScheId: "123", UserId: "u1", OrderId: "o1", Order: []byte(`{}`)},
+			wantErr: ErrInventoryNotLoaded,
+		},
+		{
+			name: "redis返回error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetErr(errors.New("redis错误"))
+				res.EXPECT().Eval(gomock.Any(), luaDeductInventory,
+					[]string{"schedule_inventory:123", "order_booking", "order_booking_status:u1:o1"},
+					"o1", gomock.Any(), []byte(`{}`), int64(86400)).Return(cmd)
+				return res
+			},
+			ctx:     context.Background(),
+			booking: Booking{ScheId: "123", UserId: "u1", OrderId: "o1", Order: []byte(`{}`)},
+			wantErr: errors.New("redis错误"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewInventoryCache(tc.mock(ctrl))
+			err := c.Deduct(tc.ctx, tc.booking)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedisInventoryCache_Reconcile(t *testing.T) {
+	staleBefore := time.UnixMilli(1893456000000)
+	testCases := []struct {
+		name   string
+		mock   func(ctrl *gomock.Controller) redis.Cmdable
+		ctx    context.Context
+		scheId string
+		remain int
+
+		wantRepaired bool
+		wantErr      error
+	}{
+		{
+			name: "清理丢失的预扣后修正",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(1))
+				res.EXPECT().Eval(gomock.Any(), luaReconcileInventory,
+					[]string{"schedule_inventory:123"}, 5, staleBefore.UnixMilli()).Return(cmd)
+				return res
+			},
+			ctx:          context.Background(),
+			scheId:       "123",
+			remain:       5,
+			wantRepaired: true,
+		},
+		{
+			name: "无需修正",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(0))
+				res.EXPECT().Eval(gomock.Any(), luaReconcileInventory,
+					[]string{"schedule_inventory:123"}, 5, staleBefore.UnixMilli()).Return(cmd)
+				return res
+			},
+			ctx:    context.Background(),
+			scheId: "123",
+			remain: 5,
+		},
+		{
+			name: "号源未加载",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetVal(int64(-2))
+				res.EXPECT().Eval(gomock.Any(), luaReconcileInventory,
+					[]string{"schedule_inventory:123"}, 5, staleBefore.UnixMilli()).Return(cmd)
+				return res
+			},
+			ctx:    context.Background(),
+			scheId: "123",
+			remain: 5,
+		},
+		{
+			name: "redis返回error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				cmd := redis.NewCmd(context.Background())
+				cmd.SetErr(errors.New("redis错误"))
+				res.EXPECT().Eval(gomock.Any(), luaReconcileInventory,
+					[]string{"schedule_inventory:123"}, 5, staleBefore.UnixMilli()).Return(cmd)
+				return res
+			},
+			ctx:     context.Background(),
+			scheId:  "123",
+			remain:  5,
+			wantErr: errors.New("redis错误"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewInventoryCache(tc.mock(ctrl))
+			repaired, err := c.Reconcile(tc.ctx, tc.scheId, tc.remain, staleBefore)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRepaired, repaired)
+		})
+	}
+}
+
+func TestRedisInventoryCache_ReadBookings(t *testing.T) {
+	claimArgs := &redis.XAutoClaimArgs{
+		Stream:   "order_booking",
+		Group:    "order_booking_persister",
+		Consumer: "c1",
+		MinIdle:  time.Minute,
+		Start:    "0",
+		Count:    10,
+	}
+	readArgs := &redis.XReadGroupArgs{
+		Group:    "order_booking_persister",
+		Consumer: "c1",
+		Streams:  []string{"order_booking", ">"},
+		Count:    10,
+		Block:    time.Second,
+	}
+	claimCmd := func(msgs []redis.XMessage, err error) *redis.XAutoClaimCmd {
+		cmd := redis.NewXAutoClaimCmd(context.Background())
+		cmd.SetVal(msgs, "0-0")
+		cmd.SetErr(err)
+		return cmd
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantBookings []QueuedBooking
+		wantErr      error
+	}{
+		{
+			name: "先领取超时没有确认的订单",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				res.EXPECT().XAutoClaim(gomock.Any(), claimArgs).
+					Return(claimCmd([]redis.XMessage{{ID: "1-0", Values: map[string]any{"order": "o1"}}}, nil))
+				return res
+			},
+			wantBookings: []QueuedBooking{{Id: "1-0", Order: []byte("o1")}},
+		},
+		{
+			name: "读取新的订单",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				res.EXPECT().XAutoClaim(gomock.Any(), claimArgs).Return(claimCmd(nil, nil))
+				cmd := redis.NewXStreamSliceCmd(context.Background())
+				cmd.SetVal([]redis.XStream{{Stream: "order_booking", Messages: []redis.XMessage{{ID: "2-0", Values: map[string]any{"order": "o2"}}}}})
+				res.EXPECT().XReadGroup(gomock.Any(), readArgs).Return(cmd)
+				return res
+			},
+			wantBookings: []QueuedBooking{{Id: "2-0", Order: []byte("o2")}},
+		},
+		{
+			name: "没有消费组时先创建",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					res.EXPECT().XAutoClaim(gomock.Any(), claimArgs).
+						Return(claimCmd(nil, errors.New("NOGROUP No such key 'order_booking' or consumer group"))),
+					res.EXPECT().XGroupCreateMkStream(gomock.Any(), "order_booking", "order_booking_persister", "0").
+						Return(redis.NewStatusResult("OK", nil)),
+					res.EXPECT().XAutoClaim(gomock.Any(), claimArgs).Return(claimCmd(nil, nil)),
+				)
+				cmd := redis.NewXStreamSliceCmd(context.Background())
+				cmd.SetErr(redis.Nil)
+				res.EXPECT().XReadGroup(gomock.Any(), readArgs).Return(cmd)
+				return res
+			},
+		},
+		{
+			name: "redis返回error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				res := redismocks.NewMockCmdable(ctrl)
+				res.EXPECT().XAutoClaim(gomock.Any(), claimArgs).Return(claimCmd(nil, errors.New("redis错误")))
+				return res
+			},
+			wantErr: errors.New("redis错误"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := NewInventoryCache(tc.mock(ctrl))
+			bookings, err := c.ReadBookings(context.Background(), "c1", 10, time.Minute)
+			assert.Equal(t, tc.wantErr, err)
+			assert.ElementsMatch(t, tc.wantBookings, bookings)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+--获取排班号源在redis中的key, schedule_inventory:xxxx
+local key = KEYS[1]
+
+--已预扣但尚未落库的订单, 分数是预扣的时间, schedule_inventory:xxxx:pending_orders
+local pendingKey = key..":pending_orders"
+
+--等待落库的订单队列
+local streamKey = KEYS[2]
+
+--订单的落库状态, 落库前查询订单时使用
+local statusKey = KEYS[3]
+
+--预扣的订单号
+local orderId = ARGV[1]
+
+--预扣的时间, 毫秒
+local now = ARGV[2]
+
+--写入落库队列的订单
+local order = ARGV[3]
+
+--落库状态的过期时间, 秒
+local statusTTL = ARGV[4]
+
+local stock = redis.call("get", key)
+
+if not stock then
+    --号源还没有加载到redis
+    return -2
+end
+
+if tonumber(stock) <= 0 then
+    --已约满
+    return -1
+end
+
+redis.call("decr", key)
+redis.call("zadd", pendingKey, now, orderId)
+
+--pending 与号源同时过期
+local ttl = tonumber(redis.call("ttl", key))
+if ttl > 0 then
+    redis.call("expire", pendingKey, ttl)
+end
+
+--预扣和写入落库队列要么都成功要么都不做, 预扣成功的订单一定会被落库协程处理
+redis.call("xadd", streamKey, "*", "order", order)
+redis.call("set", statusKey, "", "EX", statusTTL)
+return 0
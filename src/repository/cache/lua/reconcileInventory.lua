@@ -0,0 +1,30 @@
+local key = KEYS[1]
+local pendingKey = key..":pending_orders"
+
+--数据库中的剩余号源
+local remain = tonumber(ARGV[1])
+
+--早于这个时间还没有落库的预扣视为已经丢失, 毫秒
+local staleBefore = ARGV[2]
+
+if redis.call("exists", key) == 0 then
+    --没有加载过, 不需要修正
+    return -2
+end
+
+--进程崩溃或者确认失败时预扣会一直留在 pending 里, 清理掉以免一直占着号源
+redis.call("zremrangebyscore", pendingKey, "-inf", "("..staleBefore)
+
+--还在落库路上的预扣要从剩余号源里扣掉
+local pending = redis.call("zcard", pendingKey)
+local expected = remain - pending
+if expected < 0 then
+    expected = 0
+end
+
+if tonumber(redis.call("get", key)) == expected then
+    return 0
+end
+
+redis.call("set", key, expected, "KEEPTTL")
+return 1
@@ -0,0 +1,19 @@
+local key = KEYS[1]
+local pendingKey = key..":pending_orders"
+
+--尚未落库的预扣的订单号, 为空表示不是预扣
+local orderId = ARGV[1]
+
+--是否把号源还回去
+local restore = ARGV[2]
+
+if orderId ~= "" and redis.call("zrem", pendingKey, orderId) == 0 then
+    --预扣已经被对账当作丢失的预扣清理了, 号源也已经修正过
+    return 0
+end
+
+--号源已过期就不用还了, 下次预扣会从数据库重新加载
+if restore == "1" and redis.call("exists", key) == 1 then
+    redis.call("incr", key)
+end
+return 0
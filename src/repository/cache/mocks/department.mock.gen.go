@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/cache/department.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/cache/department.go -destination=src/repository/cache/mocks/department.mock.gen.go -package=cachemock
+//
+
+// Package cachemock is a generated GoMock package.
+package cachemock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockDepartmentCache is a mock of DepartmentCache interface.
+type MockDepartmentCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockDepartmentCacheMockRecorder
+	isgomock struct{}
+}
+
+// MockDepartmentCacheMockRecorder is the mock recorder for MockDepartmentCache.
+type MockDepartmentCacheMockRecorder struct {
+	mock *MockDepartmentCache
+}
+
+// NewMockDepartmentCache creates a new mock instance.
+func NewMockDepartmentCache(ctrl *gomock.Controller) *MockDepartmentCache {
+	mock := &MockDepartmentCache{ctrl: ctrl}
+	mock.recorder = &MockDepartmentCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDepartmentCache) EXPECT() *MockDepartmentCacheMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockDepartmentCache) Delete(ctx context.Context, hosId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, hosId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDepartmentCacheMockRecorder) Delete(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDepartmentCache)(nil).Delete), ctx, hosId)
+}
+
+// Get mocks base method.
+func (m *MockDepartmentCache) Get(ctx context.Context, hosId string) ([]xytmodel.Department, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, hosId)
+	ret0, _ := ret[0].([]xytmodel.Department)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockDepartmentCacheMockRecorder) Get(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockDepartmentCache)(nil).Get), ctx, hosId)
+}
+
+// Set mocks base method.
+func (m *MockDepartmentCache) Set(ctx context.Context, hosId string, depts []xytmodel.Department, expiration time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, hosId, depts, expiration)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockDepartmentCacheMockRecorder) Set(ctx, hosId, depts, expiration any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockDepartmentCache)(nil).Set), ctx, hosId, depts, expiration)
+}
@@ -0,0 +1,201 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/cache/inventory.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/cache/inventory.go -destination=src/repository/cache/mocks/inventory.mock.gen.go -package=cachemock
+//
+
+// Package cachemock is a generated GoMock package.
+package cachemock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	cache "github.com/solunara/isb/src/repository/cache"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockInventoryCache is a mock of InventoryCache interface.
+type MockInventoryCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockInventoryCacheMockRecorder
+	isgomock struct{}
+}
+
+// MockInventoryCacheMockRecorder is the mock recorder for MockInventoryCache.
+type MockInventoryCacheMockRecorder struct {
+	mock *MockInventoryCache
+}
+
+// NewMockInventoryCache creates a new mock instance.
+func NewMockInventoryCache(ctrl *gomock.Controller) *MockInventoryCache {
+	mock := &MockInventoryCache{ctrl: ctrl}
+	mock.recorder = &MockInventoryCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockInventoryCache) EXPECT() *MockInventoryCacheMockRecorder {
+	return m.recorder
+}
+
+// AckBooking mocks base method.
+func (m *MockInventoryCache) AckBooking(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AckBooking", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AckBooking indicates an expected call of AckBooking.
+func (mr *MockInventoryCacheMockRecorder) AckBooking(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AckBooking", reflect.TypeOf((*MockInventoryCache)(nil).AckBooking), ctx, id)
+}
+
+// BindIdempotencyKey mocks base method.
+func (m *MockInventoryCache) BindIdempotencyKey(ctx context.Context, userId, key, orderId string, expiration time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BindIdempotencyKey", ctx, userId, key, orderId, expiration)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BindIdempotencyKey indicates an expected call of BindIdempotencyKey.
+func (mr *MockInventoryCacheMockRecorder) BindIdempotencyKey(ctx, userId, key, orderId, expiration any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindIdempotencyKey", reflect.TypeOf((*MockInventoryCache)(nil).BindIdempotencyKey), ctx, userId, key, orderId, expiration)
+}
+
+// BookingStatus mocks base method.
+func (m *MockInventoryCache) BookingStatus(ctx context.Context, userId, orderId string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BookingStatus", ctx, userId, orderId)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BookingStatus indicates an expected call of BookingStatus.
+func (mr *MockInventoryCacheMockRecorder) BookingStatus(ctx, userId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BookingStatus", reflect.TypeOf((*MockInventoryCache)(nil).BookingStatus), ctx, userId, orderId)
+}
+
+// Confirm mocks base method.
+func (m *MockInventoryCache) Confirm(ctx context.Context, scheId, orderId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Confirm", ctx, scheId, orderId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Confirm indicates an expected call of Confirm.
+func (mr *MockInventoryCacheMockRecorder) Confirm(ctx, scheId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Confirm", reflect.TypeOf((*MockInventoryCache)(nil).Confirm), ctx, scheId, orderId)
+}
+
+// Deduct mocks base method.
+func (m *MockInventoryCache) Deduct(ctx context.Context, booking cache.Booking) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deduct", ctx, booking)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Deduct indicates an expected call of Deduct.
+func (mr *MockInventoryCacheMockRecorder) Deduct(ctx, booking any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deduct", reflect.TypeOf((*MockInventoryCache)(nil).Deduct), ctx, booking)
+}
+
+// FailBooking mocks base method.
+func (m *MockInventoryCache) FailBooking(ctx context.Context, userId, orderId, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailBooking", ctx, userId, orderId, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailBooking indicates an expected call of FailBooking.
+func (mr *MockInventoryCacheMockRecorder) FailBooking(ctx, userId, orderId, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailBooking", reflect.TypeOf((*MockInventoryCache)(nil).FailBooking), ctx, userId, orderId, reason)
+}
+
+// Load mocks base method.
+func (m *MockInventoryCache) Load(ctx context.Context, scheId string, remain int, expiration time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Load", ctx, scheId, remain, expiration)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Load indicates an expected call of Load.
+func (mr *MockInventoryCacheMockRecorder) Load(ctx, scheId, remain, expiration any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockInventoryCache)(nil).Load), ctx, scheId, remain, expiration)
+}
+
+// ReadBookings mocks base method.
+func (m *MockInventoryCache) ReadBookings(ctx context.Context, consumer string, count int64, minIdle time.Duration) ([]cache.QueuedBooking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadBookings", ctx, consumer, count, minIdle)
+	ret0, _ := ret[0].([]cache.QueuedBooking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadBookings indicates an expected call of ReadBookings.
+func (mr *MockInventoryCacheMockRecorder) ReadBookings(ctx, consumer, count, minIdle any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadBookings", reflect.TypeOf((*MockInventoryCache)(nil).ReadBookings), ctx, consumer, count, minIdle)
+}
+
+// Reconcile mocks base method.
+func (m *MockInventoryCache) Reconcile(ctx context.Context, scheId string, remain int, staleBefore time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", ctx, scheId, remain, staleBefore)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockInventoryCacheMockRecorder) Reconcile(ctx, scheId, remain, staleBefore any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockInventoryCache)(nil).Reconcile), ctx, scheId, remain, staleBefore)
+}
+
+// Release mocks base method.
+func (m *MockInventoryCache) Release(ctx context.Context, scheId, orderId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, scheId, orderId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockInventoryCacheMockRecorder) Release(ctx, scheId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockInventoryCache)(nil).Release), ctx, scheId, orderId)
+}
+
+// UnbindIdempotencyKey mocks base method.
+func (m *MockInventoryCache) UnbindIdempotencyKey(ctx context.Context, userId, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnbindIdempotencyKey", ctx, userId, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnbindIdempotencyKey indicates an expected call of UnbindIdempotencyKey.
+func (mr *MockInventoryCacheMockRecorder) UnbindIdempotencyKey(ctx, userId, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnbindIdempotencyKey", reflect.TypeOf((*MockInventoryCache)(nil).UnbindIdempotencyKey), ctx, userId, key)
+}
@@ -0,0 +1,86 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/cache/region.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/cache/region.go -destination=src/repository/cache/mocks/region.mock.gen.go -package=cachemock
+//
+
+// Package cachemock is a generated GoMock package.
+package cachemock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	cache "github.com/solunara/isb/src/repository/cache"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRegionCache is a mock of RegionCache interface.
+type MockRegionCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockRegionCacheMockRecorder
+	isgomock struct{}
+}
+
+// MockRegionCacheMockRecorder is the mock recorder for MockRegionCache.
+type MockRegionCacheMockRecorder struct {
+	mock *MockRegionCache
+}
+
+// NewMockRegionCache creates a new mock instance.
+func NewMockRegionCache(ctrl *gomock.Controller) *MockRegionCache {
+	mock := &MockRegionCache{ctrl: ctrl}
+	mock.recorder = &MockRegionCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRegionCache) EXPECT() *MockRegionCacheMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockRegionCache) Delete(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockRegionCacheMockRecorder) Delete(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRegionCache)(nil).Delete), ctx)
+}
+
+// Get mocks base method.
+func (m *MockRegionCache) Get(ctx context.Context) (cache.RegionSnapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx)
+	ret0, _ := ret[0].(cache.RegionSnapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockRegionCacheMockRecorder) Get(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRegionCache)(nil).Get), ctx)
+}
+
+// Set mocks base method.
+func (m *MockRegionCache) Set(ctx context.Context, snap cache.RegionSnapshot, expiration time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, snap, expiration)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockRegionCacheMockRecorder) Set(ctx, snap, expiration any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockRegionCache)(nil).Set), ctx, snap, expiration)
+}
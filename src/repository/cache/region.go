@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/solunara/isb/src/model/xytmodel"
+)
+
+// RegionSnapshot 某个版本的全部省市区数据
+type RegionSnapshot struct {
+	Version   string              `json:"version"`
+	Provinces []xytmodel.Province `json:"provinces"`
+	Cities    []xytmodel.City     `json:"cities"`
+	Districts []xytmodel.District `json:"districts"`
+}
+
+// RegionCache 缓存全部省市区数据, 导入新版本后删除
+type RegionCache interface {
+	Get(ctx context.Context) (RegionSnapshot, error)
+	Set(ctx context.Context, snap RegionSnapshot, expiration time.Duration) error
+	Delete(ctx context.Context) error
+}
+
+const regionKey = "region:snapshot"
+
+type RedisRegionCache struct {
+	cmd redis.Cmdable
+}
+
+func NewRegionCache(cmd redis.Cmdable) RegionCache {
+	return &RedisRegionCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisRegionCache) Get(ctx context.Context) (RegionSnapshot, error) {
+	var snap RegionSnapshot
+	data, err := c.cmd.Get(ctx, regionKey).Bytes()
+	if err != nil {
+		return snap, err
+	}
+	err = json.Unmarshal(data, &snap)
+	return snap, err
+}
+
+func (c *RedisRegionCache) Set(ctx context.Context, snap RegionSnapshot, expiration time.Duration) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return c.cmd.Set(ctx, regionKey, data, expiration).Err()
+}
+
+func (c *RedisRegionCache) Delete(ctx context.Context) error {
+	return c.cmd.Del(ctx, regionKey).Err()
+}
@@ -0,0 +1,88 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"gorm.io/gorm"
+)
+
+// HospitalFilter 医院列表的筛选条件, 为空的条件不参与筛选
+type HospitalFilter struct {
+	HosId        string
+	GradeCode    string
+	CityCode     string
+	CityName     string
+	DistrictCode string
+	// 按医院全称模糊匹配
+	HosName string
+}
+
+type HospitalDAO interface {
+	FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error)
+	List(ctx context.Context, filter HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error)
+	Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error)
+	FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error)
+}
+
+type GORMHospitalDAO struct {
+	db *gorm.DB
+}
+
+func NewHospitalDAO(db *gorm.DB) HospitalDAO {
+	return &GORMHospitalDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMHospitalDAO) FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error) {
+	var hos xytmodel.Hospital
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableHospital).Where("uid = ?", uid).Take(&hos).Error
+	return hos, err
+}
+
+// List 按条件分页查询医院, 同时返回符合条件的总数; offset 超过总数时不再查询列表
+func (dao *GORMHospitalDAO) List(ctx context.Context, filter HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	query := dao.db.WithContext(ctx).Model(&xytmodel.Hospital{})
+	if filter.HosId != "" {
+		query = query.Where("uid = ?", filter.HosId)
+	}
+	if filter.GradeCode != "" {
+		query = query.Where("grade_code = ?", filter.GradeCode)
+	}
+	if filter.CityCode != "" {
+		query = query.Where("city_code = ?", filter.CityCode)
+	}
+	if filter.CityName != "" {
+		query = query.Where("city_name = ?", filter.CityName)
+	}
+	if filter.HosName != "" {
+		query = query.Where("full_name like ?", "%"+filter.HosName+"%")
+	}
+	if filter.DistrictCode != "" {
+		query = query.Where("district_code = ?", filter.DistrictCode)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total < 1 || offset > int(total) {
+		return nil, total, nil
+	}
+	var hoslist []xytmodel.Hospital
+	err := query.Limit(limit).Offset(offset).Find(&hoslist).Error
+	return hoslist, total, err
+}
+
+func (dao *GORMHospitalDAO) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	var grades []xytmodel.HospitalGrade
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableHospitalGrade).Find(&grades).Error
+	return grades, err
+}
+
+func (dao *GORMHospitalDAO) FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error) {
+	var dept xytmodel.Department
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableDepartment).Where("uid = ?", uid).Take(&dept).Error
+	return dept, err
+}
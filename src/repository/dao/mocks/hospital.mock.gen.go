@@ -0,0 +1,104 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/dao/hospital.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/dao/hospital.go -destination=src/repository/dao/mocks/hospital.mock.gen.go -package=daomock
+//
+
+// Package daomock is a generated GoMock package.
+package daomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	dao "github.com/solunara/isb/src/repository/dao"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockHospitalDAO is a mock of HospitalDAO interface.
+type MockHospitalDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockHospitalDAOMockRecorder
+	isgomock struct{}
+}
+
+// MockHospitalDAOMockRecorder is the mock recorder for MockHospitalDAO.
+type MockHospitalDAOMockRecorder struct {
+	mock *MockHospitalDAO
+}
+
+// NewMockHospitalDAO creates a new mock instance.
+func NewMockHospitalDAO(ctrl *gomock.Controller) *MockHospitalDAO {
+	mock := &MockHospitalDAO{ctrl: ctrl}
+	mock.recorder = &MockHospitalDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHospitalDAO) EXPECT() *MockHospitalDAOMockRecorder {
+	return m.recorder
+}
+
+// FindByUid mocks base method.
+func (m *MockHospitalDAO) FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUid", ctx, uid)
+	ret0, _ := ret[0].(xytmodel.Hospital)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUid indicates an expected call of FindByUid.
+func (mr *MockHospitalDAOMockRecorder) FindByUid(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUid", reflect.TypeOf((*MockHospitalDAO)(nil).FindByUid), ctx, uid)
+}
+
+// FindDepartment mocks base method.
+func (m *MockHospitalDAO) FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDepartment", ctx, uid)
+	ret0, _ := ret[0].(xytmodel.Department)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDepartment indicates an expected call of FindDepartment.
+func (mr *MockHospitalDAOMockRecorder) FindDepartment(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDepartment", reflect.TypeOf((*MockHospitalDAO)(nil).FindDepartment), ctx, uid)
+}
+
+// Grades mocks base method.
+func (m *MockHospitalDAO) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grades", ctx)
+	ret0, _ := ret[0].([]xytmodel.HospitalGrade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Grades indicates an expected call of Grades.
+func (mr *MockHospitalDAOMockRecorder) Grades(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grades", reflect.TypeOf((*MockHospitalDAO)(nil).Grades), ctx)
+}
+
+// List mocks base method.
+func (m *MockHospitalDAO) List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]xytmodel.Hospital)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockHospitalDAOMockRecorder) List(ctx, filter, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockHospitalDAO)(nil).List), ctx, filter, offset, limit)
+}
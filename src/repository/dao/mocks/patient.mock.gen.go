@@ -0,0 +1,159 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/dao/patient.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/dao/patient.go -destination=src/repository/dao/mocks/patient.mock.gen.go -package=daomock
+//
+
+// Package daomock is a generated GoMock package.
+package daomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPatientDAO is a mock of PatientDAO interface.
+type MockPatientDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockPatientDAOMockRecorder
+	isgomock struct{}
+}
+
+// MockPatientDAOMockRecorder is the mock recorder for MockPatientDAO.
+type MockPatientDAOMockRecorder struct {
+	mock *MockPatientDAO
+}
+
+// NewMockPatientDAO creates a new mock instance.
+func NewMockPatientDAO(ctrl *gomock.Controller) *MockPatientDAO {
+	mock := &MockPatientDAO{ctrl: ctrl}
+	mock.recorder = &MockPatientDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPatientDAO) EXPECT() *MockPatientDAOMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockPatientDAO) Delete(ctx context.Context, p xytmodel.Patient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPatientDAOMockRecorder) Delete(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPatientDAO)(nil).Delete), ctx, p)
+}
+
+// FindById mocks base method.
+func (m *MockPatientDAO) FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, userId, id)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockPatientDAOMockRecorder) FindById(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockPatientDAO)(nil).FindById), ctx, userId, id)
+}
+
+// FindByUser mocks base method.
+func (m *MockPatientDAO) FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUser", ctx, userId)
+	ret0, _ := ret[0].([]xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUser indicates an expected call of FindByUser.
+func (mr *MockPatientDAOMockRecorder) FindByUser(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUser", reflect.TypeOf((*MockPatientDAO)(nil).FindByUser), ctx, userId)
+}
+
+// FindDefault mocks base method.
+func (m *MockPatientDAO) FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDefault", ctx, userId)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDefault indicates an expected call of FindDefault.
+func (mr *MockPatientDAOMockRecorder) FindDefault(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDefault", reflect.TypeOf((*MockPatientDAO)(nil).FindDefault), ctx, userId)
+}
+
+// Insert mocks base method.
+func (m *MockPatientDAO) Insert(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", ctx, p, maxPatients)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert.
+func (mr *MockPatientDAOMockRecorder) Insert(ctx, p, maxPatients any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockPatientDAO)(nil).Insert), ctx, p, maxPatients)
+}
+
+// Reencrypt mocks base method.
+func (m *MockPatientDAO) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reencrypt", ctx, batchSize)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reencrypt indicates an expected call of Reencrypt.
+func (mr *MockPatientDAOMockRecorder) Reencrypt(ctx, batchSize any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reencrypt", reflect.TypeOf((*MockPatientDAO)(nil).Reencrypt), ctx, batchSize)
+}
+
+// SetDefault mocks base method.
+func (m *MockPatientDAO) SetDefault(ctx context.Context, userId, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDefault", ctx, userId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDefault indicates an expected call of SetDefault.
+func (mr *MockPatientDAOMockRecorder) SetDefault(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDefault", reflect.TypeOf((*MockPatientDAO)(nil).SetDefault), ctx, userId, id)
+}
+
+// Update mocks base method.
+func (m *MockPatientDAO) Update(ctx context.Context, p xytmodel.Patient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPatientDAOMockRecorder) Update(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPatientDAO)(nil).Update), ctx, p)
+}
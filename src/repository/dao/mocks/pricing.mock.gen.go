@@ -0,0 +1,129 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/dao/pricing.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/dao/pricing.go -destination=src/repository/dao/mocks/pricing.mock.gen.go -package=daomock
+//
+
+// Package daomock is a generated GoMock package.
+package daomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPricingDAO is a mock of PricingDAO interface.
+type MockPricingDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockPricingDAOMockRecorder
+	isgomock struct{}
+}
+
+// MockPricingDAOMockRecorder is the mock recorder for MockPricingDAO.
+type MockPricingDAOMockRecorder struct {
+	mock *MockPricingDAO
+}
+
+// NewMockPricingDAO creates a new mock instance.
+func NewMockPricingDAO(ctrl *gomock.Controller) *MockPricingDAO {
+	mock := &MockPricingDAO{ctrl: ctrl}
+	mock.recorder = &MockPricingDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPricingDAO) EXPECT() *MockPricingDAOMockRecorder {
+	return m.recorder
+}
+
+// DeleteFee mocks base method.
+func (m *MockPricingDAO) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFee", ctx, hosId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFee indicates an expected call of DeleteFee.
+func (mr *MockPricingDAOMockRecorder) DeleteFee(ctx, hosId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFee", reflect.TypeOf((*MockPricingDAO)(nil).DeleteFee), ctx, hosId, id)
+}
+
+// FindFees mocks base method.
+func (m *MockPricingDAO) FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindFees", ctx, regTypeIds)
+	ret0, _ := ret[0].([]xytmodel.RegistrationFee)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindFees indicates an expected call of FindFees.
+func (mr *MockPricingDAOMockRecorder) FindFees(ctx, regTypeIds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindFees", reflect.TypeOf((*MockPricingDAO)(nil).FindFees), ctx, regTypeIds)
+}
+
+// FindTypes mocks base method.
+func (m *MockPricingDAO) FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTypes", ctx, ids)
+	ret0, _ := ret[0].([]xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTypes indicates an expected call of FindTypes.
+func (mr *MockPricingDAOMockRecorder) FindTypes(ctx, ids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTypes", reflect.TypeOf((*MockPricingDAO)(nil).FindTypes), ctx, ids)
+}
+
+// ListTypes mocks base method.
+func (m *MockPricingDAO) ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTypes", ctx, hosId)
+	ret0, _ := ret[0].([]xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTypes indicates an expected call of ListTypes.
+func (mr *MockPricingDAOMockRecorder) ListTypes(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTypes", reflect.TypeOf((*MockPricingDAO)(nil).ListTypes), ctx, hosId)
+}
+
+// SaveFee mocks base method.
+func (m *MockPricingDAO) SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveFee", ctx, fee)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveFee indicates an expected call of SaveFee.
+func (mr *MockPricingDAOMockRecorder) SaveFee(ctx, fee any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveFee", reflect.TypeOf((*MockPricingDAO)(nil).SaveFee), ctx, fee)
+}
+
+// SaveType mocks base method.
+func (m *MockPricingDAO) SaveType(ctx context.Context, t *xytmodel.RegistrationType) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveType", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveType indicates an expected call of SaveType.
+func (mr *MockPricingDAOMockRecorder) SaveType(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveType", reflect.TypeOf((*MockPricingDAO)(nil).SaveType), ctx, t)
+}
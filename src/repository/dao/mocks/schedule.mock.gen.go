@@ -0,0 +1,132 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/dao/schedule.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/dao/schedule.go -destination=src/repository/dao/mocks/schedule.mock.gen.go -package=daomock
+//
+
+// Package daomock is a generated GoMock package.
+package daomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockScheduleDAO is a mock of ScheduleDAO interface.
+type MockScheduleDAO struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleDAOMockRecorder
+	isgomock struct{}
+}
+
+// MockScheduleDAOMockRecorder is the mock recorder for MockScheduleDAO.
+type MockScheduleDAOMockRecorder struct {
+	mock *MockScheduleDAO
+}
+
+// NewMockScheduleDAO creates a new mock instance.
+func NewMockScheduleDAO(ctrl *gomock.Controller) *MockScheduleDAO {
+	mock := &MockScheduleDAO{ctrl: ctrl}
+	mock.recorder = &MockScheduleDAOMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleDAO) EXPECT() *MockScheduleDAOMockRecorder {
+	return m.recorder
+}
+
+// CountDoctors mocks base method.
+func (m *MockScheduleDAO) CountDoctors(ctx context.Context, hosId, deptId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountDoctors", ctx, hosId, deptId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountDoctors indicates an expected call of CountDoctors.
+func (mr *MockScheduleDAOMockRecorder) CountDoctors(ctx, hosId, deptId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountDoctors", reflect.TypeOf((*MockScheduleDAO)(nil).CountDoctors), ctx, hosId, deptId)
+}
+
+// FindByDate mocks base method.
+func (m *MockScheduleDAO) FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByDate", ctx, hosId, deptId, date)
+	ret0, _ := ret[0].([]xytmodel.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByDate indicates an expected call of FindByDate.
+func (mr *MockScheduleDAOMockRecorder) FindByDate(ctx, hosId, deptId, date any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByDate", reflect.TypeOf((*MockScheduleDAO)(nil).FindByDate), ctx, hosId, deptId, date)
+}
+
+// FindById mocks base method.
+func (m *MockScheduleDAO) FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, scheId)
+	ret0, _ := ret[0].(xytmodel.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockScheduleDAOMockRecorder) FindById(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockScheduleDAO)(nil).FindById), ctx, scheId)
+}
+
+// FindDoctor mocks base method.
+func (m *MockScheduleDAO) FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDoctor", ctx, id)
+	ret0, _ := ret[0].(xytmodel.Doctor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDoctor indicates an expected call of FindDoctor.
+func (mr *MockScheduleDAOMockRecorder) FindDoctor(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDoctor", reflect.TypeOf((*MockScheduleDAO)(nil).FindDoctor), ctx, id)
+}
+
+// FindDoctors mocks base method.
+func (m *MockScheduleDAO) FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDoctors", ctx, ids)
+	ret0, _ := ret[0].([]xytmodel.Doctor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDoctors indicates an expected call of FindDoctors.
+func (mr *MockScheduleDAOMockRecorder) FindDoctors(ctx, ids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDoctors", reflect.TypeOf((*MockScheduleDAO)(nil).FindDoctors), ctx, ids)
+}
+
+// TakenSeqs mocks base method.
+func (m *MockScheduleDAO) TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakenSeqs", ctx, scheIds)
+	ret0, _ := ret[0].(map[string][]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakenSeqs indicates an expected call of TakenSeqs.
+func (mr *MockScheduleDAOMockRecorder) TakenSeqs(ctx, scheIds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakenSeqs", reflect.TypeOf((*MockScheduleDAO)(nil).TakenSeqs), ctx, scheIds)
+}
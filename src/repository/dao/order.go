@@ -0,0 +1,245 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderFilter 用户订单列表的筛选条件, State 为 nil 时不按状态筛选
+type OrderFilter struct {
+	UserId    string
+	PatientId string
+	State     *int8
+}
+
+type OrderDAO interface {
+	// Transaction 在同一个事务中执行 fn, fn 返回错误时回滚
+	Transaction(ctx context.Context, fn func(tx OrderDAO) error) error
+	// FindById 查询属于 userId 的订单, 其他用户的订单和不存在一样
+	FindById(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error)
+	List(ctx context.Context, filter OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error)
+	FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error)
+	// TakeSeat 占用排班的一个号源并返回排班, 没有号源或已停诊时返回 app.ErrScheduleFull
+	// 条件更新的行锁保证并发预约同一排班时不会超卖, 号序分配也因此是串行的
+	TakeSeat(ctx context.Context, scheId string) (xytmodel.Schedule, error)
+	// ReleaseSeat 归还排班的一个号源
+	ReleaseSeat(ctx context.Context, scheId string) error
+	// TakenSeqs 排班已经分配出去的号序
+	TakenSeqs(ctx context.Context, scheId string) ([]int, error)
+	// Insert 写入订单, 幂等键已有订单时返回 app.ErrDuplicateOrder
+	Insert(ctx context.Context, order xytmodel.RegisterOrder) error
+	// Transit 把订单从 from 迁移到 to 并记录变更历史, 需要在事务中调用
+	// 订单已经不在 from 状态时返回 app.ErrOrderStateChanged
+	Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error
+	InsertHistory(ctx context.Context, history xytmodel.OrderHistory) error
+	FindHistory(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error)
+	// LockPatient 锁住就诊人, 同一就诊人的并发预约串行执行
+	LockPatient(ctx context.Context, patientId string) error
+	// CountActive 就诊人还没有就诊的订单数
+	CountActive(ctx context.Context, patientId string) (int64, error)
+	// CountActiveOnDate 就诊人 date 当天预约了 docId 医生或 deptId 科室且还没有就诊的订单数
+	CountActiveOnDate(ctx context.Context, patientId, date, docId, deptId string) (int64, error)
+	// PromoteWaitlist 把候补记录标记为已递补, 候补记录已经不在候补中时返回 app.ErrWaitlistChanged
+	PromoteWaitlist(ctx context.Context, entryId int, orderId string) error
+	FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error)
+	// UpdateRefund 更新支付单的退款结果
+	UpdateRefund(ctx context.Context, payment xytmodel.OrderPayment) error
+	// FindStaleRefunding 进入退款中早于 before 且仍在退款中的订单
+	FindStaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error)
+}
+
+type GORMOrderDAO struct {
+	db *gorm.DB
+}
+
+func NewOrderDAO(db *gorm.DB) OrderDAO {
+	return &GORMOrderDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMOrderDAO) Transaction(ctx context.Context, fn func(tx OrderDAO) error) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewOrderDAO(tx))
+	})
+}
+
+func (dao *GORMOrderDAO) FindById(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	var order xytmodel.RegisterOrder
+	if userId == "" || orderId == "" {
+		return order, gorm.ErrRecordNotFound
+	}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("order_id = ? and user_id = ?", orderId, userId).Take(&order).Error
+	return order, err
+}
+
+// List 按条件分页查询订单, 同时返回符合条件的总数; offset 超过总数时不再查询列表
+func (dao *GORMOrderDAO) List(ctx context.Context, filter OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error) {
+	query := dao.db.WithContext(ctx).Model(&xytmodel.RegisterOrder{}).Where("user_id = ?", filter.UserId)
+	if filter.PatientId != "" {
+		query = query.Where("patient_id = ?", filter.PatientId)
+	}
+	if filter.State != nil {
+		query = query.Where("state = ?", *filter.State)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total < 1 || offset > int(total) {
+		return nil, total, nil
+	}
+	var orders []xytmodel.RegisterOrder
+	err := query.Limit(limit).Offset(offset).Find(&orders).Error
+	return orders, total, err
+}
+
+func (dao *GORMOrderDAO) FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error) {
+	var order xytmodel.RegisterOrder
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).Select("order_id").
+		Where("user_id = ? and idempotency_key = ?", userId, key).Take(&order).Error
+	return order.OrderId, err
+}
+
+func (dao *GORMOrderDAO) TakeSeat(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	var schedule xytmodel.Schedule
+	res := dao.db.WithContext(ctx).Table(xytmodel.TableSchedule).
+		Where("sche_id = ? and status = ? and registered < max_patients", scheId, xytmodel.ScheduleStatusNormal).
+		Update("registered", gorm.Expr("registered + 1"))
+	if res.Error != nil {
+		return schedule, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return schedule, app.ErrScheduleFull
+	}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableSchedule).Where("sche_id = ?", scheId).Take(&schedule).Error
+	return schedule, err
+}
+
+func (dao *GORMOrderDAO) ReleaseSeat(ctx context.Context, scheId string) error {
+	return dao.db.WithContext(ctx).Table(xytmodel.TableSchedule).
+		Where("sche_id = ? and registered > 0", scheId).
+		Update("registered", gorm.Expr("registered - 1")).Error
+}
+
+func (dao *GORMOrderDAO) TakenSeqs(ctx context.Context, scheId string) ([]int, error) {
+	var taken []int
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("sche_id = ? and state in ? and seq_no > 0", scheId, xytmodel.SeqHoldingStates).
+		Pluck("seq_no", &taken).Error
+	return taken, err
+}
+
+func (dao *GORMOrderDAO) Insert(ctx context.Context, order xytmodel.RegisterOrder) error {
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).Create(&order).Error
+	if IsDuplicateKeyErr(err) {
+		return app.ErrDuplicateOrder
+	}
+	return err
+}
+
+func (dao *GORMOrderDAO) Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error {
+	if !xytmodel.CanTransitOrder(from, to) {
+		return app.ErrOrderTransition
+	}
+	res := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("order_id = ? and state = ?", orderId, from).
+		Update("state", to)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return app.ErrOrderStateChanged
+	}
+	return dao.db.WithContext(ctx).Create(&xytmodel.OrderHistory{
+		OrderId:   orderId,
+		FromState: from,
+		ToState:   to,
+		Actor:     actor,
+		Reason:    reason,
+	}).Error
+}
+
+func (dao *GORMOrderDAO) InsertHistory(ctx context.Context, history xytmodel.OrderHistory) error {
+	return dao.db.WithContext(ctx).Create(&history).Error
+}
+
+func (dao *GORMOrderDAO) FindHistory(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error) {
+	var history []xytmodel.OrderHistory
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrderHistory).Where("order_id = ?", orderId).Order("id").Find(&history).Error
+	return history, err
+}
+
+func (dao *GORMOrderDAO) LockPatient(ctx context.Context, patientId string) error {
+	var patient xytmodel.Patient
+	return dao.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Table(xytmodel.TablePatient).
+		Select("id").Where("id = ?", patientId).Take(&patient).Error
+}
+
+func (dao *GORMOrderDAO) CountActive(ctx context.Context, patientId string) (int64, error) {
+	var count int64
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("patient_id = ? and state in ?", patientId, xytmodel.ActiveOrderStates).
+		Count(&count).Error
+	return count, err
+}
+
+func (dao *GORMOrderDAO) CountActiveOnDate(ctx context.Context, patientId, date, docId, deptId string) (int64, error) {
+	var count int64
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("patient_id = ? and state in ? and visit_time like ?", patientId, xytmodel.ActiveOrderStates, date+"%").
+		Where("doc_id = ? or dept_id = ?", docId, deptId).
+		Count(&count).Error
+	return count, err
+}
+
+func (dao *GORMOrderDAO) PromoteWaitlist(ctx context.Context, entryId int, orderId string) error {
+	res := dao.db.WithContext(ctx).Table(xytmodel.TableWaitlist).
+		Where("id = ? and state = ?", entryId, xytmodel.WaitlistStateWaiting).
+		Updates(map[string]any{
+			"state":       xytmodel.WaitlistStatePromoted,
+			"order_id":    orderId,
+			"promoted_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return app.ErrWaitlistChanged
+	}
+	return nil
+}
+
+func (dao *GORMOrderDAO) FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error) {
+	var payment xytmodel.OrderPayment
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrderPayment).Where("order_id = ?", orderId).Take(&payment).Error
+	return payment, err
+}
+
+func (dao *GORMOrderDAO) UpdateRefund(ctx context.Context, payment xytmodel.OrderPayment) error {
+	return dao.db.WithContext(ctx).Table(xytmodel.TableOrderPayment).Where("order_id = ?", payment.OrderId).Updates(map[string]any{
+		"status":        payment.Status,
+		"refund_no":     payment.RefundNo,
+		"refund_amount": payment.RefundAmount,
+		"refunded_at":   payment.RefundedAt,
+	}).Error
+}
+
+func (dao *GORMOrderDAO) FindStaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error) {
+	// 订单表没有记录进入退款中的时间, 从状态变更记录中查
+	stale := dao.db.Table(xytmodel.TableOrderHistory).Select("order_id").
+		Where("to_state = ? and created_at < ?", xytmodel.OrderStateRefunding, before)
+	var orders []xytmodel.RegisterOrder
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("state = ? and order_id in (?)", xytmodel.OrderStateRefunding, stale).
+		Order("id").Limit(limit).
+		Find(&orders).Error
+	return orders, err
+}
@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestCanTransitOrder(t *testing.T) {
+	testCases := []struct {
+		name string
+		from int8
+		to   int8
+		want bool
+	}{
+		{name: "待支付->已支付", from: xytmodel.OrderStatePending, to: xytmodel.OrderStatePaid, want: true},
+		{name: "待支付->已取消", from: xytmodel.OrderStatePending, to: xytmodel.OrderStateCancelled, want: true},
+		{name: "已支付->已完成", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateCompleted, want: true},
+		{name: "已支付->退款中", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateRefunding, want: true},
+		{name: "退款中->已退款", from: xytmodel.OrderStateRefunding, to: xytmodel.OrderStateRefunded, want: true},
+		{name: "退款失败回到已支付", from: xytmodel.OrderStateRefunding, to: xytmodel.OrderStatePaid, want: true},
+		{name: "待支付->已完成", from: xytmodel.OrderStatePending, to: xytmodel.OrderStateCompleted},
+		{name: "已支付->已退款", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateRefunded},
+		{name: "已支付->已取消", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateCancelled},
+		{name: "已取消->待支付", from: xytmodel.OrderStateCancelled, to: xytmodel.OrderStatePending},
+		{name: "已完成->已支付", from: xytmodel.OrderStateCompleted, to: xytmodel.OrderStatePaid},
+		{name: "已支付->已签到", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateCheckedIn, want: true},
+		{name: "已支付->爽约", from: xytmodel.OrderStatePaid, to: xytmodel.OrderStateNoShow, want: true},
+		{name: "已签到->就诊中", from: xytmodel.OrderStateCheckedIn, to: xytmodel.OrderStateCalling, want: true},
+		{name: "过号回到候诊", from: xytmodel.OrderStateCalling, to: xytmodel.OrderStateCheckedIn, want: true},
+		{name: "就诊中->已完成", from: xytmodel.OrderStateCalling, to: xytmodel.OrderStateCompleted, want: true},
+		{name: "已签到->已退款", from: xytmodel.OrderStateCheckedIn, to: xytmodel.OrderStateRefunding},
+		{name: "爽约->已签到", from: xytmodel.OrderStateNoShow, to: xytmodel.OrderStateCheckedIn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, xytmodel.CanTransitOrder(tc.from, tc.to))
+		})
+	}
+}
+
+func TestGORMOrderDAO_Transit(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(t *testing.T) *sql.DB
+		from int8
+		to   int8
+
+		wantErr error
+	}{
+		{
+			name: "迁移成功",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				return db
+			},
+			from: xytmodel.OrderStatePending,
+			to:   xytmodel.OrderStateCancelled,
+		},
+		{
+			name: "订单状态已变更",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return db
+			},
+			from:    xytmodel.OrderStatePending,
+			to:      xytmodel.OrderStateCancelled,
+			wantErr: app.ErrOrderStateChanged,
+		},
+		{
+			name: "不允许的迁移",
+			mock: func(t *testing.T) *sql.DB {
+				db, _, err := sqlmock.New()
+				assert.NoError(t, err)
+				return db
+			},
+			from:    xytmodel.OrderStateCancelled,
+			to:      xytmodel.OrderStatePaid,
+			wantErr: app.ErrOrderTransition,
+		},
+		{
+			name: "数据库错误",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+					WillReturnError(errors.New("数据库错误"))
+				return db
+			},
+			from:    xytmodel.OrderStatePending,
+			to:      xytmodel.OrderStatePaid,
+			wantErr: errors.New("数据库错误"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			err = NewOrderDAO(db).Transit(context.Background(), "123", tc.from, tc.to, "user", "test")
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
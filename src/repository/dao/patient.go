@@ -0,0 +1,241 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/solunara/isb/pkg/fieldcrypt"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 加密保存的就诊人字段, 重新加密时只更新这些列和实名号的索引
+var patientEncryptedColumns = []string{"certificates_no", "certificates_hash", "address", "contacts_certificates_no", "contacts_phone", "phone"}
+
+// 用户可以修改的就诊人字段
+var patientEditableColumns = []string{
+	"name", "province_code", "city_code", "district_code", "certificates_no", "certificates_hash",
+	"address", "contacts_name", "contacts_certificates_no", "contacts_phone", "birthday", "phone",
+	"certificates_type", "contacts_certificates_type", "sex", "is_marry", "is_insure", "relation",
+}
+
+type PatientDAO interface {
+	// FindByUser 用户的全部就诊人, 默认就诊人排在最前面
+	FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error)
+	FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error)
+	FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error)
+	// Insert 每个账号最多 maxPatients 个就诊人, 第一个就诊人设为默认就诊人
+	Insert(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error)
+	Update(ctx context.Context, p xytmodel.Patient) error
+	// Delete 删除默认就诊人后, 最早添加的就诊人成为默认就诊人
+	Delete(ctx context.Context, p xytmodel.Patient) error
+	SetDefault(ctx context.Context, userId, id string) error
+	// Reencrypt 用当前密钥重新加密全部就诊人并补全实名号索引, 返回处理的行数
+	Reencrypt(ctx context.Context, batchSize int) (int, error)
+}
+
+type GORMPatientDAO struct {
+	db *gorm.DB
+}
+
+func NewPatientDAO(db *gorm.DB) PatientDAO {
+	return &GORMPatientDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMPatientDAO) FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	var patients []xytmodel.Patient
+	err := dao.db.WithContext(ctx).Table(xytmodel.TablePatient).Where("user_id = ?", userId).
+		Order("is_default desc, created_at").Find(&patients).Error
+	return patients, err
+}
+
+// FindById 查询属于 userId 的就诊人, 其他用户的就诊人和不存在一样
+func (dao *GORMPatientDAO) FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	var patient xytmodel.Patient
+	if userId == "" || id == "" {
+		return patient, gorm.ErrRecordNotFound
+	}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TablePatient).
+		Where("id = ? and user_id = ?", id, userId).Take(&patient).Error
+	return patient, err
+}
+
+func (dao *GORMPatientDAO) FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	var patient xytmodel.Patient
+	if userId == "" {
+		return patient, gorm.ErrRecordNotFound
+	}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TablePatient).
+		Where("user_id = ? and is_default = ?", userId, true).Take(&patient).Error
+	return patient, err
+}
+
+func (dao *GORMPatientDAO) Insert(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error) {
+	p.CertificatesHash = certificatesHash(p.CertificatesNo)
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := LockXytUser(tx, p.UserId); err != nil {
+			return err
+		}
+		if err := checkPatientBinding(tx, p); err != nil {
+			return err
+		}
+		var count int64
+		err := tx.Table(xytmodel.TablePatient).Where("user_id = ?", p.UserId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= int64(maxPatients) {
+			return fmt.Errorf("%w, 每个账号最多添加%d个就诊人", app.ErrPatientLimit, maxPatients)
+		}
+		p.IsDefault = count == 0
+		return tx.Table(xytmodel.TablePatient).Create(&p).Error
+	})
+	// 并发绑定同一个实名号时由唯一索引拦住
+	if IsDuplicateKeyErr(err) {
+		return p, app.ErrPatientBound
+	}
+	return p, err
+}
+
+func (dao *GORMPatientDAO) Update(ctx context.Context, p xytmodel.Patient) error {
+	p.CertificatesHash = certificatesHash(p.CertificatesNo)
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkPatientBinding(tx, p); err != nil {
+			return err
+		}
+		// 指定列更新, 性别和关系等字段改为 0 时也要写入
+		return tx.Table(xytmodel.TablePatient).Where("id = ? and user_id = ?", p.Id, p.UserId).
+			Select(patientEditableColumns).Updates(&p).Error
+	})
+	if IsDuplicateKeyErr(err) {
+		return app.ErrPatientBound
+	}
+	return err
+}
+
+func (dao *GORMPatientDAO) Delete(ctx context.Context, p xytmodel.Patient) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(xytmodel.TablePatient).Where("id = ? and user_id = ?", p.Id, p.UserId).
+			Delete(&xytmodel.Patient{}).Error
+		if err != nil || !p.IsDefault {
+			return err
+		}
+		var next xytmodel.Patient
+		err = tx.Table(xytmodel.TablePatient).Select("id").Where("user_id = ?", p.UserId).
+			Order("created_at").Take(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Table(xytmodel.TablePatient).Where("id = ?", next.Id).Update("is_default", true).Error
+	})
+}
+
+func (dao *GORMPatientDAO) SetDefault(ctx context.Context, userId, id string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(xytmodel.TablePatient).Where("user_id = ? and is_default = ? and id <> ?", userId, true, id).
+			Update("is_default", false).Error
+		if err != nil {
+			return err
+		}
+		return tx.Table(xytmodel.TablePatient).Where("id = ? and user_id = ?", id, userId).
+			Update("is_default", true).Error
+	})
+}
+
+// Reencrypt 轮换密钥或者首次启用加密后执行
+func (dao *GORMPatientDAO) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 200
+	}
+	total := 0
+	lastId := ""
+	for {
+		var patients []xytmodel.Patient
+		err := dao.db.WithContext(ctx).Table(xytmodel.TablePatient).
+			Where("id > ?", lastId).Order("id").Limit(batchSize).Find(&patients).Error
+		if err != nil {
+			return total, err
+		}
+		for i := range patients {
+			patients[i].CertificatesHash = certificatesHash(patients[i].CertificatesNo)
+			err = dao.db.WithContext(ctx).Table(xytmodel.TablePatient).Where("id = ?", patients[i].Id).
+				Select(patientEncryptedColumns).Updates(&patients[i]).Error
+			if err != nil {
+				return total, err
+			}
+			total++
+		}
+		if len(patients) < batchSize {
+			return total, nil
+		}
+		lastId = patients[len(patients)-1].Id
+	}
+}
+
+// certificatesHash 实名号的索引, 实名号为空时为 NULL, 不参与唯一约束
+func certificatesHash(no string) sql.NullString {
+	if no == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: fieldcrypt.Index(no), Valid: true}
+}
+
+// LockXytUser 锁住用户, 同一用户并发添加就诊人、提交实名认证等操作时串行执行
+func LockXytUser(tx *gorm.DB, userId string) error {
+	var user xytmodel.XytUser
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table(xytmodel.TableXytUser).
+		Select("id").Where("user_id = ?", userId).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return app.ErrUserNotFound
+	}
+	return err
+}
+
+// checkPatientBinding 同一个实名号只能绑定到一个账号, 每个账号只能有一个本人
+func checkPatientBinding(tx *gorm.DB, patient xytmodel.Patient) error {
+	var bound xytmodel.Patient
+	err := tx.Table(xytmodel.TablePatient).Select("user_id").
+		Where("certificates_hash = ? and id <> ?", patient.CertificatesHash, patient.Id).Take(&bound).Error
+	switch {
+	case err == nil && bound.UserId == patient.UserId:
+		return app.ErrPatientExists
+	case err == nil:
+		return app.ErrPatientBound
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	if patient.Relation != xytmodel.PatientRelationSelf {
+		return nil
+	}
+	var count int64
+	err = tx.Table(xytmodel.TablePatient).
+		Where("user_id = ? and relation = ? and id <> ?", patient.UserId, xytmodel.PatientRelationSelf, patient.Id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return app.ErrPatientSelfExists
+	}
+	return nil
+}
+
+// IsDuplicateKeyErr 判断是否违反了唯一约束
+func IsDuplicateKeyErr(err error) bool {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		const duplicateErr uint16 = 1062
+		return me.Number == duplicateErr
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
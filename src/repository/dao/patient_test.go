@@ -0,0 +1,152 @@
+package dao
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/pkg/fieldcrypt"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestGORMPatientDAO_Insert(t *testing.T) {
+	const userId = "u1"
+	patient := xytmodel.Patient{
+		Id:             "p1",
+		UserId:         userId,
+		Name:           "张三",
+		CertificatesNo: "11010519491231002X",
+		Phone:          "13800138000",
+		Relation:       xytmodel.PatientRelationSelf,
+	}
+	hash := fieldcrypt.Index(patient.CertificatesNo)
+	expectBinding := func(mock sqlmock.Sqlmock, boundUser string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT `id` FROM `xyt_user` WHERE user_id = \\? LIMIT \\? FOR UPDATE").
+			WithArgs(userId, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		rows := sqlmock.NewRows([]string{"user_id"})
+		if boundUser != "" {
+			rows.AddRow(boundUser)
+		}
+		mock.ExpectQuery("SELECT `user_id` FROM `patient` WHERE certificates_hash = \\? and id <> \\?").
+			WithArgs(hash, patient.Id, 1).
+			WillReturnRows(rows)
+	}
+	testCases := []struct {
+		name        string
+		patient     xytmodel.Patient
+		mock        func(mock sqlmock.Sqlmock)
+		maxPatients int
+
+		wantErr     error
+		wantDefault bool
+	}{
+		{
+			name:        "添加第一个就诊人",
+			patient:     patient,
+			maxPatients: 5,
+			mock: func(mock sqlmock.Sqlmock) {
+				expectBinding(mock, "")
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `patient` WHERE user_id = \\? and relation = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `patient` WHERE user_id = \\?").
+					WithArgs(userId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec("INSERT INTO `patient`").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantDefault: true,
+		},
+		{
+			name:        "证件号已被其他账号绑定",
+			patient:     patient,
+			maxPatients: 5,
+			mock: func(mock sqlmock.Sqlmock) {
+				expectBinding(mock, "u2")
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrPatientBound,
+		},
+		{
+			name:        "同一账号重复添加",
+			patient:     patient,
+			maxPatients: 5,
+			mock: func(mock sqlmock.Sqlmock) {
+				expectBinding(mock, userId)
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrPatientExists,
+		},
+		{
+			name:        "已经添加过本人",
+			patient:     patient,
+			maxPatients: 5,
+			mock: func(mock sqlmock.Sqlmock) {
+				expectBinding(mock, "")
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `patient` WHERE user_id = \\? and relation = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrPatientSelfExists,
+		},
+		{
+			name: "就诊人数量达到上限",
+			patient: xytmodel.Patient{Id: "p2", UserId: userId, Name: "李四", CertificatesNo: "110101199003071233",
+				Sex: 1, Phone: "13800138000", Relation: xytmodel.PatientRelationChild},
+			maxPatients: 2,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `xyt_user` WHERE user_id = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT `user_id` FROM `patient` WHERE certificates_hash = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `patient` WHERE user_id = \\?").
+					WithArgs(userId).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrPatientLimit,
+		},
+		{
+			name:        "用户不存在",
+			patient:     patient,
+			maxPatients: 5,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `xyt_user` WHERE user_id = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrUserNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			p, err := NewPatientDAO(db).Insert(context.Background(), tc.patient, tc.maxPatients)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				assert.Equal(t, tc.wantDefault, p.IsDefault)
+				assert.Equal(t, hash, p.CertificatesHash.String)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
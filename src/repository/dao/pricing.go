@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PricingDAO interface {
+	FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error)
+	ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error)
+	// SaveType id 为 0 时新增, 否则修改
+	SaveType(ctx context.Context, t *xytmodel.RegistrationType) error
+	// FindFees 挂号类型下按医生和职称配置的挂号费
+	FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error)
+	// SaveFee 同一挂号类型下相同的医生或职称已经配置过时修改挂号费
+	SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error
+	DeleteFee(ctx context.Context, hosId string, id uint) error
+}
+
+type GORMPricingDAO struct {
+	db *gorm.DB
+}
+
+func NewPricingDAO(db *gorm.DB) PricingDAO {
+	return &GORMPricingDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMPricingDAO) FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var types []xytmodel.RegistrationType
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableRegistrationType).Where("id in ?", ids).Find(&types).Error
+	return types, err
+}
+
+func (dao *GORMPricingDAO) ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	var types = []xytmodel.RegistrationType{}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableRegistrationType).Where("hos_id = ?", hosId).Order("id").Find(&types).Error
+	return types, err
+}
+
+func (dao *GORMPricingDAO) SaveType(ctx context.Context, t *xytmodel.RegistrationType) error {
+	if t.Id == 0 {
+		return dao.db.WithContext(ctx).Create(t).Error
+	}
+	return dao.db.WithContext(ctx).Model(t).Select("name", "fee", "insurance_cover", "description").Updates(t).Error
+}
+
+func (dao *GORMPricingDAO) FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error) {
+	var fees = []xytmodel.RegistrationFee{}
+	if len(regTypeIds) == 0 {
+		return fees, nil
+	}
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableRegistrationFee).Where("reg_type_id in ?", regTypeIds).
+		Order("id").Find(&fees).Error
+	return fees, err
+}
+
+func (dao *GORMPricingDAO) SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error {
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "reg_type_id"}, {Name: "rank"}, {Name: "doc_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"fee", "updated_at"}),
+	}).Create(fee).Error
+}
+
+func (dao *GORMPricingDAO) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	res := dao.db.WithContext(ctx).Where("id = ? and hos_id = ?", id, hosId).Delete(&xytmodel.RegistrationFee{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"gorm.io/gorm"
+)
+
+type ScheduleDAO interface {
+	FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error)
+	// FindByDate 科室某天的排班, 按时段排序
+	FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error)
+	FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error)
+	FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error)
+	CountDoctors(ctx context.Context, hosId, deptId string) (int64, error)
+	// TakenSeqs 排班已经分配出去的号序, 按 sche_id 分组
+	TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error)
+}
+
+type GORMScheduleDAO struct {
+	db *gorm.DB
+}
+
+func NewScheduleDAO(db *gorm.DB) ScheduleDAO {
+	return &GORMScheduleDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMScheduleDAO) FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	var schedule xytmodel.Schedule
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableSchedule).Where("sche_id = ?", scheId).Take(&schedule).Error
+	return schedule, err
+}
+
+func (dao *GORMScheduleDAO) FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error) {
+	var schedules []xytmodel.Schedule
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableSchedule).
+		Where("hos_id = ? and dept_id = ? and work_date = ?", hosId, deptId, date).
+		Order("time_slot, id").Find(&schedules).Error
+	return schedules, err
+}
+
+func (dao *GORMScheduleDAO) FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error) {
+	var doctor xytmodel.Doctor
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableDoctor).Where("id = ?", id).Take(&doctor).Error
+	return doctor, err
+}
+
+func (dao *GORMScheduleDAO) FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var doctors []xytmodel.Doctor
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableDoctor).Where("id in ?", ids).Find(&doctors).Error
+	return doctors, err
+}
+
+func (dao *GORMScheduleDAO) CountDoctors(ctx context.Context, hosId, deptId string) (int64, error) {
+	var count int64
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableDoctor).
+		Where("hos_id = ? and dept_id = ?", hosId, deptId).Count(&count).Error
+	return count, err
+}
+
+func (dao *GORMScheduleDAO) TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error) {
+	var taken = make(map[string][]int, len(scheIds))
+	if len(scheIds) == 0 {
+		return taken, nil
+	}
+	var orders []xytmodel.RegisterOrder
+	err := dao.db.WithContext(ctx).Table(xytmodel.TableOrder).Select("sche_id", "seq_no").
+		Where("sche_id in ? and state in ? and seq_no > 0", scheIds, xytmodel.SeqHoldingStates).
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		taken[order.ScheId] = append(taken[order.ScheId], order.SeqNo)
+	}
+	return taken, nil
+}
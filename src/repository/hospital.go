@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type HospitalRepository interface {
+	FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error)
+	List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error)
+	Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error)
+	FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error)
+}
+
+type CachedHospitalRepository struct {
+	dao dao.HospitalDAO
+}
+
+func NewHospitalRepository(dao dao.HospitalDAO) HospitalRepository {
+	return &CachedHospitalRepository{
+		dao: dao,
+	}
+}
+
+func (repo *CachedHospitalRepository) FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error) {
+	return repo.dao.FindByUid(ctx, uid)
+}
+
+func (repo *CachedHospitalRepository) List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	return repo.dao.List(ctx, filter, offset, limit)
+}
+
+func (repo *CachedHospitalRepository) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	return repo.dao.Grades(ctx)
+}
+
+func (repo *CachedHospitalRepository) FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error) {
+	return repo.dao.FindDepartment(ctx, uid)
+}
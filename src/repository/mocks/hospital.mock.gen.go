@@ -0,0 +1,104 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/hospital.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/hospital.go -destination=src/repository/mocks/hospital.mock.gen.go -package=repomock
+//
+
+// Package repomock is a generated GoMock package.
+package repomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	dao "github.com/solunara/isb/src/repository/dao"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockHospitalRepository is a mock of HospitalRepository interface.
+type MockHospitalRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockHospitalRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockHospitalRepositoryMockRecorder is the mock recorder for MockHospitalRepository.
+type MockHospitalRepositoryMockRecorder struct {
+	mock *MockHospitalRepository
+}
+
+// NewMockHospitalRepository creates a new mock instance.
+func NewMockHospitalRepository(ctrl *gomock.Controller) *MockHospitalRepository {
+	mock := &MockHospitalRepository{ctrl: ctrl}
+	mock.recorder = &MockHospitalRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHospitalRepository) EXPECT() *MockHospitalRepositoryMockRecorder {
+	return m.recorder
+}
+
+// FindByUid mocks base method.
+func (m *MockHospitalRepository) FindByUid(ctx context.Context, uid string) (xytmodel.Hospital, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUid", ctx, uid)
+	ret0, _ := ret[0].(xytmodel.Hospital)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUid indicates an expected call of FindByUid.
+func (mr *MockHospitalRepositoryMockRecorder) FindByUid(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUid", reflect.TypeOf((*MockHospitalRepository)(nil).FindByUid), ctx, uid)
+}
+
+// FindDepartment mocks base method.
+func (m *MockHospitalRepository) FindDepartment(ctx context.Context, uid string) (xytmodel.Department, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDepartment", ctx, uid)
+	ret0, _ := ret[0].(xytmodel.Department)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDepartment indicates an expected call of FindDepartment.
+func (mr *MockHospitalRepositoryMockRecorder) FindDepartment(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDepartment", reflect.TypeOf((*MockHospitalRepository)(nil).FindDepartment), ctx, uid)
+}
+
+// Grades mocks base method.
+func (m *MockHospitalRepository) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grades", ctx)
+	ret0, _ := ret[0].([]xytmodel.HospitalGrade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Grades indicates an expected call of Grades.
+func (mr *MockHospitalRepositoryMockRecorder) Grades(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grades", reflect.TypeOf((*MockHospitalRepository)(nil).Grades), ctx)
+}
+
+// List mocks base method.
+func (m *MockHospitalRepository) List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]xytmodel.Hospital)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockHospitalRepositoryMockRecorder) List(ctx, filter, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockHospitalRepository)(nil).List), ctx, filter, offset, limit)
+}
@@ -0,0 +1,308 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/order.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/order.go -destination=src/repository/mocks/order.mock.gen.go -package=repomock
+//
+
+// Package repomock is a generated GoMock package.
+package repomock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	repository "github.com/solunara/isb/src/repository"
+	dao "github.com/solunara/isb/src/repository/dao"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockOrderRepository is a mock of OrderRepository interface.
+type MockOrderRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockOrderRepositoryMockRecorder is the mock recorder for MockOrderRepository.
+type MockOrderRepositoryMockRecorder struct {
+	mock *MockOrderRepository
+}
+
+// NewMockOrderRepository creates a new mock instance.
+func NewMockOrderRepository(ctrl *gomock.Controller) *MockOrderRepository {
+	mock := &MockOrderRepository{ctrl: ctrl}
+	mock.recorder = &MockOrderRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderRepository) EXPECT() *MockOrderRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CountActive mocks base method.
+func (m *MockOrderRepository) CountActive(ctx context.Context, patientId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountActive", ctx, patientId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountActive indicates an expected call of CountActive.
+func (mr *MockOrderRepositoryMockRecorder) CountActive(ctx, patientId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountActive", reflect.TypeOf((*MockOrderRepository)(nil).CountActive), ctx, patientId)
+}
+
+// CountActiveOnDate mocks base method.
+func (m *MockOrderRepository) CountActiveOnDate(ctx context.Context, patientId, date, docId, deptId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountActiveOnDate", ctx, patientId, date, docId, deptId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountActiveOnDate indicates an expected call of CountActiveOnDate.
+func (mr *MockOrderRepositoryMockRecorder) CountActiveOnDate(ctx, patientId, date, docId, deptId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountActiveOnDate", reflect.TypeOf((*MockOrderRepository)(nil).CountActiveOnDate), ctx, patientId, date, docId, deptId)
+}
+
+// FindById mocks base method.
+func (m *MockOrderRepository) FindById(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, userId, orderId)
+	ret0, _ := ret[0].(xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockOrderRepositoryMockRecorder) FindById(ctx, userId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockOrderRepository)(nil).FindById), ctx, userId, orderId)
+}
+
+// FindHistory mocks base method.
+func (m *MockOrderRepository) FindHistory(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindHistory", ctx, orderId)
+	ret0, _ := ret[0].([]xytmodel.OrderHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindHistory indicates an expected call of FindHistory.
+func (mr *MockOrderRepositoryMockRecorder) FindHistory(ctx, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindHistory", reflect.TypeOf((*MockOrderRepository)(nil).FindHistory), ctx, orderId)
+}
+
+// FindIdByIdempotencyKey mocks base method.
+func (m *MockOrderRepository) FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindIdByIdempotencyKey", ctx, userId, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindIdByIdempotencyKey indicates an expected call of FindIdByIdempotencyKey.
+func (mr *MockOrderRepositoryMockRecorder) FindIdByIdempotencyKey(ctx, userId, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindIdByIdempotencyKey", reflect.TypeOf((*MockOrderRepository)(nil).FindIdByIdempotencyKey), ctx, userId, key)
+}
+
+// FindPayment mocks base method.
+func (m *MockOrderRepository) FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPayment", ctx, orderId)
+	ret0, _ := ret[0].(xytmodel.OrderPayment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPayment indicates an expected call of FindPayment.
+func (mr *MockOrderRepositoryMockRecorder) FindPayment(ctx, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPayment", reflect.TypeOf((*MockOrderRepository)(nil).FindPayment), ctx, orderId)
+}
+
+// FindStaleRefunding mocks base method.
+func (m *MockOrderRepository) FindStaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindStaleRefunding", ctx, before, limit)
+	ret0, _ := ret[0].([]xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindStaleRefunding indicates an expected call of FindStaleRefunding.
+func (mr *MockOrderRepositoryMockRecorder) FindStaleRefunding(ctx, before, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindStaleRefunding", reflect.TypeOf((*MockOrderRepository)(nil).FindStaleRefunding), ctx, before, limit)
+}
+
+// Insert mocks base method.
+func (m *MockOrderRepository) Insert(ctx context.Context, order xytmodel.RegisterOrder) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", ctx, order)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Insert indicates an expected call of Insert.
+func (mr *MockOrderRepositoryMockRecorder) Insert(ctx, order any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockOrderRepository)(nil).Insert), ctx, order)
+}
+
+// InsertHistory mocks base method.
+func (m *MockOrderRepository) InsertHistory(ctx context.Context, history xytmodel.OrderHistory) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertHistory", ctx, history)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertHistory indicates an expected call of InsertHistory.
+func (mr *MockOrderRepositoryMockRecorder) InsertHistory(ctx, history any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertHistory", reflect.TypeOf((*MockOrderRepository)(nil).InsertHistory), ctx, history)
+}
+
+// List mocks base method.
+func (m *MockOrderRepository) List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockOrderRepositoryMockRecorder) List(ctx, filter, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockOrderRepository)(nil).List), ctx, filter, offset, limit)
+}
+
+// LockPatient mocks base method.
+func (m *MockOrderRepository) LockPatient(ctx context.Context, patientId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockPatient", ctx, patientId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockPatient indicates an expected call of LockPatient.
+func (mr *MockOrderRepositoryMockRecorder) LockPatient(ctx, patientId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockPatient", reflect.TypeOf((*MockOrderRepository)(nil).LockPatient), ctx, patientId)
+}
+
+// PromoteWaitlist mocks base method.
+func (m *MockOrderRepository) PromoteWaitlist(ctx context.Context, entryId int, orderId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PromoteWaitlist", ctx, entryId, orderId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PromoteWaitlist indicates an expected call of PromoteWaitlist.
+func (mr *MockOrderRepositoryMockRecorder) PromoteWaitlist(ctx, entryId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PromoteWaitlist", reflect.TypeOf((*MockOrderRepository)(nil).PromoteWaitlist), ctx, entryId, orderId)
+}
+
+// ReleaseSeat mocks base method.
+func (m *MockOrderRepository) ReleaseSeat(ctx context.Context, scheId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseSeat", ctx, scheId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseSeat indicates an expected call of ReleaseSeat.
+func (mr *MockOrderRepositoryMockRecorder) ReleaseSeat(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseSeat", reflect.TypeOf((*MockOrderRepository)(nil).ReleaseSeat), ctx, scheId)
+}
+
+// TakeSeat mocks base method.
+func (m *MockOrderRepository) TakeSeat(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeSeat", ctx, scheId)
+	ret0, _ := ret[0].(xytmodel.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeSeat indicates an expected call of TakeSeat.
+func (mr *MockOrderRepositoryMockRecorder) TakeSeat(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeSeat", reflect.TypeOf((*MockOrderRepository)(nil).TakeSeat), ctx, scheId)
+}
+
+// TakenSeqs mocks base method.
+func (m *MockOrderRepository) TakenSeqs(ctx context.Context, scheId string) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakenSeqs", ctx, scheId)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakenSeqs indicates an expected call of TakenSeqs.
+func (mr *MockOrderRepositoryMockRecorder) TakenSeqs(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakenSeqs", reflect.TypeOf((*MockOrderRepository)(nil).TakenSeqs), ctx, scheId)
+}
+
+// Transaction mocks base method.
+func (m *MockOrderRepository) Transaction(ctx context.Context, fn func(repository.OrderRepository) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Transaction indicates an expected call of Transaction.
+func (mr *MockOrderRepositoryMockRecorder) Transaction(ctx, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transaction", reflect.TypeOf((*MockOrderRepository)(nil).Transaction), ctx, fn)
+}
+
+// Transit mocks base method.
+func (m *MockOrderRepository) Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transit", ctx, orderId, from, to, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Transit indicates an expected call of Transit.
+func (mr *MockOrderRepositoryMockRecorder) Transit(ctx, orderId, from, to, actor, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transit", reflect.TypeOf((*MockOrderRepository)(nil).Transit), ctx, orderId, from, to, actor, reason)
+}
+
+// UpdateRefund mocks base method.
+func (m *MockOrderRepository) UpdateRefund(ctx context.Context, payment xytmodel.OrderPayment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRefund", ctx, payment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRefund indicates an expected call of UpdateRefund.
+func (mr *MockOrderRepositoryMockRecorder) UpdateRefund(ctx, payment any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRefund", reflect.TypeOf((*MockOrderRepository)(nil).UpdateRefund), ctx, payment)
+}
@@ -0,0 +1,144 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/patient.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/patient.go -destination=src/repository/mocks/patient.mock.gen.go -package=repomock
+//
+
+// Package repomock is a generated GoMock package.
+package repomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPatientRepository is a mock of PatientRepository interface.
+type MockPatientRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockPatientRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockPatientRepositoryMockRecorder is the mock recorder for MockPatientRepository.
+type MockPatientRepositoryMockRecorder struct {
+	mock *MockPatientRepository
+}
+
+// NewMockPatientRepository creates a new mock instance.
+func NewMockPatientRepository(ctrl *gomock.Controller) *MockPatientRepository {
+	mock := &MockPatientRepository{ctrl: ctrl}
+	mock.recorder = &MockPatientRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPatientRepository) EXPECT() *MockPatientRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockPatientRepository) Create(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, p, maxPatients)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockPatientRepositoryMockRecorder) Create(ctx, p, maxPatients any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPatientRepository)(nil).Create), ctx, p, maxPatients)
+}
+
+// Delete mocks base method.
+func (m *MockPatientRepository) Delete(ctx context.Context, p xytmodel.Patient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPatientRepositoryMockRecorder) Delete(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPatientRepository)(nil).Delete), ctx, p)
+}
+
+// FindById mocks base method.
+func (m *MockPatientRepository) FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, userId, id)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockPatientRepositoryMockRecorder) FindById(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockPatientRepository)(nil).FindById), ctx, userId, id)
+}
+
+// FindByUser mocks base method.
+func (m *MockPatientRepository) FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUser", ctx, userId)
+	ret0, _ := ret[0].([]xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUser indicates an expected call of FindByUser.
+func (mr *MockPatientRepositoryMockRecorder) FindByUser(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUser", reflect.TypeOf((*MockPatientRepository)(nil).FindByUser), ctx, userId)
+}
+
+// FindDefault mocks base method.
+func (m *MockPatientRepository) FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDefault", ctx, userId)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDefault indicates an expected call of FindDefault.
+func (mr *MockPatientRepositoryMockRecorder) FindDefault(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDefault", reflect.TypeOf((*MockPatientRepository)(nil).FindDefault), ctx, userId)
+}
+
+// SetDefault mocks base method.
+func (m *MockPatientRepository) SetDefault(ctx context.Context, userId, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDefault", ctx, userId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDefault indicates an expected call of SetDefault.
+func (mr *MockPatientRepositoryMockRecorder) SetDefault(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDefault", reflect.TypeOf((*MockPatientRepository)(nil).SetDefault), ctx, userId, id)
+}
+
+// Update mocks base method.
+func (m *MockPatientRepository) Update(ctx context.Context, p xytmodel.Patient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPatientRepositoryMockRecorder) Update(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPatientRepository)(nil).Update), ctx, p)
+}
@@ -0,0 +1,129 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/pricing.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/pricing.go -destination=src/repository/mocks/pricing.mock.gen.go -package=repomock
+//
+
+// Package repomock is a generated GoMock package.
+package repomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPricingRepository is a mock of PricingRepository interface.
+type MockPricingRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockPricingRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockPricingRepositoryMockRecorder is the mock recorder for MockPricingRepository.
+type MockPricingRepositoryMockRecorder struct {
+	mock *MockPricingRepository
+}
+
+// NewMockPricingRepository creates a new mock instance.
+func NewMockPricingRepository(ctrl *gomock.Controller) *MockPricingRepository {
+	mock := &MockPricingRepository{ctrl: ctrl}
+	mock.recorder = &MockPricingRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPricingRepository) EXPECT() *MockPricingRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteFee mocks base method.
+func (m *MockPricingRepository) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFee", ctx, hosId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFee indicates an expected call of DeleteFee.
+func (mr *MockPricingRepositoryMockRecorder) DeleteFee(ctx, hosId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFee", reflect.TypeOf((*MockPricingRepository)(nil).DeleteFee), ctx, hosId, id)
+}
+
+// FindFees mocks base method.
+func (m *MockPricingRepository) FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindFees", ctx, regTypeIds)
+	ret0, _ := ret[0].([]xytmodel.RegistrationFee)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindFees indicates an expected call of FindFees.
+func (mr *MockPricingRepositoryMockRecorder) FindFees(ctx, regTypeIds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindFees", reflect.TypeOf((*MockPricingRepository)(nil).FindFees), ctx, regTypeIds)
+}
+
+// FindTypes mocks base method.
+func (m *MockPricingRepository) FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTypes", ctx, ids)
+	ret0, _ := ret[0].([]xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTypes indicates an expected call of FindTypes.
+func (mr *MockPricingRepositoryMockRecorder) FindTypes(ctx, ids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTypes", reflect.TypeOf((*MockPricingRepository)(nil).FindTypes), ctx, ids)
+}
+
+// ListTypes mocks base method.
+func (m *MockPricingRepository) ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTypes", ctx, hosId)
+	ret0, _ := ret[0].([]xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTypes indicates an expected call of ListTypes.
+func (mr *MockPricingRepositoryMockRecorder) ListTypes(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTypes", reflect.TypeOf((*MockPricingRepository)(nil).ListTypes), ctx, hosId)
+}
+
+// SaveFee mocks base method.
+func (m *MockPricingRepository) SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveFee", ctx, fee)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveFee indicates an expected call of SaveFee.
+func (mr *MockPricingRepositoryMockRecorder) SaveFee(ctx, fee any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveFee", reflect.TypeOf((*MockPricingRepository)(nil).SaveFee), ctx, fee)
+}
+
+// SaveType mocks base method.
+func (m *MockPricingRepository) SaveType(ctx context.Context, t *xytmodel.RegistrationType) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveType", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveType indicates an expected call of SaveType.
+func (mr *MockPricingRepositoryMockRecorder) SaveType(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveType", reflect.TypeOf((*MockPricingRepository)(nil).SaveType), ctx, t)
+}
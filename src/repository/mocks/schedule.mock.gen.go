@@ -0,0 +1,132 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/repository/schedule.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/repository/schedule.go -destination=src/repository/mocks/schedule.mock.gen.go -package=repomock
+//
+
+// Package repomock is a generated GoMock package.
+package repomock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockScheduleRepository is a mock of ScheduleRepository interface.
+type MockScheduleRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockScheduleRepositoryMockRecorder is the mock recorder for MockScheduleRepository.
+type MockScheduleRepositoryMockRecorder struct {
+	mock *MockScheduleRepository
+}
+
+// NewMockScheduleRepository creates a new mock instance.
+func NewMockScheduleRepository(ctrl *gomock.Controller) *MockScheduleRepository {
+	mock := &MockScheduleRepository{ctrl: ctrl}
+	mock.recorder = &MockScheduleRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleRepository) EXPECT() *MockScheduleRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CountDoctors mocks base method.
+func (m *MockScheduleRepository) CountDoctors(ctx context.Context, hosId, deptId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountDoctors", ctx, hosId, deptId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountDoctors indicates an expected call of CountDoctors.
+func (mr *MockScheduleRepositoryMockRecorder) CountDoctors(ctx, hosId, deptId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountDoctors", reflect.TypeOf((*MockScheduleRepository)(nil).CountDoctors), ctx, hosId, deptId)
+}
+
+// FindByDate mocks base method.
+func (m *MockScheduleRepository) FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByDate", ctx, hosId, deptId, date)
+	ret0, _ := ret[0].([]xytmodel.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByDate indicates an expected call of FindByDate.
+func (mr *MockScheduleRepositoryMockRecorder) FindByDate(ctx, hosId, deptId, date any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByDate", reflect.TypeOf((*MockScheduleRepository)(nil).FindByDate), ctx, hosId, deptId, date)
+}
+
+// FindById mocks base method.
+func (m *MockScheduleRepository) FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, scheId)
+	ret0, _ := ret[0].(xytmodel.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockScheduleRepositoryMockRecorder) FindById(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockScheduleRepository)(nil).FindById), ctx, scheId)
+}
+
+// FindDoctor mocks base method.
+func (m *MockScheduleRepository) FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDoctor", ctx, id)
+	ret0, _ := ret[0].(xytmodel.Doctor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDoctor indicates an expected call of FindDoctor.
+func (mr *MockScheduleRepositoryMockRecorder) FindDoctor(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDoctor", reflect.TypeOf((*MockScheduleRepository)(nil).FindDoctor), ctx, id)
+}
+
+// FindDoctors mocks base method.
+func (m *MockScheduleRepository) FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDoctors", ctx, ids)
+	ret0, _ := ret[0].([]xytmodel.Doctor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDoctors indicates an expected call of FindDoctors.
+func (mr *MockScheduleRepositoryMockRecorder) FindDoctors(ctx, ids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDoctors", reflect.TypeOf((*MockScheduleRepository)(nil).FindDoctors), ctx, ids)
+}
+
+// TakenSeqs mocks base method.
+func (m *MockScheduleRepository) TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakenSeqs", ctx, scheIds)
+	ret0, _ := ret[0].(map[string][]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakenSeqs indicates an expected call of TakenSeqs.
+func (mr *MockScheduleRepositoryMockRecorder) TakenSeqs(ctx, scheIds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakenSeqs", reflect.TypeOf((*MockScheduleRepository)(nil).TakenSeqs), ctx, scheIds)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type OrderRepository interface {
+	// Transaction 在同一个事务中执行 fn, fn 返回错误时回滚
+	Transaction(ctx context.Context, fn func(repo OrderRepository) error) error
+	FindById(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error)
+	List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error)
+	FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error)
+	TakeSeat(ctx context.Context, scheId string) (xytmodel.Schedule, error)
+	ReleaseSeat(ctx context.Context, scheId string) error
+	TakenSeqs(ctx context.Context, scheId string) ([]int, error)
+	Insert(ctx context.Context, order xytmodel.RegisterOrder) error
+	Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error
+	InsertHistory(ctx context.Context, history xytmodel.OrderHistory) error
+	FindHistory(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error)
+	LockPatient(ctx context.Context, patientId string) error
+	CountActive(ctx context.Context, patientId string) (int64, error)
+	CountActiveOnDate(ctx context.Context, patientId, date, docId, deptId string) (int64, error)
+	PromoteWaitlist(ctx context.Context, entryId int, orderId string) error
+	FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error)
+	UpdateRefund(ctx context.Context, payment xytmodel.OrderPayment) error
+	FindStaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error)
+}
+
+type CachedOrderRepository struct {
+	dao dao.OrderDAO
+}
+
+func NewOrderRepository(dao dao.OrderDAO) OrderRepository {
+	return &CachedOrderRepository{
+		dao: dao,
+	}
+}
+
+func (repo *CachedOrderRepository) Transaction(ctx context.Context, fn func(repo OrderRepository) error) error {
+	return repo.dao.Transaction(ctx, func(tx dao.OrderDAO) error {
+		return fn(NewOrderRepository(tx))
+	})
+}
+
+func (repo *CachedOrderRepository) FindById(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	return repo.dao.FindById(ctx, userId, orderId)
+}
+
+func (repo *CachedOrderRepository) List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error) {
+	return repo.dao.List(ctx, filter, offset, limit)
+}
+
+func (repo *CachedOrderRepository) FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error) {
+	return repo.dao.FindIdByIdempotencyKey(ctx, userId, key)
+}
+
+func (repo *CachedOrderRepository) TakeSeat(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	return repo.dao.TakeSeat(ctx, scheId)
+}
+
+func (repo *CachedOrderRepository) ReleaseSeat(ctx context.Context, scheId string) error {
+	return repo.dao.ReleaseSeat(ctx, scheId)
+}
+
+func (repo *CachedOrderRepository) TakenSeqs(ctx context.Context, scheId string) ([]int, error) {
+	return repo.dao.TakenSeqs(ctx, scheId)
+}
+
+func (repo *CachedOrderRepository) Insert(ctx context.Context, order xytmodel.RegisterOrder) error {
+	return repo.dao.Insert(ctx, order)
+}
+
+func (repo *CachedOrderRepository) Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error {
+	return repo.dao.Transit(ctx, orderId, from, to, actor, reason)
+}
+
+func (repo *CachedOrderRepository) InsertHistory(ctx context.Context, history xytmodel.OrderHistory) error {
+	return repo.dao.InsertHistory(ctx, history)
+}
+
+func (repo *CachedOrderRepository) FindHistory(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error) {
+	return repo.dao.FindHistory(ctx, orderId)
+}
+
+func (repo *CachedOrderRepository) LockPatient(ctx context.Context, patientId string) error {
+	return repo.dao.LockPatient(ctx, patientId)
+}
+
+func (repo *CachedOrderRepository) CountActive(ctx context.Context, patientId string) (int64, error) {
+	return repo.dao.CountActive(ctx, patientId)
+}
+
+func (repo *CachedOrderRepository) CountActiveOnDate(ctx context.Context, patientId, date, docId, deptId string) (int64, error) {
+	return repo.dao.CountActiveOnDate(ctx, patientId, date, docId, deptId)
+}
+
+func (repo *CachedOrderRepository) PromoteWaitlist(ctx context.Context, entryId int, orderId string) error {
+	return repo.dao.PromoteWaitlist(ctx, entryId, orderId)
+}
+
+func (repo *CachedOrderRepository) FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error) {
+	return repo.dao.FindPayment(ctx, orderId)
+}
+
+func (repo *CachedOrderRepository) UpdateRefund(ctx context.Context, payment xytmodel.OrderPayment) error {
+	return repo.dao.UpdateRefund(ctx, payment)
+}
+
+func (repo *CachedOrderRepository) FindStaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error) {
+	return repo.dao.FindStaleRefunding(ctx, before, limit)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type PatientRepository interface {
+	FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error)
+	FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error)
+	FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error)
+	Create(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error)
+	Update(ctx context.Context, p xytmodel.Patient) error
+	Delete(ctx context.Context, p xytmodel.Patient) error
+	SetDefault(ctx context.Context, userId, id string) error
+}
+
+type CachedPatientRepository struct {
+	dao dao.PatientDAO
+}
+
+func NewPatientRepository(dao dao.PatientDAO) PatientRepository {
+	return &CachedPatientRepository{
+		dao: dao,
+	}
+}
+
+func (repo *CachedPatientRepository) FindByUser(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	return repo.dao.FindByUser(ctx, userId)
+}
+
+func (repo *CachedPatientRepository) FindById(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	return repo.dao.FindById(ctx, userId, id)
+}
+
+func (repo *CachedPatientRepository) FindDefault(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	return repo.dao.FindDefault(ctx, userId)
+}
+
+func (repo *CachedPatientRepository) Create(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error) {
+	return repo.dao.Insert(ctx, p, maxPatients)
+}
+
+func (repo *CachedPatientRepository) Update(ctx context.Context, p xytmodel.Patient) error {
+	return repo.dao.Update(ctx, p)
+}
+
+func (repo *CachedPatientRepository) Delete(ctx context.Context, p xytmodel.Patient) error {
+	return repo.dao.Delete(ctx, p)
+}
+
+func (repo *CachedPatientRepository) SetDefault(ctx context.Context, userId, id string) error {
+	return repo.dao.SetDefault(ctx, userId, id)
+}
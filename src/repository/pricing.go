@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type PricingRepository interface {
+	FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error)
+	ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error)
+	SaveType(ctx context.Context, t *xytmodel.RegistrationType) error
+	FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error)
+	SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error
+	DeleteFee(ctx context.Context, hosId string, id uint) error
+}
+
+type CachedPricingRepository struct {
+	dao dao.PricingDAO
+}
+
+func NewPricingRepository(dao dao.PricingDAO) PricingRepository {
+	return &CachedPricingRepository{
+		dao: dao,
+	}
+}
+
+func (repo *CachedPricingRepository) FindTypes(ctx context.Context, ids []uint) ([]xytmodel.RegistrationType, error) {
+	return repo.dao.FindTypes(ctx, ids)
+}
+
+func (repo *CachedPricingRepository) ListTypes(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	return repo.dao.ListTypes(ctx, hosId)
+}
+
+func (repo *CachedPricingRepository) SaveType(ctx context.Context, t *xytmodel.RegistrationType) error {
+	return repo.dao.SaveType(ctx, t)
+}
+
+func (repo *CachedPricingRepository) FindFees(ctx context.Context, regTypeIds []uint) ([]xytmodel.RegistrationFee, error) {
+	return repo.dao.FindFees(ctx, regTypeIds)
+}
+
+func (repo *CachedPricingRepository) SaveFee(ctx context.Context, fee *xytmodel.RegistrationFee) error {
+	return repo.dao.SaveFee(ctx, fee)
+}
+
+func (repo *CachedPricingRepository) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	return repo.dao.DeleteFee(ctx, hosId, id)
+}
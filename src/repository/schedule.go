@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type ScheduleRepository interface {
+	FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error)
+	FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error)
+	FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error)
+	FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error)
+	CountDoctors(ctx context.Context, hosId, deptId string) (int64, error)
+	TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error)
+}
+
+type CachedScheduleRepository struct {
+	dao dao.ScheduleDAO
+}
+
+func NewScheduleRepository(dao dao.ScheduleDAO) ScheduleRepository {
+	return &CachedScheduleRepository{
+		dao: dao,
+	}
+}
+
+func (repo *CachedScheduleRepository) FindById(ctx context.Context, scheId string) (xytmodel.Schedule, error) {
+	return repo.dao.FindById(ctx, scheId)
+}
+
+func (repo *CachedScheduleRepository) FindByDate(ctx context.Context, hosId, deptId, date string) ([]xytmodel.Schedule, error) {
+	return repo.dao.FindByDate(ctx, hosId, deptId, date)
+}
+
+func (repo *CachedScheduleRepository) FindDoctor(ctx context.Context, id string) (xytmodel.Doctor, error) {
+	return repo.dao.FindDoctor(ctx, id)
+}
+
+func (repo *CachedScheduleRepository) FindDoctors(ctx context.Context, ids []string) ([]xytmodel.Doctor, error) {
+	return repo.dao.FindDoctors(ctx, ids)
+}
+
+func (repo *CachedScheduleRepository) CountDoctors(ctx context.Context, hosId, deptId string) (int64, error) {
+	return repo.dao.CountDoctors(ctx, hosId, deptId)
+}
+
+func (repo *CachedScheduleRepository) TakenSeqs(ctx context.Context, scheIds []string) (map[string][]int, error) {
+	return repo.dao.TakenSeqs(ctx, scheIds)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/web/xytweb"
+	"github.com/spf13/viper"
+)
+
+// Import 命令行批量导入, 用法: isb [-c config] import -kind hospital|department|doctor file...
+// 文件按顺序导入, 报告以 json 输出到标准输出; 有失败的行时退出码为 1.
+// 搜索索引由运行中的服务按更新时间增量同步
+func Import(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := fs.String("kind", "", "数据类型: hospital, department 或 doctor")
+	batchSize := fs.Int("batch", 0, "每批写入的行数, 默认使用配置 xyt.import_batch_size")
+	_ = fs.Parse(args)
+	if *kind == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := InitConfig(nil); err != nil {
+		log.Fatalf("[Err] init config: %v", err)
+	}
+	db, err := InitDB(InitLogger())
+	if err != nil {
+		log.Fatalf("[Err] init db client: %v", err)
+	}
+	redisCli, err := InitRedis()
+	if err != nil {
+		log.Fatalf("[Err] init redis client: %v", err)
+	}
+	if *batchSize <= 0 {
+		*batchSize = viper.GetInt("xyt.import_batch_size")
+	}
+	importer := xytweb.NewImporter(db, cache.NewDepartmentCache(redisCli), *batchSize)
+
+	failed := false
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for _, name := range fs.Args() {
+		format, ok := xytweb.ImportFormatByName(name)
+		if !ok {
+			log.Fatalf("[Err] %s: 只支持 csv 和 json 文件", name)
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			log.Fatalf("[Err] %v", err)
+		}
+		report, err := importer.Import(context.Background(), xytweb.ImportKind(*kind), format, file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("[Err] import %s: %v", name, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: 共 %d 行, 导入 %d 行, 失败 %d 行\n", name, report.Total, report.Imported, report.Failed)
+		if err = enc.Encode(report); err != nil {
+			log.Fatalf("[Err] %v", err)
+		}
+		failed = failed || report.Failed > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -3,7 +3,6 @@ package server
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
@@ -11,9 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ecodeclub/ekit"
 	"github.com/gin-contrib/sessions"
 	sessionsredis "github.com/gin-contrib/sessions/redis"
+	"github.com/olivere/elastic/v7"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/solunara/isb/pkg/fieldcrypt"
 	"github.com/solunara/isb/pkg/logger"
 	"github.com/solunara/isb/pkg/metric"
 	"github.com/solunara/isb/pkg/ratelimit"
@@ -26,6 +32,9 @@ import (
 	"github.com/solunara/isb/src/repository/dao"
 	"github.com/solunara/isb/src/service"
 	"github.com/solunara/isb/src/service/oauth2/wechat"
+	"github.com/solunara/isb/src/service/payment/localpay"
+	"github.com/solunara/isb/src/service/region"
+	"github.com/solunara/isb/src/service/search"
 	"github.com/solunara/isb/src/service/sms/localsms"
 	"github.com/solunara/isb/src/service/sms/ratelimitSms"
 	"github.com/solunara/isb/src/web"
@@ -152,6 +161,9 @@ func InitPrometheus() {
 	}()
 }
 
+// 上传文件的访问路径, 不需要登录
+const xytStaticPath = "/xyt/static"
+
 func InitMiddlewares(redisCmd redis.Cmdable, store sessionsredis.Store, l logger.Logger) []gin.HandlerFunc {
 	bd := middleware.NewLogBuilder(func(ctx context.Context, al *middleware.AccessLog) {
 		l.Debug("HTTP请求", logger.Field{Key: "al", Val: al})
@@ -185,7 +197,13 @@ func InitMiddlewares(redisCmd redis.Cmdable, store sessionsredis.Store, l logger
 			IgnorePaths("/xyt/hos/region").
 			IgnorePaths("/xyt/hos/detail").
 			IgnorePaths("/xyt/hos/department").
+			IgnorePaths("/xyt/hos/search").
+			IgnorePaths("/xyt/hos/doctor/search").
+			IgnorePaths("/xyt/hos/doctor/detail").
+			IgnorePaths("/xyt/hos/doctor/reviews").
+			IgnorePaths("/xyt/pay/notify").
 			IgnorePaths("/hll/user/login").
+			IgnorePathPrefix(xytStaticPath + "/").
 			Build(),
 		//ratelimit.NewBuilder(redisClient, time.Second, 100).Build(),
 	}
@@ -242,6 +260,77 @@ func InitWechatService() wechat.Service {
 	return wechat.NewOauth2WechatService(appId, appKey, http.DefaultClient)
 }
 
+func InitRefundPolicy() xytweb.RefundPolicy {
+	policy := xytweb.DefaultRefundPolicy()
+	if viper.IsSet("xyt.refund_full_before") {
+		policy.FullBefore = viper.GetDuration("xyt.refund_full_before")
+	}
+	if viper.IsSet("xyt.refund_partial_percent") {
+		policy.PartialPercent = viper.GetInt("xyt.refund_partial_percent")
+	}
+	return policy
+}
+
+// InitFieldCrypt 就诊人敏感字段的加密密钥, 轮换时新增密钥并修改 current, 再执行 isb rekey
+// viper 读出的 map 键是小写的, 密钥 id 统一按小写处理
+func InitFieldCrypt() error {
+	current := strings.ToLower(viper.GetString("xyt.field_crypt.current"))
+	keyring, err := fieldcrypt.NewKeyring(current, viper.GetStringMapString("xyt.field_crypt.keys"), viper.GetString("xyt.field_crypt.index_key"))
+	if err != nil {
+		return err
+	}
+	fieldcrypt.SetDefault(keyring)
+	return nil
+}
+
+func InitBookingGuard(db *gorm.DB, orderRepo repository.OrderRepository, cace redis.Cmdable, certifier *xytweb.Certifier) *xytweb.BookingGuard {
+	viper.SetDefault("xyt.booking.max_active_orders", 3)
+	viper.SetDefault("xyt.booking.max_no_shows", 3)
+	viper.SetDefault("xyt.booking.no_show_window", 90*24*time.Hour)
+	viper.SetDefault("xyt.booking.no_show_ban", 30*24*time.Hour)
+	viper.SetDefault("xyt.booking.rate_interval", time.Minute)
+	viper.SetDefault("xyt.booking.rate", 10)
+	return xytweb.NewBookingGuard(db,
+		xytweb.NewRateRule(ratelimit.NewRedisSlideWindowLimit(cace, viper.GetDuration("xyt.booking.rate_interval"), viper.GetInt("xyt.booking.rate"))),
+		xytweb.NewMaxActiveOrdersRule(orderRepo, viper.GetInt("xyt.booking.max_active_orders")),
+		xytweb.NewDuplicateVisitRule(orderRepo),
+		xytweb.NewNoShowRule(db, viper.GetInt("xyt.booking.max_no_shows"), viper.GetDuration("xyt.booking.no_show_window"), viper.GetDuration("xyt.booking.no_show_ban")),
+		xytweb.NewCertificationRule(db, certifier),
+	)
+}
+
+// InitObjectStorage 证件照片等不公开文件的存储, s3 的密钥从环境变量 COS_APP_ID 和 COS_APP_SECRET 读取
+func InitObjectStorage() xytweb.ObjectStorage {
+	viper.SetDefault("xyt.object_storage.dir", "./private")
+	if viper.GetString("xyt.object_storage.type") != "s3" {
+		return xytweb.NewLocalObjectStorage(viper.GetString("xyt.object_storage.dir"))
+	}
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(os.Getenv("COS_APP_ID"), os.Getenv("COS_APP_SECRET"), ""),
+		Region:      ekit.ToPtr[string](viper.GetString("xyt.object_storage.region")),
+		Endpoint:    ekit.ToPtr[string](viper.GetString("xyt.object_storage.endpoint")),
+		// 强制使用 /bucket/key 的形态
+		S3ForcePathStyle: ekit.ToPtr[bool](true),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return xytweb.NewS3ObjectStorage(s3.New(sess), viper.GetString("xyt.object_storage.bucket"))
+}
+
+func InitSearchService() search.Service {
+	viper.SetDefault("es.addresses", []string{"http://localhost:9200"})
+	client, err := elastic.NewClient(
+		elastic.SetURL(viper.GetStringSlice("es.addresses")...),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return search.NewElasticService(client)
+}
+
 func InitRouters(ginEngine *gin.Engine, db *gorm.DB, cace redis.Cmdable) {
 	// vbook-api
 	userCache := cache.NewUserCache(cace)
@@ -270,15 +359,134 @@ func InitRouters(ginEngine *gin.Engine, db *gorm.DB, cace redis.Cmdable) {
 
 	// xyt-api
 	xytGroup := ginEngine.Group("/xyt")
-	xytHospitalCtrl := xytweb.NewXytHospitalHandler(db)
+	findRole := func(ctx context.Context, userId string) (string, error) {
+		u, err := hllweb.FindUserById(db.WithContext(ctx), userId)
+		if err != nil || u.State != "active" {
+			return "", err
+		}
+		return u.Role, nil
+	}
+	// 管理后台只允许管理员访问, 每次写操作都记录审计日志
+	xytAdminGroup := xytGroup.Group("/admin",
+		middleware.NewRoleBuilder(findRole).Allow(hllmodel.RoleAdmin).Build(),
+		middleware.NewAuditBuilder(xytweb.NewAdminAuditRecorder(db)).Build(),
+	)
+	// 实名认证审核, 管理员和审核员都可以访问
+	xytReviewGroup := xytGroup.Group("/review",
+		middleware.NewRoleBuilder(findRole).Allow(hllmodel.RoleAdmin).Allow(hllmodel.RoleReviewer).Build(),
+		middleware.NewAuditBuilder(xytweb.NewAdminAuditRecorder(db)).Build(),
+	)
+	// 诊室叫号工作站, 医生和管理员都可以访问, 医生只能操作自己出诊的排班
+	xytStationGroup := xytGroup.Group("/station",
+		middleware.NewRoleBuilder(findRole).Allow(hllmodel.RoleAdmin).Allow(hllmodel.RoleDoctor).Build(),
+		middleware.NewAuditBuilder(xytweb.NewAdminAuditRecorder(db)).Build(),
+	)
+	// 只有医生可以填写就诊记录, 医生只能查看和填写自己接诊的就诊人的就诊记录
+	xytClinicGroup := xytGroup.Group("/clinic",
+		middleware.NewRoleBuilder(findRole).Allow(hllmodel.RoleDoctor).Build(),
+		middleware.NewAuditBuilder(xytweb.NewAdminAuditRecorder(db)).Build(),
+	)
+	viper.SetDefault("xyt.max_patients_per_user", 5)
+	hospitalRepo := repository.NewHospitalRepository(dao.NewHospitalDAO(db))
+	scheduleRepo := repository.NewScheduleRepository(dao.NewScheduleDAO(db))
+	patientRepo := repository.NewPatientRepository(dao.NewPatientDAO(db))
+	orderRepo := repository.NewOrderRepository(dao.NewOrderDAO(db))
+	pricingRepo := repository.NewPricingRepository(dao.NewPricingDAO(db))
+	hospitalSvc := service.NewHospitalService(hospitalRepo)
+	scheduleSvc := service.NewScheduleService(scheduleRepo, hospitalRepo)
+	patientSvc := service.NewPatientService(patientRepo, viper.GetInt("xyt.max_patients_per_user"))
+	pricingSvc := service.NewPricingService(pricingRepo, scheduleRepo)
+	orderSvc := service.NewOrderService(orderRepo, patientRepo, scheduleSvc, pricingSvc)
+
+	objectStorage := InitObjectStorage()
+	certifier := xytweb.NewCertifier(db, objectStorage, xytweb.NewFakeVerifier())
+	orderBooker := xytweb.NewOrderBooker(db, cache.NewInventoryCache(cace), orderSvc)
+	orderBooker.Start(context.Background())
+	waitlist := xytweb.NewWaitlist(db, orderSvc, ratelimitSmsSvc, viper.GetDuration("xyt.waitlist_confirm_window"))
+	orderBooker.UseWaitlist(waitlist)
+	bookingGuard := InitBookingGuard(db, orderRepo, cace, certifier)
+	orderBooker.UseGuard(bookingGuard)
+	waitlist.UseGuard(bookingGuard)
+	xytweb.NewOrderExpirer(db, orderSvc, orderBooker, viper.GetDuration("xyt.order_pay_timeout")).Start(context.Background())
+	paySvc := localpay.NewService(viper.GetString("xyt.localpay_secret"))
+	orderRefunder := xytweb.NewOrderRefunder(orderSvc, paySvc, orderBooker, InitRefundPolicy())
+	orderRefunder.Start(context.Background())
+	departmentManager := xytweb.NewDepartmentManager(db, cache.NewDepartmentCache(cace))
+	xytHospitalCtrl := xytweb.NewXytHospitalHandler(hospitalSvc, scheduleSvc, orderSvc, pricingSvc, orderBooker, orderRefunder, departmentManager)
 	xytHospitalCtrl.RegisterRoutes(xytGroup)
 
-	xytUserCtrl := xytweb.NewXytUserlHandler(cace, db)
+	xytDepartmentAdminCtrl := xytweb.NewXytDepartmentAdminHandler(departmentManager)
+	xytDepartmentAdminCtrl.RegisterRoutes(xytAdminGroup)
+
+	xytDoctorCtrl := xytweb.NewXytDoctorHandler(db, pricingSvc)
+	xytDoctorCtrl.RegisterRoutes(xytGroup)
+
+	xytPricingCtrl := xytweb.NewXytPricingHandler(pricingSvc, scheduleSvc, patientSvc)
+	xytPricingCtrl.RegisterRoutes(xytGroup)
+	xytPricingCtrl.RegisterAdminRoutes(xytAdminGroup)
+
+	xytBookingAdminCtrl := xytweb.NewXytBookingAdminHandler(db)
+	xytBookingAdminCtrl.RegisterRoutes(xytAdminGroup)
+
+	xytWaitlistCtrl := xytweb.NewXytWaitlistHandler(waitlist)
+	xytWaitlistCtrl.RegisterRoutes(xytGroup)
+
+	visitQueue := xytweb.NewVisitQueue(db, viper.GetString("xyt.checkin_secret"), viper.GetDuration("xyt.checkin_grace"))
+	visitQueue.Start(context.Background())
+	xytQueueCtrl := xytweb.NewXytQueueHandler(visitQueue, orderSvc)
+	xytQueueCtrl.RegisterRoutes(xytGroup)
+	xytQueueCtrl.RegisterStationRoutes(xytStationGroup)
+
+	notificationCenter := xytweb.NewNotificationCenter(db, ratelimitSmsSvc, viper.GetDuration("xyt.notify_remind_before"))
+	notificationCenter.Start(context.Background())
+	xytNotificationCtrl := xytweb.NewXytNotificationHandler(notificationCenter)
+	xytNotificationCtrl.RegisterRoutes(xytGroup)
+
+	xytMedicalRecordCtrl := xytweb.NewXytMedicalRecordHandler(xytweb.NewMedicalRecords(db, objectStorage))
+	xytMedicalRecordCtrl.RegisterRoutes(xytGroup)
+	xytMedicalRecordCtrl.RegisterDoctorRoutes(xytClinicGroup)
+
+	xytPayCtrl := xytweb.NewXytPayHandler(db, paySvc)
+	xytPayCtrl.RegisterRoutes(xytGroup)
+
+	xytUserCtrl := xytweb.NewXytUserlHandler(cace, db, patientSvc, orderSvc)
 	xytUserCtrl.RegisterRoutes(xytGroup)
 
-	xytCityCtrl := xytweb.NewXytCiteslHandler(db)
+	xytCertificationCtrl := xytweb.NewXytCertificationHandler(db, certifier)
+	xytCertificationCtrl.RegisterRoutes(xytGroup)
+	xytCertificationCtrl.RegisterReviewRoutes(xytReviewGroup)
+
+	regionSvc := region.NewService(db, cache.NewRegionCache(cace))
+	xytCityCtrl := xytweb.NewXytCiteslHandler(regionSvc)
 	xytCityCtrl.RegisterRoutes(xytGroup)
 
+	xytRegionAdminCtrl := xytweb.NewXytRegionAdminHandler(regionSvc)
+	xytRegionAdminCtrl.RegisterRoutes(xytAdminGroup)
+
+	rosterGenerator := xytweb.NewRosterGenerator(db, xytweb.MaxSchedulerDays)
+	rosterGenerator.Start(context.Background())
+	xytRosterCtrl := xytweb.NewXytRosterHandler(db, ratelimitSmsSvc, rosterGenerator, orderSvc, orderRefunder)
+	xytRosterCtrl.RegisterRoutes(xytAdminGroup)
+
+	searchSvc := InitSearchService()
+	searchSyncer := search.NewSyncer(db, searchSvc)
+	if err := searchSyncer.RegisterCallbacks(); err != nil {
+		panic(err)
+	}
+	searchSyncer.Start(context.Background())
+	xytSearchCtrl := xytweb.NewXytSearchHandler(searchSvc, searchSyncer)
+	xytSearchCtrl.RegisterRoutes(xytGroup)
+	xytSearchCtrl.RegisterAdminRoutes(xytAdminGroup)
+
+	viper.SetDefault("xyt.upload_dir", "./uploads")
+	ginEngine.Static(xytStaticPath, viper.GetString("xyt.upload_dir"))
+	xytAdminCtrl := xytweb.NewXytAdminHandler(db, xytweb.NewLocalFileStorage(viper.GetString("xyt.upload_dir"), xytStaticPath))
+	xytAdminCtrl.RegisterRoutes(xytAdminGroup)
+
+	importer := xytweb.NewImporter(db, cache.NewDepartmentCache(cace), viper.GetInt("xyt.import_batch_size"))
+	xytImportCtrl := xytweb.NewXytImportHandler(importer)
+	xytImportCtrl.RegisterRoutes(xytAdminGroup)
+
 	// hll api
 	hllGroup := ginEngine.Group("/hll")
 
@@ -299,14 +507,30 @@ func autoCreateTable(db *gorm.DB) error {
 		&xytmodel.Registration{},
 		&xytmodel.Doctor{},
 		&xytmodel.RegistrationType{},
+		&xytmodel.RegistrationFee{},
 		&xytmodel.Schedule{},
+		&xytmodel.RosterTemplate{},
 		&xytmodel.Patient{},
 		&xytmodel.RegisterOrder{},
+		&xytmodel.WaitlistEntry{},
+		&xytmodel.BookingBan{},
+		&xytmodel.BookingViolation{},
+		&xytmodel.DoctorReview{},
+		&xytmodel.AdminAuditLog{},
+		&xytmodel.Certification{},
+		&xytmodel.OrderHistory{},
+		&xytmodel.OrderPayment{},
+		&xytmodel.Notification{},
+		&xytmodel.NotificationPreference{},
+		&xytmodel.MedicalRecord{},
+		&xytmodel.MedicalRecordAttachment{},
 
 		// 城市表
 		&xytmodel.Province{},
 		&xytmodel.City{},
 		&xytmodel.District{},
+		&xytmodel.RegionVersion{},
+		&xytmodel.RegionCodeRemap{},
 
 		// 用户表
 		&xytmodel.XytUser{},
@@ -316,184 +540,3 @@ func autoCreateTable(db *gorm.DB) error {
 		&hllmodel.HllUser{},
 	)
 }
-
-// 省 1级数据
-type CitiesLevelOne struct {
-	Code string `json:"code"`
-	Name string `json:"name"`
-}
-
-// 省/市 2级数据
-type CitiesLevelTwo struct {
-	Code     string           `json:"code"`
-	Name     string           `json:"name"`
-	Children []CitiesLevelOne `json:"children"`
-}
-
-// 省/市/区县 3级数据
-type CitiesLevelThree struct {
-	Code     string           `json:"code"`
-	Name     string           `json:"name"`
-	Children []CitiesLevelTwo `json:"children"`
-}
-
-func ReadJSONInsertToDB(db *gorm.DB) {
-	data, err := os.ReadFile("pca-code.json")
-	if err != nil {
-		panic(err)
-	}
-
-	var provinces []CitiesLevelThree
-	if err := json.Unmarshal(data, &provinces); err != nil {
-		panic(err)
-	}
-
-	var category uint8
-	var abbr Abbreviation
-	// now := time.Now().Unix()
-	for _, p := range provinces {
-		// 插入省
-		category = categoryByProvinceName(p.Name)
-		abbr = abbrByProvinceName(p.Name)
-		err = db.Table(xytmodel.TableProvince).Create(&xytmodel.Province{
-			Name:     p.Name,
-			Abbr_zh:  abbr.Zh,
-			Abbr_en:  abbr.En,
-			Code:     p.Code,
-			Category: category,
-		}).Error
-		if err != nil {
-			panic(err)
-		}
-		for _, c := range p.Children {
-			// 插入市
-			// fmt.Printf("INSERT INTO cities (name, code, province_name, province_code, category, created_at, updated_at) VALUES ('%s', '%s', '%s', '%s', %d, %d, %d);\n",
-			// 	c.Name, c.Code, p.Name, p.Code, category, now, now)
-			err = db.Table(xytmodel.TableCity).Create(&xytmodel.City{
-				Name:         c.Name,
-				Code:         c.Code,
-				ProvinceName: p.Name,
-				ProvinceCode: p.Code,
-				Category:     category,
-			}).Error
-			if err != nil {
-				panic(err)
-			}
-			for _, d := range c.Children {
-				// 插入区/县
-				// fmt.Printf("INSERT INTO districts (name, code, city_name, city_code, created_at, updated_at) VALUES ('%s', '%s', '%s', '%s', %d, %d);\n",
-				// 	d.Name, d.Code, c.Name, c.Code, now, now)
-				err = db.Table(xytmodel.TableDistrict).Create(&xytmodel.District{
-					Name:         d.Name,
-					Code:         d.Code,
-					CityName:     c.Name,
-					CityCode:     c.Code,
-					ProvinceName: p.Name,
-					ProvinceCode: p.Code,
-					Category:     category,
-				}).Error
-				if err != nil {
-					panic(err)
-				}
-			}
-		}
-	}
-}
-
-// 行政区划分类
-func categoryByProvinceName(name string) uint8 {
-	switch name {
-	case "北京市", "北京":
-		return 3
-	case "天津市", "天津":
-		return 3
-	case "上海市", "上海":
-		return 3
-	case "重庆市", "重庆":
-		return 3
-	}
-	if strings.Contains(name, "自治区") {
-		return 2
-	}
-	return 1
-}
-
-type Abbreviation struct {
-	Zh string // 中文简称，例如 "冀"
-	En string // 英文简称，例如 "HE"
-}
-
-func abbrByProvinceName(name string) Abbreviation {
-	switch name {
-	case "北京市":
-		return Abbreviation{"京", "BJ"}
-	case "天津市":
-		return Abbreviation{"津", "TJ"}
-	case "上海市":
-		return Abbreviation{"沪", "SH"}
-	case "重庆市":
-		return Abbreviation{"渝", "CQ"}
-	case "河北省":
-		return Abbreviation{"冀", "HE"}
-	case "山西省":
-		return Abbreviation{"晋", "SX"}
-	case "辽宁省":
-		return Abbreviation{"辽", "LN"}
-	case "吉林省":
-		return Abbreviation{"吉", "JL"}
-	case "黑龙江省":
-		return Abbreviation{"黑", "HL"}
-	case "江苏省":
-		return Abbreviation{"苏", "JS"}
-	case "浙江省":
-		return Abbreviation{"浙", "ZJ"}
-	case "安徽省":
-		return Abbreviation{"皖", "AH"}
-	case "福建省":
-		return Abbreviation{"闽", "FJ"}
-	case "江西省":
-		return Abbreviation{"赣", "JX"}
-	case "山东省":
-		return Abbreviation{"鲁", "SD"}
-	case "河南省":
-		return Abbreviation{"豫", "HA"}
-	case "湖北省":
-		return Abbreviation{"鄂", "HB"}
-	case "湖南省":
-		return Abbreviation{"湘", "HN"}
-	case "广东省":
-		return Abbreviation{"粤", "GD"}
-	case "海南省":
-		return Abbreviation{"琼", "HI"}
-	case "四川省":
-		return Abbreviation{"川", "SC"}
-	case "贵州省":
-		return Abbreviation{"黔", "GZ"}
-	case "云南省":
-		return Abbreviation{"滇", "YN"}
-	case "陕西省":
-		return Abbreviation{"陕", "SN"}
-	case "甘肃省":
-		return Abbreviation{"甘", "GS"}
-	case "青海省":
-		return Abbreviation{"青", "QH"}
-	case "台湾省":
-		return Abbreviation{"台", "TW"}
-	case "内蒙古自治区":
-		return Abbreviation{"蒙", "NM"}
-	case "广西壮族自治区":
-		return Abbreviation{"桂", "GX"}
-	case "西藏自治区":
-		return Abbreviation{"藏", "XZ"}
-	case "宁夏回族自治区":
-		return Abbreviation{"宁", "NX"}
-	case "新疆维吾尔自治区":
-		return Abbreviation{"新", "XJ"}
-	case "香港特别行政区":
-		return Abbreviation{"港", "HK"}
-	case "澳门特别行政区":
-		return Abbreviation{"澳", "MO"}
-	default:
-		return Abbreviation{"", ""}
-	}
-}
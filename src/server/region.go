@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/service/region"
+)
+
+// Region 命令行导入行政区划, 用法: isb [-c config] region [-apply] [-version v] file
+// 默认只输出与当前数据的差异, -apply 时导入; 首次导入 pca-code.json 时需要指定 -version
+func Region(args []string) {
+	fs := flag.NewFlagSet("region", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "导入数据, 默认只输出差异")
+	version := fs.String("version", "", "文件中没有版本号时使用的版本号")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("[Err] %v", err)
+	}
+	ds, err := region.LoadDataset(data, *version)
+	if err != nil {
+		log.Fatalf("[Err] %v", err)
+	}
+	if err = InitConfig(nil); err != nil {
+		log.Fatalf("[Err] init config: %v", err)
+	}
+	db, err := InitDB(InitLogger())
+	if err != nil {
+		log.Fatalf("[Err] init db client: %v", err)
+	}
+	if err = autoCreateTable(db); err != nil {
+		log.Fatalf("[Err] autoCreateTable: %v", err)
+	}
+	redisCli, err := InitRedis()
+	if err != nil {
+		log.Fatalf("[Err] init redis client: %v", err)
+	}
+
+	svc := region.NewService(db, cache.NewRegionCache(redisCli))
+	var diff region.Diff
+	if *apply {
+		diff, err = svc.Apply(context.Background(), ds, "cli")
+	} else {
+		diff, err = svc.Diff(context.Background(), ds)
+	}
+	if err != nil {
+		log.Fatalf("[Err] %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(diff); err != nil {
+		log.Fatalf("[Err] %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+// Rekey 命令行用当前密钥重新加密就诊人的敏感字段, 用法: isb [-c config] rekey [-batch n]
+// 轮换密钥时先新增密钥并修改 xyt.field_crypt.current, 重启服务后执行, 完成后才能删除旧密钥
+func Rekey(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	batchSize := fs.Int("batch", 200, "每批处理的行数")
+	_ = fs.Parse(args)
+
+	if err := InitConfig(nil); err != nil {
+		log.Fatalf("[Err] init config: %v", err)
+	}
+	if err := InitFieldCrypt(); err != nil {
+		log.Fatalf("[Err] init field crypt: %v", err)
+	}
+	db, err := InitDB(InitLogger())
+	if err != nil {
+		log.Fatalf("[Err] init db client: %v", err)
+	}
+	n, err := dao.NewPatientDAO(db).Reencrypt(context.Background(), *batchSize)
+	if err != nil {
+		log.Fatalf("[Err] rekey after %d patients: %v", n, err)
+	}
+	fmt.Fprintf(os.Stderr, "重新加密 %d 个就诊人\n", n)
+}
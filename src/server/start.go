@@ -18,6 +18,12 @@ func Start() {
 		StartDefault()
 	}
 
+	err = InitFieldCrypt()
+	if err != nil {
+		log.Printf("[Err] init field crypt: %v", err)
+		return
+	}
+
 	dbCli, err := InitDB(InitLogger())
 	if err != nil {
 		log.Printf("[Err] init db client: %v", err)
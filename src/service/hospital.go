@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/repository/dao"
+)
+
+type HospitalService interface {
+	List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error)
+	Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error)
+	Detail(ctx context.Context, hosId string) (xytmodel.Hospital, error)
+}
+
+type hospitalService struct {
+	repo repository.HospitalRepository
+}
+
+func NewHospitalService(repo repository.HospitalRepository) HospitalService {
+	return &hospitalService{
+		repo: repo,
+	}
+}
+
+func (svc *hospitalService) List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	return svc.repo.List(ctx, filter, offset, limit)
+}
+
+func (svc *hospitalService) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	return svc.repo.Grades(ctx)
+}
+
+func (svc *hospitalService) Detail(ctx context.Context, hosId string) (xytmodel.Hospital, error) {
+	return svc.repo.FindByUid(ctx, hosId)
+}
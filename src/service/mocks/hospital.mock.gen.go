@@ -0,0 +1,89 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/service/hospital.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/service/hospital.go -destination=src/service/mocks/hospital.mock.gen.go -package=svcmock
+//
+
+// Package svcmock is a generated GoMock package.
+package svcmock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	dao "github.com/solunara/isb/src/repository/dao"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockHospitalService is a mock of HospitalService interface.
+type MockHospitalService struct {
+	ctrl     *gomock.Controller
+	recorder *MockHospitalServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockHospitalServiceMockRecorder is the mock recorder for MockHospitalService.
+type MockHospitalServiceMockRecorder struct {
+	mock *MockHospitalService
+}
+
+// NewMockHospitalService creates a new mock instance.
+func NewMockHospitalService(ctrl *gomock.Controller) *MockHospitalService {
+	mock := &MockHospitalService{ctrl: ctrl}
+	mock.recorder = &MockHospitalServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHospitalService) EXPECT() *MockHospitalServiceMockRecorder {
+	return m.recorder
+}
+
+// Detail mocks base method.
+func (m *MockHospitalService) Detail(ctx context.Context, hosId string) (xytmodel.Hospital, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Detail", ctx, hosId)
+	ret0, _ := ret[0].(xytmodel.Hospital)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Detail indicates an expected call of Detail.
+func (mr *MockHospitalServiceMockRecorder) Detail(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Detail", reflect.TypeOf((*MockHospitalService)(nil).Detail), ctx, hosId)
+}
+
+// Grades mocks base method.
+func (m *MockHospitalService) Grades(ctx context.Context) ([]xytmodel.HospitalGrade, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grades", ctx)
+	ret0, _ := ret[0].([]xytmodel.HospitalGrade)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Grades indicates an expected call of Grades.
+func (mr *MockHospitalServiceMockRecorder) Grades(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grades", reflect.TypeOf((*MockHospitalService)(nil).Grades), ctx)
+}
+
+// List mocks base method.
+func (m *MockHospitalService) List(ctx context.Context, filter dao.HospitalFilter, offset, limit int) ([]xytmodel.Hospital, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]xytmodel.Hospital)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockHospitalServiceMockRecorder) List(ctx, filter, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockHospitalService)(nil).List), ctx, filter, offset, limit)
+}
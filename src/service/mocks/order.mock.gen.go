@@ -0,0 +1,213 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/service/order.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/service/order.go -destination=src/service/mocks/order.mock.gen.go -package=svcmock
+//
+
+// Package svcmock is a generated GoMock package.
+package svcmock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	dao "github.com/solunara/isb/src/repository/dao"
+	service "github.com/solunara/isb/src/service"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockOrderService is a mock of OrderService interface.
+type MockOrderService struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockOrderServiceMockRecorder is the mock recorder for MockOrderService.
+type MockOrderServiceMockRecorder struct {
+	mock *MockOrderService
+}
+
+// NewMockOrderService creates a new mock instance.
+func NewMockOrderService(ctrl *gomock.Controller) *MockOrderService {
+	mock := &MockOrderService{ctrl: ctrl}
+	mock.recorder = &MockOrderServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderService) EXPECT() *MockOrderServiceMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockOrderService) Cancel(ctx context.Context, order xytmodel.RegisterOrder, actor, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, order, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockOrderServiceMockRecorder) Cancel(ctx, order, actor, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockOrderService)(nil).Cancel), ctx, order, actor, reason)
+}
+
+// Create mocks base method.
+func (m *MockOrderService) Create(ctx context.Context, order xytmodel.RegisterOrder, checks ...service.OrderCheck) (string, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, order}
+	for _, a := range checks {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Create", varargs...)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockOrderServiceMockRecorder) Create(ctx, order any, checks ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, order}, checks...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockOrderService)(nil).Create), varargs...)
+}
+
+// Find mocks base method.
+func (m *MockOrderService) Find(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", ctx, userId, orderId)
+	ret0, _ := ret[0].(xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find.
+func (mr *MockOrderServiceMockRecorder) Find(ctx, userId, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockOrderService)(nil).Find), ctx, userId, orderId)
+}
+
+// FindIdByIdempotencyKey mocks base method.
+func (m *MockOrderService) FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindIdByIdempotencyKey", ctx, userId, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindIdByIdempotencyKey indicates an expected call of FindIdByIdempotencyKey.
+func (mr *MockOrderServiceMockRecorder) FindIdByIdempotencyKey(ctx, userId, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindIdByIdempotencyKey", reflect.TypeOf((*MockOrderService)(nil).FindIdByIdempotencyKey), ctx, userId, key)
+}
+
+// FindPayment mocks base method.
+func (m *MockOrderService) FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPayment", ctx, orderId)
+	ret0, _ := ret[0].(xytmodel.OrderPayment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPayment indicates an expected call of FindPayment.
+func (mr *MockOrderServiceMockRecorder) FindPayment(ctx, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPayment", reflect.TypeOf((*MockOrderService)(nil).FindPayment), ctx, orderId)
+}
+
+// FinishRefund mocks base method.
+func (m *MockOrderService) FinishRefund(ctx context.Context, order xytmodel.RegisterOrder, actor, refundNo string, amount int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishRefund", ctx, order, actor, refundNo, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishRefund indicates an expected call of FinishRefund.
+func (mr *MockOrderServiceMockRecorder) FinishRefund(ctx, order, actor, refundNo, amount any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishRefund", reflect.TypeOf((*MockOrderService)(nil).FinishRefund), ctx, order, actor, refundNo, amount)
+}
+
+// History mocks base method.
+func (m *MockOrderService) History(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, orderId)
+	ret0, _ := ret[0].([]xytmodel.OrderHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockOrderServiceMockRecorder) History(ctx, orderId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockOrderService)(nil).History), ctx, orderId)
+}
+
+// List mocks base method.
+func (m *MockOrderService) List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockOrderServiceMockRecorder) List(ctx, filter, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockOrderService)(nil).List), ctx, filter, offset, limit)
+}
+
+// Prepare mocks base method.
+func (m *MockOrderService) Prepare(ctx context.Context, req service.OrderReq) (xytmodel.RegisterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prepare", ctx, req)
+	ret0, _ := ret[0].(xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prepare indicates an expected call of Prepare.
+func (mr *MockOrderServiceMockRecorder) Prepare(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prepare", reflect.TypeOf((*MockOrderService)(nil).Prepare), ctx, req)
+}
+
+// StaleRefunding mocks base method.
+func (m *MockOrderService) StaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StaleRefunding", ctx, before, limit)
+	ret0, _ := ret[0].([]xytmodel.RegisterOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StaleRefunding indicates an expected call of StaleRefunding.
+func (mr *MockOrderServiceMockRecorder) StaleRefunding(ctx, before, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StaleRefunding", reflect.TypeOf((*MockOrderService)(nil).StaleRefunding), ctx, before, limit)
+}
+
+// Transit mocks base method.
+func (m *MockOrderService) Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transit", ctx, orderId, from, to, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Transit indicates an expected call of Transit.
+func (mr *MockOrderServiceMockRecorder) Transit(ctx, orderId, from, to, actor, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transit", reflect.TypeOf((*MockOrderService)(nil).Transit), ctx, orderId, from, to, actor, reason)
+}
@@ -0,0 +1,144 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/service/patient.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/service/patient.go -destination=src/service/mocks/patient.mock.gen.go -package=svcmock
+//
+
+// Package svcmock is a generated GoMock package.
+package svcmock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPatientService is a mock of PatientService interface.
+type MockPatientService struct {
+	ctrl     *gomock.Controller
+	recorder *MockPatientServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockPatientServiceMockRecorder is the mock recorder for MockPatientService.
+type MockPatientServiceMockRecorder struct {
+	mock *MockPatientService
+}
+
+// NewMockPatientService creates a new mock instance.
+func NewMockPatientService(ctrl *gomock.Controller) *MockPatientService {
+	mock := &MockPatientService{ctrl: ctrl}
+	mock.recorder = &MockPatientServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPatientService) EXPECT() *MockPatientServiceMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockPatientService) Create(ctx context.Context, p xytmodel.Patient) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, p)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockPatientServiceMockRecorder) Create(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPatientService)(nil).Create), ctx, p)
+}
+
+// Default mocks base method.
+func (m *MockPatientService) Default(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Default", ctx, userId)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Default indicates an expected call of Default.
+func (mr *MockPatientServiceMockRecorder) Default(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Default", reflect.TypeOf((*MockPatientService)(nil).Default), ctx, userId)
+}
+
+// Delete mocks base method.
+func (m *MockPatientService) Delete(ctx context.Context, userId, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, userId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPatientServiceMockRecorder) Delete(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPatientService)(nil).Delete), ctx, userId, id)
+}
+
+// Find mocks base method.
+func (m *MockPatientService) Find(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", ctx, userId, id)
+	ret0, _ := ret[0].(xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find.
+func (mr *MockPatientServiceMockRecorder) Find(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockPatientService)(nil).Find), ctx, userId, id)
+}
+
+// List mocks base method.
+func (m *MockPatientService) List(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, userId)
+	ret0, _ := ret[0].([]xytmodel.Patient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockPatientServiceMockRecorder) List(ctx, userId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockPatientService)(nil).List), ctx, userId)
+}
+
+// SetDefault mocks base method.
+func (m *MockPatientService) SetDefault(ctx context.Context, userId, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDefault", ctx, userId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDefault indicates an expected call of SetDefault.
+func (mr *MockPatientServiceMockRecorder) SetDefault(ctx, userId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDefault", reflect.TypeOf((*MockPatientService)(nil).SetDefault), ctx, userId, id)
+}
+
+// Update mocks base method.
+func (m *MockPatientService) Update(ctx context.Context, p xytmodel.Patient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPatientServiceMockRecorder) Update(ctx, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPatientService)(nil).Update), ctx, p)
+}
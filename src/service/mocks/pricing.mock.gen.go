@@ -0,0 +1,147 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/service/pricing.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/service/pricing.go -destination=src/service/mocks/pricing.mock.gen.go -package=svcmock
+//
+
+// Package svcmock is a generated GoMock package.
+package svcmock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	xytmodel "github.com/solunara/isb/src/model/xytmodel"
+	service "github.com/solunara/isb/src/service"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockPricingService is a mock of PricingService interface.
+type MockPricingService struct {
+	ctrl     *gomock.Controller
+	recorder *MockPricingServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockPricingServiceMockRecorder is the mock recorder for MockPricingService.
+type MockPricingServiceMockRecorder struct {
+	mock *MockPricingService
+}
+
+// NewMockPricingService creates a new mock instance.
+func NewMockPricingService(ctrl *gomock.Controller) *MockPricingService {
+	mock := &MockPricingService{ctrl: ctrl}
+	mock.recorder = &MockPricingServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPricingService) EXPECT() *MockPricingServiceMockRecorder {
+	return m.recorder
+}
+
+// DeleteFee mocks base method.
+func (m *MockPricingService) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFee", ctx, hosId, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteFee indicates an expected call of DeleteFee.
+func (mr *MockPricingServiceMockRecorder) DeleteFee(ctx, hosId, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFee", reflect.TypeOf((*MockPricingService)(nil).DeleteFee), ctx, hosId, id)
+}
+
+// Fees mocks base method.
+func (m *MockPricingService) Fees(ctx context.Context, hosId string, regTypeId uint) ([]xytmodel.RegistrationFee, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fees", ctx, hosId, regTypeId)
+	ret0, _ := ret[0].([]xytmodel.RegistrationFee)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fees indicates an expected call of Fees.
+func (mr *MockPricingServiceMockRecorder) Fees(ctx, hosId, regTypeId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fees", reflect.TypeOf((*MockPricingService)(nil).Fees), ctx, hosId, regTypeId)
+}
+
+// Quote mocks base method.
+func (m *MockPricingService) Quote(ctx context.Context, detail service.ScheduleDetail, patient *xytmodel.Patient) (xytmodel.OrderPrice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Quote", ctx, detail, patient)
+	ret0, _ := ret[0].(xytmodel.OrderPrice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Quote indicates an expected call of Quote.
+func (mr *MockPricingServiceMockRecorder) Quote(ctx, detail, patient any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Quote", reflect.TypeOf((*MockPricingService)(nil).Quote), ctx, detail, patient)
+}
+
+// SaveFee mocks base method.
+func (m *MockPricingService) SaveFee(ctx context.Context, fee xytmodel.RegistrationFee) (xytmodel.RegistrationFee, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveFee", ctx, fee)
+	ret0, _ := ret[0].(xytmodel.RegistrationFee)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveFee indicates an expected call of SaveFee.
+func (mr *MockPricingServiceMockRecorder) SaveFee(ctx, fee any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveFee", reflect.TypeOf((*MockPricingService)(nil).SaveFee), ctx, fee)
+}
+
+// SaveType mocks base method.
+func (m *MockPricingService) SaveType(ctx context.Context, t xytmodel.RegistrationType) (xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveType", ctx, t)
+	ret0, _ := ret[0].(xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveType indicates an expected call of SaveType.
+func (mr *MockPricingServiceMockRecorder) SaveType(ctx, t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveType", reflect.TypeOf((*MockPricingService)(nil).SaveType), ctx, t)
+}
+
+// SchedulePrices mocks base method.
+func (m *MockPricingService) SchedulePrices(ctx context.Context, schedules []xytmodel.Schedule, doctors []xytmodel.Doctor) (map[string]xytmodel.OrderPrice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SchedulePrices", ctx, schedules, doctors)
+	ret0, _ := ret[0].(map[string]xytmodel.OrderPrice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SchedulePrices indicates an expected call of SchedulePrices.
+func (mr *MockPricingServiceMockRecorder) SchedulePrices(ctx, schedules, doctors any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SchedulePrices", reflect.TypeOf((*MockPricingService)(nil).SchedulePrices), ctx, schedules, doctors)
+}
+
+// Types mocks base method.
+func (m *MockPricingService) Types(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Types", ctx, hosId)
+	ret0, _ := ret[0].([]xytmodel.RegistrationType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Types indicates an expected call of Types.
+func (mr *MockPricingServiceMockRecorder) Types(ctx, hosId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Types", reflect.TypeOf((*MockPricingService)(nil).Types), ctx, hosId)
+}
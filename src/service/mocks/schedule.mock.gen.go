@@ -0,0 +1,87 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: src/service/schedule.go
+//
+// Generated by this command:
+//
+//	mockgen -source=src/service/schedule.go -destination=src/service/mocks/schedule.mock.gen.go -package=svcmock
+//
+
+// Package svcmock is a generated GoMock package.
+package svcmock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	service "github.com/solunara/isb/src/service"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockScheduleService is a mock of ScheduleService interface.
+type MockScheduleService struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockScheduleServiceMockRecorder is the mock recorder for MockScheduleService.
+type MockScheduleServiceMockRecorder struct {
+	mock *MockScheduleService
+}
+
+// NewMockScheduleService creates a new mock instance.
+func NewMockScheduleService(ctrl *gomock.Controller) *MockScheduleService {
+	mock := &MockScheduleService{ctrl: ctrl}
+	mock.recorder = &MockScheduleServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleService) EXPECT() *MockScheduleServiceMockRecorder {
+	return m.recorder
+}
+
+// Day mocks base method.
+func (m *MockScheduleService) Day(ctx context.Context, hosId, deptId, date string) (service.DaySchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Day", ctx, hosId, deptId, date)
+	ret0, _ := ret[0].(service.DaySchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Day indicates an expected call of Day.
+func (mr *MockScheduleServiceMockRecorder) Day(ctx, hosId, deptId, date any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Day", reflect.TypeOf((*MockScheduleService)(nil).Day), ctx, hosId, deptId, date)
+}
+
+// DeptInfo mocks base method.
+func (m *MockScheduleService) DeptInfo(ctx context.Context, hosId, deptId string) (service.DeptInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeptInfo", ctx, hosId, deptId)
+	ret0, _ := ret[0].(service.DeptInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeptInfo indicates an expected call of DeptInfo.
+func (mr *MockScheduleServiceMockRecorder) DeptInfo(ctx, hosId, deptId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeptInfo", reflect.TypeOf((*MockScheduleService)(nil).DeptInfo), ctx, hosId, deptId)
+}
+
+// Detail mocks base method.
+func (m *MockScheduleService) Detail(ctx context.Context, scheId string) (service.ScheduleDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Detail", ctx, scheId)
+	ret0, _ := ret[0].(service.ScheduleDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Detail indicates an expected call of Detail.
+func (mr *MockScheduleServiceMockRecorder) Detail(ctx, scheId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Detail", reflect.TypeOf((*MockScheduleService)(nil).Detail), ctx, scheId)
+}
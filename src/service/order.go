@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/utils"
+)
+
+// OrderReq 预约请求, 只能为 UserId 自己的就诊人预约, 没有指定就诊人时使用默认就诊人
+type OrderReq struct {
+	UserId         string
+	PatientId      string
+	ScheId         string
+	IdempotencyKey string
+}
+
+// OrderCheck 在占号的事务里执行的检查, 返回错误时不占号也不写入订单
+type OrderCheck func(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error
+
+type OrderService interface {
+	// Prepare 查询预约需要的数据, 组装出一个待支付的订单, 由 Create 占号和落库
+	Prepare(ctx context.Context, req OrderReq) (xytmodel.RegisterOrder, error)
+	// Create 在一个事务里依次执行 checks, 占号, 分配号序并写入订单和第一条变更历史, 返回实际生效的订单号;
+	// 相同幂等键的请求并发创建时返回先提交的订单号
+	Create(ctx context.Context, order xytmodel.RegisterOrder, checks ...OrderCheck) (string, error)
+	FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error)
+	Find(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error)
+	List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error)
+	// Transit 把订单从 from 迁移到 to 并记录变更历史, 订单已经不在 from 状态时返回 app.ErrOrderStateChanged
+	Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error
+	// Cancel 取消待支付订单并归还排班号源
+	Cancel(ctx context.Context, order xytmodel.RegisterOrder, actor, reason string) error
+	// FinishRefund 渠道退款成功后把订单改为已退款, 记录退款结果并归还排班号源
+	FinishRefund(ctx context.Context, order xytmodel.RegisterOrder, actor, refundNo string, amount int64) error
+	History(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error)
+	FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error)
+	// StaleRefunding 进入退款中早于 before 且仍在退款中的订单
+	StaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error)
+}
+
+type orderService struct {
+	repo      repository.OrderRepository
+	patients  repository.PatientRepository
+	schedules ScheduleService
+	pricing   PricingService
+}
+
+func NewOrderService(repo repository.OrderRepository, patients repository.PatientRepository, schedules ScheduleService, pricing PricingService) OrderService {
+	return &orderService{
+		repo:      repo,
+		patients:  patients,
+		schedules: schedules,
+		pricing:   pricing,
+	}
+}
+
+func (svc *orderService) Prepare(ctx context.Context, req OrderReq) (xytmodel.RegisterOrder, error) {
+	var patient xytmodel.Patient
+	var err error
+	if req.PatientId == "" {
+		patient, err = svc.patients.FindDefault(ctx, req.UserId)
+	} else {
+		patient, err = svc.patients.FindById(ctx, req.UserId, req.PatientId)
+	}
+	if err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+
+	detail, err := svc.schedules.Detail(ctx, req.ScheId)
+	if err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+	if detail.Schedule.Status == xytmodel.ScheduleStatusSuspended {
+		return xytmodel.RegisterOrder{}, app.ErrScheduleSuspended
+	}
+	price, err := svc.pricing.Quote(ctx, detail, &patient)
+	if err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+
+	return xytmodel.RegisterOrder{
+		UserId:       patient.UserId,
+		OrderId:      utils.GenerateUinqueID(),
+		ScheId:       req.ScheId,
+		PatientId:    patient.Id,
+		HosID:        detail.Schedule.HosID,
+		DeptID:       detail.Schedule.DeptID,
+		DocId:        detail.Schedule.DocId,
+		HosName:      detail.Hospital.FullName,
+		DeptName:     detail.Department.Name,
+		DocName:      detail.Doctor.Name,
+		PatientName:  patient.Name,
+		VisitTime:    detail.Schedule.WorkDate + " " + detail.Schedule.TimeSlot,
+		Amount:       price.Payable,
+		Price:        price,
+		State:        xytmodel.OrderStatePending,
+		RegisterTime: time.Now().Format(time.DateTime),
+		IdempotencyKey: sql.NullString{
+			String: req.IdempotencyKey,
+			Valid:  req.IdempotencyKey != "",
+		},
+	}, nil
+}
+
+func (svc *orderService) Find(ctx context.Context, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	return svc.repo.FindById(ctx, userId, orderId)
+}
+
+func (svc *orderService) List(ctx context.Context, filter dao.OrderFilter, offset, limit int) ([]xytmodel.RegisterOrder, int64, error) {
+	return svc.repo.List(ctx, filter, offset, limit)
+}
+
+func (svc *orderService) Create(ctx context.Context, order xytmodel.RegisterOrder, checks ...OrderCheck) (string, error) {
+	err := svc.repo.Transaction(ctx, func(repo repository.OrderRepository) error {
+		for _, check := range checks {
+			if err := check(ctx, repo, order); err != nil {
+				return err
+			}
+		}
+		schedule, err := repo.TakeSeat(ctx, order.ScheId)
+		if err != nil {
+			return err
+		}
+		taken, err := repo.TakenSeqs(ctx, order.ScheId)
+		if err != nil {
+			return err
+		}
+		seq := nextFreeSeq(taken)
+		start, end, err := SeqVisitPeriod(schedule, seq)
+		if err != nil {
+			return err
+		}
+		order.SeqNo = seq
+		order.VisitPeriod = start.Format("2006-01-02 15:04") + "-" + end.Format("15:04")
+		if err = repo.Insert(ctx, order); err != nil {
+			return err
+		}
+		// 下单也记一条变更历史, 订单的完整生命周期都能在历史里查到
+		return repo.InsertHistory(ctx, xytmodel.OrderHistory{
+			OrderId:   order.OrderId,
+			FromState: xytmodel.OrderStatePending,
+			ToState:   xytmodel.OrderStatePending,
+			Actor:     order.UserId,
+			Reason:    "用户下单",
+		})
+	})
+	switch {
+	case err == nil:
+		return order.OrderId, nil
+	case errors.Is(err, app.ErrDuplicateOrder) && order.IdempotencyKey.Valid:
+		// 相同幂等键的请求并发到达, 以先提交的订单为准
+		return svc.repo.FindIdByIdempotencyKey(ctx, order.UserId, order.IdempotencyKey.String)
+	default:
+		return "", err
+	}
+}
+
+func (svc *orderService) FindIdByIdempotencyKey(ctx context.Context, userId, key string) (string, error) {
+	return svc.repo.FindIdByIdempotencyKey(ctx, userId, key)
+}
+
+func (svc *orderService) Transit(ctx context.Context, orderId string, from, to int8, actor, reason string) error {
+	return svc.repo.Transaction(ctx, func(repo repository.OrderRepository) error {
+		return repo.Transit(ctx, orderId, from, to, actor, reason)
+	})
+}
+
+func (svc *orderService) Cancel(ctx context.Context, order xytmodel.RegisterOrder, actor, reason string) error {
+	return svc.repo.Transaction(ctx, func(repo repository.OrderRepository) error {
+		err := repo.Transit(ctx, order.OrderId, xytmodel.OrderStatePending, xytmodel.OrderStateCancelled, actor, reason)
+		if err != nil {
+			return err
+		}
+		return repo.ReleaseSeat(ctx, order.ScheId)
+	})
+}
+
+func (svc *orderService) FinishRefund(ctx context.Context, order xytmodel.RegisterOrder, actor, refundNo string, amount int64) error {
+	return svc.repo.Transaction(ctx, func(repo repository.OrderRepository) error {
+		err := repo.Transit(ctx, order.OrderId, xytmodel.OrderStateRefunding, xytmodel.OrderStateRefunded, actor, "退款成功")
+		if err != nil {
+			return err
+		}
+		err = repo.UpdateRefund(ctx, xytmodel.OrderPayment{
+			OrderId:      order.OrderId,
+			Status:       payment.StatusRefunded,
+			RefundNo:     refundNo,
+			RefundAmount: amount,
+			RefundedAt:   time.Now().UnixMilli(),
+		})
+		if err != nil {
+			return err
+		}
+		return repo.ReleaseSeat(ctx, order.ScheId)
+	})
+}
+
+func (svc *orderService) History(ctx context.Context, orderId string) ([]xytmodel.OrderHistory, error) {
+	return svc.repo.FindHistory(ctx, orderId)
+}
+
+func (svc *orderService) FindPayment(ctx context.Context, orderId string) (xytmodel.OrderPayment, error) {
+	return svc.repo.FindPayment(ctx, orderId)
+}
+
+func (svc *orderService) StaleRefunding(ctx context.Context, before time.Time, limit int) ([]xytmodel.RegisterOrder, error) {
+	return svc.repo.FindStaleRefunding(ctx, before, limit)
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	repomocks "github.com/solunara/isb/src/repository/mocks"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestOrderService_Prepare(t *testing.T) {
+	patient := xytmodel.Patient{Id: "p1", UserId: "u1", Name: "张三"}
+	// 排班服务直接使用, 只 mock 它依赖的 repository
+	schedules := func(ctrl *gomock.Controller, status int8) ScheduleService {
+		repo := repomocks.NewMockScheduleRepository(ctrl)
+		repo.EXPECT().FindById(gomock.Any(), "s1").Return(xytmodel.Schedule{
+			ScheId: "s1", HosID: "h1", DeptID: "d1", DocId: "doc1",
+			WorkDate: "2026-10-20", TimeSlot: "上午", Amount: 50, Status: status,
+		}, nil)
+		repo.EXPECT().FindDoctor(gomock.Any(), "doc1").Return(xytmodel.Doctor{Name: "李医生"}, nil)
+		hospitals := repomocks.NewMockHospitalRepository(ctrl)
+		hospitals.EXPECT().FindByUid(gomock.Any(), "h1").Return(xytmodel.Hospital{FullName: "第一医院"}, nil)
+		hospitals.EXPECT().FindDepartment(gomock.Any(), "d1").Return(xytmodel.Department{Name: "内科", HospitalID: "h1"}, nil)
+		return NewScheduleService(repo, hospitals)
+	}
+	testCases := []struct {
+		name     string
+		patients func(ctrl *gomock.Controller) repository.PatientRepository
+		schedule func(ctrl *gomock.Controller) ScheduleService
+		req      OrderReq
+
+		wantErr error
+	}{
+		{
+			name: "没有指定就诊人时使用默认就诊人",
+			patients: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindDefault(gomock.Any(), "u1").Return(patient, nil)
+				return repo
+			},
+			schedule: func(ctrl *gomock.Controller) ScheduleService {
+				return schedules(ctrl, xytmodel.ScheduleStatusNormal)
+			},
+			req: OrderReq{UserId: "u1", ScheId: "s1", IdempotencyKey: "k1"},
+		},
+		{
+			name: "就诊人不属于当前用户",
+			patients: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), "u2", "p1").Return(xytmodel.Patient{}, app.ErrRecordNotFound)
+				return repo
+			},
+			schedule: func(ctrl *gomock.Controller) ScheduleService {
+				return NewScheduleService(repomocks.NewMockScheduleRepository(ctrl), repomocks.NewMockHospitalRepository(ctrl))
+			},
+			req:     OrderReq{UserId: "u2", PatientId: "p1", ScheId: "s1"},
+			wantErr: app.ErrRecordNotFound,
+		},
+		{
+			name: "排班已停诊",
+			patients: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), "u1", "p1").Return(patient, nil)
+				return repo
+			},
+			schedule: func(ctrl *gomock.Controller) ScheduleService {
+				return schedules(ctrl, xytmodel.ScheduleStatusSuspended)
+			},
+			req:     OrderReq{UserId: "u1", PatientId: "p1", ScheId: "s1"},
+			wantErr: app.ErrScheduleSuspended,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			// 排班没有挂号类型, 不会查询挂号费配置
+			pricing := NewPricingService(repomocks.NewMockPricingRepository(ctrl), nil)
+			svc := NewOrderService(nil, tc.patients(ctrl), tc.schedule(ctrl), pricing)
+			order, err := svc.Prepare(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.NotEmpty(t, order.OrderId)
+			assert.Equal(t, "p1", order.PatientId)
+			assert.Equal(t, "张三", order.PatientName)
+			assert.Equal(t, "第一医院", order.HosName)
+			assert.Equal(t, "2026-10-20 上午", order.VisitTime)
+			assert.Equal(t, xytmodel.OrderStatePending, order.State)
+			assert.Equal(t, 50, order.Amount)
+			assert.Equal(t, xytmodel.OrderPrice{Source: xytmodel.PriceSourceSchedule, Total: 50, Payable: 50}, order.Price)
+			assert.Equal(t, tc.req.IdempotencyKey, order.IdempotencyKey.String)
+		})
+	}
+}
+
+// transactionRepo 事务直接在 mock 上执行
+func transactionRepo(ctrl *gomock.Controller) *repomocks.MockOrderRepository {
+	repo := repomocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().Transaction(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, fn func(repo repository.OrderRepository) error) error {
+			return fn(repo)
+		}).AnyTimes()
+	return repo
+}
+
+func TestOrderService_Create(t *testing.T) {
+	order := xytmodel.RegisterOrder{
+		UserId:         "u1",
+		OrderId:        "o1",
+		ScheId:         "s1",
+		PatientId:      "p1",
+		IdempotencyKey: sql.NullString{String: "k1", Valid: true},
+	}
+	schedule := xytmodel.Schedule{ScheId: "s1", WorkDate: "2030-01-02", TimeSlot: "上午"}
+	testCases := []struct {
+		name   string
+		mock   func(ctrl *gomock.Controller) repository.OrderRepository
+		checks []OrderCheck
+
+		wantId  string
+		wantErr error
+	}{
+		{
+			name: "分配空出来的号序",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().TakeSeat(gomock.Any(), "s1").Return(schedule, nil)
+				repo.EXPECT().TakenSeqs(gomock.Any(), "s1").Return([]int{1, 3}, nil)
+				repo.EXPECT().Insert(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, o xytmodel.RegisterOrder) error {
+						assert.Equal(t, 2, o.SeqNo)
+						assert.Equal(t, "2030-01-02 08:10-08:20", o.VisitPeriod)
+						return nil
+					})
+				repo.EXPECT().InsertHistory(gomock.Any(), xytmodel.OrderHistory{
+					OrderId:   "o1",
+					FromState: xytmodel.OrderStatePending,
+					ToState:   xytmodel.OrderStatePending,
+					Actor:     "u1",
+					Reason:    "用户下单",
+				}).Return(nil)
+				return repo
+			},
+			wantId: "o1",
+		},
+		{
+			name: "事务内的检查不通过",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				return transactionRepo(ctrl)
+			},
+			checks: []OrderCheck{
+				func(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error {
+					return app.ErrBookingRejected
+				},
+			},
+			wantErr: app.ErrBookingRejected,
+		},
+		{
+			name: "已约满",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().TakeSeat(gomock.Any(), "s1").Return(xytmodel.Schedule{}, app.ErrScheduleFull)
+				return repo
+			},
+			wantErr: app.ErrScheduleFull,
+		},
+		{
+			name: "相同幂等键的订单先提交了",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().TakeSeat(gomock.Any(), "s1").Return(schedule, nil)
+				repo.EXPECT().TakenSeqs(gomock.Any(), "s1").Return(nil, nil)
+				repo.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(app.ErrDuplicateOrder)
+				repo.EXPECT().FindIdByIdempotencyKey(gomock.Any(), "u1", "k1").Return("o0", nil)
+				return repo
+			},
+			wantId: "o0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewOrderService(tc.mock(ctrl), nil, nil, nil)
+			orderId, err := svc.Create(context.Background(), order, tc.checks...)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantId, orderId)
+		})
+	}
+}
+
+func TestOrderService_Cancel(t *testing.T) {
+	order := xytmodel.RegisterOrder{OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStatePending}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.OrderRepository
+
+		wantErr error
+	}{
+		{
+			name: "取消并归还号源",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().Transit(gomock.Any(), "o1", xytmodel.OrderStatePending, xytmodel.OrderStateCancelled, "u1", "用户取消").Return(nil)
+				repo.EXPECT().ReleaseSeat(gomock.Any(), "s1").Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "订单已经支付",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().Transit(gomock.Any(), "o1", xytmodel.OrderStatePending, xytmodel.OrderStateCancelled, "u1", "用户取消").
+					Return(app.ErrOrderStateChanged)
+				return repo
+			},
+			wantErr: app.ErrOrderStateChanged,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewOrderService(tc.mock(ctrl), nil, nil, nil)
+			err := svc.Cancel(context.Background(), order, "u1", "用户取消")
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestOrderService_FinishRefund(t *testing.T) {
+	order := xytmodel.RegisterOrder{OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStateRefunding}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.OrderRepository
+
+		wantErr error
+	}{
+		{
+			name: "记录退款结果并归还号源",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().Transit(gomock.Any(), "o1", xytmodel.OrderStateRefunding, xytmodel.OrderStateRefunded, "localpay", "退款成功").Return(nil)
+				repo.EXPECT().UpdateRefund(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, paid xytmodel.OrderPayment) error {
+						assert.Equal(t, payment.StatusRefunded, paid.Status)
+						assert.Equal(t, "r1", paid.RefundNo)
+						assert.EqualValues(t, 3000, paid.RefundAmount)
+						return nil
+					})
+				repo.EXPECT().ReleaseSeat(gomock.Any(), "s1").Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "对账任务已经处理了",
+			mock: func(ctrl *gomock.Controller) repository.OrderRepository {
+				repo := transactionRepo(ctrl)
+				repo.EXPECT().Transit(gomock.Any(), "o1", xytmodel.OrderStateRefunding, xytmodel.OrderStateRefunded, "localpay", "退款成功").
+					Return(app.ErrOrderStateChanged)
+				return repo
+			},
+			wantErr: app.ErrOrderStateChanged,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewOrderService(tc.mock(ctrl), nil, nil, nil)
+			err := svc.FinishRefund(context.Background(), order, "localpay", "r1", 3000)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/utils"
+)
+
+var phoneRegexp = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// 身份证号前 17 位的加权因子, 加权和模 11 后对应的校验码
+var (
+	idNumberWeights    = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idNumberCheckCodes = "10X98765432"
+)
+
+type PatientService interface {
+	List(ctx context.Context, userId string) ([]xytmodel.Patient, error)
+	Find(ctx context.Context, userId, id string) (xytmodel.Patient, error)
+	// Default 用户的默认就诊人, 预约时没有指定就诊人就使用它
+	Default(ctx context.Context, userId string) (xytmodel.Patient, error)
+	Create(ctx context.Context, p xytmodel.Patient) (xytmodel.Patient, error)
+	Update(ctx context.Context, p xytmodel.Patient) error
+	Delete(ctx context.Context, userId, id string) error
+	SetDefault(ctx context.Context, userId, id string) error
+}
+
+type patientService struct {
+	repo repository.PatientRepository
+	// 每个账号最多可以添加的就诊人数量
+	maxPatients int
+}
+
+func NewPatientService(repo repository.PatientRepository, maxPatients int) PatientService {
+	return &patientService{
+		repo:        repo,
+		maxPatients: maxPatients,
+	}
+}
+
+func (svc *patientService) List(ctx context.Context, userId string) ([]xytmodel.Patient, error) {
+	return svc.repo.FindByUser(ctx, userId)
+}
+
+func (svc *patientService) Find(ctx context.Context, userId, id string) (xytmodel.Patient, error) {
+	return svc.repo.FindById(ctx, userId, id)
+}
+
+func (svc *patientService) Default(ctx context.Context, userId string) (xytmodel.Patient, error) {
+	return svc.repo.FindDefault(ctx, userId)
+}
+
+func (svc *patientService) Create(ctx context.Context, p xytmodel.Patient) (xytmodel.Patient, error) {
+	if !validRelation(p.Relation) {
+		return xytmodel.Patient{}, app.ErrPatientRelation
+	}
+	if err := validatePatient(&p); err != nil {
+		return xytmodel.Patient{}, err
+	}
+	p.Id = utils.GenerateUinqueID()
+	return svc.repo.Create(ctx, p, svc.maxPatients)
+}
+
+// Update 前端原样提交脱敏后的值时表示没有修改
+func (svc *patientService) Update(ctx context.Context, p xytmodel.Patient) error {
+	stored, err := svc.repo.FindById(ctx, p.UserId, p.Id)
+	if err != nil {
+		return err
+	}
+	// 没有传关系时保留原来的, 添加关系之前的就诊人可以一直不填
+	if p.Relation == 0 {
+		p.Relation = stored.Relation
+	}
+	if p.Relation != 0 && !validRelation(p.Relation) {
+		return app.ErrPatientRelation
+	}
+	unmaskPatient(&p, stored)
+	if err = validatePatient(&p); err != nil {
+		return err
+	}
+	return svc.repo.Update(ctx, p)
+}
+
+func (svc *patientService) Delete(ctx context.Context, userId, id string) error {
+	p, err := svc.repo.FindById(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+	return svc.repo.Delete(ctx, p)
+}
+
+func (svc *patientService) SetDefault(ctx context.Context, userId, id string) error {
+	if _, err := svc.repo.FindById(ctx, userId, id); err != nil {
+		return err
+	}
+	return svc.repo.SetDefault(ctx, userId, id)
+}
+
+// IdNumber 从 18 位身份证号中解析出的出生日期和性别
+type IdNumber struct {
+	Birthday time.Time
+	Sex      uint8 // 0:女性 1: 男性
+}
+
+// ParseIdNumber 校验 18 位身份证号的格式, 出生日期和校验码
+func ParseIdNumber(no string) (IdNumber, error) {
+	if len(no) != 18 {
+		return IdNumber{}, app.ErrIdNumberInvalid
+	}
+	no = strings.ToUpper(no)
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if no[i] < '0' || no[i] > '9' {
+			return IdNumber{}, app.ErrIdNumberInvalid
+		}
+		sum += int(no[i]-'0') * idNumberWeights[i]
+	}
+	if no[17] != idNumberCheckCodes[sum%11] {
+		return IdNumber{}, app.ErrIdNumberInvalid
+	}
+	birthday, err := time.ParseInLocation("20060102", no[6:14], time.Local)
+	if err != nil || birthday.After(time.Now()) {
+		return IdNumber{}, app.ErrIdNumberInvalid
+	}
+	return IdNumber{
+		Birthday: birthday,
+		Sex:      (no[16] - '0') % 2,
+	}, nil
+}
+
+func validRelation(relation uint8) bool {
+	return relation >= xytmodel.PatientRelationSelf && relation <= xytmodel.PatientRelationParent
+}
+
+// validatePatient 校验实名号和手机号, 出生日期为空时按身份证号补全
+// 户口本登记的也是身份证号, 两种证件按同样的规则校验
+func validatePatient(p *xytmodel.Patient) error {
+	id, err := ParseIdNumber(p.CertificatesNo)
+	if err != nil {
+		return err
+	}
+	p.CertificatesNo = strings.ToUpper(p.CertificatesNo)
+	if p.Birthday == "" {
+		p.Birthday = id.Birthday.Format(time.DateOnly)
+	}
+	birthday, err := time.ParseInLocation(time.DateOnly, p.Birthday, time.Local)
+	if err != nil {
+		return app.ErrBirthdayInvalid
+	}
+	if !birthday.Equal(id.Birthday) || p.Sex != id.Sex {
+		return app.ErrIdNumberMismatch
+	}
+	if !phoneRegexp.MatchString(p.Phone) {
+		return app.ErrPhoneInvalid
+	}
+	if p.ContactsCertificatesNo != "" {
+		if _, err = ParseIdNumber(p.ContactsCertificatesNo); err != nil {
+			return err
+		}
+		p.ContactsCertificatesNo = strings.ToUpper(p.ContactsCertificatesNo)
+	}
+	if p.ContactsPhone != "" && !phoneRegexp.MatchString(p.ContactsPhone) {
+		return app.ErrPhoneInvalid
+	}
+	return nil
+}
+
+// MaskMiddle 保留前 head 个和后 tail 个字符, 中间用 * 代替
+func MaskMiddle(s string, head, tail int) string {
+	r := []rune(s)
+	if len(r) <= head+tail {
+		return s
+	}
+	return string(r[:head]) + strings.Repeat("*", len(r)-head-tail) + string(r[len(r)-tail:])
+}
+
+// MaskPatient 返回给前端的就诊人, 实名号和手机号只保留前 3 位和后 4 位
+func MaskPatient(p xytmodel.Patient) xytmodel.Patient {
+	p.CertificatesNo = MaskMiddle(p.CertificatesNo, 3, 4)
+	p.ContactsCertificatesNo = MaskMiddle(p.ContactsCertificatesNo, 3, 4)
+	p.Phone = MaskMiddle(p.Phone, 3, 4)
+	p.ContactsPhone = MaskMiddle(p.ContactsPhone, 3, 4)
+	return p
+}
+
+// unmaskPatient 提交的值和脱敏后的值一样时换回保存的值
+func unmaskPatient(p *xytmodel.Patient, stored xytmodel.Patient) {
+	masked := MaskPatient(stored)
+	for _, f := range []struct {
+		value          *string
+		masked, stored string
+	}{
+		{&p.CertificatesNo, masked.CertificatesNo, stored.CertificatesNo},
+		{&p.ContactsCertificatesNo, masked.ContactsCertificatesNo, stored.ContactsCertificatesNo},
+		{&p.Phone, masked.Phone, stored.Phone},
+		{&p.ContactsPhone, masked.ContactsPhone, stored.ContactsPhone},
+	} {
+		if *f.value != "" && *f.value == f.masked {
+			*f.value = f.stored
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	repomocks "github.com/solunara/isb/src/repository/mocks"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestValidatePatient(t *testing.T) {
+	testCases := []struct {
+		name string
+		data xytmodel.Patient
+
+		wantErr      error
+		wantBirthday string
+	}{
+		{
+			name:         "出生日期为空时按身份证号补全",
+			data:         xytmodel.Patient{CertificatesNo: "11010519491231002x", Sex: 0, Phone: "13800138000"},
+			wantBirthday: "1949-12-31",
+		},
+		{
+			name:         "出生日期和性别一致",
+			data:         xytmodel.Patient{CertificatesNo: "110101199003071233", Sex: 1, Birthday: "1990-03-07", Phone: "13800138000"},
+			wantBirthday: "1990-03-07",
+		},
+		{
+			name:    "校验码错误",
+			data:    xytmodel.Patient{CertificatesNo: "110101199003071234", Sex: 1, Phone: "13800138000"},
+			wantErr: app.ErrIdNumberInvalid,
+		},
+		{
+			name:    "出生日期不存在",
+			data:    xytmodel.Patient{CertificatesNo: "440106201002290010", Sex: 1, Phone: "13800138000"},
+			wantErr: app.ErrIdNumberInvalid,
+		},
+		{
+			name:    "位数错误",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231", Phone: "13800138000"},
+			wantErr: app.ErrIdNumberInvalid,
+		},
+		{
+			name:    "性别不一致",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Sex: 1, Phone: "13800138000"},
+			wantErr: app.ErrIdNumberMismatch,
+		},
+		{
+			name:    "出生日期不一致",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Birthday: "1949-12-30", Phone: "13800138000"},
+			wantErr: app.ErrIdNumberMismatch,
+		},
+		{
+			name:    "出生日期格式错误",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Birthday: "1949/12/31", Phone: "13800138000"},
+			wantErr: app.ErrBirthdayInvalid,
+		},
+		{
+			name:    "手机号格式错误",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Phone: "12800138000"},
+			wantErr: app.ErrPhoneInvalid,
+		},
+		{
+			name:    "联系人身份证号错误",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Phone: "13800138000", ContactsCertificatesNo: "110101199003071234"},
+			wantErr: app.ErrIdNumberInvalid,
+		},
+		{
+			name:    "联系人手机号错误",
+			data:    xytmodel.Patient{CertificatesNo: "11010519491231002X", Phone: "13800138000", ContactsPhone: "1380013800"},
+			wantErr: app.ErrPhoneInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePatient(&tc.data)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantBirthday, tc.data.Birthday)
+		})
+	}
+}
+
+func TestUnmaskPatient(t *testing.T) {
+	stored := xytmodel.Patient{CertificatesNo: "11010519491231002X", Phone: "13800138000"}
+	data := xytmodel.Patient{CertificatesNo: "110***********002X", Phone: "13900139000"}
+	unmaskPatient(&data, stored)
+	assert.Equal(t, "11010519491231002X", data.CertificatesNo)
+	assert.Equal(t, "13900139000", data.Phone)
+}
+
+func TestPatientService_Update(t *testing.T) {
+	stored := xytmodel.Patient{
+		Id:             "p1",
+		UserId:         "u1",
+		CertificatesNo: "11010519491231002X",
+		Phone:          "13800138000",
+		Relation:       xytmodel.PatientRelationSelf,
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.PatientRepository
+		data xytmodel.Patient
+
+		wantErr error
+	}{
+		{
+			name: "提交脱敏后的值时保留原值",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), "u1", "p1").Return(stored, nil)
+				want := stored
+				want.Phone = "13900139000"
+				want.Birthday = "1949-12-31"
+				repo.EXPECT().Update(gomock.Any(), want).Return(nil)
+				return repo
+			},
+			data: xytmodel.Patient{Id: "p1", UserId: "u1", CertificatesNo: "110***********002X", Phone: "13900139000"},
+		},
+		{
+			name: "其他用户的就诊人",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), "u2", "p1").Return(xytmodel.Patient{}, app.ErrRecordNotFound)
+				return repo
+			},
+			data:    xytmodel.Patient{Id: "p1", UserId: "u2", CertificatesNo: "110***********002X", Phone: "13900139000"},
+			wantErr: app.ErrRecordNotFound,
+		},
+		{
+			name: "关系不合法",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), "u1", "p1").Return(stored, nil)
+				return repo
+			},
+			data:    xytmodel.Patient{Id: "p1", UserId: "u1", CertificatesNo: "110***********002X", Phone: "13900139000", Relation: 100},
+			wantErr: app.ErrPatientRelation,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewPatientService(tc.mock(ctrl), 5)
+			err := svc.Update(context.Background(), tc.data)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestPatientService_Create(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.PatientRepository
+		data xytmodel.Patient
+
+		wantErr error
+	}{
+		{
+			name: "添加成功",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any(), 5).
+					DoAndReturn(func(ctx context.Context, p xytmodel.Patient, maxPatients int) (xytmodel.Patient, error) {
+						assert.NotEmpty(t, p.Id)
+						assert.Equal(t, "1949-12-31", p.Birthday)
+						return p, nil
+					})
+				return repo
+			},
+			data: xytmodel.Patient{UserId: "u1", CertificatesNo: "11010519491231002X", Phone: "13800138000", Relation: xytmodel.PatientRelationSelf},
+		},
+		{
+			name: "没有选择关系",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				return repomocks.NewMockPatientRepository(ctrl)
+			},
+			data:    xytmodel.Patient{UserId: "u1", CertificatesNo: "11010519491231002X", Phone: "13800138000"},
+			wantErr: app.ErrPatientRelation,
+		},
+		{
+			name: "身份证号错误",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				return repomocks.NewMockPatientRepository(ctrl)
+			},
+			data:    xytmodel.Patient{UserId: "u1", CertificatesNo: "110101199003071234", Phone: "13800138000", Relation: xytmodel.PatientRelationSelf},
+			wantErr: app.ErrIdNumberInvalid,
+		},
+		{
+			name: "数量达到上限",
+			mock: func(ctrl *gomock.Controller) repository.PatientRepository {
+				repo := repomocks.NewMockPatientRepository(ctrl)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any(), 5).Return(xytmodel.Patient{}, app.ErrPatientLimit)
+				return repo
+			},
+			data:    xytmodel.Patient{UserId: "u1", CertificatesNo: "11010519491231002X", Phone: "13800138000", Relation: xytmodel.PatientRelationSelf},
+			wantErr: app.ErrPatientLimit,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewPatientService(tc.mock(ctrl), 5)
+			_, err := svc.Create(context.Background(), tc.data)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
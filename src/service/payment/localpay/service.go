@@ -0,0 +1,159 @@
+package localpay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/solunara/isb/src/service/payment"
+)
+
+// HeaderSignature 本地支付通知的签名头
+const HeaderSignature = "X-Localpay-Signature"
+
+var _ payment.Service = &Service{}
+
+// Service 本地模拟的支付渠道, 数据只保存在内存中
+// 通过 Pay 模拟用户完成支付并得到一条带签名的异步通知
+type Service struct {
+	secret []byte
+
+	mu       sync.Mutex
+	seq      int
+	payments map[string]payment.Payment
+	refunds  map[string]payment.Refund
+}
+
+func NewService(secret string) *Service {
+	return &Service{
+		secret:   []byte(secret),
+		payments: make(map[string]payment.Payment),
+		refunds:  make(map[string]payment.Refund),
+	}
+}
+
+func (s *Service) Name() string {
+	return "localpay"
+}
+
+func (s *Service) Create(ctx context.Context, req payment.CreateRequest) (payment.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.payments[req.OutTradeNo]; ok {
+		return p, nil
+	}
+	s.seq++
+	p := payment.Payment{
+		OutTradeNo: req.OutTradeNo,
+		TradeNo:    fmt.Sprintf("local%010d", s.seq),
+		Amount:     req.Amount,
+		Status:     payment.StatusPending,
+		PayParams:  fmt.Sprintf("localpay://pay?out_trade_no=%s", req.OutTradeNo),
+	}
+	s.payments[req.OutTradeNo] = p
+	return p, nil
+}
+
+func (s *Service) Query(ctx context.Context, outTradeNo string) (payment.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[outTradeNo]
+	if !ok {
+		return payment.Payment{}, payment.ErrTradeNotFound
+	}
+	return p, nil
+}
+
+func (s *Service) Refund(ctx context.Context, req payment.RefundRequest) (payment.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.refunds[req.OutRefundNo]; ok {
+		return r, nil
+	}
+	p, ok := s.payments[req.OutTradeNo]
+	if !ok {
+		return payment.Refund{}, payment.ErrTradeNotFound
+	}
+	if p.Status != payment.StatusSuccess {
+		return payment.Refund{}, payment.ErrRefundRejected
+	}
+	if req.Amount == p.Amount {
+		p.Status = payment.StatusRefunded
+		s.payments[req.OutTradeNo] = p
+	}
+	r := payment.Refund{
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    "refund_" + req.OutRefundNo,
+		Amount:      req.Amount,
+		Status:      payment.StatusSuccess,
+	}
+	s.refunds[req.OutRefundNo] = r
+	return r, nil
+}
+
+func (s *Service) QueryRefund(ctx context.Context, outRefundNo string) (payment.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.refunds[outRefundNo]
+	if !ok {
+		return payment.Refund{}, payment.ErrRefundNotFound
+	}
+	return r, nil
+}
+
+func (s *Service) VerifyNotify(ctx context.Context, req *http.Request) (payment.Notify, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return payment.Notify{}, err
+	}
+	expected := s.sign(body)
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(HeaderSignature))) {
+		return payment.Notify{}, payment.ErrInvalidSignature
+	}
+	var notify payment.Notify
+	err = json.Unmarshal(body, &notify)
+	return notify, err
+}
+
+// Pay 模拟用户支付成功, 返回渠道会推送给回调地址的通知请求
+func (s *Service) Pay(outTradeNo string, notifyURL string) (*http.Request, error) {
+	s.mu.Lock()
+	p, ok := s.payments[outTradeNo]
+	if !ok {
+		s.mu.Unlock()
+		return nil, payment.ErrTradeNotFound
+	}
+	p.Status = payment.StatusSuccess
+	s.payments[outTradeNo] = p
+	s.mu.Unlock()
+
+	body, err := json.Marshal(payment.Notify{
+		OutTradeNo: p.OutTradeNo,
+		TradeNo:    p.TradeNo,
+		Amount:     p.Amount,
+		Status:     p.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, s.sign(body))
+	return req, nil
+}
+
+func (s *Service) sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
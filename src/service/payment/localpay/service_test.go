@@ -0,0 +1,82 @@
+package localpay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_VerifyNotify(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper func(body []byte) []byte
+
+		wantErr error
+	}{
+		{
+			name:   "验签成功",
+			tamper: func(body []byte) []byte { return body },
+		},
+		{
+			name: "通知内容被篡改",
+			tamper: func(body []byte) []byte {
+				return bytes.Replace(body, []byte(`"amount":1000`), []byte(`"amount":1`), 1)
+			},
+			wantErr: payment.ErrInvalidSignature,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService("secret")
+			p, err := svc.Create(context.Background(), payment.CreateRequest{OutTradeNo: "123", Amount: 1000})
+			require.NoError(t, err)
+			assert.Equal(t, payment.StatusPending, p.Status)
+
+			req, err := svc.Pay("123", "/xyt/pay/notify")
+			require.NoError(t, err)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			req.Body = io.NopCloser(bytes.NewReader(tc.tamper(body)))
+
+			notify, err := svc.VerifyNotify(context.Background(), req)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, payment.Notify{
+				OutTradeNo: "123",
+				TradeNo:    p.TradeNo,
+				Amount:     1000,
+				Status:     payment.StatusSuccess,
+			}, notify)
+		})
+	}
+}
+
+func TestService_QueryRefund(t *testing.T) {
+	svc := NewService("secret")
+	_, err := svc.Create(context.Background(), payment.CreateRequest{OutTradeNo: "123", Amount: 1000})
+	require.NoError(t, err)
+	_, err = svc.Pay("123", "/xyt/pay/notify")
+	require.NoError(t, err)
+
+	_, err = svc.QueryRefund(context.Background(), "123")
+	assert.Equal(t, payment.ErrRefundNotFound, err)
+
+	refund, err := svc.Refund(context.Background(), payment.RefundRequest{OutTradeNo: "123", OutRefundNo: "123", Amount: 1000})
+	require.NoError(t, err)
+	// 重复退款返回同一退款单
+	again, err := svc.Refund(context.Background(), payment.RefundRequest{OutTradeNo: "123", OutRefundNo: "123", Amount: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, refund, again)
+
+	got, err := svc.QueryRefund(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, refund, got)
+}
@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrInvalidSignature = errors.New("支付通知签名错误")
+	ErrTradeNotFound    = errors.New("支付单不存在")
+	ErrRefundNotFound   = errors.New("退款单不存在")
+	ErrRefundRejected   = errors.New("渠道拒绝退款")
+)
+
+// 支付单状态
+const (
+	StatusPending  = "PENDING"
+	StatusSuccess  = "SUCCESS"
+	StatusClosed   = "CLOSED"
+	StatusRefunded = "REFUNDED"
+)
+
+type Service interface {
+	// Create 发起支付, OutTradeNo 是业务侧订单号, 重复发起返回同一支付单
+	Create(ctx context.Context, req CreateRequest) (Payment, error)
+	Query(ctx context.Context, outTradeNo string) (Payment, error)
+	// Refund 发起退款, 相同 OutRefundNo 重复发起返回同一退款单
+	// 渠道明确拒绝时返回 ErrTradeNotFound 或 ErrRefundRejected, 其他错误不能确定渠道是否受理了退款
+	Refund(ctx context.Context, req RefundRequest) (Refund, error)
+	// QueryRefund 查询退款结果, 渠道没有收到退款请求时返回 ErrRefundNotFound
+	QueryRefund(ctx context.Context, outRefundNo string) (Refund, error)
+	// VerifyNotify 校验异步通知的签名并解析出通知内容
+	VerifyNotify(ctx context.Context, req *http.Request) (Notify, error)
+	// Name 渠道名称, 记录在支付单上
+	Name() string
+}
+
+type CreateRequest struct {
+	OutTradeNo  string
+	Amount      int64 // 单位: 分
+	Description string
+}
+
+type Payment struct {
+	OutTradeNo string `json:"outTradeNo"`
+	TradeNo    string `json:"tradeNo"`
+	Amount     int64  `json:"amount"`
+	Status     string `json:"status"`
+	// 客户端拉起支付需要的参数, 各渠道格式不同
+	PayParams string `json:"payParams"`
+}
+
+type RefundRequest struct {
+	OutTradeNo  string
+	OutRefundNo string
+	Amount      int64
+	Reason      string
+}
+
+type Refund struct {
+	OutRefundNo string `json:"outRefundNo"`
+	RefundNo    string `json:"refundNo"`
+	Amount      int64  `json:"amount"`
+	Status      string `json:"status"`
+}
+
+type Notify struct {
+	OutTradeNo string `json:"outTradeNo"`
+	TradeNo    string `json:"tradeNo"`
+	Amount     int64  `json:"amount"`
+	Status     string `json:"status"`
+}
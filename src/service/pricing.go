@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/types/app"
+)
+
+type PricingService interface {
+	// Quote 排班的挂号费明细, patient 为空时不计算医保报销
+	Quote(ctx context.Context, detail ScheduleDetail, patient *xytmodel.Patient) (xytmodel.OrderPrice, error)
+	// SchedulePrices 排班列表展示的挂号费, 不计算医保报销, 按 sche_id 索引
+	SchedulePrices(ctx context.Context, schedules []xytmodel.Schedule, doctors []xytmodel.Doctor) (map[string]xytmodel.OrderPrice, error)
+	Types(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error)
+	SaveType(ctx context.Context, t xytmodel.RegistrationType) (xytmodel.RegistrationType, error)
+	Fees(ctx context.Context, hosId string, regTypeId uint) ([]xytmodel.RegistrationFee, error)
+	SaveFee(ctx context.Context, fee xytmodel.RegistrationFee) (xytmodel.RegistrationFee, error)
+	DeleteFee(ctx context.Context, hosId string, id uint) error
+}
+
+type pricingService struct {
+	repo      repository.PricingRepository
+	schedules repository.ScheduleRepository
+}
+
+func NewPricingService(repo repository.PricingRepository, schedules repository.ScheduleRepository) PricingService {
+	return &pricingService{
+		repo:      repo,
+		schedules: schedules,
+	}
+}
+
+// Price 计算挂号费明细; 排班没有挂号类型时使用排班的挂号费,
+// 否则依次使用挂号类型下按医生, 按职称配置的挂号费和挂号类型的默认挂号费
+func Price(sche xytmodel.Schedule, doctor xytmodel.Doctor, regType *xytmodel.RegistrationType, fees []xytmodel.RegistrationFee, insured bool) xytmodel.OrderPrice {
+	if regType == nil {
+		return xytmodel.OrderPrice{Source: xytmodel.PriceSourceSchedule, Total: sche.Amount, Payable: sche.Amount}
+	}
+	price := xytmodel.OrderPrice{
+		RegTypeId:   regType.Id,
+		RegTypeName: regType.Name,
+		Source:      xytmodel.PriceSourceType,
+		Total:       regType.Fee,
+	}
+	for _, fee := range fees {
+		if fee.RegTypeId != regType.Id {
+			continue
+		}
+		if fee.DocId != "" && fee.DocId == doctor.Id {
+			price.Source, price.Total = xytmodel.PriceSourceDoctor, fee.Fee
+			break
+		}
+		if fee.DocId == "" && fee.Rank != "" && fee.Rank == doctor.Rank {
+			price.Source, price.Total = xytmodel.PriceSourceRank, fee.Fee
+		}
+	}
+	if insured {
+		price.Insurance = min(regType.InsuranceCover, price.Total)
+	}
+	price.Payable = price.Total - price.Insurance
+	return price
+}
+
+func (svc *pricingService) Quote(ctx context.Context, detail ScheduleDetail, patient *xytmodel.Patient) (xytmodel.OrderPrice, error) {
+	if detail.Schedule.RegTypeId == 0 {
+		return Price(detail.Schedule, detail.Doctor, nil, nil, false), nil
+	}
+	regType, err := svc.findType(ctx, detail.Schedule.HosID, detail.Schedule.RegTypeId)
+	if err != nil {
+		return xytmodel.OrderPrice{}, err
+	}
+	fees, err := svc.repo.FindFees(ctx, []uint{regType.Id})
+	if err != nil {
+		return xytmodel.OrderPrice{}, err
+	}
+	// 医院支持医保并且就诊人是医保用户时才报销
+	insured := patient != nil && detail.Hospital.IsMedicalInsurance && patient.IsInsure == xytmodel.PatientInsured
+	return Price(detail.Schedule, detail.Doctor, &regType, fees, insured), nil
+}
+
+func (svc *pricingService) SchedulePrices(ctx context.Context, schedules []xytmodel.Schedule, doctors []xytmodel.Doctor) (map[string]xytmodel.OrderPrice, error) {
+	var typeIds []uint
+	for _, sche := range schedules {
+		if sche.RegTypeId != 0 {
+			typeIds = append(typeIds, sche.RegTypeId)
+		}
+	}
+	types, err := svc.repo.FindTypes(ctx, typeIds)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := svc.repo.FindFees(ctx, typeIds)
+	if err != nil {
+		return nil, err
+	}
+	var typeMap = make(map[uint]xytmodel.RegistrationType, len(types))
+	for _, t := range types {
+		typeMap[t.Id] = t
+	}
+	var docMap = make(map[string]xytmodel.Doctor, len(doctors))
+	for _, doc := range doctors {
+		docMap[doc.Id] = doc
+	}
+	var prices = make(map[string]xytmodel.OrderPrice, len(schedules))
+	for _, sche := range schedules {
+		// 挂号类型不存在或者不属于排班的医院时按排班的挂号费展示, 预约时 Quote 会报错
+		var regType *xytmodel.RegistrationType
+		if t, ok := typeMap[sche.RegTypeId]; ok && t.HosId == sche.HosID {
+			regType = &t
+		}
+		prices[sche.ScheId] = Price(sche, docMap[sche.DocId], regType, fees, false)
+	}
+	return prices, nil
+}
+
+func (svc *pricingService) Types(ctx context.Context, hosId string) ([]xytmodel.RegistrationType, error) {
+	return svc.repo.ListTypes(ctx, hosId)
+}
+
+// findType 挂号类型必须属于 hosId
+func (svc *pricingService) findType(ctx context.Context, hosId string, id uint) (xytmodel.RegistrationType, error) {
+	types, err := svc.repo.FindTypes(ctx, []uint{id})
+	if err != nil {
+		return xytmodel.RegistrationType{}, err
+	}
+	if len(types) == 0 || types[0].HosId != hosId {
+		return xytmodel.RegistrationType{}, app.ErrRecordNotFound
+	}
+	return types[0], nil
+}
+
+func (svc *pricingService) SaveType(ctx context.Context, t xytmodel.RegistrationType) (xytmodel.RegistrationType, error) {
+	if t.Id != 0 {
+		if _, err := svc.findType(ctx, t.HosId, t.Id); err != nil {
+			return xytmodel.RegistrationType{}, err
+		}
+	}
+	err := svc.repo.SaveType(ctx, &t)
+	return t, err
+}
+
+func (svc *pricingService) Fees(ctx context.Context, hosId string, regTypeId uint) ([]xytmodel.RegistrationFee, error) {
+	if _, err := svc.findType(ctx, hosId, regTypeId); err != nil {
+		return nil, err
+	}
+	return svc.repo.FindFees(ctx, []uint{regTypeId})
+}
+
+// SaveFee 按医生配置时医生必须属于挂号类型的医院, 同时配置了医生和职称时只保留医生
+func (svc *pricingService) SaveFee(ctx context.Context, fee xytmodel.RegistrationFee) (xytmodel.RegistrationFee, error) {
+	if _, err := svc.findType(ctx, fee.HosId, fee.RegTypeId); err != nil {
+		return xytmodel.RegistrationFee{}, err
+	}
+	if fee.DocId != "" {
+		doctor, err := svc.schedules.FindDoctor(ctx, fee.DocId)
+		if err != nil {
+			return xytmodel.RegistrationFee{}, err
+		}
+		if doctor.HosId != fee.HosId {
+			return xytmodel.RegistrationFee{}, app.ErrRecordNotFound
+		}
+		fee.Rank = ""
+	}
+	err := svc.repo.SaveFee(ctx, &fee)
+	return fee, err
+}
+
+func (svc *pricingService) DeleteFee(ctx context.Context, hosId string, id uint) error {
+	return svc.repo.DeleteFee(ctx, hosId, id)
+}
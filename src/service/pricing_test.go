@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	repomocks "github.com/solunara/isb/src/repository/mocks"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPrice(t *testing.T) {
+	regType := &xytmodel.RegistrationType{Id: 1, HosId: "h1", Name: "专家门诊", Fee: 20, InsuranceCover: 8}
+	fees := []xytmodel.RegistrationFee{
+		{RegTypeId: 1, Rank: "主任医师", Fee: 50},
+		{RegTypeId: 1, DocId: "doc1", Fee: 100},
+		{RegTypeId: 2, Rank: "副主任医师", Fee: 30},
+	}
+	sche := xytmodel.Schedule{Amount: 15}
+	testCases := []struct {
+		name    string
+		doctor  xytmodel.Doctor
+		regType *xytmodel.RegistrationType
+		insured bool
+
+		want xytmodel.OrderPrice
+	}{
+		{
+			name:   "排班没有挂号类型",
+			doctor: xytmodel.Doctor{Id: "doc1"},
+			want:   xytmodel.OrderPrice{Source: xytmodel.PriceSourceSchedule, Total: 15, Payable: 15},
+		},
+		{
+			name:    "按医生配置的挂号费优先于职称",
+			doctor:  xytmodel.Doctor{Id: "doc1", Rank: "主任医师"},
+			regType: regType,
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceDoctor, Total: 100, Payable: 100},
+		},
+		{
+			name:    "按职称配置的挂号费",
+			doctor:  xytmodel.Doctor{Id: "doc2", Rank: "主任医师"},
+			regType: regType,
+			insured: true,
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceRank, Total: 50, Insurance: 8, Payable: 42},
+		},
+		{
+			name:    "其他挂号类型的配置不生效",
+			doctor:  xytmodel.Doctor{Id: "doc3", Rank: "副主任医师"},
+			regType: regType,
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceType, Total: 20, Payable: 20},
+		},
+		{
+			name:    "医保报销不超过挂号费",
+			doctor:  xytmodel.Doctor{Id: "doc3"},
+			regType: &xytmodel.RegistrationType{Id: 3, Name: "普通门诊", Fee: 5, InsuranceCover: 8},
+			insured: true,
+			want:    xytmodel.OrderPrice{RegTypeId: 3, RegTypeName: "普通门诊", Source: xytmodel.PriceSourceType, Total: 5, Insurance: 5, Payable: 0},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Price(sche, tc.doctor, tc.regType, fees, tc.insured))
+		})
+	}
+}
+
+func TestPricingService_Quote(t *testing.T) {
+	detail := func(isMedicalInsurance bool) ScheduleDetail {
+		return ScheduleDetail{
+			Schedule: xytmodel.Schedule{ScheId: "s1", HosID: "h1", RegTypeId: 1, Amount: 15},
+			Doctor:   xytmodel.Doctor{Id: "doc1", Rank: "主任医师"},
+			Hospital: xytmodel.Hospital{UID: "h1", IsMedicalInsurance: isMedicalInsurance},
+		}
+	}
+	regType := xytmodel.RegistrationType{Id: 1, HosId: "h1", Name: "专家门诊", Fee: 20, InsuranceCover: 8}
+	testCases := []struct {
+		name    string
+		repo    func(ctrl *gomock.Controller) repository.PricingRepository
+		detail  ScheduleDetail
+		patient *xytmodel.Patient
+
+		want    xytmodel.OrderPrice
+		wantErr error
+	}{
+		{
+			name: "医保用户在支持医保的医院",
+			repo: func(ctrl *gomock.Controller) repository.PricingRepository {
+				repo := repomocks.NewMockPricingRepository(ctrl)
+				repo.EXPECT().FindTypes(gomock.Any(), []uint{1}).Return([]xytmodel.RegistrationType{regType}, nil)
+				repo.EXPECT().FindFees(gomock.Any(), []uint{1}).Return(nil, nil)
+				return repo
+			},
+			detail:  detail(true),
+			patient: &xytmodel.Patient{IsInsure: xytmodel.PatientInsured},
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceType, Total: 20, Insurance: 8, Payable: 12},
+		},
+		{
+			name: "医院不支持医保",
+			repo: func(ctrl *gomock.Controller) repository.PricingRepository {
+				repo := repomocks.NewMockPricingRepository(ctrl)
+				repo.EXPECT().FindTypes(gomock.Any(), []uint{1}).Return([]xytmodel.RegistrationType{regType}, nil)
+				repo.EXPECT().FindFees(gomock.Any(), []uint{1}).Return(nil, nil)
+				return repo
+			},
+			detail:  detail(false),
+			patient: &xytmodel.Patient{IsInsure: xytmodel.PatientInsured},
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceType, Total: 20, Payable: 20},
+		},
+		{
+			name: "自费用户",
+			repo: func(ctrl *gomock.Controller) repository.PricingRepository {
+				repo := repomocks.NewMockPricingRepository(ctrl)
+				repo.EXPECT().FindTypes(gomock.Any(), []uint{1}).Return([]xytmodel.RegistrationType{regType}, nil)
+				repo.EXPECT().FindFees(gomock.Any(), []uint{1}).Return(nil, nil)
+				return repo
+			},
+			detail:  detail(true),
+			patient: &xytmodel.Patient{IsInsure: xytmodel.PatientSelfPay},
+			want:    xytmodel.OrderPrice{RegTypeId: 1, RegTypeName: "专家门诊", Source: xytmodel.PriceSourceType, Total: 20, Payable: 20},
+		},
+		{
+			name: "挂号类型不属于排班的医院",
+			repo: func(ctrl *gomock.Controller) repository.PricingRepository {
+				repo := repomocks.NewMockPricingRepository(ctrl)
+				repo.EXPECT().FindTypes(gomock.Any(), []uint{1}).Return([]xytmodel.RegistrationType{{Id: 1, HosId: "h2"}}, nil)
+				return repo
+			},
+			detail:  detail(true),
+			wantErr: app.ErrRecordNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewPricingService(tc.repo(ctrl), nil)
+			price, err := svc.Quote(context.Background(), tc.detail, tc.patient)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, price)
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package region
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/solunara/isb/src/types/app"
+)
+
+// Level 行政区划级别
+type Level int8
+
+const (
+	LevelProvince Level = 1
+	LevelCity     Level = 2
+	LevelDistrict Level = 3
+)
+
+// 省份类别
+const (
+	CategoryProvince     uint8 = 1
+	CategoryAutonomous   uint8 = 2
+	CategoryMunicipality uint8 = 3
+)
+
+// validCode 省市区编码分别为 2, 4, 6 位数字; 不设区的地级市直接下辖乡镇, 编码为 9 位
+func (l Level) validCode(code string) bool {
+	if strings.Trim(code, "0123456789") != "" {
+		return false
+	}
+	return len(code) == int(l)*2 || (l == LevelDistrict && len(code) == 9)
+}
+
+// Node 数据文件中的一个行政区划, 省份可以带简称和类别, 没有时按名称补全
+type Node struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	AbbrZh   string `json:"abbr_zh,omitempty"`
+	AbbrEn   string `json:"abbr_en,omitempty"`
+	Category uint8  `json:"category,omitempty"`
+	Children []Node `json:"children,omitempty"`
+}
+
+// Dataset 一个版本的全量行政区划数据
+type Dataset struct {
+	Version string `json:"version"`
+	Regions []Node `json:"regions"`
+	// 撤销的编码合并到的新编码, 没有指定时按同一省份内同名的新增编码推断
+	Merges map[string]string `json:"merges"`
+	// 数据文件的 sha256
+	Checksum string `json:"-"`
+}
+
+// LoadDataset 文件为 {"version", "regions", "merges"} 对象, 或者 pca-code.json 格式的数组;
+// 文件中没有版本号时使用 version
+func LoadDataset(data []byte, version string) (Dataset, error) {
+	var ds Dataset
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &ds.Regions); err != nil {
+			return ds, fmt.Errorf("%w: %v", app.ErrRegionDataset, err)
+		}
+	} else if err := json.Unmarshal(data, &ds); err != nil {
+		return ds, fmt.Errorf("%w: %v", app.ErrRegionDataset, err)
+	}
+	if ds.Version == "" {
+		ds.Version = version
+	}
+	if ds.Version == "" || len(ds.Version) > 32 {
+		return ds, fmt.Errorf("%w: 版本号不能为空且不能超过 32 个字符", app.ErrRegionDataset)
+	}
+	sum := sha256.Sum256(data)
+	ds.Checksum = hex.EncodeToString(sum[:])
+	return ds, nil
+}
+
+// Region 展开后的一个行政区划
+type Region struct {
+	Level      Level  `json:"level"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	ParentCode string `json:"parentCode"`
+	// 只有省份有简称, 类别为所属省份的类别
+	AbbrZh   string `json:"abbrZh,omitempty"`
+	AbbrEn   string `json:"abbrEn,omitempty"`
+	Category uint8  `json:"category"`
+}
+
+// regionSet 按编码索引的全部行政区划
+type regionSet map[string]Region
+
+// province 所属省份
+func (rs regionSet) province(r Region) Region {
+	for r.Level > LevelProvince {
+		r = rs[r.ParentCode]
+	}
+	return r
+}
+
+// flatten 展开并校验数据: 编码与级别一致且不重复
+func (ds Dataset) flatten() (regionSet, error) {
+	rs := regionSet{}
+	var walk func(nodes []Node, level Level, parent Region) error
+	walk = func(nodes []Node, level Level, parent Region) error {
+		for _, n := range nodes {
+			if level > LevelDistrict {
+				return fmt.Errorf("%w: %s 超过三级", app.ErrRegionDataset, n.Code)
+			}
+			if !level.validCode(n.Code) {
+				return fmt.Errorf("%w: 编码 %s 格式错误", app.ErrRegionDataset, n.Code)
+			}
+			if n.Name == "" {
+				return fmt.Errorf("%w: 编码 %s 没有名称", app.ErrRegionDataset, n.Code)
+			}
+			if _, ok := rs[n.Code]; ok {
+				return fmt.Errorf("%w: 编码 %s 重复", app.ErrRegionDataset, n.Code)
+			}
+			r := Region{Level: level, Code: n.Code, Name: n.Name, ParentCode: parent.Code, Category: parent.Category}
+			if level == LevelProvince {
+				r.AbbrZh, r.AbbrEn, r.Category = n.AbbrZh, n.AbbrEn, n.Category
+				if r.AbbrZh == "" && r.AbbrEn == "" {
+					abbr := provinceAbbrs[n.Name]
+					r.AbbrZh, r.AbbrEn = abbr[0], abbr[1]
+				}
+				if r.Category == 0 {
+					r.Category = categoryByProvinceName(n.Name)
+				}
+			}
+			rs[n.Code] = r
+			if err := walk(n.Children, level+1, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(ds.Regions, LevelProvince, Region{}); err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("%w: 没有行政区划", app.ErrRegionDataset)
+	}
+	return rs, nil
+}
+
+func categoryByProvinceName(name string) uint8 {
+	switch name {
+	case "北京市", "北京", "天津市", "天津", "上海市", "上海", "重庆市", "重庆":
+		return CategoryMunicipality
+	}
+	if strings.Contains(name, "自治区") {
+		return CategoryAutonomous
+	}
+	return CategoryProvince
+}
+
+// 数据文件没有简称时使用的省份中文和英文简称
+var provinceAbbrs = map[string][2]string{
+	"北京市":      {"京", "BJ"},
+	"天津市":      {"津", "TJ"},
+	"上海市":      {"沪", "SH"},
+	"重庆市":      {"渝", "CQ"},
+	"河北省":      {"冀", "HE"},
+	"山西省":      {"晋", "SX"},
+	"辽宁省":      {"辽", "LN"},
+	"吉林省":      {"吉", "JL"},
+	"黑龙江省":     {"黑", "HL"},
+	"江苏省":      {"苏", "JS"},
+	"浙江省":      {"浙", "ZJ"},
+	"安徽省":      {"皖", "AH"},
+	"福建省":      {"闽", "FJ"},
+	"江西省":      {"赣", "JX"},
+	"山东省":      {"鲁", "SD"},
+	"河南省":      {"豫", "HA"},
+	"湖北省":      {"鄂", "HB"},
+	"湖南省":      {"湘", "HN"},
+	"广东省":      {"粤", "GD"},
+	"海南省":      {"琼", "HI"},
+	"四川省":      {"川", "SC"},
+	"贵州省":      {"黔", "GZ"},
+	"云南省":      {"滇", "YN"},
+	"陕西省":      {"陕", "SN"},
+	"甘肃省":      {"甘", "GS"},
+	"青海省":      {"青", "QH"},
+	"台湾省":      {"台", "TW"},
+	"内蒙古自治区":   {"蒙", "NM"},
+	"广西壮族自治区":  {"桂", "GX"},
+	"西藏自治区":    {"藏", "XZ"},
+	"宁夏回族自治区":  {"宁", "NX"},
+	"新疆维吾尔自治区": {"新", "XJ"},
+	"香港特别行政区":  {"港", "HK"},
+	"澳门特别行政区":  {"澳", "MO"},
+}
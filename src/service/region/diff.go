@@ -0,0 +1,109 @@
+package region
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/solunara/isb/src/types/app"
+)
+
+// Change 一个编码的变化, 撤销的编码 NewCode 为合并到的编码, 为空表示直接撤销
+type Change struct {
+	Level         Level  `json:"level"`
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	ParentCode    string `json:"parentCode"`
+	OldName       string `json:"oldName,omitempty"`
+	OldParentCode string `json:"oldParentCode,omitempty"`
+	NewCode       string `json:"newCode,omitempty"`
+	// 仍在使用该编码的医院和就诊人数量, 只统计撤销的编码
+	References int64 `json:"references,omitempty"`
+}
+
+// Diff 新版本数据与当前数据的差异
+type Diff struct {
+	FromVersion string   `json:"fromVersion"`
+	Version     string   `json:"version"`
+	Added       []Change `json:"added"`
+	Updated     []Change `json:"updated"`
+	Retired     []Change `json:"retired"`
+}
+
+// Unmapped 撤销后没有代替编码但仍在使用的编码
+func (d Diff) Unmapped() []string {
+	var codes []string
+	for _, c := range d.Retired {
+		if c.NewCode == "" && c.References > 0 {
+			codes = append(codes, c.Code)
+		}
+	}
+	return codes
+}
+
+// diffRegions 比较当前数据 cur 和新数据 next; 名称, 上级, 简称或类别变化的编码为更新
+func diffRegions(cur, next regionSet, merges map[string]string) (Diff, error) {
+	var diff Diff
+	for code, r := range next {
+		old, ok := cur[code]
+		if !ok {
+			diff.Added = append(diff.Added, Change{Level: r.Level, Code: code, Name: r.Name, ParentCode: r.ParentCode})
+			continue
+		}
+		if old != r {
+			diff.Updated = append(diff.Updated, Change{
+				Level:         r.Level,
+				Code:          code,
+				Name:          r.Name,
+				ParentCode:    r.ParentCode,
+				OldName:       old.Name,
+				OldParentCode: old.ParentCode,
+			})
+		}
+	}
+
+	for code, old := range cur {
+		if _, ok := next[code]; ok {
+			continue
+		}
+		change := Change{Level: old.Level, Code: code, Name: old.Name, ParentCode: old.ParentCode}
+		if newCode, ok := merges[code]; ok {
+			target, ok := next[newCode]
+			if !ok || target.Level != old.Level {
+				return diff, fmt.Errorf("%w: %s 合并到的编码 %s 不存在或级别不同", app.ErrRegionDataset, code, newCode)
+			}
+			change.NewCode = newCode
+		} else {
+			change.NewCode = inferMerge(cur, next, diff.Added, old)
+		}
+		diff.Retired = append(diff.Retired, change)
+	}
+	for code := range merges {
+		if _, ok := next[code]; ok {
+			return diff, fmt.Errorf("%w: 合并的编码 %s 在新数据中仍然存在", app.ErrRegionDataset, code)
+		}
+	}
+
+	for _, changes := range [][]Change{diff.Added, diff.Updated, diff.Retired} {
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].Code < changes[j].Code
+		})
+	}
+	return diff, nil
+}
+
+// inferMerge 撤销的编码在同一省份内有唯一一个同级同名的新增编码时, 认为是编码调整
+func inferMerge(cur, next regionSet, added []Change, old Region) string {
+	province := cur.province(old).Name
+	var found string
+	for _, c := range added {
+		r := next[c.Code]
+		if r.Level != old.Level || r.Name != old.Name || next.province(r).Name != province {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = c.Code
+	}
+	return found
+}
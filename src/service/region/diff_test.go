@@ -0,0 +1,176 @@
+package region
+
+import (
+	"testing"
+
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDataset(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		version string
+
+		wantVersion string
+		wantRegions regionSet
+		wantErr     error
+	}{
+		{
+			name:        "pca数组",
+			data:        `[{"code":"11","name":"北京市","children":[{"code":"1101","name":"市辖区","children":[{"code":"110101","name":"东城区"}]}]}]`,
+			version:     "2023",
+			wantVersion: "2023",
+			wantRegions: regionSet{
+				"11":     {Level: LevelProvince, Code: "11", Name: "北京市", AbbrZh: "京", AbbrEn: "BJ", Category: CategoryMunicipality},
+				"1101":   {Level: LevelCity, Code: "1101", Name: "市辖区", ParentCode: "11", Category: CategoryMunicipality},
+				"110101": {Level: LevelDistrict, Code: "110101", Name: "东城区", ParentCode: "1101", Category: CategoryMunicipality},
+			},
+		},
+		{
+			name:        "带版本号和简称",
+			data:        `{"version":"2024","regions":[{"code":"45","name":"广西壮族自治区","abbr_zh":"桂","abbr_en":"GX"}]}`,
+			version:     "2023",
+			wantVersion: "2024",
+			wantRegions: regionSet{
+				"45": {Level: LevelProvince, Code: "45", Name: "广西壮族自治区", AbbrZh: "桂", AbbrEn: "GX", Category: CategoryAutonomous},
+			},
+		},
+		{
+			name:    "没有版本号",
+			data:    `[{"code":"11","name":"北京市"}]`,
+			wantErr: app.ErrRegionDataset,
+		},
+		{
+			name:    "编码长度与级别不符",
+			data:    `[{"code":"11","name":"北京市","children":[{"code":"110101","name":"东城区"}]}]`,
+			version: "2023",
+			wantErr: app.ErrRegionDataset,
+		},
+		{
+			name:    "编码重复",
+			data:    `[{"code":"11","name":"北京市"},{"code":"11","name":"天津市"}]`,
+			version: "2023",
+			wantErr: app.ErrRegionDataset,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ds, err := LoadDataset([]byte(tc.data), tc.version)
+			if err == nil {
+				var rs regionSet
+				rs, err = ds.flatten()
+				if err == nil {
+					assert.Equal(t, tc.wantVersion, ds.Version)
+					assert.Len(t, ds.Checksum, 64)
+					assert.Equal(t, tc.wantRegions, rs)
+				}
+			}
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestDiffRegions(t *testing.T) {
+	cur := regionSet{
+		"11":     {Level: LevelProvince, Code: "11", Name: "北京市", Category: CategoryMunicipality},
+		"1101":   {Level: LevelCity, Code: "1101", Name: "市辖区", ParentCode: "11", Category: CategoryMunicipality},
+		"110101": {Level: LevelDistrict, Code: "110101", Name: "东城区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110103": {Level: LevelDistrict, Code: "110103", Name: "崇文区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110104": {Level: LevelDistrict, Code: "110104", Name: "宣武区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110199": {Level: LevelDistrict, Code: "110199", Name: "朝阳区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110120": {Level: LevelDistrict, Code: "110120", Name: "撤销区", ParentCode: "1101", Category: CategoryMunicipality},
+	}
+	next := regionSet{
+		"11":     {Level: LevelProvince, Code: "11", Name: "北京市", Category: CategoryMunicipality},
+		"1101":   {Level: LevelCity, Code: "1101", Name: "北京城区", ParentCode: "11", Category: CategoryMunicipality},
+		"110101": {Level: LevelDistrict, Code: "110101", Name: "东城区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110102": {Level: LevelDistrict, Code: "110102", Name: "西城区", ParentCode: "1101", Category: CategoryMunicipality},
+		"110105": {Level: LevelDistrict, Code: "110105", Name: "朝阳区", ParentCode: "1101", Category: CategoryMunicipality},
+	}
+
+	testCases := []struct {
+		name   string
+		merges map[string]string
+
+		wantDiff Diff
+		wantErr  error
+	}{
+		{
+			name:   "新增改名和合并",
+			merges: map[string]string{"110103": "110101", "110104": "110102"},
+			wantDiff: Diff{
+				Added: []Change{
+					{Level: LevelDistrict, Code: "110102", Name: "西城区", ParentCode: "1101"},
+					{Level: LevelDistrict, Code: "110105", Name: "朝阳区", ParentCode: "1101"},
+				},
+				Updated: []Change{
+					{Level: LevelCity, Code: "1101", Name: "北京城区", ParentCode: "11", OldName: "市辖区", OldParentCode: "11"},
+				},
+				Retired: []Change{
+					{Level: LevelDistrict, Code: "110103", Name: "崇文区", ParentCode: "1101", NewCode: "110101"},
+					{Level: LevelDistrict, Code: "110104", Name: "宣武区", ParentCode: "1101", NewCode: "110102"},
+					{Level: LevelDistrict, Code: "110120", Name: "撤销区", ParentCode: "1101"},
+					// 同省份同名的新增编码
+					{Level: LevelDistrict, Code: "110199", Name: "朝阳区", ParentCode: "1101", NewCode: "110105"},
+				},
+			},
+		},
+		{
+			name:    "合并到不存在的编码",
+			merges:  map[string]string{"110103": "110109"},
+			wantErr: app.ErrRegionDataset,
+		},
+		{
+			name:    "合并到不同级别",
+			merges:  map[string]string{"110103": "1101"},
+			wantErr: app.ErrRegionDataset,
+		},
+		{
+			name:    "合并的编码仍然存在",
+			merges:  map[string]string{"110101": "110102"},
+			wantErr: app.ErrRegionDataset,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := diffRegions(cur, next, tc.merges)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantDiff, diff)
+		})
+	}
+}
+
+func TestDiff_Unmapped(t *testing.T) {
+	diff := Diff{Retired: []Change{
+		{Code: "110103", NewCode: "110101", References: 3},
+		{Code: "110104", References: 2},
+		{Code: "110120"},
+	}}
+	assert.Equal(t, []string{"110104"}, diff.Unmapped())
+}
+
+func TestRegionSet_ChainColumns(t *testing.T) {
+	rs := regionSet{
+		"11":     {Level: LevelProvince, Code: "11", Name: "北京市"},
+		"1101":   {Level: LevelCity, Code: "1101", Name: "市辖区", ParentCode: "11"},
+		"110101": {Level: LevelDistrict, Code: "110101", Name: "东城区", ParentCode: "1101"},
+	}
+	columns := rs.chainColumns(rs["110101"])
+	assert.Equal(t, map[string]any{
+		"province_code": "11", "province_name": "北京市",
+		"city_code": "1101", "city_name": "市辖区",
+		"district_code": "110101", "district_name": "东城区",
+	}, columns)
+	assert.Equal(t, map[string]any{
+		"province_code": "11", "city_code": "1101", "district_code": "110101",
+	}, codeColumns(columns))
+}
@@ -0,0 +1,216 @@
+package region
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+)
+
+// CodeCountry 全国, 下级为全部省份
+const CodeCountry = "86"
+
+// 直辖市和省直辖县的市级占位名称, 不参与名称查找, 也不出现在完整名称中
+var placeholderNames = map[string]bool{
+	"市辖区":         true,
+	"县":           true,
+	"省直辖县级行政区划":   true,
+	"自治区直辖县级行政区划": true,
+}
+
+// 名称查找时去掉的后缀, 长的在前
+var nameSuffixes = []string{"特别行政区", "维吾尔自治区", "壮族自治区", "回族自治区", "自治区", "自治州", "地区", "省", "市", "盟", "区", "县"}
+
+// shortName 去掉行政区划名称的后缀, 北京市 -> 北京, 至少保留两个字
+func shortName(name string) string {
+	for _, suffix := range nameSuffixes {
+		short := strings.TrimSuffix(name, suffix)
+		if short != name && len([]rune(short)) >= 2 {
+			return short
+		}
+	}
+	return name
+}
+
+// Path 一个编码对应的省, 市, 区县, 直辖市的市级为占位的市辖区
+type Path struct {
+	Code     string  `json:"code"`
+	FullName string  `json:"fullName"`
+	Province Region  `json:"province"`
+	City     *Region `json:"city,omitempty"`
+	District *Region `json:"district,omitempty"`
+}
+
+// Index 内存中某个版本的全部省市区, 创建后只读
+type Index struct {
+	Version   string
+	regions   regionSet
+	children  map[string][]string
+	names     map[string][]string
+	districts map[string]xytmodel.District
+}
+
+func newIndex(snap cache.RegionSnapshot) *Index {
+	ix := &Index{
+		Version:   snap.Version,
+		regions:   snapshotRegions(snap),
+		children:  map[string][]string{},
+		names:     map[string][]string{},
+		districts: make(map[string]xytmodel.District, len(snap.Districts)),
+	}
+	for _, d := range snap.Districts {
+		ix.districts[d.Code] = d
+	}
+	for code, r := range ix.regions {
+		parent := r.ParentCode
+		if r.Level == LevelProvince {
+			parent = CodeCountry
+		}
+		ix.children[parent] = append(ix.children[parent], code)
+		if placeholderNames[r.Name] {
+			continue
+		}
+		keys := []string{r.Name, shortName(r.Name)}
+		if r.AbbrZh != "" {
+			keys = append(keys, r.AbbrZh)
+		}
+		if r.AbbrEn != "" {
+			keys = append(keys, strings.ToUpper(r.AbbrEn))
+		}
+		for _, key := range keys {
+			if !slices.Contains(ix.names[key], code) {
+				ix.names[key] = append(ix.names[key], code)
+			}
+		}
+	}
+	for _, codes := range ix.children {
+		sort.Strings(codes)
+	}
+	for _, codes := range ix.names {
+		ix.sortCodes(codes)
+	}
+	return ix
+}
+
+// sortCodes 上级在前, 同级按编码
+func (ix *Index) sortCodes(codes []string) {
+	sort.Slice(codes, func(i, j int) bool {
+		a, b := ix.regions[codes[i]], ix.regions[codes[j]]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		return a.Code < b.Code
+	})
+}
+
+// Get 编码对应的行政区划
+func (ix *Index) Get(code string) (Region, bool) {
+	r, ok := ix.regions[code]
+	return r, ok
+}
+
+// Children 下级行政区划, code 为 86 时返回全部省份; 编码不存在时 ok 为 false
+func (ix *Index) Children(code string) ([]Region, bool) {
+	if _, ok := ix.regions[code]; !ok && code != CodeCountry {
+		return nil, false
+	}
+	codes := ix.children[code]
+	result := make([]Region, 0, len(codes))
+	for _, c := range codes {
+		result = append(result, ix.regions[c])
+	}
+	return result, true
+}
+
+// HasChildren 是否有下级行政区划
+func (ix *Index) HasChildren(code string) bool {
+	return len(ix.children[code]) > 0
+}
+
+// Path 编码对应的完整路径
+func (ix *Index) Path(code string) (Path, bool) {
+	r, ok := ix.regions[code]
+	if !ok {
+		return Path{}, false
+	}
+	p := Path{Code: code}
+	var names []string
+	for {
+		region := r
+		switch r.Level {
+		case LevelProvince:
+			p.Province = region
+		case LevelCity:
+			p.City = &region
+		case LevelDistrict:
+			p.District = &region
+		}
+		if !placeholderNames[r.Name] {
+			names = append(names, r.Name)
+		}
+		if r.Level == LevelProvince {
+			break
+		}
+		r = ix.regions[r.ParentCode]
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		p.FullName += names[i]
+	}
+	return p, true
+}
+
+// Lookup 按名称, 去掉后缀的名称或者省份简称查找, 上级在前
+func (ix *Index) Lookup(name string) []Path {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+	var codes []string
+	for _, key := range []string{name, shortName(name), strings.ToUpper(name)} {
+		for _, code := range ix.names[key] {
+			if !slices.Contains(codes, code) {
+				codes = append(codes, code)
+			}
+		}
+	}
+	ix.sortCodes(codes)
+	paths := make([]Path, 0, len(codes))
+	for _, code := range codes {
+		p, _ := ix.Path(code)
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// FindCity 按名称查找市, 直辖市按省份名称查找, 与普通的市一样处理
+func (ix *Index) FindCity(name string) (Region, bool) {
+	for _, p := range ix.Lookup(name) {
+		switch {
+		case p.District != nil:
+		case p.City != nil:
+			return *p.City, true
+		case p.Province.Category == CategoryMunicipality:
+			return p.Province, true
+		}
+	}
+	return Region{}, false
+}
+
+// Districts code 下的全部区县, code 可以是省或者市
+func (ix *Index) Districts(code string) []xytmodel.District {
+	result := []xytmodel.District{}
+	var walk func(code string)
+	walk = func(code string) {
+		for _, c := range ix.children[code] {
+			if d, ok := ix.districts[c]; ok {
+				result = append(result, d)
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(code)
+	return result
+}
@@ -0,0 +1,206 @@
+package region
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+	cachemock "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func testSnapshot() cache.RegionSnapshot {
+	return cache.RegionSnapshot{
+		Version: "2023",
+		Provinces: []xytmodel.Province{
+			{Code: "11", Name: "北京市", Abbr_zh: "京", Abbr_en: "BJ", Category: CategoryMunicipality},
+			{Code: "44", Name: "广东省", Abbr_zh: "粤", Abbr_en: "GD", Category: CategoryProvince},
+		},
+		Cities: []xytmodel.City{
+			{Code: "1101", Name: "市辖区", ProvinceCode: "11", Category: CategoryMunicipality},
+			{Code: "4401", Name: "广州市", ProvinceCode: "44", Category: CategoryProvince},
+			{Code: "4419", Name: "东莞市", ProvinceCode: "44", Category: CategoryProvince},
+		},
+		Districts: []xytmodel.District{
+			{Code: "110105", Name: "朝阳区", CityCode: "1101", Category: CategoryMunicipality},
+			{Code: "110101", Name: "东城区", CityCode: "1101", Category: CategoryMunicipality},
+			{Code: "440106", Name: "天河区", CityCode: "4401", Category: CategoryProvince},
+		},
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ix := newIndex(testSnapshot())
+
+	provinces, ok := ix.Children(CodeCountry)
+	require.True(t, ok)
+	assert.Equal(t, []string{"11", "44"}, []string{provinces[0].Code, provinces[1].Code})
+	districts, ok := ix.Children("1101")
+	require.True(t, ok)
+	assert.Equal(t, "110101", districts[0].Code)
+	_, ok = ix.Children("99")
+	assert.False(t, ok)
+	assert.False(t, ix.HasChildren("4419"))
+
+	path, ok := ix.Path("110105")
+	require.True(t, ok)
+	assert.Equal(t, "北京市朝阳区", path.FullName)
+	assert.Equal(t, "11", path.Province.Code)
+	assert.Equal(t, "1101", path.City.Code)
+	assert.Equal(t, "110105", path.District.Code)
+
+	testCases := []struct {
+		name      string
+		wantCodes []string
+	}{
+		{name: "北京市", wantCodes: []string{"11"}},
+		{name: "北京", wantCodes: []string{"11"}},
+		{name: "京", wantCodes: []string{"11"}},
+		{name: "gd", wantCodes: []string{"44"}},
+		{name: "广州", wantCodes: []string{"4401"}},
+		{name: "天河区", wantCodes: []string{"440106"}},
+		{name: "市辖区", wantCodes: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			codes := []string{}
+			for _, p := range ix.Lookup(tc.name) {
+				codes = append(codes, p.Code)
+			}
+			assert.Equal(t, tc.wantCodes, codes)
+		})
+	}
+}
+
+func TestIndex_FindCity(t *testing.T) {
+	ix := newIndex(testSnapshot())
+
+	testCases := []struct {
+		name  string
+		query string
+
+		wantCode      string
+		wantDistricts []string
+		wantOk        bool
+	}{
+		{
+			name:          "直辖市",
+			query:         "北京",
+			wantCode:      "11",
+			wantDistricts: []string{"110101", "110105"},
+			wantOk:        true,
+		},
+		{
+			name:          "市",
+			query:         "广州",
+			wantCode:      "4401",
+			wantDistricts: []string{"440106"},
+			wantOk:        true,
+		},
+		{
+			name:          "不设区的市",
+			query:         "东莞市",
+			wantCode:      "4419",
+			wantDistricts: []string{},
+			wantOk:        true,
+		},
+		{
+			name:  "省份不是市",
+			query: "广东省",
+		},
+		{
+			name:  "区县不是市",
+			query: "天河区",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			city, ok := ix.FindCity(tc.query)
+			assert.Equal(t, tc.wantOk, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tc.wantCode, city.Code)
+			codes := []string{}
+			for _, d := range ix.Districts(city.Code) {
+				codes = append(codes, d.Code)
+			}
+			assert.Equal(t, tc.wantDistricts, codes)
+		})
+	}
+}
+
+func TestService_Index(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) cache.RegionCache
+
+		wantVersion string
+	}{
+		{
+			name: "缓存命中",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) cache.RegionCache {
+				rc := cachemock.NewMockRegionCache(ctrl)
+				rc.EXPECT().Get(gomock.Any()).Return(testSnapshot(), nil)
+				return rc
+			},
+			wantVersion: "2023",
+		},
+		{
+			name: "缓存未命中从数据库加载",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) cache.RegionCache {
+				rc := cachemock.NewMockRegionCache(ctrl)
+				rc.EXPECT().Get(gomock.Any()).Return(cache.RegionSnapshot{}, cache.ErrKeyNotExist)
+				mock.ExpectQuery("SELECT \\* FROM `region_version` ORDER BY id desc LIMIT \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(2, "2024"))
+				mock.ExpectQuery("SELECT \\* FROM `province` ORDER BY code").
+					WillReturnRows(sqlmock.NewRows([]string{"code", "name"}).AddRow("11", "北京市"))
+				mock.ExpectQuery("SELECT \\* FROM `city` ORDER BY code").
+					WillReturnRows(sqlmock.NewRows([]string{"code", "name", "province_code"}))
+				mock.ExpectQuery("SELECT \\* FROM `district` ORDER BY code").
+					WillReturnRows(sqlmock.NewRows([]string{"code", "name", "city_code"}))
+				rc.EXPECT().Set(gomock.Any(), gomock.Any(), regionCacheExpiration).
+					DoAndReturn(func(ctx context.Context, snap cache.RegionSnapshot, expiration any) error {
+						assert.Equal(t, "2024", snap.Version)
+						assert.Len(t, snap.Provinces, 1)
+						return nil
+					})
+				return rc
+			},
+			wantVersion: "2024",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			svc := NewService(db, tc.mock(ctrl, mock))
+			ix, err := svc.Index(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVersion, ix.Version)
+			// 刷新间隔内不再读取缓存
+			again, err := svc.Index(context.Background())
+			require.NoError(t, err)
+			assert.Same(t, ix, again)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
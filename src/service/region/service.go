@@ -0,0 +1,415 @@
+package region
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 各级行政区划所在的表和医院, 就诊人中对应的编码列
+var (
+	levelTables  = map[Level]string{LevelProvince: xytmodel.TableProvince, LevelCity: xytmodel.TableCity, LevelDistrict: xytmodel.TableDistrict}
+	levelColumns = map[Level]string{LevelProvince: "province_code", LevelCity: "city_code", LevelDistrict: "district_code"}
+	levels       = []Level{LevelProvince, LevelCity, LevelDistrict}
+)
+
+const (
+	regionCacheExpiration = 24 * time.Hour
+	// 进程内的数据多久以后重新从 redis 读取, 其他实例导入新版本后最多延迟这么久生效
+	indexRefreshInterval = time.Minute
+)
+
+// Service 维护省市区数据的版本, 导入新版本时在一个事务中更新三张表, 并替换医院和就诊人中撤销的编码;
+// 查询使用内存中的 Index, 依次从进程内, redis 和数据库加载
+type Service struct {
+	db    *gorm.DB
+	cache cache.RegionCache
+
+	mu       sync.Mutex
+	index    *Index
+	loadedAt time.Time
+}
+
+func NewService(db *gorm.DB, cache cache.RegionCache) *Service {
+	return &Service{
+		db:    db,
+		cache: cache,
+	}
+}
+
+// Index 当前版本的省市区数据
+func (s *Service) Index(ctx context.Context) (*Index, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index != nil && time.Since(s.loadedAt) < indexRefreshInterval {
+		return s.index, nil
+	}
+
+	snap, err := s.cache.Get(ctx)
+	if err != nil {
+		if !errors.Is(err, cache.ErrKeyNotExist) {
+			log.Println("get region cache:", err)
+		}
+		snap, err = loadSnapshot(s.db.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if err = s.cache.Set(ctx, snap, regionCacheExpiration); err != nil {
+			log.Println("set region cache:", err)
+		}
+	}
+	if s.index == nil || s.index.Version != snap.Version {
+		s.index = newIndex(snap)
+	}
+	s.loadedAt = time.Now()
+	return s.index, nil
+}
+
+// Versions 已导入的版本, 最新的在前
+func (s *Service) Versions(ctx context.Context) ([]xytmodel.RegionVersion, error) {
+	var versions []xytmodel.RegionVersion
+	err := s.db.WithContext(ctx).Order("id desc").Find(&versions).Error
+	return versions, err
+}
+
+// Diff 预览导入 ds 会产生的变化, 不修改数据
+func (s *Service) Diff(ctx context.Context, ds Dataset) (Diff, error) {
+	next, err := ds.flatten()
+	if err != nil {
+		return Diff{}, err
+	}
+	diff, err := diffCurrent(s.db.WithContext(ctx), next, ds.Merges)
+	diff.Version = ds.Version
+	return diff, err
+}
+
+// Apply 导入新版本, 撤销的编码仍被医院或就诊人使用但没有代替编码时不做任何修改
+func (s *Service) Apply(ctx context.Context, ds Dataset, operator string) (Diff, error) {
+	next, err := ds.flatten()
+	if err != nil {
+		return Diff{}, err
+	}
+	var diff Diff
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住最新的版本, 同一时间只有一个导入
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id desc").Take(&xytmodel.RegionVersion{}).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var applied int64
+		if err = tx.Model(&xytmodel.RegionVersion{}).Where("version = ?", ds.Version).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return app.ErrRegionVersionApplied
+		}
+
+		diff, err = diffCurrent(tx, next, ds.Merges)
+		if err != nil {
+			return err
+		}
+		diff.Version = ds.Version
+		if codes := diff.Unmapped(); len(codes) > 0 {
+			return fmt.Errorf("%w: %s", app.ErrRegionRetired, strings.Join(codes, ", "))
+		}
+
+		if err = insertRegions(tx, next, diff.Added); err != nil {
+			return err
+		}
+		remapped, err := updateRegions(tx, next, diff)
+		if err != nil {
+			return err
+		}
+		return recordVersion(tx, ds, diff, remapped, operator)
+	})
+	if err != nil {
+		return diff, err
+	}
+	s.invalidate(ctx)
+	return diff, nil
+}
+
+// invalidate 删除缓存, 下一次查询从数据库加载新版本
+func (s *Service) invalidate(ctx context.Context) {
+	if err := s.cache.Delete(ctx); err != nil {
+		log.Println("delete region cache:", err)
+	}
+	s.mu.Lock()
+	s.index = nil
+	s.mu.Unlock()
+}
+
+func levelModel(level Level) any {
+	switch level {
+	case LevelProvince:
+		return &xytmodel.Province{}
+	case LevelCity:
+		return &xytmodel.City{}
+	}
+	return &xytmodel.District{}
+}
+
+func diffCurrent(db *gorm.DB, next regionSet, merges map[string]string) (Diff, error) {
+	snap, err := loadSnapshot(db)
+	if err != nil {
+		return Diff{}, err
+	}
+	diff, err := diffRegions(snapshotRegions(snap), next, merges)
+	if err != nil {
+		return diff, err
+	}
+	diff.FromVersion = snap.Version
+	return diff, countReferences(db, diff.Retired)
+}
+
+// loadSnapshot 当前三张表中的数据和最新的版本号
+func loadSnapshot(db *gorm.DB) (cache.RegionSnapshot, error) {
+	var snap cache.RegionSnapshot
+	var cur xytmodel.RegionVersion
+	err := db.Order("id desc").Take(&cur).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return snap, err
+	}
+	snap.Version = cur.Version
+	if err = db.Table(xytmodel.TableProvince).Order("code").Find(&snap.Provinces).Error; err != nil {
+		return snap, err
+	}
+	if err = db.Table(xytmodel.TableCity).Order("code").Find(&snap.Cities).Error; err != nil {
+		return snap, err
+	}
+	err = db.Table(xytmodel.TableDistrict).Order("code").Find(&snap.Districts).Error
+	return snap, err
+}
+
+func snapshotRegions(snap cache.RegionSnapshot) regionSet {
+	rs := make(regionSet, len(snap.Provinces)+len(snap.Cities)+len(snap.Districts))
+	for _, p := range snap.Provinces {
+		rs[p.Code] = Region{Level: LevelProvince, Code: p.Code, Name: p.Name, AbbrZh: p.Abbr_zh, AbbrEn: p.Abbr_en, Category: p.Category}
+	}
+	for _, c := range snap.Cities {
+		rs[c.Code] = Region{Level: LevelCity, Code: c.Code, Name: c.Name, ParentCode: c.ProvinceCode, Category: c.Category}
+	}
+	for _, d := range snap.Districts {
+		rs[d.Code] = Region{Level: LevelDistrict, Code: d.Code, Name: d.Name, ParentCode: d.CityCode, Category: d.Category}
+	}
+	return rs
+}
+
+// countReferences 统计撤销的编码被医院和就诊人使用的次数
+func countReferences(db *gorm.DB, retired []Change) error {
+	codes := map[Level][]string{}
+	for _, c := range retired {
+		codes[c.Level] = append(codes[c.Level], c.Code)
+	}
+	counts := map[string]int64{}
+	for level, list := range codes {
+		column := levelColumns[level]
+		for _, table := range []string{xytmodel.TableHospital, xytmodel.TablePatient} {
+			var rows []struct {
+				Code string
+				N    int64
+			}
+			err := db.Table(table).Select(column+" as code, count(*) as n").
+				Where(column+" in ?", list).Group(column).Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				counts[row.Code] += row.N
+			}
+		}
+	}
+	for i := range retired {
+		retired[i].References = counts[retired[i].Code]
+	}
+	return nil
+}
+
+// chainColumns r 和它的上级的编码和名称, 列名与医院表相同
+func (rs regionSet) chainColumns(r Region) map[string]any {
+	columns := map[string]any{}
+	for {
+		column := levelColumns[r.Level]
+		columns[column] = r.Code
+		columns[strings.TrimSuffix(column, "_code")+"_name"] = r.Name
+		if r.Level == LevelProvince {
+			return columns
+		}
+		r = rs[r.ParentCode]
+	}
+}
+
+// codeColumns 只保留编码列, 就诊人只保存编码
+func codeColumns(columns map[string]any) map[string]any {
+	codes := map[string]any{}
+	for column, v := range columns {
+		if strings.HasSuffix(column, "_code") {
+			codes[column] = v
+		}
+	}
+	return codes
+}
+
+func insertRegions(tx *gorm.DB, next regionSet, added []Change) error {
+	var (
+		provinces []xytmodel.Province
+		cities    []xytmodel.City
+		districts []xytmodel.District
+	)
+	for _, c := range added {
+		r := next[c.Code]
+		switch r.Level {
+		case LevelProvince:
+			provinces = append(provinces, xytmodel.Province{
+				Name:     r.Name,
+				Abbr_zh:  r.AbbrZh,
+				Abbr_en:  r.AbbrEn,
+				Code:     r.Code,
+				Category: r.Category,
+			})
+		case LevelCity:
+			p := next[r.ParentCode]
+			cities = append(cities, xytmodel.City{
+				Name:         r.Name,
+				Code:         r.Code,
+				ProvinceName: p.Name,
+				ProvinceCode: p.Code,
+				Category:     r.Category,
+			})
+		case LevelDistrict:
+			c := next[r.ParentCode]
+			p := next[c.ParentCode]
+			districts = append(districts, xytmodel.District{
+				Name:         r.Name,
+				Code:         r.Code,
+				CityName:     c.Name,
+				CityCode:     c.Code,
+				ProvinceName: p.Name,
+				ProvinceCode: p.Code,
+				Category:     r.Category,
+			})
+		}
+	}
+	const batchSize = 500
+	if len(provinces) > 0 {
+		if err := tx.CreateInBatches(&provinces, batchSize).Error; err != nil {
+			return err
+		}
+	}
+	if len(cities) > 0 {
+		if err := tx.CreateInBatches(&cities, batchSize).Error; err != nil {
+			return err
+		}
+	}
+	if len(districts) > 0 {
+		return tx.CreateInBatches(&districts, batchSize).Error
+	}
+	return nil
+}
+
+// updateRegions 按省, 市, 区县的顺序处理更新和撤销的编码, 下级的变化覆盖上级写入的冗余字段; 返回替换编码的医院和就诊人数量
+func updateRegions(tx *gorm.DB, next regionSet, diff Diff) (int64, error) {
+	var remapped int64
+	for _, level := range levels {
+		table, column := levelTables[level], levelColumns[level]
+		for _, c := range diff.Updated {
+			if c.Level != level {
+				continue
+			}
+			r := next[c.Code]
+			chain := next.chainColumns(r)
+			// 本级的行: 名称, 上级的编码和名称, 类别
+			row := map[string]any{"name": r.Name, "category": r.Category}
+			for k, v := range chain {
+				if !strings.HasPrefix(k, strings.TrimSuffix(column, "code")) {
+					row[k] = v
+				}
+			}
+			if level == LevelProvince {
+				row["abbr_zh"], row["abbr_en"] = r.AbbrZh, r.AbbrEn
+			}
+			if err := tx.Table(table).Where("code = ?", r.Code).Updates(row).Error; err != nil {
+				return 0, err
+			}
+			// 下级行政区划中冗余的名称和类别
+			children := map[string]any{"category": r.Category}
+			for k, v := range chain {
+				children[k] = v
+			}
+			for _, child := range levels[level:] {
+				if err := tx.Table(levelTables[child]).Where(column+" = ?", r.Code).Updates(children).Error; err != nil {
+					return 0, err
+				}
+			}
+			if err := tx.Model(&xytmodel.Hospital{}).Where(column+" = ?", r.Code).Updates(chain).Error; err != nil {
+				return 0, err
+			}
+			if err := tx.Model(&xytmodel.Patient{}).Where(column+" = ?", r.Code).Updates(codeColumns(chain)).Error; err != nil {
+				return 0, err
+			}
+		}
+
+		var retired []string
+		for _, c := range diff.Retired {
+			if c.Level != level {
+				continue
+			}
+			retired = append(retired, c.Code)
+			if c.NewCode == "" {
+				continue
+			}
+			chain := next.chainColumns(next[c.NewCode])
+			res := tx.Model(&xytmodel.Hospital{}).Where(column+" = ?", c.Code).Updates(chain)
+			if res.Error != nil {
+				return 0, res.Error
+			}
+			remapped += res.RowsAffected
+			res = tx.Model(&xytmodel.Patient{}).Where(column+" = ?", c.Code).Updates(codeColumns(chain))
+			if res.Error != nil {
+				return 0, res.Error
+			}
+			remapped += res.RowsAffected
+		}
+		if len(retired) > 0 {
+			if err := tx.Where("code in ?", retired).Delete(levelModel(level)).Error; err != nil {
+				return 0, err
+			}
+		}
+	}
+	return remapped, nil
+}
+
+func recordVersion(tx *gorm.DB, ds Dataset, diff Diff, remapped int64, operator string) error {
+	err := tx.Create(&xytmodel.RegionVersion{
+		Version:  ds.Version,
+		Checksum: ds.Checksum,
+		Added:    len(diff.Added),
+		Updated:  len(diff.Updated),
+		Retired:  len(diff.Retired),
+		Remapped: remapped,
+		Operator: operator,
+	}).Error
+	if err != nil || len(diff.Retired) == 0 {
+		return err
+	}
+	remaps := make([]xytmodel.RegionCodeRemap, 0, len(diff.Retired))
+	for _, c := range diff.Retired {
+		remaps = append(remaps, xytmodel.RegionCodeRemap{
+			Version: ds.Version,
+			Level:   int8(c.Level),
+			OldCode: c.Code,
+			NewCode: c.NewCode,
+		})
+	}
+	return tx.Create(&remaps).Error
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/types/app"
+)
+
+// DeptInfo 排班页面的科室信息, Parent 是上一级科室
+type DeptInfo struct {
+	Hospital   xytmodel.Hospital
+	Department xytmodel.Department
+	Parent     xytmodel.Department
+	Doctors    int64
+}
+
+// DaySchedule 科室一天的排班, 出诊医生和已经分配的号序
+type DaySchedule struct {
+	Schedules []xytmodel.Schedule
+	Doctors   []xytmodel.Doctor
+	Taken     map[string][]int
+}
+
+// ScheduleDetail 预约一个排班需要展示的信息
+type ScheduleDetail struct {
+	Schedule   xytmodel.Schedule
+	Doctor     xytmodel.Doctor
+	Hospital   xytmodel.Hospital
+	Department xytmodel.Department
+}
+
+type ScheduleService interface {
+	DeptInfo(ctx context.Context, hosId, deptId string) (DeptInfo, error)
+	Day(ctx context.Context, hosId, deptId, date string) (DaySchedule, error)
+	Detail(ctx context.Context, scheId string) (ScheduleDetail, error)
+}
+
+type scheduleService struct {
+	repo      repository.ScheduleRepository
+	hospitals repository.HospitalRepository
+}
+
+func NewScheduleService(repo repository.ScheduleRepository, hospitals repository.HospitalRepository) ScheduleService {
+	return &scheduleService{
+		repo:      repo,
+		hospitals: hospitals,
+	}
+}
+
+func (svc *scheduleService) DeptInfo(ctx context.Context, hosId, deptId string) (DeptInfo, error) {
+	var info DeptInfo
+	var err error
+	info.Hospital, err = svc.hospitals.FindByUid(ctx, hosId)
+	if err != nil {
+		return DeptInfo{}, err
+	}
+	info.Department, err = svc.hospitals.FindDepartment(ctx, deptId)
+	if err != nil {
+		return DeptInfo{}, err
+	}
+	// 一级科室没有上级
+	if info.Department.ParentID != "" {
+		info.Parent, err = svc.hospitals.FindDepartment(ctx, info.Department.ParentID)
+		if err != nil {
+			return DeptInfo{}, err
+		}
+	}
+	info.Doctors, err = svc.repo.CountDoctors(ctx, hosId, deptId)
+	return info, err
+}
+
+func (svc *scheduleService) Day(ctx context.Context, hosId, deptId, date string) (DaySchedule, error) {
+	schedules, err := svc.repo.FindByDate(ctx, hosId, deptId, date)
+	if err != nil {
+		return DaySchedule{}, err
+	}
+	var docIds = make([]string, 0, len(schedules))
+	var scheIds = make([]string, 0, len(schedules))
+	for _, sche := range schedules {
+		docIds = append(docIds, sche.DocId)
+		scheIds = append(scheIds, sche.ScheId)
+	}
+	docs, err := svc.repo.FindDoctors(ctx, docIds)
+	if err != nil {
+		return DaySchedule{}, err
+	}
+	taken, err := svc.repo.TakenSeqs(ctx, scheIds)
+	if err != nil {
+		return DaySchedule{}, err
+	}
+	return DaySchedule{
+		Schedules: schedules,
+		Doctors:   docs,
+		Taken:     taken,
+	}, nil
+}
+
+// Detail 排班的科室不属于排班的医院时按不存在处理
+func (svc *scheduleService) Detail(ctx context.Context, scheId string) (ScheduleDetail, error) {
+	var detail ScheduleDetail
+	var err error
+	detail.Schedule, err = svc.repo.FindById(ctx, scheId)
+	if err != nil {
+		return ScheduleDetail{}, err
+	}
+	detail.Doctor, err = svc.repo.FindDoctor(ctx, detail.Schedule.DocId)
+	if err != nil {
+		return ScheduleDetail{}, err
+	}
+	detail.Hospital, err = svc.hospitals.FindByUid(ctx, detail.Schedule.HosID)
+	if err != nil {
+		return ScheduleDetail{}, err
+	}
+	detail.Department, err = svc.hospitals.FindDepartment(ctx, detail.Schedule.DeptID)
+	if err != nil {
+		return ScheduleDetail{}, err
+	}
+	if detail.Department.HospitalID != detail.Schedule.HosID {
+		return ScheduleDetail{}, app.ErrRecordNotFound
+	}
+	return detail, nil
+}
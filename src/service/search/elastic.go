@@ -0,0 +1,315 @@
+package search
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/olivere/elastic/v7"
+)
+
+var (
+	//go:embed mapping/hospital.json
+	hospitalMapping string
+	//go:embed mapping/department.json
+	departmentMapping string
+	//go:embed mapping/doctor.json
+	doctorMapping string
+)
+
+const (
+	defaultSearchSize = 10
+	maxSearchSize     = 50
+
+	// 拼音搜索依赖的插件, 官方镜像默认没有安装
+	pinyinPlugin = "analysis-pinyin"
+)
+
+// 分面统计的字段
+var hospitalFacets = map[string]string{
+	"grade":     "grade_code",
+	"type":      "type_code",
+	"district":  "district_code",
+	"insurance": "is_medical_insurance",
+}
+
+type ElasticService struct {
+	client *elastic.Client
+}
+
+func NewElasticService(client *elastic.Client) Service {
+	return &ElasticService{
+		client: client,
+	}
+}
+
+// EnsureIndices 创建不存在的索引, 没有安装拼音插件时 pinyin 子字段退化为标准分词, 只能按汉字搜索;
+// 之后安装了插件需要删除索引重建
+func (s *ElasticService) EnsureIndices(ctx context.Context) error {
+	pinyin, err := s.hasPlugin(ctx, pinyinPlugin)
+	if err != nil {
+		return err
+	}
+	if !pinyin {
+		log.Printf("elasticsearch plugin %s not installed, fall back to standard tokenizer", pinyinPlugin)
+	}
+	indices := map[string]string{
+		IndexHospital:   hospitalMapping,
+		IndexDepartment: departmentMapping,
+		IndexDoctor:     doctorMapping,
+	}
+	for index, mapping := range indices {
+		exists, err := s.client.IndexExists(index).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if !pinyin {
+			if mapping, err = withoutPinyin(mapping); err != nil {
+				return fmt.Errorf("mapping %s: %w", index, err)
+			}
+		}
+		_, err = s.client.CreateIndex(index).BodyString(mapping).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("create index %s: %w", index, err)
+		}
+	}
+	return nil
+}
+
+func (s *ElasticService) hasPlugin(ctx context.Context, name string) (bool, error) {
+	stats, err := s.client.ClusterStats().Do(ctx)
+	if err != nil {
+		return false, err
+	}
+	if stats.Nodes == nil {
+		return false, nil
+	}
+	for _, plugin := range stats.Nodes.Plugins {
+		if plugin.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// withoutPinyin 把索引配置中的 pinyin_tokenizer 换成内置的 standard 分词器, 字段和分析器的名字不变
+func withoutPinyin(mapping string) (string, error) {
+	var body map[string]any
+	if err := json.Unmarshal([]byte(mapping), &body); err != nil {
+		return "", err
+	}
+	settings, _ := body["settings"].(map[string]any)
+	analysis, _ := settings["analysis"].(map[string]any)
+	tokenizers, ok := analysis["tokenizer"].(map[string]any)
+	if !ok {
+		return mapping, nil
+	}
+	tokenizers["pinyin_tokenizer"] = map[string]any{"type": "standard"}
+	data, err := json.Marshal(body)
+	return string(data), err
+}
+
+func (s *ElasticService) SearchHospitals(ctx context.Context, query HospitalQuery) (HospitalResult, error) {
+	resp, err := buildHospitalSearch(s.client.Search(IndexHospital), query).Do(ctx)
+	if err != nil {
+		return HospitalResult{}, err
+	}
+	return parseHospitalResult(resp, query.Location != nil)
+}
+
+func (s *ElasticService) SearchDoctors(ctx context.Context, query DoctorQuery) (DoctorResult, error) {
+	resp, err := buildDoctorSearch(s.client.Search(IndexDoctor), query).Do(ctx)
+	if err != nil {
+		return DoctorResult{}, err
+	}
+	var result = DoctorResult{
+		Total: resp.TotalHits(),
+		Hits:  make([]DoctorDoc, 0, len(resp.Hits.Hits)),
+	}
+	for _, hit := range resp.Hits.Hits {
+		var doc DoctorDoc
+		if err = json.Unmarshal(hit.Source, &doc); err != nil {
+			return DoctorResult{}, err
+		}
+		result.Hits = append(result.Hits, doc)
+	}
+	return result, nil
+}
+
+func (s *ElasticService) IndexHospitals(ctx context.Context, docs ...HospitalDoc) error {
+	var reqs = make([]elastic.BulkableRequest, 0, len(docs))
+	for _, doc := range docs {
+		reqs = append(reqs, elastic.NewBulkIndexRequest().Index(IndexHospital).Id(doc.UID).Doc(doc))
+	}
+	return s.bulk(ctx, reqs)
+}
+
+func (s *ElasticService) IndexDepartments(ctx context.Context, docs ...DepartmentDoc) error {
+	var reqs = make([]elastic.BulkableRequest, 0, len(docs))
+	for _, doc := range docs {
+		reqs = append(reqs, elastic.NewBulkIndexRequest().Index(IndexDepartment).Id(doc.UID).Doc(doc))
+	}
+	return s.bulk(ctx, reqs)
+}
+
+func (s *ElasticService) IndexDoctors(ctx context.Context, docs ...DoctorDoc) error {
+	var reqs = make([]elastic.BulkableRequest, 0, len(docs))
+	for _, doc := range docs {
+		reqs = append(reqs, elastic.NewBulkIndexRequest().Index(IndexDoctor).Id(doc.Id).Doc(doc))
+	}
+	return s.bulk(ctx, reqs)
+}
+
+func (s *ElasticService) Delete(ctx context.Context, index string, ids ...string) error {
+	var reqs = make([]elastic.BulkableRequest, 0, len(ids))
+	for _, id := range ids {
+		reqs = append(reqs, elastic.NewBulkDeleteRequest().Index(index).Id(id))
+	}
+	return s.bulk(ctx, reqs)
+}
+
+func (s *ElasticService) bulk(ctx context.Context, reqs []elastic.BulkableRequest) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	resp, err := s.client.Bulk().Add(reqs...).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := resp.Failed(); len(failed) > 0 {
+		// 删除不存在的文档不算失败
+		for _, item := range failed {
+			if item.Status != 404 {
+				return fmt.Errorf("bulk %s %s: %s", item.Index, item.Id, item.Error.Reason)
+			}
+		}
+	}
+	return nil
+}
+
+// buildHospitalSearch 关键字和距离放在 query 中, 分面字段的过滤放在 post_filter 中,
+// 这样分面统计不会被自己的过滤条件影响
+func buildHospitalSearch(svc *elastic.SearchService, query HospitalQuery) *elastic.SearchService {
+	main := elastic.NewBoolQuery().Filter(elastic.NewTermQuery("is_active", true))
+	if query.Keyword != "" {
+		main.Must(elastic.NewMultiMatchQuery(query.Keyword,
+			"full_name^3", "short_name^2", "full_name.pinyin", "short_name.pinyin", "address").
+			Fuzziness("AUTO"))
+	}
+	if query.CityCode != "" {
+		main.Filter(elastic.NewTermQuery("city_code", query.CityCode))
+	}
+	if query.Location != nil && query.RadiusKm > 0 {
+		main.Filter(elastic.NewGeoDistanceQuery("location").
+			Lat(query.Location.Lat).Lon(query.Location.Lon).
+			Distance(strconv.FormatFloat(query.RadiusKm, 'f', -1, 64) + "km"))
+	}
+
+	post := elastic.NewBoolQuery()
+	if query.GradeCode != "" {
+		post.Filter(elastic.NewTermQuery("grade_code", query.GradeCode))
+	}
+	if query.TypeCode != "" {
+		post.Filter(elastic.NewTermQuery("type_code", query.TypeCode))
+	}
+	if query.DistrictCode != "" {
+		post.Filter(elastic.NewTermQuery("district_code", query.DistrictCode))
+	}
+	if query.Insurance != nil {
+		post.Filter(elastic.NewTermQuery("is_medical_insurance", *query.Insurance))
+	}
+
+	svc = svc.Query(main).PostFilter(post).From(query.From).Size(searchSize(query.Size)).TrackTotalHits(true)
+
+	// 有位置时距离总是最后一个排序值, 用来返回距离
+	if query.Location != nil {
+		distance := elastic.NewGeoDistanceSort("location").
+			Point(query.Location.Lat, query.Location.Lon).
+			Unit("km").Asc()
+		if query.SortByDistance {
+			svc = svc.SortBy(distance)
+		} else {
+			svc = svc.SortBy(elastic.NewScoreSort(), distance)
+		}
+	}
+
+	for name, field := range hospitalFacets {
+		svc = svc.Aggregation(name, elastic.NewTermsAggregation().Field(field).Size(50))
+	}
+	return svc
+}
+
+// buildDoctorSearch 相关度相同时评分高的医生排在前面
+func buildDoctorSearch(svc *elastic.SearchService, query DoctorQuery) *elastic.SearchService {
+	main := elastic.NewBoolQuery()
+	if query.Keyword != "" {
+		main.Must(elastic.NewMultiMatchQuery(query.Keyword,
+			"name^3", "name.pinyin", "specialty^2", "profile").
+			Fuzziness("AUTO"))
+	}
+	if query.Rank != "" {
+		main.Filter(elastic.NewTermQuery("rank", query.Rank))
+	}
+	if query.HosId != "" {
+		main.Filter(elastic.NewTermQuery("hos_id", query.HosId))
+	}
+	if query.DeptId != "" {
+		main.Filter(elastic.NewTermQuery("dept_id", query.DeptId))
+	}
+	return svc.Query(main).From(query.From).Size(searchSize(query.Size)).TrackTotalHits(true).
+		SortBy(elastic.NewScoreSort(), elastic.NewFieldSort("rating").Desc(), elastic.NewFieldSort("rating_count").Desc())
+}
+
+func searchSize(size int) int {
+	if size <= 0 {
+		return defaultSearchSize
+	}
+	if size > maxSearchSize {
+		return maxSearchSize
+	}
+	return size
+}
+
+func parseHospitalResult(resp *elastic.SearchResult, withDistance bool) (HospitalResult, error) {
+	var result = HospitalResult{
+		Total:  resp.TotalHits(),
+		Hits:   make([]HospitalHit, 0, len(resp.Hits.Hits)),
+		Facets: make(map[string][]FacetBucket, len(hospitalFacets)),
+	}
+	for _, hit := range resp.Hits.Hits {
+		var h HospitalHit
+		if err := json.Unmarshal(hit.Source, &h.HospitalDoc); err != nil {
+			return HospitalResult{}, err
+		}
+		if withDistance && h.Location != nil && len(hit.Sort) > 0 {
+			if km, ok := hit.Sort[len(hit.Sort)-1].(float64); ok {
+				h.DistanceKm = &km
+			}
+		}
+		result.Hits = append(result.Hits, h)
+	}
+
+	for name := range hospitalFacets {
+		terms, ok := resp.Aggregations.Terms(name)
+		if !ok {
+			continue
+		}
+		buckets := make([]FacetBucket, 0, len(terms.Buckets))
+		for _, b := range terms.Buckets {
+			key := fmt.Sprint(b.Key)
+			// 布尔字段的 key 是 0/1, 用 key_as_string 的 true/false
+			if b.KeyAsString != nil {
+				key = *b.KeyAsString
+			}
+			buckets = append(buckets, FacetBucket{Key: key, Count: b.DocCount})
+		}
+		result.Facets[name] = buckets
+	}
+	return result, nil
+}
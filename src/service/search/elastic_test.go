@@ -0,0 +1,171 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElasticService_SearchHospitals(t *testing.T) {
+	insurance := true
+	testCases := []struct {
+		name  string
+		query HospitalQuery
+		resp  string
+
+		wantBody   func(t *testing.T, body map[string]any)
+		wantResult HospitalResult
+	}{
+		{
+			name:  "关键字搜索",
+			query: HospitalQuery{Keyword: "xiehe", GradeCode: "3A", Size: 100},
+			resp: `{"hits":{"total":{"value":1},"hits":[{"_source":{"uid":"h1","full_name":"协和医院"},"sort":[1.5]}]},
+				"aggregations":{"grade":{"buckets":[{"key":"3A","doc_count":1},{"key":"2A","doc_count":3}]}}}`,
+			wantBody: func(t *testing.T, body map[string]any) {
+				assert.EqualValues(t, maxSearchSize, body["size"])
+				assert.Nil(t, body["sort"])
+				must := body["query"].(map[string]any)["bool"].(map[string]any)["must"].(map[string]any)
+				assert.Equal(t, "AUTO", must["multi_match"].(map[string]any)["fuzziness"])
+				// 分面字段的过滤只放在 post_filter 中
+				assert.Contains(t, toJSON(t, body["post_filter"]), `"grade_code":"3A"`)
+				assert.NotContains(t, toJSON(t, body["query"]), "grade_code")
+				assert.Len(t, body["aggregations"], len(hospitalFacets))
+			},
+			wantResult: HospitalResult{
+				Total: 1,
+				Hits:  []HospitalHit{{HospitalDoc: HospitalDoc{UID: "h1", FullName: "协和医院"}}},
+				Facets: map[string][]FacetBucket{
+					"grade": {{Key: "3A", Count: 1}, {Key: "2A", Count: 3}},
+				},
+			},
+		},
+		{
+			name: "附近的医院按距离排序",
+			query: HospitalQuery{
+				Location:       &GeoPoint{Lat: 39.9, Lon: 116.4},
+				RadiusKm:       5,
+				SortByDistance: true,
+				Insurance:      &insurance,
+			},
+			resp: `{"hits":{"total":{"value":1},"hits":[{"_source":{"uid":"h1","location":{"lat":39.91,"lon":116.41}},"sort":[1.2]}]},
+				"aggregations":{"insurance":{"buckets":[{"key":1,"key_as_string":"true","doc_count":1}]}}}`,
+			wantBody: func(t *testing.T, body map[string]any) {
+				assert.EqualValues(t, defaultSearchSize, body["size"])
+				assert.Contains(t, toJSON(t, body["query"]), `"distance":"5km"`)
+				assert.Contains(t, toJSON(t, body["post_filter"]), `"is_medical_insurance":true`)
+				sorts := body["sort"].([]any)
+				require.Len(t, sorts, 1)
+				assert.Contains(t, sorts[0], "_geo_distance")
+			},
+			wantResult: HospitalResult{
+				Total: 1,
+				Hits: []HospitalHit{{
+					HospitalDoc: HospitalDoc{UID: "h1", Location: &GeoPoint{Lat: 39.91, Lon: 116.41}},
+					DistanceKm:  ptr(1.2),
+				}},
+				Facets: map[string][]FacetBucket{
+					"insurance": {{Key: "true", Count: 1}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/"+IndexHospital+"/_search", r.URL.Path)
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				var body map[string]any
+				require.NoError(t, json.Unmarshal(data, &body))
+				tc.wantBody(t, body)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tc.resp))
+			}))
+			defer server.Close()
+
+			client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+			require.NoError(t, err)
+			result, err := NewElasticService(client).SearchHospitals(context.Background(), tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantResult, result)
+		})
+	}
+}
+
+func TestElasticService_EnsureIndices(t *testing.T) {
+	testCases := []struct {
+		name    string
+		plugins string
+
+		wantTokenizer string
+	}{
+		{
+			name:          "安装了拼音插件",
+			plugins:       `[{"name":"analysis-pinyin"}]`,
+			wantTokenizer: "pinyin",
+		},
+		{
+			name:          "没有拼音插件时使用标准分词",
+			plugins:       `[]`,
+			wantTokenizer: "standard",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var created = map[string]string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.URL.Path == "/_cluster/stats":
+					_, _ = w.Write([]byte(`{"nodes":{"plugins":` + tc.plugins + `}}`))
+				case r.Method == http.MethodHead:
+					w.WriteHeader(http.StatusNotFound)
+				case r.Method == http.MethodPut:
+					data, err := io.ReadAll(r.Body)
+					require.NoError(t, err)
+					var body struct {
+						Settings struct {
+							Analysis struct {
+								Tokenizer map[string]map[string]any `json:"tokenizer"`
+							} `json:"analysis"`
+						} `json:"settings"`
+					}
+					require.NoError(t, json.Unmarshal(data, &body))
+					created[r.URL.Path[1:]], _ = body.Settings.Analysis.Tokenizer["pinyin_tokenizer"]["type"].(string)
+					_, _ = w.Write([]byte(`{"acknowledged":true}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+			}))
+			defer server.Close()
+
+			client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+			require.NoError(t, err)
+			require.NoError(t, NewElasticService(client).EnsureIndices(context.Background()))
+			assert.Equal(t, map[string]string{
+				IndexHospital:   tc.wantTokenizer,
+				IndexDepartment: tc.wantTokenizer,
+				IndexDoctor:     tc.wantTokenizer,
+			}, created)
+		})
+	}
+}
+
+func toJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,236 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"gorm.io/gorm"
+)
+
+const (
+	syncInterval  = 5 * time.Minute
+	syncBatch     = 500
+	syncQueueSize = 1024
+)
+
+type syncEvent struct {
+	table   string
+	id      string
+	deleted bool
+}
+
+// Syncer 保持搜索索引和数据库一致
+// 通过 gorm 回调同步按主键写入的记录, 定时按 updated_at 增量同步兜底批量更新
+type Syncer struct {
+	db     *gorm.DB
+	svc    Service
+	events chan syncEvent
+	// 各表上一次增量同步到的 updated_at 和主键
+	mu         sync.Mutex
+	watermarks map[string]watermark
+}
+
+type watermark struct {
+	updatedAt int64
+	id        string
+}
+
+func NewSyncer(db *gorm.DB, svc Service) *Syncer {
+	return &Syncer{
+		db:         db,
+		svc:        svc,
+		events:     make(chan syncEvent, syncQueueSize),
+		watermarks: make(map[string]watermark),
+	}
+}
+
+// RegisterCallbacks 在 gorm 的写操作之后把变更的主键放入同步队列
+func (s *Syncer) RegisterCallbacks() error {
+	err := s.db.Callback().Create().After("gorm:create").Register("search:sync_create", s.callback(false))
+	if err != nil {
+		return err
+	}
+	err = s.db.Callback().Update().After("gorm:update").Register("search:sync_update", s.callback(false))
+	if err != nil {
+		return err
+	}
+	return s.db.Callback().Delete().After("gorm:delete").Register("search:sync_delete", s.callback(true))
+}
+
+func (s *Syncer) callback(deleted bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Schema == nil {
+			return
+		}
+		table := db.Statement.Table
+		if table == "" {
+			table = db.Statement.Schema.Table
+		}
+		if table != xytmodel.TableHospital && table != xytmodel.TableDepartment && table != xytmodel.TableDoctor {
+			return
+		}
+		field := db.Statement.Schema.PrioritizedPrimaryField
+		if field == nil {
+			return
+		}
+		rv := reflect.Indirect(db.Statement.ReflectValue)
+		var values []reflect.Value
+		switch rv.Kind() {
+		case reflect.Struct:
+			values = append(values, rv)
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				values = append(values, reflect.Indirect(rv.Index(i)))
+			}
+		}
+		for _, v := range values {
+			id, zero := field.ValueOf(db.Statement.Context, v)
+			if zero {
+				// 按条件批量更新拿不到主键, 由定时增量同步处理
+				continue
+			}
+			select {
+			case s.events <- syncEvent{table: table, id: fmt.Sprint(id), deleted: deleted}:
+			default:
+				log.Printf("search sync queue full, drop %s %v", table, id)
+			}
+		}
+	}
+}
+
+// Start 创建索引后全量同步一次, 之后消费同步队列并定时增量同步
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		if err := s.svc.EnsureIndices(ctx); err != nil {
+			log.Println("ensure search indices:", err)
+		}
+		if err := s.SyncChanged(ctx); err != nil {
+			log.Println("sync search index:", err)
+		}
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-s.events:
+				if err := s.apply(ctx, ev); err != nil {
+					log.Printf("sync %s %s: %v", ev.table, ev.id, err)
+				}
+			case <-ticker.C:
+				if err := s.SyncChanged(ctx); err != nil {
+					log.Println("sync search index:", err)
+				}
+			}
+		}
+	}()
+}
+
+// Reindex 忽略水位全量重建索引
+func (s *Syncer) Reindex(ctx context.Context) error {
+	s.mu.Lock()
+	s.watermarks = make(map[string]watermark)
+	s.mu.Unlock()
+	return s.SyncChanged(ctx)
+}
+
+// SyncChanged 同步上次同步之后 updated_at 变化的记录
+func (s *Syncer) SyncChanged(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := syncTable(ctx, s, xytmodel.TableHospital, "uid",
+		func(h xytmodel.Hospital) watermark { return watermark{h.UpdatedAt, h.UID} },
+		func(rows []xytmodel.Hospital) error {
+			docs := make([]HospitalDoc, 0, len(rows))
+			for _, h := range rows {
+				docs = append(docs, HospitalDocFrom(h))
+			}
+			return s.svc.IndexHospitals(ctx, docs...)
+		})
+	if err != nil {
+		return err
+	}
+	err = syncTable(ctx, s, xytmodel.TableDepartment, "uid",
+		func(d xytmodel.Department) watermark { return watermark{d.UpdatedAt, d.UID} },
+		func(rows []xytmodel.Department) error {
+			docs := make([]DepartmentDoc, 0, len(rows))
+			for _, d := range rows {
+				docs = append(docs, DepartmentDocFrom(d))
+			}
+			return s.svc.IndexDepartments(ctx, docs...)
+		})
+	if err != nil {
+		return err
+	}
+	return syncTable(ctx, s, xytmodel.TableDoctor, "id",
+		func(d xytmodel.Doctor) watermark { return watermark{d.UpdatedAt, d.Id} },
+		func(rows []xytmodel.Doctor) error {
+			docs := make([]DoctorDoc, 0, len(rows))
+			for _, d := range rows {
+				docs = append(docs, DoctorDocFrom(d))
+			}
+			return s.svc.IndexDoctors(ctx, docs...)
+		})
+}
+
+// syncTable 按 (updated_at, 主键) 分批读取变化的记录写入索引, 需要持有 s.mu
+func syncTable[T any](ctx context.Context, s *Syncer, table, pk string, mark func(T) watermark, index func([]T) error) error {
+	for {
+		last := s.watermarks[table]
+		var rows []T
+		err := s.db.WithContext(ctx).Table(table).
+			Where(fmt.Sprintf("updated_at > ? or (updated_at = ? and %s > ?)", pk), last.updatedAt, last.updatedAt, last.id).
+			Order("updated_at, " + pk).Limit(syncBatch).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err = index(rows); err != nil {
+			return err
+		}
+		s.watermarks[table] = mark(rows[len(rows)-1])
+		if len(rows) < syncBatch {
+			return nil
+		}
+	}
+}
+
+func (s *Syncer) apply(ctx context.Context, ev syncEvent) error {
+	switch ev.table {
+	case xytmodel.TableHospital:
+		if ev.deleted {
+			return s.svc.Delete(ctx, IndexHospital, ev.id)
+		}
+		var h xytmodel.Hospital
+		if err := s.db.WithContext(ctx).Table(ev.table).Where("uid = ?", ev.id).Take(&h).Error; err != nil {
+			return err
+		}
+		return s.svc.IndexHospitals(ctx, HospitalDocFrom(h))
+	case xytmodel.TableDepartment:
+		if ev.deleted {
+			return s.svc.Delete(ctx, IndexDepartment, ev.id)
+		}
+		var d xytmodel.Department
+		if err := s.db.WithContext(ctx).Table(ev.table).Where("uid = ?", ev.id).Take(&d).Error; err != nil {
+			return err
+		}
+		return s.svc.IndexDepartments(ctx, DepartmentDocFrom(d))
+	case xytmodel.TableDoctor:
+		if ev.deleted {
+			return s.svc.Delete(ctx, IndexDoctor, ev.id)
+		}
+		var d xytmodel.Doctor
+		if err := s.db.WithContext(ctx).Table(ev.table).Where("id = ?", ev.id).Take(&d).Error; err != nil {
+			return err
+		}
+		return s.svc.IndexDoctors(ctx, DoctorDocFrom(d))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+)
+
+const (
+	IndexHospital   = "xyt_hospital"
+	IndexDepartment = "xyt_department"
+	IndexDoctor     = "xyt_doctor"
+)
+
+// Service 医院, 科室和医生的搜索
+type Service interface {
+	// EnsureIndices 索引不存在时按 mapping 创建
+	EnsureIndices(ctx context.Context) error
+	SearchHospitals(ctx context.Context, query HospitalQuery) (HospitalResult, error)
+	SearchDoctors(ctx context.Context, query DoctorQuery) (DoctorResult, error)
+
+	IndexHospitals(ctx context.Context, docs ...HospitalDoc) error
+	IndexDepartments(ctx context.Context, docs ...DepartmentDoc) error
+	IndexDoctors(ctx context.Context, docs ...DoctorDoc) error
+	Delete(ctx context.Context, index string, ids ...string) error
+}
+
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type HospitalDoc struct {
+	UID                string    `json:"uid"`
+	FullName           string    `json:"full_name"`
+	ShortName          string    `json:"short_name"`
+	TypeCode           string    `json:"type_code"`
+	TypeName           string    `json:"type_name"`
+	GradeCode          string    `json:"grade_code"`
+	GradeName          string    `json:"grade_name"`
+	ProvinceCode       string    `json:"province_code"`
+	CityCode           string    `json:"city_code"`
+	CityName           string    `json:"city_name"`
+	DistrictCode       string    `json:"district_code"`
+	DistrictName       string    `json:"district_name"`
+	Address            string    `json:"address"`
+	LogoUrl            string    `json:"logo_url"`
+	Location           *GeoPoint `json:"location,omitempty"`
+	IsMedicalInsurance bool      `json:"is_medical_insurance"`
+	IsActive           bool      `json:"is_active"`
+	UpdatedAt          int64     `json:"updated_at"`
+}
+
+type DepartmentDoc struct {
+	UID         string `json:"uid"`
+	HospitalID  string `json:"hospital_id"`
+	ParentID    string `json:"parent_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      bool   `json:"status"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+type DoctorDoc struct {
+	Id          string  `json:"id"`
+	Name        string  `json:"name"`
+	Rank        string  `json:"rank"`
+	DeptId      string  `json:"dept_id"`
+	HosId       string  `json:"hos_id"`
+	Profile     string  `json:"profile"`
+	Specialty   string  `json:"specialty"`
+	Rating      float64 `json:"rating"`
+	RatingCount int     `json:"rating_count"`
+	UpdatedAt   int64   `json:"updated_at"`
+}
+
+// HospitalQuery 医院搜索条件, 所有条件都是可选的
+type HospitalQuery struct {
+	Keyword string
+	// 用户位置, 有位置时返回距离, RadiusKm 大于 0 时只返回范围内的医院
+	Location *GeoPoint
+	RadiusKm float64
+	// 按距离由近到远排序, 否则按相关度排序
+	SortByDistance bool
+
+	GradeCode    string
+	TypeCode     string
+	CityCode     string
+	DistrictCode string
+	Insurance    *bool
+
+	From int
+	Size int
+}
+
+// DoctorQuery 医生搜索条件, Keyword 匹配姓名和擅长
+type DoctorQuery struct {
+	Keyword string
+	Rank    string
+	HosId   string
+	DeptId  string
+
+	From int
+	Size int
+}
+
+type DoctorResult struct {
+	Total int64       `json:"total"`
+	Hits  []DoctorDoc `json:"hits"`
+}
+
+type HospitalHit struct {
+	HospitalDoc
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// HospitalResult Facets 的 key 为 grade, type, district, insurance
+type HospitalResult struct {
+	Total  int64                    `json:"total"`
+	Hits   []HospitalHit            `json:"hits"`
+	Facets map[string][]FacetBucket `json:"facets"`
+}
+
+func HospitalDocFrom(h xytmodel.Hospital) HospitalDoc {
+	doc := HospitalDoc{
+		UID:                h.UID,
+		FullName:           h.FullName,
+		ShortName:          h.ShortName,
+		TypeCode:           h.TypeCode,
+		TypeName:           h.TypeName,
+		GradeCode:          h.GradeCode,
+		GradeName:          h.GradeName,
+		ProvinceCode:       h.ProvinceCode,
+		CityCode:           h.CityCode,
+		CityName:           h.CityName,
+		DistrictCode:       h.DistrictCode,
+		DistrictName:       h.DistrictName,
+		Address:            h.Address,
+		LogoUrl:            h.LogoUrl,
+		IsMedicalInsurance: h.IsMedicalInsurance,
+		IsActive:           h.IsActive,
+		UpdatedAt:          h.UpdatedAt,
+	}
+	// 没有录入坐标的医院不参与距离排序
+	if h.Latitude != 0 || h.Longitude != 0 {
+		doc.Location = &GeoPoint{Lat: h.Latitude, Lon: h.Longitude}
+	}
+	return doc
+}
+
+func DepartmentDocFrom(d xytmodel.Department) DepartmentDoc {
+	return DepartmentDoc{
+		UID:         d.UID,
+		HospitalID:  d.HospitalID,
+		ParentID:    d.ParentID,
+		Name:        d.Name,
+		Description: d.Description,
+		Status:      d.Status,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+func DoctorDocFrom(d xytmodel.Doctor) DoctorDoc {
+	return DoctorDoc{
+		Id:          d.Id,
+		Name:        d.Name,
+		Rank:        d.Rank,
+		DeptId:      d.DeptId,
+		HosId:       d.HosId,
+		Profile:     d.Profile,
+		Specialty:   d.Specialty,
+		Rating:      d.Rating(),
+		RatingCount: d.RatingCount,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
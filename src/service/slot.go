@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+)
+
+const (
+	// 排班没有配置时, 每个号段 10 分钟, 每个号段 1 个号
+	defaultSlotMinutes  = 10
+	defaultSlotPatients = 1
+)
+
+// TimeSlotStart 各时段的开诊时间
+var TimeSlotStart = map[string]string{
+	"上午": "08:00",
+	"下午": "13:30",
+	"晚上": "18:00",
+}
+
+// TimeSlotEnd 各时段的结束时间, 没有号段的旧订单按它判断是否爽约
+var TimeSlotEnd = map[string]string{
+	"上午": "12:00",
+	"下午": "17:30",
+	"晚上": "21:00",
+}
+
+// SlotSize 排班每个号段的分钟数和号数
+func SlotSize(sche xytmodel.Schedule) (minutes, patients int) {
+	minutes, patients = sche.SlotMinutes, sche.SlotPatients
+	if minutes <= 0 {
+		minutes = defaultSlotMinutes
+	}
+	if patients <= 0 {
+		patients = defaultSlotPatients
+	}
+	return minutes, patients
+}
+
+// SeqVisitPeriod 计算号序 seq 的预计就诊时间段
+func SeqVisitPeriod(sche xytmodel.Schedule, seq int) (time.Time, time.Time, error) {
+	start, ok := TimeSlotStart[sche.TimeSlot]
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid time slot: %s", sche.TimeSlot)
+	}
+	begin, err := time.ParseInLocation("2006-01-02 15:04", sche.WorkDate+" "+start, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	minutes, patients := SlotSize(sche)
+	begin = begin.Add(time.Duration((seq-1)/patients*minutes) * time.Minute)
+	return begin, begin.Add(time.Duration(minutes) * time.Minute), nil
+}
+
+// nextFreeSeq 返回最小的未占用号序, 退号空出来的号序优先分配
+func nextFreeSeq(taken []int) int {
+	sort.Ints(taken)
+	var seq = 1
+	for _, t := range taken {
+		if t < seq {
+			continue
+		}
+		if t > seq {
+			break
+		}
+		seq++
+	}
+	return seq
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextFreeSeq(t *testing.T) {
+	testCases := []struct {
+		name  string
+		taken []int
+		want  int
+	}{
+		{name: "没有占用", want: 1},
+		{name: "连续占用", taken: []int{1, 2, 3}, want: 4},
+		{name: "优先分配空出来的号", taken: []int{1, 3, 4}, want: 2},
+		{name: "乱序", taken: []int{3, 1, 2}, want: 4},
+		{name: "重复号序", taken: []int{1, 1, 2}, want: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, nextFreeSeq(tc.taken))
+		})
+	}
+}
+
+func TestSeqVisitPeriod(t *testing.T) {
+	testCases := []struct {
+		name      string
+		sche      xytmodel.Schedule
+		seq       int
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "默认每10分钟1个号",
+			sche:      xytmodel.Schedule{WorkDate: "2030-01-02", TimeSlot: "上午"},
+			seq:       3,
+			wantStart: time.Date(2030, 1, 2, 8, 20, 0, 0, time.Local),
+			wantEnd:   time.Date(2030, 1, 2, 8, 30, 0, 0, time.Local),
+		},
+		{
+			name:      "每15分钟2个号",
+			sche:      xytmodel.Schedule{WorkDate: "2030-01-02", TimeSlot: "下午", SlotMinutes: 15, SlotPatients: 2},
+			seq:       4,
+			wantStart: time.Date(2030, 1, 2, 13, 45, 0, 0, time.Local),
+			wantEnd:   time.Date(2030, 1, 2, 14, 0, 0, 0, time.Local),
+		},
+		{
+			name:    "未知时段",
+			sche:    xytmodel.Schedule{WorkDate: "2030-01-02", TimeSlot: "凌晨"},
+			seq:     1,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end, err := SeqVisitPeriod(tc.sche, tc.seq)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tc.wantStart.Equal(start))
+			assert.True(t, tc.wantEnd.Equal(end))
+		})
+	}
+}
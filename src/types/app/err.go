@@ -16,12 +16,64 @@ var (
 	ErrDuplicateEmail = errors.New("邮箱冲突")
 	ErrRecordNotFound = gorm.ErrRecordNotFound
 	ErrDuplicateUser  = gorm.ErrDuplicatedKey
+	ErrDuplicateOrder = errors.New("幂等键已有订单")
 )
 
 // service err
 var (
 	ErrInvalidUserOrPassword = errors.New("用户不存在或者密码不对")
 	ErrUserNotFound          = errors.New("用户不存在")
+	ErrScheduleFull          = errors.New("已约满")
+	ErrScheduleSuspended     = errors.New("医生已停诊")
+	ErrScheduleAvailable     = errors.New("还有号源, 请直接预约")
+	ErrWaitlistJoined        = errors.New("已在候补队列中")
+	ErrWaitlistLimit         = errors.New("候补数量已达上限")
+	ErrWaitlistChanged       = errors.New("候补记录已变更")
+	ErrBookingRejected       = errors.New("预约受限")
+	ErrOrderQueued           = errors.New("订单正在处理中, 请稍后查询")
+	ErrOrderFailed           = errors.New("预约失败")
+	ErrPatientBanned         = errors.New("就诊人已被暂停预约")
+	ErrOrderTransition       = errors.New("订单当前状态不允许该操作")
+	ErrOrderStateChanged     = errors.New("订单状态已变更")
+	ErrPayAmountMismatch     = errors.New("支付金额与订单金额不一致")
+	ErrNotRefundable         = errors.New("已过退号时间, 无法退款")
+	ErrRefundProcessing      = errors.New("退款已受理, 正在处理中")
+	ErrDepartmentCycle       = errors.New("不能把科室移动到自己或自己的下级科室")
+	ErrDepartmentExists      = errors.New("科室编码已存在")
+	ErrDepartmentReorder     = errors.New("排序的科室必须是该上级科室的全部下级科室")
+	ErrDepartmentMismatch    = errors.New("科室不属于该医院")
+	ErrHospitalExists        = errors.New("医院编码已存在")
+	ErrDoctorExists          = errors.New("医生编号已存在")
+	ErrReviewNotAllowed      = errors.New("只有已完成就诊的订单才能评价")
+	ErrReviewed              = errors.New("该订单已评价")
+	ErrImportFile            = errors.New("导入文件无法解析")
+	ErrRegionDataset         = errors.New("行政区划数据错误")
+	ErrRegionVersionApplied  = errors.New("该版本的行政区划数据已导入")
+	ErrRegionRetired         = errors.New("撤销的行政区划仍在使用, 请指定合并到的编码")
+	ErrIdNumberInvalid       = errors.New("身份证号格式错误")
+	ErrIdNumberMismatch      = errors.New("身份证号与出生日期或性别不一致")
+	ErrBirthdayInvalid       = errors.New("出生日期格式错误")
+	ErrPhoneInvalid          = errors.New("手机号格式错误")
+	ErrPatientRelation       = errors.New("请选择就诊人与本人的关系")
+	ErrPatientLimit          = errors.New("就诊人数量已达上限")
+	ErrPatientExists         = errors.New("该就诊人已添加")
+	ErrPatientBound          = errors.New("该证件号已被其他账号绑定")
+	ErrPatientSelfExists     = errors.New("已经添加过本人")
+	ErrCertificationPending  = errors.New("实名认证正在审核中")
+	ErrCertified             = errors.New("已通过实名认证")
+	ErrCertificationReviewed = errors.New("该实名认证已审核")
+	ErrCertificationImage    = errors.New("证件照片只支持 png, jpg 和 webp, 且不超过 5M")
+	ErrCheckinNotOpen        = errors.New("只能在就诊当天签到")
+	ErrCheckinClosed         = errors.New("已过签到时间")
+	ErrCheckinToken          = errors.New("签到码无效或已过期")
+	ErrQueueCalling          = errors.New("还有就诊人正在就诊, 请先完成或过号")
+	ErrQueueEmpty            = errors.New("没有候诊的就诊人")
+	ErrStationScope          = errors.New("只能操作自己出诊的排班")
+	ErrSubstituteMismatch    = errors.New("替诊医生与排班不属于同一医院科室")
+	ErrSubstituteConflict    = errors.New("替诊医生在该时段已有排班")
+	ErrRecordNotAllowed      = errors.New("只能为就诊中或已完成的订单填写就诊记录")
+	ErrRecordAttachment      = errors.New("附件只支持 png, jpg, webp 和 pdf, 且不超过 10M")
+	ErrRecordScope           = errors.New("只能查看和填写自己接诊的就诊人的就诊记录")
 	ErrMissingData           = "请求数据缺失"
 )
 
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+)
+
+const maxAuditBody = 4096
+
+// AuditBuilder 记录写操作的审计日志, GET 请求不记录
+// 只记录 JSON 请求体, 上传文件等请求只记录 URL
+type AuditBuilder struct {
+	auditFunc func(ctx context.Context, al *AuditLog)
+}
+
+func NewAuditBuilder(fn func(ctx context.Context, al *AuditLog)) *AuditBuilder {
+	return &AuditBuilder{
+		auditFunc: fn,
+	}
+}
+
+func (b *AuditBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			ctx.Next()
+			return
+		}
+
+		uid, _ := ctx.Get(config.USER_ID)
+		operatorId, _ := uid.(string)
+		al := &AuditLog{
+			OperatorId: operatorId,
+			Method:     ctx.Request.Method,
+			Path:       ctx.Request.URL.Path,
+			Query:      ctx.Request.URL.RawQuery,
+			IP:         ctx.ClientIP(),
+		}
+		if ctx.Request.Body != nil && strings.HasPrefix(ctx.ContentType(), "application/json") {
+			body, _ := ctx.GetRawData()
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+			if len(body) > maxAuditBody {
+				body = body[:maxAuditBody]
+			}
+			al.ReqBody = string(body)
+		}
+
+		w := &auditWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+
+		// 业务结果在响应体的 code 中
+		var resp struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if err := json.Unmarshal(w.body.Bytes(), &resp); err == nil {
+			al.Code = resp.Code
+			al.Msg = resp.Msg
+		}
+		b.auditFunc(ctx, al)
+	}
+}
+
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+type AuditLog struct {
+	OperatorId string
+	Method     string
+	Path       string
+	Query      string
+	ReqBody    string
+	IP         string
+	// 响应体中的业务 code 和 msg
+	Code int
+	Msg  string
+}
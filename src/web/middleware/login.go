@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/solunara/isb/src/config"
@@ -11,7 +12,8 @@ import (
 
 // LoginJWTMiddlewareBuilder JWT 登录校验
 type LoginJWTMiddlewareBuilder struct {
-	paths []string
+	paths    []string
+	prefixes []string
 }
 
 func NewLoginJWTMiddlewareBuilder() *LoginJWTMiddlewareBuilder {
@@ -23,6 +25,12 @@ func (l *LoginJWTMiddlewareBuilder) IgnorePaths(path string) *LoginJWTMiddleware
 	return l
 }
 
+// IgnorePathPrefix 以 prefix 开头的路径都不需要登录, 例如静态文件
+func (l *LoginJWTMiddlewareBuilder) IgnorePathPrefix(prefix string) *LoginJWTMiddlewareBuilder {
+	l.prefixes = append(l.prefixes, prefix)
+	return l
+}
+
 func (l *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
 	// 用 Go 的方式编码解码
 	return func(ctx *gin.Context) {
@@ -34,6 +42,12 @@ func (l *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
 				break
 			}
 		}
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(ctx.Request.URL.Path, prefix) {
+				flag = true
+				break
+			}
+		}
 		if !flag {
 			token := ctx.GetHeader(config.HTTTP_HEADER_AUTH)
 			if token == "" {
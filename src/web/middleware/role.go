@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/types/app"
+)
+
+// RoleMiddlewareBuilder 校验登录用户的角色, 需要放在 JWT 登录校验之后
+type RoleMiddlewareBuilder struct {
+	roleFunc func(ctx context.Context, userId string) (string, error)
+	roles    []string
+}
+
+// NewRoleBuilder fn 查询用户的角色, 用户不存在时返回 error
+func NewRoleBuilder(fn func(ctx context.Context, userId string) (string, error)) *RoleMiddlewareBuilder {
+	return &RoleMiddlewareBuilder{
+		roleFunc: fn,
+	}
+}
+
+func (b *RoleMiddlewareBuilder) Allow(role string) *RoleMiddlewareBuilder {
+	b.roles = append(b.roles, role)
+	return b
+}
+
+func (b *RoleMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		uid, _ := ctx.Get(config.USER_ID)
+		userId, _ := uid.(string)
+		if userId == "" {
+			ctx.AbortWithStatusJSON(200, app.ErrUnauthorized)
+			return
+		}
+		role, err := b.roleFunc(ctx, userId)
+		if err != nil || !b.allowed(role) {
+			ctx.AbortWithStatusJSON(200, app.ErrForbidden)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func (b *RoleMiddlewareBuilder) allowed(role string) bool {
+	for _, r := range b.roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/web/middleware"
+	"gorm.io/gorm"
+)
+
+const maxLogoSize = 2 << 20
+
+// 允许上传的 logo 类型和保存的扩展名
+var logoTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// FileStorage 保存上传的文件, 返回可以访问的地址
+type FileStorage interface {
+	Save(ctx context.Context, name string, data []byte) (string, error)
+}
+
+// LocalFileStorage 把文件保存在本地目录, 由 web 服务以 urlPrefix 提供静态访问
+type LocalFileStorage struct {
+	dir       string
+	urlPrefix string
+}
+
+func NewLocalFileStorage(dir, urlPrefix string) *LocalFileStorage {
+	return &LocalFileStorage{
+		dir:       dir,
+		urlPrefix: urlPrefix,
+	}
+}
+
+func (s *LocalFileStorage) Save(ctx context.Context, name string, data []byte) (string, error) {
+	file := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return "", err
+	}
+	return path.Join(s.urlPrefix, name), nil
+}
+
+// NewAdminAuditRecorder 把管理后台的审计日志写入数据库, 写入失败只打印日志
+func NewAdminAuditRecorder(db *gorm.DB) func(ctx context.Context, al *middleware.AuditLog) {
+	return func(ctx context.Context, al *middleware.AuditLog) {
+		err := db.WithContext(ctx).Create(&xytmodel.AdminAuditLog{
+			OperatorId: al.OperatorId,
+			Method:     al.Method,
+			Path:       al.Path,
+			Query:      al.Query,
+			ReqBody:    al.ReqBody,
+			IP:         al.IP,
+			Code:       al.Code,
+			Msg:        al.Msg,
+		}).Error
+		if err != nil {
+			log.Println("create admin audit log:", err)
+		}
+	}
+}
+
+// XytAdminHandler 管理后台维护医院, 医院等级和医生, 查看预约统计和审计日志
+type XytAdminHandler struct {
+	db      *gorm.DB
+	storage FileStorage
+}
+
+func NewXytAdminHandler(db *gorm.DB, storage FileStorage) *XytAdminHandler {
+	return &XytAdminHandler{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// RegisterRoutes group 为管理后台的路由组
+func (xh *XytAdminHandler) RegisterRoutes(group *gin.RouterGroup) {
+	hg := group.Group("/hospital")
+	hg.GET("/list", xh.listHospital)
+	hg.POST("/create", xh.createHospital)
+	hg.POST("/update", xh.updateHospital)
+	hg.POST("/status", xh.setHospitalStatus)
+	hg.POST("/logo", xh.uploadLogo)
+
+	gg := group.Group("/grade")
+	gg.GET("/list", xh.listGrade)
+	gg.POST("/save", xh.saveGrade)
+
+	dg := group.Group("/doctor")
+	dg.GET("/list", xh.listDoctor)
+	dg.POST("/create", xh.createDoctor)
+	dg.POST("/update", xh.updateDoctor)
+
+	group.GET("/stats/booking", xh.bookingStats)
+	group.GET("/audit/list", xh.listAudit)
+}
+
+// 管理后台可以修改的医院字段, 编码和启用状态单独维护
+var hospitalEditableColumns = []string{
+	"full_name", "short_name", "type_code", "type_name", "grade_code", "grade_name",
+	"economic_type_code", "economic_type_name", "province_code", "province_name",
+	"city_code", "city_name", "district_code", "district_name", "address", "telephone",
+	"website_url", "legal_representative", "org_code", "license_number",
+	"longitude", "latitude", "license_expiry", "established_at", "is_medical_insurance",
+	"require_certification",
+}
+
+func (xh *XytAdminHandler) listHospital(ctx *gin.Context) {
+	pageNo, pageSize := searchPage(ctx)
+	dbQuery := xh.db.Model(&xytmodel.Hospital{})
+	if keyword := ctx.Query("keyword"); keyword != "" {
+		dbQuery = dbQuery.Where("full_name like ? or uid = ?", "%"+keyword+"%", keyword)
+	}
+	if active := ctx.Query("isActive"); active != "" {
+		v, err := strconv.ParseBool(active)
+		if err != nil {
+			ctx.JSON(http.StatusOK, app.ErrBadRequest)
+			return
+		}
+		dbQuery = dbQuery.Where("is_active = ?", v)
+	}
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var hospitals []xytmodel.Hospital
+	err := dbQuery.Order("uid").Limit(pageSize).Offset((pageNo - 1) * pageSize).Find(&hospitals).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, hospitals))
+}
+
+func (xh *XytAdminHandler) createHospital(ctx *gin.Context) {
+	var hos xytmodel.Hospital
+	if err := ctx.Bind(&hos); err != nil || hos.UID == "" || hos.FullName == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.fillGradeName(&hos); err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	hos.LogoUrl = ""
+	hos.IsActive = true
+	err := xh.db.Create(&hos).Error
+	if err != nil {
+		if dao.IsDuplicateKeyErr(err) {
+			err = app.ErrHospitalExists
+		}
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(hos))
+}
+
+func (xh *XytAdminHandler) updateHospital(ctx *gin.Context) {
+	var hos xytmodel.Hospital
+	if err := ctx.Bind(&hos); err != nil || hos.UID == "" || hos.FullName == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.fillGradeName(&hos); err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	if err := xh.db.Model(&xytmodel.Hospital{}).Where("uid = ?", hos.UID).Take(&xytmodel.Hospital{}).Error; err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	err := xh.db.Model(&xytmodel.Hospital{UID: hos.UID}).Select(hospitalEditableColumns).Updates(&hos).Error
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+// fillGradeName 按等级编码补全等级名称
+func (xh *XytAdminHandler) fillGradeName(hos *xytmodel.Hospital) error {
+	if hos.GradeCode == "" {
+		hos.GradeName = ""
+		return nil
+	}
+	var grade xytmodel.HospitalGrade
+	err := xh.db.Table(xytmodel.TableHospitalGrade).Where("grade_code = ?", hos.GradeCode).Take(&grade).Error
+	if err != nil {
+		return err
+	}
+	hos.GradeName = grade.GradeName
+	return nil
+}
+
+type hospitalStatusReq struct {
+	UID      string `json:"uid"`
+	IsActive bool   `json:"isActive"`
+}
+
+// setHospitalStatus 停用的医院不再出现在搜索结果中
+func (xh *XytAdminHandler) setHospitalStatus(ctx *gin.Context) {
+	var req hospitalStatusReq
+	if err := ctx.Bind(&req); err != nil || req.UID == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	var hos xytmodel.Hospital
+	if err := xh.db.Model(&xytmodel.Hospital{}).Where("uid = ?", req.UID).Take(&hos).Error; err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	err := xh.db.Model(&xytmodel.Hospital{UID: req.UID}).Update("is_active", req.IsActive).Error
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytAdminHandler) uploadLogo(ctx *gin.Context) {
+	uid := ctx.PostForm("uid")
+	fh, err := ctx.FormFile("file")
+	if err != nil || uid == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if fh.Size > maxLogoSize {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, "logo 不能超过 2MB"))
+		return
+	}
+	var hos xytmodel.Hospital
+	if err = xh.db.Model(&xytmodel.Hospital{}).Where("uid = ?", uid).Take(&hos).Error; err != nil {
+		adminErr(ctx, err)
+		return
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxLogoSize+1))
+	if err != nil || len(data) > maxLogoSize {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	// 以文件内容判断类型, 不信任客户端的文件名和 Content-Type
+	ext, ok := logoTypes[http.DetectContentType(data)]
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, "logo 只支持 png, jpg 和 webp"))
+		return
+	}
+
+	url, err := xh.storage.Save(ctx, "logo/"+uuid.NewString()+ext, data)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	err = xh.db.Model(&xytmodel.Hospital{UID: uid}).Update("logo_url", url).Error
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(map[string]string{"logoUrl": url}))
+}
+
+func (xh *XytAdminHandler) listGrade(ctx *gin.Context) {
+	var grades []xytmodel.HospitalGrade
+	if err := xh.db.Table(xytmodel.TableHospitalGrade).Order("id").Find(&grades).Error; err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(grades))
+}
+
+// saveGrade id 为 0 时新增, 否则修改
+func (xh *XytAdminHandler) saveGrade(ctx *gin.Context) {
+	var grade xytmodel.HospitalGrade
+	if err := ctx.Bind(&grade); err != nil || grade.GradeCode == "" || grade.GradeName == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	err := xh.db.Transaction(func(tx *gorm.DB) error {
+		if grade.Id == 0 {
+			return tx.Create(&grade).Error
+		}
+		var old xytmodel.HospitalGrade
+		err := tx.Table(xytmodel.TableHospitalGrade).Where("id = ?", grade.Id).Take(&old).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&xytmodel.HospitalGrade{Id: grade.Id}).Updates(map[string]any{
+			"grade_code": grade.GradeCode,
+			"grade_name": grade.GradeName,
+		}).Error
+		if err != nil {
+			return err
+		}
+		// 同步修改医院冗余的等级编码和名称
+		return tx.Model(&xytmodel.Hospital{}).Where("grade_code = ?", old.GradeCode).Updates(map[string]any{
+			"grade_code": grade.GradeCode,
+			"grade_name": grade.GradeName,
+		}).Error
+	})
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(grade))
+}
+
+func (xh *XytAdminHandler) listAudit(ctx *gin.Context) {
+	pageNo, pageSize := searchPage(ctx)
+	dbQuery := xh.db.Table(xytmodel.TableAdminAuditLog)
+	if operatorId := ctx.Query("operatorId"); operatorId != "" {
+		dbQuery = dbQuery.Where("operator_id = ?", operatorId)
+	}
+	if p := ctx.Query("path"); p != "" {
+		dbQuery = dbQuery.Where("path = ?", p)
+	}
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var logs []xytmodel.AdminAuditLog
+	err := dbQuery.Order("id desc").Limit(pageSize).Offset((pageNo - 1) * pageSize).Find(&logs).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, logs))
+}
+
+func adminErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrDepartmentMismatch):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrHospitalExists), errors.Is(err, app.ErrDoctorExists):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
@@ -0,0 +1,135 @@
+package xytweb
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/types/app"
+)
+
+func (xh *XytAdminHandler) listDoctor(ctx *gin.Context) {
+	pageNo, pageSize := searchPage(ctx)
+	dbQuery := xh.db.Model(&xytmodel.Doctor{})
+	if hosId := ctx.Query("hosId"); hosId != "" {
+		dbQuery = dbQuery.Where("hos_id = ?", hosId)
+	}
+	if deptId := ctx.Query("deptId"); deptId != "" {
+		dbQuery = dbQuery.Where("dept_id = ?", deptId)
+	}
+	if name := ctx.Query("name"); name != "" {
+		dbQuery = dbQuery.Where("name like ?", "%"+name+"%")
+	}
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var doctors []xytmodel.Doctor
+	err := dbQuery.Order("id").Limit(pageSize).Offset((pageNo - 1) * pageSize).Find(&doctors).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, doctors))
+}
+
+type DoctorReq struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Rank      string `json:"rank"`
+	HosId     string `json:"hosId"`
+	DeptId    string `json:"deptId"`
+	Profile   string `json:"profile"`
+	Specialty string `json:"specialty"`
+	Phone     string `json:"phone"`
+	Email     string `json:"email"`
+}
+
+func (req DoctorReq) valid() bool {
+	return req.Name != "" && req.HosId != "" && req.DeptId != ""
+}
+
+// createDoctor 没有指定编号时自动生成
+func (xh *XytAdminHandler) createDoctor(ctx *gin.Context) {
+	var req DoctorReq
+	if err := ctx.Bind(&req); err != nil || !req.valid() {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.checkDoctorDept(req.HosId, req.DeptId); err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	if req.Id == "" {
+		req.Id = strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+	}
+	doctor := xytmodel.Doctor{
+		Id:        req.Id,
+		Name:      req.Name,
+		Rank:      req.Rank,
+		DeptId:    req.DeptId,
+		HosId:     req.HosId,
+		Profile:   req.Profile,
+		Specialty: req.Specialty,
+		Phone:     req.Phone,
+		Email:     req.Email,
+	}
+	err := xh.db.Create(&doctor).Error
+	if err != nil {
+		if dao.IsDuplicateKeyErr(err) {
+			err = app.ErrDoctorExists
+		}
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(doctor))
+}
+
+// updateDoctor 可以修改医生所属的医院和科室, 已生成的排班不受影响
+func (xh *XytAdminHandler) updateDoctor(ctx *gin.Context) {
+	var req DoctorReq
+	if err := ctx.Bind(&req); err != nil || req.Id == "" || !req.valid() {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.db.Model(&xytmodel.Doctor{}).Where("id = ?", req.Id).Take(&xytmodel.Doctor{}).Error; err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	if err := xh.checkDoctorDept(req.HosId, req.DeptId); err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	err := xh.db.Model(&xytmodel.Doctor{Id: req.Id}).Updates(map[string]any{
+		"name":      req.Name,
+		"rank":      req.Rank,
+		"hos_id":    req.HosId,
+		"dept_id":   req.DeptId,
+		"profile":   req.Profile,
+		"specialty": req.Specialty,
+		"phone":     req.Phone,
+		"email":     req.Email,
+	}).Error
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+// checkDoctorDept 科室必须存在并且属于该医院
+func (xh *XytAdminHandler) checkDoctorDept(hosId, deptId string) error {
+	var dept xytmodel.Department
+	err := xh.db.Table(xytmodel.TableDepartment).Where("uid = ?", deptId).Take(&dept).Error
+	if err != nil {
+		return err
+	}
+	if dept.HospitalID != hosId {
+		return app.ErrDepartmentMismatch
+	}
+	return nil
+}
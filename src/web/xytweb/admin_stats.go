@@ -0,0 +1,126 @@
+package xytweb
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+type StateCount struct {
+	State int8  `json:"state"`
+	Count int64 `json:"count"`
+}
+
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+type DeptCount struct {
+	DeptId   string `json:"deptId"`
+	DeptName string `json:"deptName"`
+	Count    int64  `json:"count"`
+}
+
+// BookingStats 医院在 [From, To] 期间创建的挂号订单统计
+type BookingStats struct {
+	HosId string `json:"hosId"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Total int64  `json:"total"`
+	// 已支付和已完成订单的金额
+	PaidAmount int64        `json:"paidAmount"`
+	ByState    []StateCount `json:"byState"`
+	Daily      []DailyCount `json:"daily"`
+	ByDept     []DeptCount  `json:"byDept"`
+}
+
+// bookingStats 按下单日期统计, from 和 to 为 2024-06-18 格式, 默认最近 30 天
+func (xh *XytAdminHandler) bookingStats(ctx *gin.Context) {
+	hosId := ctx.Query("hosId")
+	if hosId == "" {
+		ctx.JSON(http.StatusOK, app.ResponseErr(400, "请指定医院hosId"))
+		return
+	}
+	to := time.Now()
+	if v := ctx.Query("to"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, app.ErrBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, 1-defaultStatsDays)
+	if v := ctx.Query("from"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+		if err != nil {
+			ctx.JSON(http.StatusOK, app.ErrBadRequest)
+			return
+		}
+		from = t
+	}
+	if from.After(to) || to.Sub(from) > maxStatsDays*24*time.Hour {
+		ctx.JSON(http.StatusOK, app.ErrOutOfRange)
+		return
+	}
+
+	stats, err := QueryBookingStats(xh.db, hosId, from, to)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(stats))
+}
+
+// 计入收款金额的订单状态, 退款中和已退款的不计入
+var paidOrderStates = []int8{
+	xytmodel.OrderStatePaid,
+	xytmodel.OrderStateCompleted,
+	xytmodel.OrderStateCheckedIn,
+	xytmodel.OrderStateCalling,
+	xytmodel.OrderStateNoShow,
+}
+
+func QueryBookingStats(db *gorm.DB, hosId string, from, to time.Time) (BookingStats, error) {
+	var stats = BookingStats{
+		HosId: hosId,
+		From:  from.Format(time.DateOnly),
+		To:    to.Format(time.DateOnly),
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	end := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, to.Location())
+	orders := func() *gorm.DB {
+		return db.Table(xytmodel.TableOrder).Where("hos_id = ? and created_at >= ? and created_at < ?", hosId, start, end)
+	}
+
+	err := orders().Select("state, count(*) as count").Group("state").Order("state").Scan(&stats.ByState).Error
+	if err != nil {
+		return stats, err
+	}
+	for _, sc := range stats.ByState {
+		stats.Total += sc.Count
+	}
+	err = orders().Where("state in ?", paidOrderStates).
+		Select("coalesce(sum(amount), 0)").Scan(&stats.PaidAmount).Error
+	if err != nil {
+		return stats, err
+	}
+	err = orders().Select("date_format(created_at, '%Y-%m-%d') as date, count(*) as count").
+		Group("date").Order("date").Scan(&stats.Daily).Error
+	if err != nil {
+		return stats, err
+	}
+	err = orders().Select("dept_id, dept_name, count(*) as count").
+		Group("dept_id, dept_name").Order("count desc").Scan(&stats.ByDept).Error
+	return stats, err
+}
@@ -0,0 +1,147 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/hllmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/web/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestXytAdminHandler_Protected(t *testing.T) {
+	const body = `{"uid":"h1","isActive":false}`
+	roles := map[string]string{
+		"admin": hllmodel.RoleAdmin,
+		"staff": "",
+	}
+
+	testCases := []struct {
+		name   string
+		userId string
+		mock   func(t *testing.T) *sql.DB
+
+		wantBody  app.ResponseType
+		wantAudit *middleware.AuditLog
+	}{
+		{
+			name:   "管理员停用医院",
+			userId: "admin",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `hospital` WHERE uid = \\?.*").
+					WillReturnRows(sqlmock.NewRows([]string{"uid", "is_active"}).AddRow("h1", true))
+				mock.ExpectExec("UPDATE `hospital` SET `is_active`=\\?,`updated_at`=\\? WHERE `uid` = \\?").
+					WithArgs(false, sqlmock.AnyArg(), "h1").WillReturnResult(sqlmock.NewResult(0, 1))
+				return db
+			},
+			wantBody: app.ResponseOK(nil),
+			wantAudit: &middleware.AuditLog{
+				OperatorId: "admin",
+				Method:     http.MethodPost,
+				Path:       "/xyt/admin/hospital/status",
+				ReqBody:    body,
+				IP:         "192.0.2.1",
+				Code:       200,
+				Msg:        "ok",
+			},
+		},
+		{
+			name:   "医院不存在也记录审计",
+			userId: "admin",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `hospital` WHERE uid = \\?.*").
+					WillReturnRows(sqlmock.NewRows([]string{"uid"}))
+				return db
+			},
+			wantBody: *app.ErrNotFound,
+			wantAudit: &middleware.AuditLog{
+				OperatorId: "admin",
+				Method:     http.MethodPost,
+				Path:       "/xyt/admin/hospital/status",
+				ReqBody:    body,
+				IP:         "192.0.2.1",
+				Code:       app.ErrCodeNotFound,
+				Msg:        app.ErrNotFound.Msg,
+			},
+		},
+		{
+			name:   "不是管理员",
+			userId: "staff",
+			mock: func(t *testing.T) *sql.DB {
+				db, _, err := sqlmock.New()
+				require.NoError(t, err)
+				return db
+			},
+			wantBody: *app.ErrForbidden,
+		},
+		{
+			name:   "不是后台用户",
+			userId: "patient",
+			mock: func(t *testing.T) *sql.DB {
+				db, _, err := sqlmock.New()
+				require.NoError(t, err)
+				return db
+			},
+			wantBody: *app.ErrForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			var audit *middleware.AuditLog
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				ctx.Set(config.USER_ID, tc.userId)
+			})
+			adminGroup := server.Group("/xyt/admin",
+				middleware.NewRoleBuilder(func(ctx context.Context, userId string) (string, error) {
+					role, ok := roles[userId]
+					if !ok {
+						return "", errors.New("用户不存在")
+					}
+					return role, nil
+				}).Allow(hllmodel.RoleAdmin).Build(),
+				middleware.NewAuditBuilder(func(ctx context.Context, al *middleware.AuditLog) {
+					audit = al
+				}).Build(),
+			)
+			NewXytAdminHandler(db, nil).RegisterRoutes(adminGroup)
+
+			req := jsonRequest(t, "/xyt/admin/hospital/status", body)
+			req.RemoteAddr = "192.0.2.1:1234"
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var respBody app.ResponseType
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &respBody))
+			assert.Equal(t, tc.wantBody, respBody)
+			assert.Equal(t, tc.wantAudit, audit)
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/pkg/ratelimit"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+// RuleViolation 预约规则拒绝了这次预约, BanFor 大于 0 时同时暂停该就诊人预约
+type RuleViolation struct {
+	Rule   string
+	Reason string
+	BanFor time.Duration
+}
+
+func (v *RuleViolation) Error() string {
+	return v.Reason
+}
+
+func (v *RuleViolation) Unwrap() error {
+	return app.ErrBookingRejected
+}
+
+// BookingRule 预约前检查的规则, 不满足时返回 *RuleViolation
+type BookingRule interface {
+	Check(ctx context.Context, order xytmodel.RegisterOrder) error
+}
+
+// TxBookingRule 依赖就诊人已有订单的规则, 在占号的事务里用事务内的 repo 再检查一次
+type TxBookingRule interface {
+	CheckTx(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error
+}
+
+// BookingGuard 在下单前依次检查封禁和预约规则, 并记录违规
+type BookingGuard struct {
+	db    *gorm.DB
+	rules []BookingRule
+}
+
+func NewBookingGuard(db *gorm.DB, rules ...BookingRule) *BookingGuard {
+	return &BookingGuard{
+		db:    db,
+		rules: rules,
+	}
+}
+
+func (g *BookingGuard) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	ban, err := FindActiveBan(g.db.WithContext(ctx), order.PatientId)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w, %s 前不能预约", app.ErrPatientBanned, time.UnixMilli(ban.ExpiresAt).Format(time.DateTime))
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	for _, rule := range g.rules {
+		err := rule.Check(ctx, order)
+		if err == nil {
+			continue
+		}
+		var violation *RuleViolation
+		if errors.As(err, &violation) {
+			g.record(ctx, order, violation)
+		}
+		return err
+	}
+	return nil
+}
+
+// CheckTx 在占号的事务里锁住就诊人后再检查 TxBookingRule, 可以直接作为 service.OrderCheck 使用
+// 同一就诊人的并发预约在这里串行执行, 不会同时通过下单前的检查
+func (g *BookingGuard) CheckTx(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error {
+	err := repo.LockPatient(ctx, order.PatientId)
+	if err != nil {
+		return err
+	}
+	for _, rule := range g.rules {
+		txRule, ok := rule.(TxBookingRule)
+		if !ok {
+			continue
+		}
+		err = txRule.CheckTx(ctx, repo, order)
+		if err == nil {
+			continue
+		}
+		var violation *RuleViolation
+		if errors.As(err, &violation) {
+			g.record(ctx, order, violation)
+		}
+		return err
+	}
+	return nil
+}
+
+// 记录失败不影响拒绝这次预约
+func (g *BookingGuard) record(ctx context.Context, order xytmodel.RegisterOrder, violation *RuleViolation) {
+	err := g.db.WithContext(ctx).Create(&xytmodel.BookingViolation{
+		UserId:    order.UserId,
+		PatientId: order.PatientId,
+		ScheId:    order.ScheId,
+		Rule:      violation.Rule,
+		Reason:    violation.Reason,
+	}).Error
+	if err != nil {
+		log.Println("record booking violation:", err)
+	}
+	if violation.BanFor <= 0 {
+		return
+	}
+	err = g.db.WithContext(ctx).Create(&xytmodel.BookingBan{
+		UserId:    order.UserId,
+		PatientId: order.PatientId,
+		Rule:      violation.Rule,
+		Reason:    violation.Reason,
+		ExpiresAt: time.Now().Add(violation.BanFor).UnixMilli(),
+	}).Error
+	if err != nil {
+		log.Println("create booking ban:", err)
+	}
+}
+
+// FindActiveBan 查询就诊人当前生效的封禁
+func FindActiveBan(db *gorm.DB, patientId string) (xytmodel.BookingBan, error) {
+	var ban xytmodel.BookingBan
+	err := db.Table(xytmodel.TableBookingBan).
+		Where("patient_id = ? and lifted_at = 0 and expires_at > ?", patientId, time.Now().UnixMilli()).
+		Order("expires_at desc").Take(&ban).Error
+	return ban, err
+}
+
+// MaxActiveOrdersRule 同一就诊人最多同时持有 Max 个未就诊的订单
+type MaxActiveOrdersRule struct {
+	orders repository.OrderRepository
+	max    int
+}
+
+func NewMaxActiveOrdersRule(orders repository.OrderRepository, max int) *MaxActiveOrdersRule {
+	return &MaxActiveOrdersRule{orders: orders, max: max}
+}
+
+func (r *MaxActiveOrdersRule) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	return r.CheckTx(ctx, r.orders, order)
+}
+
+func (r *MaxActiveOrdersRule) CheckTx(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error {
+	count, err := repo.CountActive(ctx, order.PatientId)
+	if err != nil {
+		return err
+	}
+	if count >= int64(r.max) {
+		return &RuleViolation{Rule: "max_active_orders", Reason: fmt.Sprintf("同一就诊人最多同时预约%d个号", r.max)}
+	}
+	return nil
+}
+
+// DuplicateVisitRule 同一就诊人同一天不能重复预约同一医生或同一科室
+type DuplicateVisitRule struct {
+	orders repository.OrderRepository
+}
+
+func NewDuplicateVisitRule(orders repository.OrderRepository) *DuplicateVisitRule {
+	return &DuplicateVisitRule{orders: orders}
+}
+
+func (r *DuplicateVisitRule) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	return r.CheckTx(ctx, r.orders, order)
+}
+
+func (r *DuplicateVisitRule) CheckTx(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error {
+	date := visitDate(order)
+	count, err := repo.CountActiveOnDate(ctx, order.PatientId, date, order.DocId, order.DeptID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &RuleViolation{Rule: "duplicate_visit", Reason: fmt.Sprintf("%s 已经预约过该医生或科室", date)}
+	}
+	return nil
+}
+
+// NoShowRule 一段时间内爽约达到 max 次后暂停预约 banFor
+// 爽约是指超过就诊时间仍未签到的订单, 爽约任务还没标记的已支付订单也算, 只统计上一次封禁之后的爽约
+type NoShowRule struct {
+	db     *gorm.DB
+	max    int
+	window time.Duration
+	banFor time.Duration
+}
+
+func NewNoShowRule(db *gorm.DB, max int, window, banFor time.Duration) *NoShowRule {
+	return &NoShowRule{db: db, max: max, window: window, banFor: banFor}
+}
+
+func (r *NoShowRule) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	since := time.Now().Add(-r.window)
+	var lastBan xytmodel.BookingBan
+	err := r.db.WithContext(ctx).Table(xytmodel.TableBookingBan).
+		Where("patient_id = ?", order.PatientId).Order("id desc").Take(&lastBan).Error
+	switch {
+	case err == nil:
+		if bannedAt := time.UnixMilli(lastBan.CreatedAt); bannedAt.After(since) {
+			since = bannedAt
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var count int64
+	err = r.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("patient_id = ? and state in ?", order.PatientId, []int8{xytmodel.OrderStatePaid, xytmodel.OrderStateNoShow}).
+		Where("visit_time >= ? and visit_time < ?", since.Format(time.DateOnly), time.Now().Format(time.DateOnly)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count >= int64(r.max) {
+		return &RuleViolation{
+			Rule:   "no_show",
+			Reason: fmt.Sprintf("爽约%d次, 暂停预约%d天", count, int(r.banFor.Hours()/24)),
+			BanFor: r.banFor,
+		}
+	}
+	return nil
+}
+
+// RateRule 用限流器限制同一用户的预约频率, 限流器出错时放行
+type RateRule struct {
+	limiter ratelimit.Limiter
+}
+
+func NewRateRule(limiter ratelimit.Limiter) *RateRule {
+	return &RateRule{limiter: limiter}
+}
+
+func (r *RateRule) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	limited, err := r.limiter.Limit(ctx, "xyt:booking:"+order.UserId)
+	if err != nil {
+		log.Println("booking rate limit:", err)
+		return nil
+	}
+	if limited {
+		return &RuleViolation{Rule: "rate", Reason: "预约太频繁, 请稍后再试"}
+	}
+	return nil
+}
+
+// CertificationRule 医院要求实名认证时, 只有实名认证通过的用户才能预约
+type CertificationRule struct {
+	db        *gorm.DB
+	certifier *Certifier
+}
+
+func NewCertificationRule(db *gorm.DB, certifier *Certifier) *CertificationRule {
+	return &CertificationRule{db: db, certifier: certifier}
+}
+
+func (r *CertificationRule) Check(ctx context.Context, order xytmodel.RegisterOrder) error {
+	var hos xytmodel.Hospital
+	err := r.db.WithContext(ctx).Table(xytmodel.TableHospital).Select("require_certification").
+		Where("uid = ?", order.HosID).Take(&hos).Error
+	if err != nil || !hos.RequireCertification {
+		return err
+	}
+	certified, err := r.certifier.Certified(ctx, order.UserId)
+	if err != nil {
+		return err
+	}
+	if !certified {
+		return &RuleViolation{Rule: "certification", Reason: "该医院需要实名认证通过后才能预约"}
+	}
+	return nil
+}
+
+func visitDate(order xytmodel.RegisterOrder) string {
+	if len(order.VisitTime) >= len(time.DateOnly) {
+		return order.VisitTime[:len(time.DateOnly)]
+	}
+	return order.VisitTime
+}
+
+// XytBookingAdminHandler 医院工作人员查看违规记录和解除封禁
+type XytBookingAdminHandler struct {
+	db *gorm.DB
+}
+
+func NewXytBookingAdminHandler(db *gorm.DB) *XytBookingAdminHandler {
+	return &XytBookingAdminHandler{db: db}
+}
+
+// RegisterRoutes group 为管理后台的路由组
+func (xh *XytBookingAdminHandler) RegisterRoutes(group *gin.RouterGroup) {
+	bg := group.Group("/booking")
+	bg.GET("/bans", xh.listBans)
+	bg.POST("/ban/lift", xh.liftBan)
+	bg.GET("/violations", xh.listViolations)
+}
+
+func (xh *XytBookingAdminHandler) listBans(ctx *gin.Context) {
+	dbQuery := xh.db.Table(xytmodel.TableBookingBan)
+	if patientId := ctx.Query("patientId"); patientId != "" {
+		dbQuery = dbQuery.Where("patient_id = ?", patientId)
+	}
+	if active, _ := strconv.ParseBool(ctx.Query("active")); active {
+		dbQuery = dbQuery.Where("lifted_at = 0 and expires_at > ?", time.Now().UnixMilli())
+	}
+	var bans []xytmodel.BookingBan
+	err := dbQuery.Order("id desc").Limit(100).Find(&bans).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(bans))
+}
+
+type liftBanReq struct {
+	Id int `json:"id"`
+}
+
+func (xh *XytBookingAdminHandler) liftBan(ctx *gin.Context) {
+	var req liftBanReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	operator, _ := ctx.Get(config.USER_ID)
+	operatorId, _ := operator.(string)
+
+	res := xh.db.Table(xytmodel.TableBookingBan).
+		Where("id = ? and lifted_at = 0", req.Id).
+		Updates(map[string]any{
+			"lifted_at": time.Now().UnixMilli(),
+			"lifted_by": operatorId,
+		})
+	if res.Error != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	if res.RowsAffected == 0 {
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytBookingAdminHandler) listViolations(ctx *gin.Context) {
+	dbQuery := xh.db.Table(xytmodel.TableBookingViolation)
+	if patientId := ctx.Query("patientId"); patientId != "" {
+		dbQuery = dbQuery.Where("patient_id = ?", patientId)
+	}
+	if userId := ctx.Query("userId"); userId != "" {
+		dbQuery = dbQuery.Where("user_id = ?", userId)
+	}
+	var violations []xytmodel.BookingViolation
+	err := dbQuery.Order("id desc").Limit(100).Find(&violations).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(violations))
+}
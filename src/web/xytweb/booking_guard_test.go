@@ -0,0 +1,277 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	limitermock "github.com/solunara/isb/pkg/ratelimit/mocks"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestBookingGuard_Check(t *testing.T) {
+	order := xytmodel.RegisterOrder{
+		UserId:    "u1",
+		PatientId: "p1",
+		ScheId:    "s1",
+		DocId:     "d1",
+		DeptID:    "dp1",
+		VisitTime: "2030-01-02 上午",
+	}
+	noBan := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM `booking_ban` WHERE patient_id = \\? and lifted_at = 0.*").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	countRows := func(n int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"count"}).AddRow(n)
+	}
+
+	testCases := []struct {
+		name  string
+		mock  func(t *testing.T) *sql.DB
+		limit func(ctrl *gomock.Controller) *limitermock.MockLimiter
+
+		wantErr  error
+		wantRule string
+	}{
+		{
+			name: "通过所有规则",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				noBan(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(2))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time like.*").WillReturnRows(countRows(0))
+				mock.ExpectQuery("SELECT \\* FROM `booking_ban` WHERE patient_id = \\? ORDER BY id desc.*").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time >=.*").WillReturnRows(countRows(2))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				limiter := limitermock.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "xyt:booking:u1").Return(false, nil)
+				return limiter
+			},
+		},
+		{
+			name: "已被封禁",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `booking_ban` WHERE patient_id = \\? and lifted_at = 0.*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "patient_id", "expires_at"}).AddRow(1, "p1", time.Now().Add(time.Hour).UnixMilli()))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				return limitermock.NewMockLimiter(ctrl)
+			},
+			wantErr: app.ErrPatientBanned,
+		},
+		{
+			name: "预约太频繁",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				noBan(mock)
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				limiter := limitermock.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "xyt:booking:u1").Return(true, nil)
+				return limiter
+			},
+			wantErr:  app.ErrBookingRejected,
+			wantRule: "rate",
+		},
+		{
+			name: "限流器出错时放行",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				noBan(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(3))
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				limiter := limitermock.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "xyt:booking:u1").Return(false, errors.New("redis 错误"))
+				return limiter
+			},
+			wantErr:  app.ErrBookingRejected,
+			wantRule: "max_active_orders",
+		},
+		{
+			name: "同一天重复预约",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				noBan(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(1))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time like.*").
+					WithArgs("p1", xytmodel.OrderStatePending, xytmodel.OrderStatePaid, xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling,
+						"2030-01-02%", "d1", "dp1").
+					WillReturnRows(countRows(1))
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				limiter := limitermock.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "xyt:booking:u1").Return(false, nil)
+				return limiter
+			},
+			wantErr:  app.ErrBookingRejected,
+			wantRule: "duplicate_visit",
+		},
+		{
+			name: "爽约次数过多被封禁",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				noBan(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(0))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time like.*").WillReturnRows(countRows(0))
+				mock.ExpectQuery("SELECT \\* FROM `booking_ban` WHERE patient_id = \\? ORDER BY id desc.*").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time >=.*").WillReturnRows(countRows(3))
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `booking_ban` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				return db
+			},
+			limit: func(ctrl *gomock.Controller) *limitermock.MockLimiter {
+				limiter := limitermock.NewMockLimiter(ctrl)
+				limiter.EXPECT().Limit(gomock.Any(), "xyt:booking:u1").Return(false, nil)
+				return limiter
+			},
+			wantErr:  app.ErrBookingRejected,
+			wantRule: "no_show",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			orders := repository.NewOrderRepository(dao.NewOrderDAO(db))
+			guard := NewBookingGuard(db,
+				NewRateRule(tc.limit(ctrl)),
+				NewMaxActiveOrdersRule(orders, 3),
+				NewDuplicateVisitRule(orders),
+				NewNoShowRule(db, 3, 90*24*time.Hour, 30*24*time.Hour),
+			)
+			err = guard.Check(context.Background(), order)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.wantErr)
+			var violation *RuleViolation
+			if tc.wantRule != "" {
+				require.ErrorAs(t, err, &violation)
+				assert.Equal(t, tc.wantRule, violation.Rule)
+			}
+		})
+	}
+}
+
+func TestBookingGuard_CheckTx(t *testing.T) {
+	order := xytmodel.RegisterOrder{
+		UserId:    "u1",
+		PatientId: "p1",
+		ScheId:    "s1",
+		DocId:     "d1",
+		DeptID:    "dp1",
+		VisitTime: "2030-01-02 上午",
+	}
+	lockPatient := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT `id` FROM `patient` WHERE id = \\? .*FOR UPDATE").
+			WithArgs("p1", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("p1"))
+	}
+	countRows := func(n int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"count"}).AddRow(n)
+	}
+
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+
+		wantRule string
+	}{
+		{
+			name: "并发预约的订单已经提交",
+			mock: func(mock sqlmock.Sqlmock) {
+				lockPatient(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(3))
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantRule: "max_active_orders",
+		},
+		{
+			name: "并发预约了同一医生",
+			mock: func(mock sqlmock.Sqlmock) {
+				lockPatient(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(1))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time like.*").WillReturnRows(countRows(1))
+				mock.ExpectExec("INSERT INTO `booking_violation` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantRule: "duplicate_visit",
+		},
+		{
+			// 限流等不依赖已有订单的规则不会在事务里再检查
+			name: "通过",
+			mock: func(mock sqlmock.Sqlmock) {
+				lockPatient(mock)
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE patient_id = \\? and state in .*").WillReturnRows(countRows(2))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` .*visit_time like.*").WillReturnRows(countRows(0))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db := newQueueTestDB(t, sqlDB)
+
+			orders := repository.NewOrderRepository(dao.NewOrderDAO(db))
+			guard := NewBookingGuard(db,
+				NewRateRule(limitermock.NewMockLimiter(ctrl)),
+				NewMaxActiveOrdersRule(orders, 3),
+				NewDuplicateVisitRule(orders),
+			)
+			err = guard.CheckTx(context.Background(), orders, order)
+			if tc.wantRule == "" {
+				assert.NoError(t, err)
+			} else {
+				var violation *RuleViolation
+				require.ErrorAs(t, err, &violation)
+				assert.Equal(t, tc.wantRule, violation.Rule)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package xytweb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCertificationImageSize = 5 << 20
+
+// VerifyResult 实名核验的结果, 没有通过时 Message 是原因
+type VerifyResult struct {
+	Passed  bool
+	Message string
+}
+
+// CertificationVerifier 核验姓名和证件号是否一致, 例如对接公安的实名核验服务
+// 核验没有通过的申请直接驳回, 通过的再由审核员对照证件照片审核
+type CertificationVerifier interface {
+	Verify(ctx context.Context, name, idType, idNumber string) (VerifyResult, error)
+}
+
+// FakeVerifier 本地开发使用, 只校验身份证号的格式和姓名长度
+type FakeVerifier struct{}
+
+func NewFakeVerifier() FakeVerifier {
+	return FakeVerifier{}
+}
+
+func (FakeVerifier) Verify(ctx context.Context, name, idType, idNumber string) (VerifyResult, error) {
+	if _, err := service.ParseIdNumber(idNumber); err != nil {
+		return VerifyResult{Message: err.Error()}, nil
+	}
+	if len([]rune(name)) < 2 {
+		return VerifyResult{Message: "姓名格式错误"}, nil
+	}
+	return VerifyResult{Passed: true, Message: "格式校验通过"}, nil
+}
+
+type CertificationReq struct {
+	Name     string `json:"name"`
+	Code     string `json:"code"`
+	CodeType string `json:"codeType"`
+	// base64 编码的证件照片, 可以带 data:image/png;base64, 前缀
+	Image string `json:"image"`
+}
+
+// Certifier 处理实名认证的提交和审核
+type Certifier struct {
+	db       *gorm.DB
+	storage  ObjectStorage
+	verifier CertificationVerifier
+}
+
+func NewCertifier(db *gorm.DB, storage ObjectStorage, verifier CertificationVerifier) *Certifier {
+	return &Certifier{
+		db:       db,
+		storage:  storage,
+		verifier: verifier,
+	}
+}
+
+// decodeCertificationImage 解码证件照片, 返回图片数据和类型
+func decodeCertificationImage(s string) ([]byte, string, error) {
+	if i := strings.Index(s, ";base64,"); i >= 0 && strings.HasPrefix(s, "data:") {
+		s = s[i+len(";base64,"):]
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 || len(data) > maxCertificationImageSize {
+		return nil, "", app.ErrCertificationImage
+	}
+	contentType := http.DetectContentType(data)
+	if _, ok := logoTypes[contentType]; !ok {
+		return nil, "", app.ErrCertificationImage
+	}
+	return data, contentType, nil
+}
+
+// Submit 提交实名认证, 核验没有通过时直接驳回; 待审核或已通过时不能再次提交
+func (c *Certifier) Submit(ctx context.Context, userId string, req CertificationReq) (xytmodel.Certification, error) {
+	data, contentType, err := decodeCertificationImage(req.Image)
+	if err != nil {
+		return xytmodel.Certification{}, err
+	}
+	req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	cert := xytmodel.Certification{
+		UserId:   userId,
+		Name:     strings.TrimSpace(req.Name),
+		IdType:   req.CodeType,
+		IdNumber: req.Code,
+		State:    xytmodel.CertificationSubmitted,
+	}
+	if err = c.checkSubmittable(c.db.WithContext(ctx), userId); err != nil {
+		return xytmodel.Certification{}, err
+	}
+
+	result, err := c.verifier.Verify(ctx, cert.Name, cert.IdType, cert.IdNumber)
+	if err != nil {
+		return xytmodel.Certification{}, err
+	}
+	cert.VerifyResult = result.Message
+	if result.Passed {
+		cert.ImageKey = "certification/" + userId + "/" + uuid.NewString() + logoTypes[contentType]
+		cert.ImageType = contentType
+		if err = c.storage.Put(ctx, cert.ImageKey, data, contentType); err != nil {
+			return xytmodel.Certification{}, err
+		}
+	} else {
+		cert.State = xytmodel.CertificationRejected
+		cert.RejectReason = result.Message
+		cert.ReviewedAt = time.Now().UnixMilli()
+	}
+
+	err = c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 同一用户并发提交时只有一个能成功
+		if err := dao.LockXytUser(tx, userId); err != nil {
+			return err
+		}
+		if err := c.checkSubmittable(tx, userId); err != nil {
+			return err
+		}
+		return tx.Create(&cert).Error
+	})
+	return cert, err
+}
+
+func (c *Certifier) checkSubmittable(db *gorm.DB, userId string) error {
+	latest, err := findLatestCertification(db, userId)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	case err != nil:
+		return err
+	case latest.State == xytmodel.CertificationSubmitted:
+		return app.ErrCertificationPending
+	case latest.State == xytmodel.CertificationApproved:
+		return app.ErrCertified
+	}
+	return nil
+}
+
+func findLatestCertification(db *gorm.DB, userId string) (xytmodel.Certification, error) {
+	var cert xytmodel.Certification
+	err := db.Table(xytmodel.TableCertification).Where("user_id = ?", userId).Order("id desc").Take(&cert).Error
+	return cert, err
+}
+
+// Latest 用户最近一次提交的实名认证
+func (c *Certifier) Latest(ctx context.Context, userId string) (xytmodel.Certification, error) {
+	return findLatestCertification(c.db.WithContext(ctx), userId)
+}
+
+// Certified 用户是否已通过实名认证
+func (c *Certifier) Certified(ctx context.Context, userId string) (bool, error) {
+	var count int64
+	err := c.db.WithContext(ctx).Table(xytmodel.TableCertification).
+		Where("user_id = ? and state = ?", userId, xytmodel.CertificationApproved).Count(&count).Error
+	return count > 0, err
+}
+
+// Review 审核待审核的实名认证, 通过后把姓名和证件号写入用户信息
+func (c *Certifier) Review(ctx context.Context, id int, reviewer string, approve bool, reason string) error {
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cert xytmodel.Certification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table(xytmodel.TableCertification).
+			Where("id = ?", id).Take(&cert).Error
+		if err != nil {
+			return err
+		}
+		if cert.State != xytmodel.CertificationSubmitted {
+			return app.ErrCertificationReviewed
+		}
+		state := xytmodel.CertificationRejected
+		if approve {
+			state = xytmodel.CertificationApproved
+			reason = ""
+		}
+		err = tx.Table(xytmodel.TableCertification).Where("id = ?", id).Updates(map[string]any{
+			"state":         state,
+			"reviewer":      reviewer,
+			"reject_reason": reason,
+			"reviewed_at":   time.Now().UnixMilli(),
+		}).Error
+		if err != nil || !approve {
+			return err
+		}
+		return tx.Table(xytmodel.TableXytUser).Where("user_id = ?", cert.UserId).Updates(&xytmodel.XytUser{
+			Name:     cert.Name,
+			IdTyper:  cert.IdType,
+			IdNumber: cert.IdNumber,
+		}).Error
+	})
+}
+
+// Image 证件照片和类型
+func (c *Certifier) Image(ctx context.Context, id int) ([]byte, string, error) {
+	var cert xytmodel.Certification
+	err := c.db.WithContext(ctx).Table(xytmodel.TableCertification).Where("id = ?", id).Take(&cert).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if cert.ImageKey == "" {
+		return nil, "", gorm.ErrRecordNotFound
+	}
+	data, err := c.storage.Get(ctx, cert.ImageKey)
+	return data, cert.ImageType, err
+}
+
+// XytCertificationHandler 用户提交实名认证, 审核员审核
+type XytCertificationHandler struct {
+	db        *gorm.DB
+	certifier *Certifier
+}
+
+func NewXytCertificationHandler(db *gorm.DB, certifier *Certifier) *XytCertificationHandler {
+	return &XytCertificationHandler{
+		db:        db,
+		certifier: certifier,
+	}
+}
+
+func (xh *XytCertificationHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/user/certification", xh.getCertification)
+	group.POST("/user/certification", xh.submit)
+}
+
+// RegisterReviewRoutes group 为审核员可以访问的路由组
+func (xh *XytCertificationHandler) RegisterReviewRoutes(group *gin.RouterGroup) {
+	cg := group.Group("/certification")
+	cg.GET("/list", xh.list)
+	cg.GET("/image", xh.image)
+	cg.POST("/review", xh.review)
+}
+
+// maskCertification 返回给用户的证件号脱敏
+func maskCertification(cert xytmodel.Certification) xytmodel.Certification {
+	cert.IdNumber = service.MaskMiddle(cert.IdNumber, 3, 4)
+	return cert
+}
+
+// getCertification 没有提交过时 data 为 null
+func (xh *XytCertificationHandler) getCertification(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	cert, err := xh.certifier.Latest(ctx, userid.(string))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+			return
+		}
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(maskCertification(cert)))
+}
+
+func (xh *XytCertificationHandler) submit(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
+	var req CertificationReq
+	if err := ctx.Bind(&req); err != nil || req.Name == "" || req.Code == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	cert, err := xh.certifier.Submit(ctx, userid.(string), req)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, app.ResponseOK(maskCertification(cert)))
+	case errors.Is(err, app.ErrUserNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrCertificationImage):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrCertificationPending), errors.Is(err, app.ErrCertified):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
+
+func (xh *XytCertificationHandler) list(ctx *gin.Context) {
+	pageNo, pageSize := searchPage(ctx)
+	dbQuery := xh.db.Table(xytmodel.TableCertification)
+	if state := ctx.Query("state"); state != "" {
+		st, err := strconv.Atoi(state)
+		if err != nil {
+			ctx.JSON(http.StatusOK, app.ErrBadRequest)
+			return
+		}
+		dbQuery = dbQuery.Where("state = ?", st)
+	}
+	if userId := ctx.Query("userId"); userId != "" {
+		dbQuery = dbQuery.Where("user_id = ?", userId)
+	}
+	var total int64
+	if err := dbQuery.Count(&total).Error; err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var certs []xytmodel.Certification
+	err := dbQuery.Order("id").Limit(pageSize).Offset((pageNo - 1) * pageSize).Find(&certs).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, certs))
+}
+
+func (xh *XytCertificationHandler) image(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	data, contentType, err := xh.certifier.Image(ctx, id)
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+type reviewCertificationReq struct {
+	Id      int    `json:"id"`
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason"`
+}
+
+// review 驳回时必须填写原因
+func (xh *XytCertificationHandler) review(ctx *gin.Context) {
+	reviewer, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req reviewCertificationReq
+	if err := ctx.Bind(&req); err != nil || req.Id == 0 || (!req.Approve && req.Reason == "") {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	err := xh.certifier.Review(ctx, req.Id, reviewer.(string), req.Approve, req.Reason)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+	case errors.Is(err, app.ErrCertificationReviewed):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		adminErr(ctx, err)
+	}
+}
@@ -0,0 +1,186 @@
+package xytweb
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type memObjectStorage map[string][]byte
+
+func (s memObjectStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s[key] = data
+	return nil
+}
+
+func (s memObjectStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	return s[key], nil
+}
+
+// png 文件头, 足够 http.DetectContentType 识别
+var testPNG = base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n0000"))
+
+func TestCertifier_Submit(t *testing.T) {
+	const userId = "u1"
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+		req  CertificationReq
+
+		wantErr    error
+		wantState  int8
+		wantStored int
+	}{
+		{
+			name:    "照片格式错误",
+			mock:    func(mock sqlmock.Sqlmock) {},
+			req:     CertificationReq{Name: "张三", Code: "11010519491231002X", Image: base64.StdEncoding.EncodeToString([]byte("not an image"))},
+			wantErr: app.ErrCertificationImage,
+		},
+		{
+			name: "审核中不能重复提交",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `certification` WHERE user_id = \\? ORDER BY id desc LIMIT \\?").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(1, xytmodel.CertificationSubmitted))
+			},
+			req:     CertificationReq{Name: "张三", Code: "11010519491231002X", Image: testPNG},
+			wantErr: app.ErrCertificationPending,
+		},
+		{
+			name: "核验不通过直接驳回",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `certification` WHERE user_id = \\? ORDER BY id desc LIMIT \\?").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(1, xytmodel.CertificationRejected))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `xyt_user` WHERE user_id = \\? LIMIT \\? FOR UPDATE").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT \\* FROM `certification` WHERE user_id = \\? ORDER BY id desc LIMIT \\?").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "state"}).AddRow(1, xytmodel.CertificationRejected))
+				mock.ExpectExec("INSERT INTO `certification`").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+			req:       CertificationReq{Name: "张三", Code: "110101199003071234", Image: testPNG},
+			wantState: xytmodel.CertificationRejected,
+		},
+		{
+			name: "核验通过等待审核",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `certification` WHERE user_id = \\? ORDER BY id desc LIMIT \\?").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `id` FROM `xyt_user` WHERE user_id = \\? LIMIT \\? FOR UPDATE").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT \\* FROM `certification` WHERE user_id = \\? ORDER BY id desc LIMIT \\?").
+					WithArgs(userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec("INSERT INTO `certification`").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			req:        CertificationReq{Name: "张三", Code: "11010519491231002x", Image: "data:image/png;base64," + testPNG},
+			wantState:  xytmodel.CertificationSubmitted,
+			wantStored: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			storage := memObjectStorage{}
+			cert, err := NewCertifier(db, storage, NewFakeVerifier()).Submit(context.Background(), userId, tc.req)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantState, cert.State)
+			assert.Len(t, storage, tc.wantStored)
+		})
+	}
+}
+
+func TestCertificationRule(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+
+		wantErr error
+	}{
+		{
+			name: "医院不要求实名认证",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT `require_certification` FROM `hospital` WHERE uid = \\? LIMIT \\?").
+					WithArgs("h1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"require_certification"}).AddRow(false))
+			},
+		},
+		{
+			name: "没有通过实名认证",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT `require_certification` FROM `hospital` WHERE uid = \\? LIMIT \\?").
+					WithArgs("h1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"require_certification"}).AddRow(true))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `certification` WHERE user_id = \\? and state = \\?").
+					WithArgs("u1", xytmodel.CertificationApproved).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			},
+			wantErr: app.ErrBookingRejected,
+		},
+		{
+			name: "已通过实名认证",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT `require_certification` FROM `hospital` WHERE uid = \\? LIMIT \\?").
+					WithArgs("h1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"require_certification"}).AddRow(true))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `certification` WHERE user_id = \\? and state = \\?").
+					WithArgs("u1", xytmodel.CertificationApproved).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			rule := NewCertificationRule(db, NewCertifier(db, memObjectStorage{}, NewFakeVerifier()))
+			err = rule.Check(context.Background(), xytmodel.RegisterOrder{UserId: "u1", HosID: "h1"})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
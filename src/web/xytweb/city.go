@@ -2,20 +2,23 @@ package xytweb
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
-	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service/region"
 	"github.com/solunara/isb/src/types/app"
-	"gorm.io/gorm"
 )
 
+// 名称查找最多返回的结果数
+const maxRegionLookup = 20
+
 type XytCitesHandler struct {
-	db *gorm.DB
+	regions *region.Service
 }
 
-func NewXytCiteslHandler(db *gorm.DB) *XytCitesHandler {
+func NewXytCiteslHandler(regions *region.Service) *XytCitesHandler {
 	return &XytCitesHandler{
-		db: db,
+		regions: regions,
 	}
 }
 
@@ -23,85 +26,113 @@ func (xh *XytCitesHandler) RegisterRoutes(group *gin.RouterGroup) {
 	// ---------------- vbook api ---------------------
 	ug := group.Group("/city")
 	ug.GET("/cascader", xh.getCascader)
+	ug.GET("/path", xh.getPath)
+	ug.GET("/lookup", xh.lookup)
+
+	group.GET("/hos/region", xh.hosRegion)
 }
 
+// CascaderCityData Leaf 沿用前端的约定, 有下级时为 true
 type CascaderCityData struct {
 	Code string `json:"code"`
 	Name string `json:"name"`
 	Leaf bool   `json:"leaf"`
 }
 
+// getCascader code 为 86 时返回全部省份, 否则返回该编码的下级
 func (xh *XytCitesHandler) getCascader(ctx *gin.Context) {
 	code := ctx.Query("code")
 	if code == "" {
 		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
 		return
 	}
-	var err error
-	switch len(code) {
-	case 2:
-		if code == "86" {
-			var province []xytmodel.Province
-			err = xh.db.Table(xytmodel.TableProvince).Find(&province).Error
-			if err != nil {
-				ctx.JSON(http.StatusOK, app.ErrInternalServer)
-				return
-			}
-			ctx.JSON(http.StatusOK, app.ResponseOK(provinceToCascaderCityData(province)))
-			return
-		}
-		var city []xytmodel.City
-		err = xh.db.Table(xytmodel.TableCity).Where("province_code = ?", code).Find(&city).Error
-		if err != nil {
-			ctx.JSON(http.StatusOK, app.ErrInternalServer)
-			return
-		}
-		ctx.JSON(http.StatusOK, app.ResponseOK(cityToCascaderCityData(city)))
-	case 4:
-		var district []xytmodel.District
-		err = xh.db.Table(xytmodel.TableDistrict).Where("city_code = ?", code).Find(&district).Error
-		if err != nil {
-			ctx.JSON(http.StatusOK, app.ErrInternalServer)
-			return
-		}
-		ctx.JSON(http.StatusOK, app.ResponseOK(districtToCascaderCityData(district)))
-	default:
-		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+	ix, err := xh.regions.Index(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
 	}
+	children, ok := ix.Children(code)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+		return
+	}
+	result := make([]CascaderCityData, 0, len(children))
+	for _, r := range children {
+		result = append(result, CascaderCityData{
+			Code: r.Code,
+			Name: r.Name,
+			Leaf: ix.HasChildren(r.Code),
+		})
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(result))
 }
 
-func provinceToCascaderCityData(province []xytmodel.Province) []CascaderCityData {
-	var result = make([]CascaderCityData, len(province))
-	for k, v := range province {
-		result[k] = CascaderCityData{
-			Code: v.Code,
-			Name: v.Name,
-			Leaf: true,
-		}
+// getPath 任意级别的编码对应的省市区和完整名称
+func (xh *XytCitesHandler) getPath(ctx *gin.Context) {
+	code := ctx.Query("code")
+	if code == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
 	}
-	return result
+	ix, err := xh.regions.Index(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	path, ok := ix.Path(code)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(path))
 }
 
-func cityToCascaderCityData(city []xytmodel.City) []CascaderCityData {
-	var result = make([]CascaderCityData, len(city))
-	for k, v := range city {
-		result[k] = CascaderCityData{
-			Code: v.Code,
-			Name: v.Name,
-			Leaf: true,
-		}
+// lookup 按名称或省份简称查找, 如 北京, 京, BJ
+func (xh *XytCitesHandler) lookup(ctx *gin.Context) {
+	name := ctx.Query("name")
+	if name == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	ix, err := xh.regions.Index(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	paths := ix.Lookup(name)
+	if len(paths) > maxRegionLookup {
+		paths = paths[:maxRegionLookup]
 	}
-	return result
+	ctx.JSON(http.StatusOK, app.ResponseOK(paths))
 }
 
-func districtToCascaderCityData(district []xytmodel.District) []CascaderCityData {
-	var result = make([]CascaderCityData, len(district))
-	for k, v := range district {
-		result[k] = CascaderCityData{
-			Code: v.Code,
-			Name: v.Name,
-			Leaf: false,
+// hosRegion 城市下的全部区县, 按城市名字或编码查询, 直辖市按省份名字查询
+func (xh *XytCitesHandler) hosRegion(ctx *gin.Context) {
+	cityName := ctx.Query("cityName")
+	cityCode := ctx.Query("cityCode")
+	if cityName == "" && cityCode == "" {
+		ctx.JSON(http.StatusOK, app.ResponseErr(400, "请指定城市名字或编码"))
+		return
+	}
+	ix, err := xh.regions.Index(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	if cityName != "" {
+		if name, err := url.QueryUnescape(cityName); err == nil {
+			cityName = name
 		}
+		city, ok := ix.FindCity(cityName)
+		if !ok {
+			ctx.JSON(http.StatusOK, app.ResponseErr(404, "请指定一个存在的城市名字"))
+			return
+		}
+		cityCode = city.Code
+	}
+	if _, ok := ix.Get(cityCode); !ok {
+		ctx.JSON(http.StatusOK, app.ResponseErr(404, "请指定一个存在的城市编码"))
+		return
 	}
-	return result
+	ctx.JSON(http.StatusOK, app.ResponseOK(ix.Districts(cityCode)))
 }
@@ -0,0 +1,431 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const departmentCacheExpiration = 24 * time.Hour
+
+// DepartmentManager 维护每个医院的科室层级, 层级变化后删除该医院的科室缓存
+type DepartmentManager struct {
+	db    *gorm.DB
+	cache cache.DepartmentCache
+}
+
+func NewDepartmentManager(db *gorm.DB, cache cache.DepartmentCache) *DepartmentManager {
+	return &DepartmentManager{
+		db:    db,
+		cache: cache,
+	}
+}
+
+// List 医院的全部科室, 包括停用的
+func (m *DepartmentManager) List(ctx context.Context, hosId string) ([]xytmodel.Department, error) {
+	depts, err := m.cache.Get(ctx, hosId)
+	if err == nil {
+		return depts, nil
+	}
+	if !errors.Is(err, cache.ErrKeyNotExist) {
+		log.Println("get department cache:", err)
+	}
+
+	err = m.db.WithContext(ctx).Table(xytmodel.TableDepartment).
+		Where("hospital_id = ?", hosId).Order("sort_order, uid").Find(&depts).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = m.cache.Set(ctx, hosId, depts, departmentCacheExpiration); err != nil {
+		log.Println("set department cache:", err)
+	}
+	return depts, nil
+}
+
+// Tree 医院的科室树, withDisabled 为 false 时停用的科室和它的下级科室都不返回
+func (m *DepartmentManager) Tree(ctx context.Context, hosId string, withDisabled bool) ([]DepartmentResponse, error) {
+	depts, err := m.List(ctx, hosId)
+	if err != nil {
+		return nil, err
+	}
+	if !withDisabled {
+		enabled := make([]xytmodel.Department, 0, len(depts))
+		for _, dept := range depts {
+			if dept.Status {
+				enabled = append(enabled, dept)
+			}
+		}
+		depts = enabled
+	}
+	return BuildDepartmentTree(depts), nil
+}
+
+// Create 创建科室, 没有指定编码时自动生成, 层级由上级科室决定
+func (m *DepartmentManager) Create(ctx context.Context, dept xytmodel.Department) (xytmodel.Department, error) {
+	var hos xytmodel.Hospital
+	err := m.db.WithContext(ctx).Table(xytmodel.TableHospital).Select("uid").Where("uid = ?", dept.HospitalID).Take(&hos).Error
+	if err != nil {
+		return xytmodel.Department{}, err
+	}
+	dept.Level = 1
+	if dept.ParentID != "" {
+		var parent xytmodel.Department
+		err = m.db.WithContext(ctx).Table(xytmodel.TableDepartment).
+			Where("uid = ? and hospital_id = ?", dept.ParentID, dept.HospitalID).Take(&parent).Error
+		if err != nil {
+			return xytmodel.Department{}, err
+		}
+		dept.Level = parent.Level + 1
+	}
+	if dept.UID == "" {
+		dept.UID = uuid.NewString()
+	}
+	dept.Status = true
+
+	err = m.db.WithContext(ctx).Create(&dept).Error
+	if err != nil {
+		if dao.IsDuplicateKeyErr(err) {
+			return xytmodel.Department{}, app.ErrDepartmentExists
+		}
+		return xytmodel.Department{}, err
+	}
+	m.invalidate(ctx, dept.HospitalID)
+	return dept, nil
+}
+
+// Update 修改科室名称和简介
+func (m *DepartmentManager) Update(ctx context.Context, hosId, uid, name, description string) error {
+	if _, err := m.find(m.db.WithContext(ctx), hosId, uid); err != nil {
+		return err
+	}
+	err := m.db.WithContext(ctx).Model(&xytmodel.Department{UID: uid}).Updates(map[string]any{
+		"name":        name,
+		"description": description,
+	}).Error
+	if err != nil {
+		return err
+	}
+	m.invalidate(ctx, hosId)
+	return nil
+}
+
+// SetStatus 启用或停用科室, 停用的科室和它的下级科室不再对外展示
+func (m *DepartmentManager) SetStatus(ctx context.Context, hosId, uid string, status bool) error {
+	if _, err := m.find(m.db.WithContext(ctx), hosId, uid); err != nil {
+		return err
+	}
+	err := m.db.WithContext(ctx).Model(&xytmodel.Department{UID: uid}).Update("status", status).Error
+	if err != nil {
+		return err
+	}
+	m.invalidate(ctx, hosId)
+	return nil
+}
+
+// Move 把科室连同下级科室移动到 parentId 下, parentId 为空表示移动为顶级科室
+func (m *DepartmentManager) Move(ctx context.Context, hosId, uid, parentId string) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住医院的全部科室, 避免并发移动形成环
+		var depts []xytmodel.Department
+		err := tx.Table(xytmodel.TableDepartment).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("hospital_id = ?", hosId).Find(&depts).Error
+		if err != nil {
+			return err
+		}
+		byId := make(map[string]xytmodel.Department, len(depts))
+		for _, dept := range depts {
+			byId[dept.UID] = dept
+		}
+		dept, ok := byId[uid]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+
+		level := 1
+		if parentId != "" {
+			parent, ok := byId[parentId]
+			if !ok {
+				return gorm.ErrRecordNotFound
+			}
+			if isDepartmentAncestor(byId, uid, parentId) {
+				return app.ErrDepartmentCycle
+			}
+			level = parent.Level + 1
+		}
+
+		err = tx.Model(&xytmodel.Department{UID: uid}).Update("parent_id", parentId).Error
+		if err != nil {
+			return err
+		}
+		if delta := level - dept.Level; delta != 0 {
+			subtree := append(departmentDescendants(depts, uid), uid)
+			err = tx.Model(&xytmodel.Department{}).Where("uid in ?", subtree).
+				Update("level", gorm.Expr("level + ?", delta)).Error
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m.invalidate(ctx, hosId)
+	return nil
+}
+
+// Reorder 按 uids 的顺序重排 parentId 的下级科室, uids 必须正好是全部下级科室
+func (m *DepartmentManager) Reorder(ctx context.Context, hosId, parentId string, uids []string) error {
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children []string
+		err := tx.Table(xytmodel.TableDepartment).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("hospital_id = ? and parent_id = ?", hosId, parentId).Pluck("uid", &children).Error
+		if err != nil {
+			return err
+		}
+		if !sameDepartments(children, uids) {
+			return app.ErrDepartmentReorder
+		}
+		for i, uid := range uids {
+			err = tx.Model(&xytmodel.Department{UID: uid}).Update("sort_order", i).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.invalidate(ctx, hosId)
+	return nil
+}
+
+func (m *DepartmentManager) find(db *gorm.DB, hosId, uid string) (xytmodel.Department, error) {
+	var dept xytmodel.Department
+	err := db.Table(xytmodel.TableDepartment).Where("uid = ? and hospital_id = ?", uid, hosId).Take(&dept).Error
+	return dept, err
+}
+
+// 删除缓存失败时缓存最多在过期前不一致
+func (m *DepartmentManager) invalidate(ctx context.Context, hosId string) {
+	if err := m.cache.Delete(ctx, hosId); err != nil {
+		log.Println("delete department cache:", err)
+	}
+}
+
+// isDepartmentAncestor uid 是否是 deptId 自己或者它的上级科室
+func isDepartmentAncestor(byId map[string]xytmodel.Department, uid, deptId string) bool {
+	// 数据本身有环时也能结束
+	visited := make(map[string]bool)
+	for cur := deptId; cur != "" && !visited[cur]; cur = byId[cur].ParentID {
+		if cur == uid {
+			return true
+		}
+		visited[cur] = true
+	}
+	return false
+}
+
+// departmentDescendants uid 的全部下级科室, 不包括 uid 自己
+func departmentDescendants(depts []xytmodel.Department, uid string) []string {
+	children := make(map[string][]string)
+	for _, dept := range depts {
+		children[dept.ParentID] = append(children[dept.ParentID], dept.UID)
+	}
+	var result []string
+	visited := map[string]bool{uid: true}
+	queue := []string{uid}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, child := range children[cur] {
+			if visited[child] {
+				continue
+			}
+			visited[child] = true
+			result = append(result, child)
+			queue = append(queue, child)
+		}
+	}
+	return result
+}
+
+func sameDepartments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// XytDepartmentAdminHandler 医院工作人员维护科室层级
+type XytDepartmentAdminHandler struct {
+	depts *DepartmentManager
+}
+
+func NewXytDepartmentAdminHandler(depts *DepartmentManager) *XytDepartmentAdminHandler {
+	return &XytDepartmentAdminHandler{depts: depts}
+}
+
+// RegisterRoutes group 为管理后台的路由组
+func (xh *XytDepartmentAdminHandler) RegisterRoutes(group *gin.RouterGroup) {
+	dg := group.Group("/department")
+	dg.GET("/tree", xh.tree)
+	dg.POST("/create", xh.create)
+	dg.POST("/update", xh.update)
+	dg.POST("/status", xh.setStatus)
+	dg.POST("/move", xh.move)
+	dg.POST("/reorder", xh.reorder)
+}
+
+func (xh *XytDepartmentAdminHandler) tree(ctx *gin.Context) {
+	hosId := ctx.Query("hosId")
+	if hosId == "" {
+		ctx.JSON(http.StatusOK, app.ResponseErr(400, "请指定医院hosId"))
+		return
+	}
+	tree, err := xh.depts.Tree(ctx, hosId, true)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(tree))
+}
+
+type CreateDepartmentReq struct {
+	UID         string `json:"uid"`
+	HosId       string `json:"hosId"`
+	ParentId    string `json:"parentId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sortOrder"`
+}
+
+func (xh *XytDepartmentAdminHandler) create(ctx *gin.Context) {
+	var req CreateDepartmentReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" || req.Name == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	dept, err := xh.depts.Create(ctx, xytmodel.Department{
+		UID:         req.UID,
+		HospitalID:  req.HosId,
+		ParentID:    req.ParentId,
+		Name:        req.Name,
+		Description: req.Description,
+		SortOrder:   req.SortOrder,
+	})
+	if err != nil {
+		departmentErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(dept))
+}
+
+type UpdateDepartmentReq struct {
+	UID         string `json:"uid"`
+	HosId       string `json:"hosId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (xh *XytDepartmentAdminHandler) update(ctx *gin.Context) {
+	var req UpdateDepartmentReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" || req.UID == "" || req.Name == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.depts.Update(ctx, req.HosId, req.UID, req.Name, req.Description); err != nil {
+		departmentErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+type DepartmentStatusReq struct {
+	UID    string `json:"uid"`
+	HosId  string `json:"hosId"`
+	Status bool   `json:"status"`
+}
+
+func (xh *XytDepartmentAdminHandler) setStatus(ctx *gin.Context) {
+	var req DepartmentStatusReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" || req.UID == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.depts.SetStatus(ctx, req.HosId, req.UID, req.Status); err != nil {
+		departmentErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+type MoveDepartmentReq struct {
+	UID      string `json:"uid"`
+	HosId    string `json:"hosId"`
+	ParentId string `json:"parentId"`
+}
+
+func (xh *XytDepartmentAdminHandler) move(ctx *gin.Context) {
+	var req MoveDepartmentReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" || req.UID == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.depts.Move(ctx, req.HosId, req.UID, req.ParentId); err != nil {
+		departmentErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+type ReorderDepartmentReq struct {
+	HosId    string   `json:"hosId"`
+	ParentId string   `json:"parentId"`
+	UIDs     []string `json:"uids"`
+}
+
+func (xh *XytDepartmentAdminHandler) reorder(ctx *gin.Context) {
+	var req ReorderDepartmentReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.depts.Reorder(ctx, req.HosId, req.ParentId, req.UIDs); err != nil {
+		departmentErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func departmentErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrDepartmentCycle), errors.Is(err, app.ErrDepartmentReorder):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrDepartmentExists):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
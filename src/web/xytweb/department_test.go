@@ -0,0 +1,129 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	cachemock "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestDepartmentManager_Move(t *testing.T) {
+	// 内科(1) -> 心内科(2) -> 心内一病区(3), 外科(1)
+	deptRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"uid", "hospital_id", "parent_id", "level"}).
+			AddRow("nk", "h1", "", 1).
+			AddRow("xnk", "h1", "nk", 2).
+			AddRow("xnk1", "h1", "xnk", 3).
+			AddRow("wk", "h1", "", 1)
+	}
+
+	testCases := []struct {
+		name     string
+		mock     func(t *testing.T) *sql.DB
+		cache    func(ctrl *gomock.Controller) *cachemock.MockDepartmentCache
+		uid      string
+		parentId string
+
+		wantErr error
+	}{
+		{
+			name: "移动子树并调整层级",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `department` WHERE hospital_id = \\? FOR UPDATE").WillReturnRows(deptRows())
+				mock.ExpectExec("UPDATE `department` SET `parent_id`=\\?,`updated_at`=\\? WHERE `uid` = \\?").
+					WithArgs("", sqlmock.AnyArg(), "xnk").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `department` SET `level`=level \\+ \\?,`updated_at`=\\? WHERE uid in \\(\\?,\\?\\)").
+					WithArgs(-1, sqlmock.AnyArg(), "xnk1", "xnk").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+				return db
+			},
+			cache: func(ctrl *gomock.Controller) *cachemock.MockDepartmentCache {
+				c := cachemock.NewMockDepartmentCache(ctrl)
+				c.EXPECT().Delete(gomock.Any(), "h1").Return(nil)
+				return c
+			},
+			uid: "xnk",
+		},
+		{
+			name: "移动到自己的下级科室",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `department` WHERE hospital_id = \\? FOR UPDATE").WillReturnRows(deptRows())
+				mock.ExpectRollback()
+				return db
+			},
+			cache: func(ctrl *gomock.Controller) *cachemock.MockDepartmentCache {
+				return cachemock.NewMockDepartmentCache(ctrl)
+			},
+			uid:      "nk",
+			parentId: "xnk1",
+			wantErr:  app.ErrDepartmentCycle,
+		},
+		{
+			name: "上级科室不属于该医院",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `department` WHERE hospital_id = \\? FOR UPDATE").WillReturnRows(deptRows())
+				mock.ExpectRollback()
+				return db
+			},
+			cache: func(ctrl *gomock.Controller) *cachemock.MockDepartmentCache {
+				return cachemock.NewMockDepartmentCache(ctrl)
+			},
+			uid:      "xnk",
+			parentId: "other",
+			wantErr:  gorm.ErrRecordNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			err = NewDepartmentManager(db, tc.cache(ctrl)).Move(context.Background(), "h1", tc.uid, tc.parentId)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestBuildDepartmentTree(t *testing.T) {
+	depts := []xytmodel.Department{
+		{UID: "wk", Name: "外科", SortOrder: 2, Status: true},
+		{UID: "nk", Name: "内科", SortOrder: 1, Status: true},
+		{UID: "xnk", Name: "心内科", ParentID: "nk", Status: true},
+		// 上级科室被过滤掉的科室不出现在树中
+		{UID: "gk", Name: "骨科", ParentID: "disabled", Status: true},
+	}
+	tree := BuildDepartmentTree(depts)
+	require.Len(t, tree, 2)
+	assert.Equal(t, "nk", tree[0].UID)
+	assert.Equal(t, "wk", tree[1].UID)
+	require.Len(t, tree[0].Children, 1)
+	assert.Equal(t, "xnk", tree[0].Children[0].UID)
+}
@@ -0,0 +1,264 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+const (
+	maxReviewContent   = 500
+	detailReviewsCount = 5
+)
+
+// XytDoctorHandler 医生详情和就诊后的评价
+type XytDoctorHandler struct {
+	db      *gorm.DB
+	pricing service.PricingService
+}
+
+func NewXytDoctorHandler(db *gorm.DB, pricing service.PricingService) *XytDoctorHandler {
+	return &XytDoctorHandler{db: db, pricing: pricing}
+}
+
+func (xh *XytDoctorHandler) RegisterRoutes(group *gin.RouterGroup) {
+	dg := group.Group("/hos/doctor")
+	dg.GET("/detail", xh.detail)
+	dg.GET("/reviews", xh.listReviews)
+	dg.POST("/review", xh.addReview)
+}
+
+type DoctorDetail struct {
+	DocId       string  `json:"docId"`
+	DoctorName  string  `json:"doctorName"`
+	Rank        string  `json:"rank"`
+	Profile     string  `json:"profile"`
+	Specialty   string  `json:"specialty"`
+	HosId       string  `json:"hosId"`
+	HosName     string  `json:"hosName"`
+	DeptId      string  `json:"deptId"`
+	DeptName    string  `json:"deptName"`
+	Amount      int     `json:"amount"` // 近期排班中最低的挂号费, 没有排班时为 0
+	Rating      float64 `json:"rating"`
+	RatingCount int     `json:"ratingCount"`
+	// 今天起 MaxSchedulerDays 天内的排班
+	Schedules []DocScheduler          `json:"schedules"`
+	Reviews   []xytmodel.DoctorReview `json:"reviews"`
+}
+
+func (xh *XytDoctorHandler) detail(ctx *gin.Context) {
+	docId := ctx.Query("docId")
+	if docId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	var doctor xytmodel.Doctor
+	err := xh.db.Table(xytmodel.TableDoctor).Where("id = ?", docId).Take(&doctor).Error
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+
+	// 医院和科室只用于展示名称, 找不到时留空
+	var hos xytmodel.Hospital
+	err = xh.db.Table(xytmodel.TableHospital).Where("uid = ?", doctor.HosId).Take(&hos).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var dept xytmodel.Department
+	err = xh.db.Table(xytmodel.TableDepartment).Where("uid = ? and hospital_id = ?", doctor.DeptId, doctor.HosId).Take(&dept).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	today := time.Now()
+	var schedules []xytmodel.Schedule
+	err = xh.db.Table(xytmodel.TableSchedule).
+		Where("doc_id = ? and work_date >= ? and work_date < ?", docId,
+			today.Format(time.DateOnly), today.AddDate(0, 0, MaxSchedulerDays).Format(time.DateOnly)).
+		Order("work_date, time_slot").Find(&schedules).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var scheIds = make([]string, 0, len(schedules))
+	for _, sche := range schedules {
+		scheIds = append(scheIds, sche.ScheId)
+	}
+	taken, err := findTakenSeqs(ctx, xh.db, scheIds)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	prices, err := xh.pricing.SchedulePrices(ctx, schedules, []xytmodel.Doctor{doctor})
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	var amount = 0
+	for i, sche := range schedules {
+		if i == 0 || prices[sche.ScheId].Total < amount {
+			amount = prices[sche.ScheId].Total
+		}
+	}
+
+	var reviews []xytmodel.DoctorReview
+	err = xh.db.Table(xytmodel.TableDoctorReview).Where("doc_id = ?", docId).
+		Order("id desc").Limit(detailReviewsCount).Find(&reviews).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, app.ResponseOK(DoctorDetail{
+		DocId:       doctor.Id,
+		DoctorName:  doctor.Name,
+		Rank:        doctor.Rank,
+		Profile:     doctor.Profile,
+		Specialty:   doctor.Specialty,
+		HosId:       doctor.HosId,
+		HosName:     hos.FullName,
+		DeptId:      doctor.DeptId,
+		DeptName:    dept.Name,
+		Amount:      amount,
+		Rating:      doctor.Rating(),
+		RatingCount: doctor.RatingCount,
+		Schedules:   docSchedulerToView(schedules, []xytmodel.Doctor{doctor}, taken, prices).DocScheduler,
+		Reviews:     reviews,
+	}))
+}
+
+func (xh *XytDoctorHandler) listReviews(ctx *gin.Context) {
+	docId := ctx.Query("docId")
+	if docId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	pageNo, _ := strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("pageSize", "10"))
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > 30 {
+		pageSize = 30
+	}
+
+	dbQuery := xh.db.Table(xytmodel.TableDoctorReview).Where("doc_id = ?", docId)
+	var total int64
+	err := dbQuery.Count(&total).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	if total < 1 {
+		ctx.JSON(http.StatusOK, app.ResponsePageData(0, nil))
+		return
+	}
+	var reviews []xytmodel.DoctorReview
+	err = dbQuery.Order("id desc").Limit(pageSize).Offset((pageNo - 1) * pageSize).Find(&reviews).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, reviews))
+}
+
+type AddReviewReq struct {
+	OrderId string `json:"orderId"`
+	Rating  int8   `json:"rating"`
+	Content string `json:"content"`
+}
+
+func (xh *XytDoctorHandler) addReview(ctx *gin.Context) {
+	userId, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req AddReviewReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if req.OrderId == "" || req.Rating < 1 || req.Rating > 5 || utf8.RuneCountInString(req.Content) > maxReviewContent {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	review, err := AddDoctorReview(ctx, xh.db, userId.(string), req)
+	switch {
+	case err == nil:
+		ctx.JSON(http.StatusOK, app.ResponseOK(review))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrReviewNotAllowed):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, err.Error()))
+	case errors.Is(err, app.ErrReviewed):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
+
+// AddDoctorReview 用户评价自己已完成就诊的订单, 同时累加医生的评分
+func AddDoctorReview(ctx context.Context, db *gorm.DB, userId string, req AddReviewReq) (xytmodel.DoctorReview, error) {
+	order, err := FindUserOrder(ctx, db, userId, req.OrderId)
+	if err != nil {
+		return xytmodel.DoctorReview{}, err
+	}
+	if order.State != xytmodel.OrderStateCompleted {
+		return xytmodel.DoctorReview{}, app.ErrReviewNotAllowed
+	}
+
+	review := xytmodel.DoctorReview{
+		OrderId:     order.OrderId,
+		DocId:       order.DocId,
+		UserId:      order.UserId,
+		PatientId:   order.PatientId,
+		PatientName: maskName(order.PatientName),
+		Rating:      req.Rating,
+		Content:     strings.TrimSpace(req.Content),
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&review).Error
+		if err != nil {
+			if dao.IsDuplicateKeyErr(err) {
+				return app.ErrReviewed
+			}
+			return err
+		}
+		return tx.Model(&xytmodel.Doctor{Id: order.DocId}).Updates(map[string]any{
+			"rating_count": gorm.Expr("rating_count + 1"),
+			"rating_sum":   gorm.Expr("rating_sum + ?", review.Rating),
+		}).Error
+	})
+	return review, err
+}
+
+// maskName 只保留姓名的第一个字, 例如 张三 -> 张*
+func maskName(name string) string {
+	n := utf8.RuneCountInString(name)
+	if n <= 1 {
+		return name
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + strings.Repeat("*", n-1)
+}
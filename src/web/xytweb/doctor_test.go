@@ -0,0 +1,118 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestAddDoctorReview(t *testing.T) {
+	orderRows := func(state int8) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"order_id", "user_id", "patient_id", "doc_id", "patient_name", "state"}).
+			AddRow("o1", "u1", "p1", "d1", "张三丰", state)
+	}
+	req := AddReviewReq{OrderId: "o1", Rating: 4, Content: " 很耐心 "}
+
+	testCases := []struct {
+		name string
+		mock func(t *testing.T) *sql.DB
+
+		wantErr    error
+		wantReview xytmodel.DoctorReview
+	}{
+		{
+			name: "评价成功",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = \\? and user_id = \\?.*").
+					WithArgs("o1", "u1", 1).WillReturnRows(orderRows(xytmodel.OrderStateCompleted))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `doctor_review` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE `doctor` SET `rating_count`=rating_count \\+ 1,`rating_sum`=rating_sum \\+ \\?,`updated_at`=\\? WHERE `id` = \\?").
+					WithArgs(int8(4), sqlmock.AnyArg(), "d1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				return db
+			},
+			wantReview: xytmodel.DoctorReview{
+				Id:          1,
+				OrderId:     "o1",
+				DocId:       "d1",
+				UserId:      "u1",
+				PatientId:   "p1",
+				PatientName: "张**",
+				Rating:      4,
+				Content:     "很耐心",
+			},
+		},
+		{
+			name: "订单未完成",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` .*").WillReturnRows(orderRows(xytmodel.OrderStatePaid))
+				return db
+			},
+			wantErr: app.ErrReviewNotAllowed,
+		},
+		{
+			name: "不是自己的订单",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` .*").WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+				return db
+			},
+			wantErr: gorm.ErrRecordNotFound,
+		},
+		{
+			name: "重复评价",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` .*").WillReturnRows(orderRows(xytmodel.OrderStateCompleted))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `doctor_review` .*").WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectRollback()
+				return db
+			},
+			wantErr: app.ErrReviewed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(gormmysql.New(gormmysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			review, err := AddDoctorReview(context.Background(), db, "u1", req)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			review.CreatedAt = 0
+			assert.Equal(t, tc.wantReview, review)
+		})
+	}
+}
+
+func TestDoctor_Rating(t *testing.T) {
+	assert.Equal(t, 0.0, xytmodel.Doctor{}.Rating())
+	assert.Equal(t, 4.3, xytmodel.Doctor{RatingCount: 3, RatingSum: 13}.Rating())
+}
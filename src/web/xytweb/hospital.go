@@ -1,32 +1,45 @@
 package xytweb
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
-	"net/url"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/solunara/isb/src/config"
 	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
 	"github.com/solunara/isb/src/types/app"
-	"github.com/solunara/isb/src/utils"
 	"gorm.io/gorm"
 )
 
 type XytHospitalHandler struct {
-	db *gorm.DB
+	hospitals service.HospitalService
+	schedules service.ScheduleService
+	orders    service.OrderService
+	pricing   service.PricingService
+	booker    *OrderBooker
+	refunder  *OrderRefunder
+	depts     *DepartmentManager
 }
 
-const MaxPatientsPerDay = 10
 const MaxSchedulerDays = 7
 
-func NewXytHospitalHandler(db *gorm.DB) *XytHospitalHandler {
+func NewXytHospitalHandler(hospitals service.HospitalService, schedules service.ScheduleService, orders service.OrderService,
+	pricing service.PricingService, booker *OrderBooker, refunder *OrderRefunder, depts *DepartmentManager) *XytHospitalHandler {
 	return &XytHospitalHandler{
-		db: db,
+		hospitals: hospitals,
+		schedules: schedules,
+		orders:    orders,
+		pricing:   pricing,
+		booker:    booker,
+		refunder:  refunder,
+		depts:     depts,
 	}
 }
 
@@ -35,7 +48,6 @@ func (xh *XytHospitalHandler) RegisterRoutes(group *gin.RouterGroup) {
 	ug := group.Group("/hos")
 	ug.GET("/list", xh.hosList)
 	ug.GET("/grade", xh.hosGrade)
-	ug.GET("/region", xh.hosRegion)
 	ug.GET("/detail", xh.hosDetail)
 	ug.GET("/department", xh.hosDepartment)
 	ug.GET("/scheduler", xh.docSchedules)
@@ -44,56 +56,20 @@ func (xh *XytHospitalHandler) RegisterRoutes(group *gin.RouterGroup) {
 	ug.GET("/order", xh.getOrder)
 	ug.POST("/cancel/order", xh.cancelOrder)
 	ug.GET("/order/list", xh.listOrder)
+	ug.GET("/order/history", xh.orderHistory)
+	ug.GET("/order/refund/preview", xh.refundPreview)
 }
 
 func (xh *XytHospitalHandler) hosList(ctx *gin.Context) {
-	var err error
-	var hoslist []xytmodel.Hospital
-	queries := ctx.Request.URL.Query()
-	dbQuery := xh.db.Model(&xytmodel.Hospital{})
-	for k, v := range queries {
-		switch k {
-		case "hosId":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("uid = ?", v[0])
-			}
-		case "gradeCode":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("grade_code = ?", v[0])
-			}
-		case "cityCode":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("city_code = ?", v[0])
-			}
-		case "cityName":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("city_name = ?", v[0])
-			}
-		case "hosName":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("full_name like ?", "%"+v[0]+"%")
-			}
-		case "districtCode":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("district_code = ?", v[0])
-			}
-		case "pageNo", "pageSize", "timeStamp":
-			continue
-		}
+	filter := dao.HospitalFilter{
+		HosId:        ctx.Query("hosId"),
+		GradeCode:    ctx.Query("gradeCode"),
+		CityCode:     ctx.Query("cityCode"),
+		CityName:     ctx.Query("cityName"),
+		DistrictCode: ctx.Query("districtCode"),
+		HosName:      ctx.Query("hosName"),
 	}
 
-	v, ok := queries["hosName"]
-	if ok {
-		if len(v) > 0 && v[0] != "" {
-			err = dbQuery.Find(&hoslist).Error
-			if err != nil {
-				ctx.JSON(200, app.ErrInternalServer)
-				return
-			}
-			ctx.JSON(http.StatusOK, app.ResponseOK(hoslist))
-			return
-		}
-	}
 	pageNo, _ := strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
 	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("pageSize", "1"))
 	if pageNo < 1 {
@@ -106,24 +82,7 @@ func (xh *XytHospitalHandler) hosList(ctx *gin.Context) {
 		pageSize = 30
 	}
 	offset := (pageNo - 1) * pageSize
-	var total int64
-	err = dbQuery.Count(&total).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-
-	if offset > int(total) {
-		ctx.JSON(200, app.ResponsePageData(total, nil))
-		return
-	}
-
-	if total < 1 {
-		ctx.JSON(http.StatusOK, app.ResponsePageData(0, nil))
-		return
-	}
-
-	err = dbQuery.Limit(pageSize).Offset(offset).Find(&hoslist).Error
+	hoslist, total, err := xh.hospitals.List(ctx, filter, offset, pageSize)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
@@ -132,9 +91,7 @@ func (xh *XytHospitalHandler) hosList(ctx *gin.Context) {
 }
 
 func (xh *XytHospitalHandler) hosGrade(ctx *gin.Context) {
-	dbQuery := xh.db.Table(xytmodel.TableHospitalGrade)
-	var hosgrade []xytmodel.HospitalGrade
-	err := dbQuery.Find(&hosgrade).Error
+	hosgrade, err := xh.hospitals.Grades(ctx)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
@@ -142,68 +99,14 @@ func (xh *XytHospitalHandler) hosGrade(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, app.ResponseOK(hosgrade))
 }
 
-func (xh *XytHospitalHandler) hosRegion(ctx *gin.Context) {
-	var err error
-	var city_code string
-	cityName := ctx.Query("cityName")
-	if cityName == "" {
-		cityCode := ctx.Param("cityCode")
-		if cityCode == "" {
-			ctx.JSON(200, app.ResponseErr(400, "请指定城市名字或编码"))
-			return
-		}
-		city_code = cityCode
-	} else {
-		var city xytmodel.City
-		unescapeCityName, err := url.QueryUnescape(cityName)
-		if err == nil {
-			cityName = unescapeCityName
-		}
-		switch cityName {
-		case "北京市", "上海市", "天津市", "重庆市", "北京", "上海", "天津", "重庆":
-			err = xh.db.Table(xytmodel.TableCity).Where("province_name = ?", cityName).Take(&city).Error
-			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					ctx.JSON(200, app.ResponseErr(404, "请指定一个存在的城市名字"))
-					return
-				}
-				ctx.JSON(200, app.ErrInternalServer)
-				return
-			}
-			city_code = city.Code
-		default:
-			err = xh.db.Table(xytmodel.TableCity).Where("name = ?", cityName).Take(&city).Error
-			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					ctx.JSON(200, app.ResponseErr(404, "请指定一个存在的城市名字"))
-					return
-				}
-				ctx.JSON(200, app.ErrInternalServer)
-				return
-			}
-			city_code = city.Code
-		}
-	}
-
-	var district []xytmodel.District
-	err = xh.db.Table(xytmodel.TableDistrict).Where("city_code = ?", city_code).Find(&district).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-	ctx.JSON(http.StatusOK, app.ResponseOK(district))
-}
-
 func (xh *XytHospitalHandler) hosDetail(ctx *gin.Context) {
-	var err error
 	uid := ctx.Query("hosId")
 	if uid == "" {
 		ctx.JSON(200, app.ResponseErr(400, "请指定医院hosId"))
 		return
 	}
 
-	var hos xytmodel.Hospital
-	err = xh.db.Table(xytmodel.TableHospital).Where("uid = ?", uid).Take(&hos).Error
+	hos, err := xh.hospitals.Detail(ctx, uid)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			ctx.JSON(200, app.ResponseErr(404, "找不到该医院"))
@@ -216,34 +119,34 @@ func (xh *XytHospitalHandler) hosDetail(ctx *gin.Context) {
 }
 
 func (xh *XytHospitalHandler) hosDepartment(ctx *gin.Context) {
-	var err error
-	// uid := ctx.Query("uid")
-	// if uid == "" {
-	// 	ctx.JSON(200, app.ResponseErr(400, "请指定医院uid"))
-	// 	return
-	// }
-
-	var department []xytmodel.Department
-	err = xh.db.Table(xytmodel.TableDepartment).Order("sort_order").Find(&department).Error
+	hosId := ctx.Query("hosId")
+	if hosId == "" {
+		ctx.JSON(200, app.ResponseErr(400, "请指定医院hosId"))
+		return
+	}
+
+	tree, err := xh.depts.Tree(ctx, hosId, false)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
 	}
-
-	ctx.JSON(http.StatusOK, app.ResponseOK(BuildDepartmentTree(department)))
+	ctx.JSON(http.StatusOK, app.ResponseOK(tree))
 }
 
 type DocScheduler struct {
-	DocId       string `json:"docId"`
-	ScheId      string `json:"scheId"`
-	TimeSlot    string `json:"timeSlot"`
-	DoctorName  string `json:"doctorName"`
-	Rank        string `json:"rank"`
-	Profile     string `json:"profile"`
-	WorkDay     string `json:"workDay"`
-	Amount      int    `json:"amount"`
-	MaxPatients int    `json:"maxPatients"`
-	Registered  int    `json:"registered"`
+	DocId       string    `json:"docId"`
+	ScheId      string    `json:"scheId"`
+	TimeSlot    string    `json:"timeSlot"`
+	DoctorName  string    `json:"doctorName"`
+	Rank        string    `json:"rank"`
+	Profile     string    `json:"profile"`
+	WorkDay     string    `json:"workDay"`
+	Amount      int       `json:"amount"` // 挂号费, 医保报销在预约时按就诊人计算
+	RegTypeName string    `json:"regTypeName"`
+	MaxPatients int       `json:"maxPatients"`
+	Registered  int       `json:"registered"`
+	Status      int8      `json:"status"` // 0:正常 1:停诊
+	SubSlots    []SubSlot `json:"subSlots"`
 }
 
 type DeptSchedule struct {
@@ -270,35 +173,13 @@ func (xh *XytHospitalHandler) docSchedules(ctx *gin.Context) {
 		return
 	}
 
-	var hos xytmodel.Hospital
-	err := xh.db.Model(&xytmodel.Hospital{}).Where("uid = ?", hosId).Take(&hos).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-
-	var dept xytmodel.Department
-	err = xh.db.Model(&xytmodel.Department{}).Where("uid = ?", deptId).Take(&dept).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-
-	var deptOne xytmodel.Department
-	err = xh.db.Model(&xytmodel.Department{}).Where("uid = ?", dept.ParentID).Take(&deptOne).Error
+	info, err := xh.schedules.DeptInfo(ctx, hosId, deptId)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
 	}
 
-	var docs []xytmodel.Doctor
-	err = xh.db.Model(&xytmodel.Doctor{}).Where("hos_id = ? and dept_id = ?", hosId, deptId).Find(&docs).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-
-	if len(docs) <= 0 {
+	if info.Doctors <= 0 {
 		ctx.JSON(200, app.ResponseOK(ScheduleInfo{}))
 		return
 	}
@@ -329,9 +210,9 @@ func (xh *XytHospitalHandler) docSchedules(ctx *gin.Context) {
 	}
 
 	var results = ScheduleInfo{
-		HosName:    hos.FullName,
-		FatherName: deptOne.Name,
-		Name:       dept.Name,
+		HosName:    info.Hospital.FullName,
+		FatherName: info.Parent.Name,
+		Name:       info.Department.Name,
 		Total:      MaxSchedulerDays,
 	}
 
@@ -339,7 +220,7 @@ func (xh *XytHospitalHandler) docSchedules(ctx *gin.Context) {
 	for i := offset; i < endIndex; i++ {
 		date := today.AddDate(0, 0, i)
 		var result DeptSchedule
-		result, err = xh.getOrCreateDocScheduler(hosId, deptId, date, docs)
+		result, err = xh.findDocScheduler(ctx, hosId, deptId, date)
 		if err != nil {
 			fmt.Println("err: ", err)
 			ctx.JSON(200, app.ErrInternalServer)
@@ -350,50 +231,24 @@ func (xh *XytHospitalHandler) docSchedules(ctx *gin.Context) {
 	ctx.JSON(200, app.ResponseOK(results))
 }
 
-func (xh *XytHospitalHandler) getOrCreateDocScheduler(hosId, deptId string, t time.Time, docs []xytmodel.Doctor) (DeptSchedule, error) {
+// findDocScheduler 查询科室某天的排班, 排班由 RosterGenerator 按出诊模板提前生成
+func (xh *XytHospitalHandler) findDocScheduler(ctx context.Context, hosId, deptId string, t time.Time) (DeptSchedule, error) {
 	year, month, day := t.Date()
 	date := fmt.Sprintf("%04d-%02d-%02d", year, month, day)
-	var scheduler []xytmodel.Schedule
-	err := xh.db.Model(&xytmodel.Schedule{}).Where("hos_id = ? and dept_id = ? and work_date = ?", hosId, deptId, date).Find(&scheduler).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	sche, err := xh.schedules.Day(ctx, hosId, deptId, date)
+	if err != nil {
 		return DeptSchedule{}, err
 	}
-	var amount = 0
-	if len(scheduler) <= 0 {
-		var result []xytmodel.Schedule
-		for i := 0; i < len(docs); i++ {
-			amount = 0
-			switch docs[i].Rank {
-			case "主任医师":
-				amount = 30
-			case "副主任医师":
-				amount = 20
-			case "特需门诊":
-				amount = 100
-			default:
-				amount = 10
-			}
-			var sche = xytmodel.Schedule{
-				ScheId:      utils.GenerateUinqueID(),
-				DocId:       docs[i].Id,
-				HosID:       hosId,
-				DeptID:      deptId,
-				WorkDate:    date,
-				WorkWeek:    int(t.Weekday()),
-				TimeSlot:    randomTimeSlot(),
-				Amount:      amount,
-				MaxPatients: MaxPatientsPerDay,
-				Registered:  0,
-			}
-			err = xh.db.Model(&xytmodel.Schedule{}).Create(&sche).Error
-			if err != nil {
-				return DeptSchedule{}, err
-			}
-			result = append(result, sche)
-		}
-		return docSchedulerToView(result, docs), nil
+
+	prices, err := xh.pricing.SchedulePrices(ctx, sche.Schedules, sche.Doctors)
+	if err != nil {
+		return DeptSchedule{}, err
 	}
-	return docSchedulerToView(scheduler, docs), nil
+
+	var result = docSchedulerToView(sche.Schedules, sche.Doctors, sche.Taken, prices)
+	result.Date = date
+	result.Weekday = int(t.Weekday())
+	return result, nil
 }
 
 type AddPatientReq struct {
@@ -406,25 +261,59 @@ type AddPatientReq struct {
 }
 
 type AddOrderReq struct {
-	PatientId string `json:"patientId"`
-	ScheId    string `json:"scheId"`
+	// 当前登录用户, 只能为自己的就诊人预约
+	UserId         string `json:"-"`
+	PatientId      string `json:"patientId"`
+	ScheId         string `json:"scheId"`
+	IdempotencyKey string `json:"idempotencyKey"`
 }
 
+// 客户端也可以通过请求头传递幂等键
+const HeaderIdempotencyKey = "Idempotency-Key"
+
 func (xh *XytHospitalHandler) addOrder(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
 	var req AddOrderReq
 	if err := ctx.Bind(&req); err != nil {
 		ctx.JSON(http.StatusOK, app.ErrBadRequest)
 		return
 	}
+	req.UserId = userid.(string)
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = ctx.GetHeader(HeaderIdempotencyKey)
+	}
+	if len(req.IdempotencyKey) > 64 {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
 
-	orderId, err := CreateOrder(xh.db, req)
+	orderId, err := xh.booker.Book(ctx, service.OrderReq{
+		UserId:         req.UserId,
+		PatientId:      req.PatientId,
+		ScheId:         req.ScheId,
+		IdempotencyKey: req.IdempotencyKey,
+	})
 	if err != nil {
 		fmt.Println(err)
-		if !errors.Is(err, app.ErrUserNotFound) {
+		switch {
+		case errors.Is(err, app.ErrScheduleFull):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, app.ErrScheduleFull.Error()))
+		case errors.Is(err, app.ErrScheduleSuspended):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, app.ErrScheduleSuspended.Error()))
+		case errors.Is(err, app.ErrBookingRejected), errors.Is(err, app.ErrPatientBanned):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, err.Error()))
+		case errors.Is(err, app.ErrUserNotFound):
+			ctx.JSON(http.StatusOK, app.ResponseErr(404, app.ErrUserNotFound.Error()))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+		default:
 			ctx.JSON(http.StatusOK, app.ErrInternalServer)
-			return
 		}
-		ctx.JSON(http.StatusOK, app.ResponseErr(404, app.ErrUserNotFound.Error()))
 		return
 	}
 
@@ -432,20 +321,30 @@ func (xh *XytHospitalHandler) addOrder(ctx *gin.Context) {
 }
 
 func (xh *XytHospitalHandler) getOrder(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
 	orderId := ctx.Query("orderId")
 	if orderId == "" {
 		ctx.JSON(200, app.ErrBadRequestQuery)
 		return
 	}
 
-	var order xytmodel.RegisterOrder
-	err := xh.db.Table(xytmodel.TableOrder).Where("order_id = ?", orderId).Take(&order).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(200, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(200, app.ErrInternalServer)
+	order, err := xh.orders.Find(ctx, userid.(string), orderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 热门排班的订单可能还在落库队列里
+		err = xh.booker.Status(ctx, userid.(string), orderId)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, app.ErrOrderQueued), errors.Is(err, app.ErrOrderFailed):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+		return
+	default:
+		abortFindErr(ctx, err)
 		return
 	}
 
@@ -458,28 +357,8 @@ func (xh *XytHospitalHandler) listOrder(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
 		return
 	}
-	queries := ctx.Request.URL.Query()
-	dbQuery := xh.db.Model(&xytmodel.RegisterOrder{})
-	for k, v := range queries {
-		switch k {
-		case "patient_id":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("patient_id = ?", v[0])
-			}
-		case "state":
-			if len(v) > 0 && v[0] != "" {
-				st, err := strconv.Atoi(v[0])
-				if err == nil {
-					if st >= -1 && st <= 2 {
-						dbQuery.Where("state = ?", v[0])
-					}
-				}
-			}
-		case "pageNo", "pageSize", "timeStamp":
-			continue
-		}
-	}
-	dbQuery.Where("user_id = ?", userid.(string))
+	filter := orderFilter(ctx, userid.(string))
+	filter.PatientId = ctx.Query("patient_id")
 
 	pageNo, _ := strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
 	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("pageSize", "1"))
@@ -493,8 +372,7 @@ func (xh *XytHospitalHandler) listOrder(ctx *gin.Context) {
 		pageSize = 30
 	}
 	offset := (pageNo - 1) * pageSize
-	var total int64
-	err := dbQuery.Count(&total).Error
+	orderList, total, err := xh.orders.List(ctx, filter, offset, pageSize)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
@@ -505,19 +383,18 @@ func (xh *XytHospitalHandler) listOrder(ctx *gin.Context) {
 		return
 	}
 
-	if total < 1 {
-		ctx.JSON(http.StatusOK, app.ResponsePageData(0, nil))
-		return
-	}
+	ctx.JSON(http.StatusOK, app.ResponsePageData(total, orderList))
+}
 
-	var orderList []xytmodel.RegisterOrder
-	err = dbQuery.Find(&orderList).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
+// orderFilter 订单列表按 state 查询参数筛选, 状态不合法时不筛选
+func orderFilter(ctx *gin.Context, userId string) dao.OrderFilter {
+	filter := dao.OrderFilter{UserId: userId}
+	st, err := strconv.Atoi(ctx.Query("state"))
+	if err == nil && st >= int(xytmodel.OrderStateCancelled) && st <= int(xytmodel.OrderStateNoShow) {
+		state := int8(st)
+		filter.State = &state
 	}
-
-	ctx.JSON(http.StatusOK, app.ResponsePageData(total, orderList))
+	return filter
 }
 
 type cancelOrderReq struct {
@@ -525,53 +402,113 @@ type cancelOrderReq struct {
 }
 
 func (xh *XytHospitalHandler) cancelOrder(ctx *gin.Context) {
-	var req cancelOrderReq
-	if err := ctx.Bind(&req); err != nil {
-		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
 		return
 	}
 
-	var order xytmodel.RegisterOrder
-	err := xh.db.Table(xytmodel.TableOrder).Where("order_id = ?", req.OrderId).Take(&order).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(200, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(200, app.ErrInternalServer)
+	var req cancelOrderReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
 		return
 	}
 
-	var sche xytmodel.Schedule
-	err = xh.db.Table(xytmodel.TableSchedule).Where("sche_id = ?", order.ScheId).Take(&sche).Error
+	order, err := xh.orders.Find(ctx, userid.(string), req.OrderId)
 	if err != nil {
-		ctx.JSON(200, app.ErrNotFound)
+		abortFindErr(ctx, err)
 		return
 	}
 
 	switch order.State {
-	case 0:
-		err = xh.db.Table(xytmodel.TableOrder).Where("order_id = ?", req.OrderId).Update("state", -1).Error
-		if err != nil {
+	case xytmodel.OrderStatePending:
+		err = xh.orders.Cancel(ctx, order, userid.(string), "用户取消")
+		switch {
+		case err == nil:
+			xh.booker.Release(ctx, order.ScheId)
+			ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+		case errors.Is(err, app.ErrOrderStateChanged):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, app.ErrOrderStateChanged.Error()))
+		default:
 			ctx.JSON(200, app.ErrInternalServer)
-			return
 		}
-		if sche.Registered > 0 {
-			sche.Registered = sche.Registered - 1
-		}
-		err = xh.db.Model(&sche).Update("registered", sche.Registered).Error
-		if err != nil {
+	case xytmodel.OrderStatePaid:
+		preview, err := xh.refunder.Refund(ctx, order, userid.(string))
+		switch {
+		case err == nil:
+			ctx.JSON(http.StatusOK, app.ResponseOK(preview))
+		case errors.Is(err, app.ErrRefundProcessing):
+			// 渠道已经退款, 订单状态由对账任务更新
+			ctx.JSON(http.StatusOK, app.ResponseType{Code: 200, Msg: app.ErrRefundProcessing.Error(), Data: preview})
+		case errors.Is(err, app.ErrNotRefundable):
+			ctx.JSON(http.StatusOK, app.ResponseErr(403, app.ErrNotRefundable.Error()))
+		case errors.Is(err, app.ErrOrderStateChanged):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, app.ErrOrderStateChanged.Error()))
+		default:
 			ctx.JSON(200, app.ErrInternalServer)
-			return
 		}
-		ctx.JSON(http.StatusOK, app.ResponseOK(nil))
-	case 1, 2:
+	case xytmodel.OrderStateCompleted, xytmodel.OrderStateRefunding, xytmodel.OrderStateCheckedIn,
+		xytmodel.OrderStateCalling, xytmodel.OrderStateNoShow:
 		ctx.JSON(http.StatusOK, app.ResponseErr(403, "无法取消该订单"))
 	default:
 		ctx.JSON(http.StatusOK, app.ResponseOK(nil))
 	}
 }
 
+func (xh *XytHospitalHandler) orderHistory(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
+	orderId := ctx.Query("orderId")
+	if orderId == "" {
+		ctx.JSON(200, app.ErrBadRequestQuery)
+		return
+	}
+
+	_, err := xh.orders.Find(ctx, userid.(string), orderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+
+	history, err := xh.orders.History(ctx, orderId)
+	if err != nil {
+		ctx.JSON(200, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(history))
+}
+
+func (xh *XytHospitalHandler) refundPreview(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
+	orderId := ctx.Query("orderId")
+	if orderId == "" {
+		ctx.JSON(200, app.ErrBadRequestQuery)
+		return
+	}
+
+	order, err := xh.orders.Find(ctx, userid.(string), orderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+
+	preview, err := xh.refunder.Preview(ctx, order)
+	if err != nil {
+		ctx.JSON(200, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(preview))
+}
+
 type DocRegister struct {
 	DocId      string `json:"docId"`
 	DoctorName string `json:"doctorName"`
@@ -581,35 +518,14 @@ type DocRegister struct {
 	HosName    string `json:"hosName"`
 	DeptName   string `json:"deptName"`
 	Amount     int    `json:"amount"`
+	// 不含医保报销的挂号费明细
+	Price xytmodel.OrderPrice `json:"price"`
 }
 
 func (xh *XytHospitalHandler) getDoctor(ctx *gin.Context) {
 	scheId := ctx.Query("scheId")
 
-	var schedule xytmodel.Schedule
-	err := xh.db.Table(xytmodel.TableSchedule).Where("sche_id = ?", scheId).Take(&schedule).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(http.StatusOK, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(http.StatusOK, app.ErrInternalServer)
-		return
-	}
-
-	var doctor xytmodel.Doctor
-	err = xh.db.Table(xytmodel.TableDoctor).Where("id = ?", schedule.DocId).Take(&doctor).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(http.StatusOK, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(http.StatusOK, app.ErrInternalServer)
-		return
-	}
-
-	var hos xytmodel.Hospital
-	err = xh.db.Table(xytmodel.TableHospital).Where("uid = ?", schedule.HosID).Take(&hos).Error
+	detail, err := xh.schedules.Detail(ctx, scheId)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			ctx.JSON(http.StatusOK, app.ErrNotFound)
@@ -618,63 +534,54 @@ func (xh *XytHospitalHandler) getDoctor(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, app.ErrInternalServer)
 		return
 	}
-
-	var dept xytmodel.Department
-	err = xh.db.Table(xytmodel.TableDepartment).Where("uid = ? and hospital_id = ?", schedule.DeptID, schedule.HosID).Take(&dept).Error
+	price, err := xh.pricing.Quote(ctx, detail, nil)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(http.StatusOK, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		abortFindErr(ctx, err)
 		return
 	}
 
-	var amount = 0
-	switch doctor.Rank {
-	case "主任医师":
-		amount = 30
-	case "副主任医师":
-		amount = 20
-	case "特需门诊":
-		amount = 100
-	default:
-		amount = 10
-	}
-
 	var result = DocRegister{
-		DocId:      schedule.DocId,
-		DoctorName: doctor.Name,
-		Rank:       doctor.Rank,
-		Profile:    doctor.Profile,
-		WorkDay:    schedule.WorkDate,
-		HosName:    hos.FullName,
-		DeptName:   dept.Name,
-		Amount:     amount,
+		DocId:      detail.Schedule.DocId,
+		DoctorName: detail.Doctor.Name,
+		Rank:       detail.Doctor.Rank,
+		Profile:    detail.Doctor.Profile,
+		WorkDay:    detail.Schedule.WorkDate,
+		HosName:    detail.Hospital.FullName,
+		DeptName:   detail.Department.Name,
+		Amount:     price.Total,
+		Price:      price,
 	}
 	ctx.JSON(http.StatusOK, app.ResponseOK(result))
 }
 
-func docSchedulerToView(sche []xytmodel.Schedule, docs []xytmodel.Doctor) DeptSchedule {
-	var result = DeptSchedule{
-		Date:    sche[0].WorkDate,
-		Weekday: sche[0].WorkWeek,
+func docSchedulerToView(sche []xytmodel.Schedule, docs []xytmodel.Doctor, taken map[string][]int, prices map[string]xytmodel.OrderPrice) DeptSchedule {
+	var docMap = make(map[string]xytmodel.Doctor, len(docs))
+	for _, doc := range docs {
+		docMap[doc.Id] = doc
 	}
+	var result DeptSchedule
 	var remain = 0
 	for i := 0; i < len(sche); i++ {
+		doc := docMap[sche[i].DocId]
 		result.DocScheduler = append(result.DocScheduler, DocScheduler{
 			DocId:       sche[i].DocId,
 			ScheId:      sche[i].ScheId,
 			TimeSlot:    sche[i].TimeSlot,
-			DoctorName:  docs[i].Name,
-			Rank:        docs[i].Rank,
-			Profile:     docs[i].Profile,
+			DoctorName:  doc.Name,
+			Rank:        doc.Rank,
+			Profile:     doc.Profile,
 			WorkDay:     sche[i].WorkDate,
-			Amount:      sche[i].Amount,
+			Amount:      prices[sche[i].ScheId].Total,
+			RegTypeName: prices[sche[i].ScheId].RegTypeName,
 			MaxPatients: sche[i].MaxPatients,
 			Registered:  sche[i].Registered,
+			Status:      sche[i].Status,
+			SubSlots:    ScheduleSubSlots(sche[i], taken[sche[i].ScheId]),
 		})
-		remain += sche[i].MaxPatients - sche[i].Registered
+		// 停诊的排班不再有余号
+		if sche[i].Status == xytmodel.ScheduleStatusNormal {
+			remain += sche[i].MaxPatients - sche[i].Registered
+		}
 	}
 	result.Remain = remain
 	return result
@@ -684,10 +591,19 @@ type DepartmentResponse struct {
 	UID         string               `json:"uid"`
 	Name        string               `json:"name"`
 	Description string               `json:"description"`
+	Level       int                  `json:"level"`
+	Status      bool                 `json:"status"`
+	SortOrder   int                  `json:"sortOrder"`
 	Children    []DepartmentResponse `json:"children,omitempty"`
 }
 
+// BuildDepartmentTree 同一层的科室按 SortOrder 排序, 上级科室不在 depts 中的科室不会出现在树中
 func BuildDepartmentTree(depts []xytmodel.Department) []DepartmentResponse {
+	depts = append([]xytmodel.Department(nil), depts...)
+	sort.SliceStable(depts, func(i, j int) bool {
+		return depts[i].SortOrder < depts[j].SortOrder
+	})
+
 	// 先构建 map：parentID -> []children
 	childrenMap := make(map[string][]DepartmentResponse)
 	var roots []DepartmentResponse
@@ -697,6 +613,9 @@ func BuildDepartmentTree(depts []xytmodel.Department) []DepartmentResponse {
 			UID:         dept.UID,
 			Name:        dept.Name,
 			Description: dept.Description,
+			Level:       dept.Level,
+			Status:      dept.Status,
+			SortOrder:   dept.SortOrder,
 		}
 		childrenMap[dept.ParentID] = append(childrenMap[dept.ParentID], node)
 	}
@@ -717,12 +636,3 @@ func fillChildren(node *DepartmentResponse, childrenMap map[string][]DepartmentR
 	}
 	node.Children = children
 }
-
-func randomTimeSlot() string {
-	surnames := []string{
-		"上午",
-		"下午",
-	}
-	rand.NewSource(time.Now().UnixNano())
-	return surnames[rand.Intn(len(surnames))]
-}
@@ -0,0 +1,337 @@
+package xytweb
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultImportBatchSize = 200
+	// 单个文件最多导入的行数
+	MaxImportRows = 20000
+	// 上传文件的大小限制
+	maxImportFileSize = 10 << 20
+)
+
+// ImportKind 导入的数据类型
+type ImportKind string
+
+const (
+	ImportHospital   ImportKind = "hospital"
+	ImportDepartment ImportKind = "department"
+	ImportDoctor     ImportKind = "doctor"
+)
+
+// ImportFormat 导入文件的格式
+type ImportFormat string
+
+const (
+	FormatCSV  ImportFormat = "csv"
+	FormatJSON ImportFormat = "json"
+)
+
+// ImportFormatByName 按文件扩展名判断格式
+func ImportFormatByName(name string) (ImportFormat, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, true
+	case ".json":
+		return FormatJSON, true
+	}
+	return "", false
+}
+
+// ImportRowError 一行数据导入失败的原因, Row 从 1 开始, 不含 csv 表头
+type ImportRowError struct {
+	Row int    `json:"row"`
+	Key string `json:"key"`
+	Msg string `json:"msg"`
+}
+
+// ImportReport 导入结果, 失败的行不影响其他行
+type ImportReport struct {
+	Kind     ImportKind       `json:"kind"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+func (r *ImportReport) fail(row int, key, msg string) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportRowError{Row: row, Key: key, Msg: msg})
+}
+
+// importRecord 文件中的一行, 字段名为数据库列名
+type importRecord struct {
+	row    int
+	fields map[string]string
+	// 解析失败的原因
+	err string
+}
+
+func (rec importRecord) get(name string) string {
+	return strings.TrimSpace(rec.fields[name])
+}
+
+// readImportRecords csv 第一行为表头; json 为对象数组, 字段值可以是字符串, 数字或布尔值
+func readImportRecords(format ImportFormat, r io.Reader) ([]importRecord, error) {
+	switch format {
+	case FormatCSV:
+		return readCSVRecords(r)
+	case FormatJSON:
+		return readJSONRecords(r)
+	}
+	return nil, fmt.Errorf("不支持的文件格式: %s", format)
+}
+
+func readCSVRecords(r io.Reader) ([]importRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取表头: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	// excel 导出的 csv 带有 BOM
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	var records []importRecord
+	for row := 1; ; row++ {
+		values, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row > MaxImportRows {
+			return nil, fmt.Errorf("超过 %d 行", MaxImportRows)
+		}
+		rec := importRecord{row: row, fields: make(map[string]string, len(header))}
+		if len(values) != len(header) {
+			rec.err = fmt.Sprintf("有 %d 列, 表头有 %d 列", len(values), len(header))
+		}
+		for i, v := range values {
+			if i < len(header) {
+				rec.fields[header[i]] = v
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+func readJSONRecords(r io.Reader) ([]importRecord, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("文件不是 json 数组: %w", err)
+	}
+	if len(items) > MaxImportRows {
+		return nil, fmt.Errorf("超过 %d 行", MaxImportRows)
+	}
+	records := make([]importRecord, 0, len(items))
+	for i, item := range items {
+		rec := importRecord{row: i + 1, fields: map[string]string{}}
+		rec.err = decodeJSONRecord(item, rec.fields)
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func decodeJSONRecord(item json.RawMessage, fields map[string]string) string {
+	dec := json.NewDecoder(strings.NewReader(string(item)))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return "不是 json 对象"
+	}
+	for name, v := range obj {
+		switch v := v.(type) {
+		case nil:
+			fields[name] = ""
+		case string:
+			fields[name] = v
+		case json.Number:
+			fields[name] = v.String()
+		case bool:
+			fields[name] = strconv.FormatBool(v)
+		default:
+			return fmt.Sprintf("字段 %s 类型错误", name)
+		}
+	}
+	return ""
+}
+
+// parseImportBool 支持 true/false, 1/0 和 是/否, 空值返回 def
+func parseImportBool(v string, def bool) (bool, error) {
+	switch v {
+	case "":
+		return def, nil
+	case "是":
+		return true, nil
+	case "否":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// importItem 校验通过等待写入的一行
+type importItem[T any] struct {
+	row   int
+	key   string
+	value T
+}
+
+// upsertImportItems 按批写入, 主键已存在时只更新 columns; 一批失败时逐行重试, 找出失败的行
+func upsertImportItems[T any](ctx context.Context, db *gorm.DB, batchSize int, items []importItem[T],
+	pk string, columns []string, report *ImportReport) []importItem[T] {
+	conflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: pk}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}
+	done := make([]importItem[T], 0, len(items))
+	for start := 0; start < len(items); start += batchSize {
+		batch := items[start:min(start+batchSize, len(items))]
+		values := make([]T, 0, len(batch))
+		for _, item := range batch {
+			values = append(values, item.value)
+		}
+		err := db.WithContext(ctx).Clauses(conflict).Create(&values).Error
+		if err == nil {
+			done = append(done, batch...)
+			continue
+		}
+		log.Printf("import %s batch from row %d: %v", report.Kind, batch[0].row, err)
+		for _, item := range batch {
+			value := []T{item.value}
+			if err := db.WithContext(ctx).Clauses(conflict).Create(&value).Error; err != nil {
+				report.fail(item.row, item.key, err.Error())
+				continue
+			}
+			done = append(done, item)
+		}
+	}
+	report.Imported += len(done)
+	return done
+}
+
+// Importer 从 csv 或 json 文件批量导入医院, 科室和医生, 按主键幂等写入, 重复导入同一个文件结果不变
+type Importer struct {
+	db        *gorm.DB
+	deptCache cache.DepartmentCache
+	batchSize int
+}
+
+func NewImporter(db *gorm.DB, deptCache cache.DepartmentCache, batchSize int) *Importer {
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	return &Importer{
+		db:        db,
+		deptCache: deptCache,
+		batchSize: batchSize,
+	}
+}
+
+// Import 只有文件无法解析或者查询校验数据失败时返回 error, 单行的错误记录在报告中
+func (im *Importer) Import(ctx context.Context, kind ImportKind, format ImportFormat, r io.Reader) (ImportReport, error) {
+	report := ImportReport{Kind: kind, Errors: []ImportRowError{}}
+	records, err := readImportRecords(format, r)
+	if err != nil {
+		return report, fmt.Errorf("%w: %v", app.ErrImportFile, err)
+	}
+	report.Total = len(records)
+
+	valid := make([]importRecord, 0, len(records))
+	for _, rec := range records {
+		if rec.err != "" {
+			report.fail(rec.row, "", rec.err)
+			continue
+		}
+		valid = append(valid, rec)
+	}
+	switch kind {
+	case ImportHospital:
+		err = im.importHospitals(ctx, valid, &report)
+	case ImportDepartment:
+		err = im.importDepartments(ctx, valid, &report)
+	case ImportDoctor:
+		err = im.importDoctors(ctx, valid, &report)
+	default:
+		err = fmt.Errorf("不支持的数据类型: %s", kind)
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Row < report.Errors[j].Row
+	})
+	return report, err
+}
+
+// XytImportHandler 管理后台上传文件导入数据
+type XytImportHandler struct {
+	importer *Importer
+}
+
+func NewXytImportHandler(importer *Importer) *XytImportHandler {
+	return &XytImportHandler{
+		importer: importer,
+	}
+}
+
+func (xh *XytImportHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.POST("/import", xh.upload)
+}
+
+// upload 表单字段 kind 为数据类型, file 为 csv 或 json 文件
+func (xh *XytImportHandler) upload(ctx *gin.Context) {
+	kind := ImportKind(ctx.PostForm("kind"))
+	fh, err := ctx.FormFile("file")
+	if err != nil || (kind != ImportHospital && kind != ImportDepartment && kind != ImportDoctor) {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	format, ok := ImportFormatByName(fh.Filename)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, "只支持 csv 和 json 文件"))
+		return
+	}
+	if fh.Size > maxImportFileSize {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, "文件不能超过 10MB"))
+		return
+	}
+	file, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	defer file.Close()
+
+	report, err := xh.importer.Import(ctx, kind, format, io.LimitReader(file, maxImportFileSize))
+	if err != nil {
+		if errors.Is(err, app.ErrImportFile) {
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+			return
+		}
+		log.Println("import:", err)
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(report))
+}
@@ -0,0 +1,411 @@
+package xytweb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+// 导入时更新的字段, 启用状态和 logo 只在管理后台维护
+var (
+	hospitalImportColumns   = append(slices.Clone(hospitalEditableColumns), "updated_at")
+	departmentImportColumns = []string{"name", "description", "sort_order", "updated_at"}
+	doctorImportColumns     = []string{"name", "rank", "hos_id", "dept_id", "profile", "specialty", "phone", "email", "updated_at"}
+)
+
+// importKeys 检查文件中重复的主键, 只导入第一次出现的行
+type importKeys map[string]int
+
+func (keys importKeys) duplicate(rec importRecord, key string, report *ImportReport) bool {
+	if first, ok := keys[key]; ok {
+		report.fail(rec.row, key, fmt.Sprintf("与第 %d 行重复", first))
+		return true
+	}
+	keys[key] = rec.row
+	return false
+}
+
+// regionIndex 省市区编码, 用于校验医院的行政区划
+type regionIndex struct {
+	provinces map[string]xytmodel.Province
+	cities    map[string]xytmodel.City
+	districts map[string]xytmodel.District
+}
+
+func loadRegionIndex(db *gorm.DB) (regionIndex, error) {
+	var (
+		provinces []xytmodel.Province
+		cities    []xytmodel.City
+		districts []xytmodel.District
+	)
+	if err := db.Table(xytmodel.TableProvince).Find(&provinces).Error; err != nil {
+		return regionIndex{}, err
+	}
+	if err := db.Table(xytmodel.TableCity).Find(&cities).Error; err != nil {
+		return regionIndex{}, err
+	}
+	if err := db.Table(xytmodel.TableDistrict).Find(&districts).Error; err != nil {
+		return regionIndex{}, err
+	}
+	ri := regionIndex{
+		provinces: make(map[string]xytmodel.Province, len(provinces)),
+		cities:    make(map[string]xytmodel.City, len(cities)),
+		districts: make(map[string]xytmodel.District, len(districts)),
+	}
+	for _, p := range provinces {
+		ri.provinces[p.Code] = p
+	}
+	for _, c := range cities {
+		ri.cities[c.Code] = c
+	}
+	for _, d := range districts {
+		ri.districts[d.Code] = d
+	}
+	return ri, nil
+}
+
+// fill 校验省市区的从属关系并补全名称, 省和市必填, 区县可以为空
+func (ri regionIndex) fill(hos *xytmodel.Hospital) string {
+	province, ok := ri.provinces[hos.ProvinceCode]
+	if !ok {
+		return "省份编码不存在"
+	}
+	city, ok := ri.cities[hos.CityCode]
+	if !ok || city.ProvinceCode != province.Code {
+		return "城市编码不存在或不属于该省份"
+	}
+	hos.ProvinceName = province.Name
+	hos.CityName = city.Name
+	hos.DistrictName = ""
+	if hos.DistrictCode == "" {
+		return ""
+	}
+	district, ok := ri.districts[hos.DistrictCode]
+	if !ok || district.CityCode != city.Code {
+		return "区县编码不存在或不属于该城市"
+	}
+	hos.DistrictName = district.Name
+	return ""
+}
+
+// parseImportHospital 列名与医院表的字段相同, 地区和等级名称按编码补全
+func parseImportHospital(rec importRecord, regions regionIndex, grades map[string]string) (xytmodel.Hospital, string) {
+	hos := xytmodel.Hospital{
+		UID:                 rec.get("uid"),
+		FullName:            rec.get("full_name"),
+		ShortName:           rec.get("short_name"),
+		TypeCode:            rec.get("type_code"),
+		TypeName:            rec.get("type_name"),
+		GradeCode:           rec.get("grade_code"),
+		EconomicTypeCode:    rec.get("economic_type_code"),
+		EconomicTypeName:    rec.get("economic_type_name"),
+		ProvinceCode:        rec.get("province_code"),
+		CityCode:            rec.get("city_code"),
+		DistrictCode:        rec.get("district_code"),
+		Address:             rec.get("address"),
+		Telephone:           rec.get("telephone"),
+		WebsiteURL:          rec.get("website_url"),
+		LegalRepresentative: rec.get("legal_representative"),
+		OrgCode:             rec.get("org_code"),
+		LicenseNumber:       rec.get("license_number"),
+		LicenseExpiry:       rec.get("license_expiry"),
+		EstablishedAt:       rec.get("established_at"),
+		IsActive:            true,
+	}
+	if hos.UID == "" || hos.FullName == "" {
+		return hos, "uid 和 full_name 不能为空"
+	}
+	if msg := regions.fill(&hos); msg != "" {
+		return hos, msg
+	}
+	if hos.GradeCode != "" {
+		name, ok := grades[hos.GradeCode]
+		if !ok {
+			return hos, "医院等级编码不存在"
+		}
+		hos.GradeName = name
+	}
+
+	var err error
+	if v := rec.get("longitude"); v != "" {
+		if hos.Longitude, err = strconv.ParseFloat(v, 64); err != nil || hos.Longitude < -180 || hos.Longitude > 180 {
+			return hos, "经度格式错误"
+		}
+	}
+	if v := rec.get("latitude"); v != "" {
+		if hos.Latitude, err = strconv.ParseFloat(v, 64); err != nil || hos.Latitude < -90 || hos.Latitude > 90 {
+			return hos, "纬度格式错误"
+		}
+	}
+	if hos.IsMedicalInsurance, err = parseImportBool(rec.get("is_medical_insurance"), false); err != nil {
+		return hos, "is_medical_insurance 格式错误"
+	}
+	if hos.RequireCertification, err = parseImportBool(rec.get("require_certification"), false); err != nil {
+		return hos, "require_certification 格式错误"
+	}
+	return hos, ""
+}
+
+func (im *Importer) importHospitals(ctx context.Context, records []importRecord, report *ImportReport) error {
+	db := im.db.WithContext(ctx)
+	regions, err := loadRegionIndex(db)
+	if err != nil {
+		return err
+	}
+	var gradeList []xytmodel.HospitalGrade
+	if err = db.Table(xytmodel.TableHospitalGrade).Find(&gradeList).Error; err != nil {
+		return err
+	}
+	grades := make(map[string]string, len(gradeList))
+	for _, g := range gradeList {
+		grades[g.GradeCode] = g.GradeName
+	}
+
+	keys := importKeys{}
+	items := make([]importItem[xytmodel.Hospital], 0, len(records))
+	for _, rec := range records {
+		hos, msg := parseImportHospital(rec, regions, grades)
+		if msg != "" {
+			report.fail(rec.row, hos.UID, msg)
+			continue
+		}
+		if keys.duplicate(rec, hos.UID, report) {
+			continue
+		}
+		items = append(items, importItem[xytmodel.Hospital]{row: rec.row, key: hos.UID, value: hos})
+	}
+	upsertImportItems(ctx, im.db, im.batchSize, items, "uid", hospitalImportColumns, report)
+	return nil
+}
+
+// importDepartments 列名为 uid, hospital_id, name, description, parent_id, sort_order;
+// 上级科室可以在数据库中或者同一个文件中, 已存在的科室不能通过导入调整上级科室
+func (im *Importer) importDepartments(ctx context.Context, records []importRecord, report *ImportReport) error {
+	keys := importKeys{}
+	parsed := make([]importItem[xytmodel.Department], 0, len(records))
+	for _, rec := range records {
+		dept := xytmodel.Department{
+			UID:         rec.get("uid"),
+			HospitalID:  rec.get("hospital_id"),
+			Name:        rec.get("name"),
+			Description: rec.get("description"),
+			ParentID:    rec.get("parent_id"),
+			Status:      true,
+		}
+		if dept.UID == "" || dept.HospitalID == "" || dept.Name == "" {
+			report.fail(rec.row, dept.UID, "uid, hospital_id 和 name 不能为空")
+			continue
+		}
+		if dept.ParentID == dept.UID {
+			report.fail(rec.row, dept.UID, app.ErrDepartmentCycle.Error())
+			continue
+		}
+		if v := rec.get("sort_order"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				report.fail(rec.row, dept.UID, "sort_order 格式错误")
+				continue
+			}
+			dept.SortOrder = n
+		}
+		if keys.duplicate(rec, dept.UID, report) {
+			continue
+		}
+		parsed = append(parsed, importItem[xytmodel.Department]{row: rec.row, key: dept.UID, value: dept})
+	}
+	if len(parsed) == 0 {
+		return nil
+	}
+
+	hosIds := make([]string, 0, len(parsed))
+	uids := make([]string, 0, len(parsed))
+	for _, item := range parsed {
+		hosIds = append(hosIds, item.value.HospitalID)
+		uids = append(uids, item.key)
+	}
+	slices.Sort(hosIds)
+	hosIds = slices.Compact(hosIds)
+
+	db := im.db.WithContext(ctx)
+	var found []string
+	if err := db.Table(xytmodel.TableHospital).Where("uid in ?", hosIds).Pluck("uid", &found).Error; err != nil {
+		return err
+	}
+	var existList []xytmodel.Department
+	err := db.Table(xytmodel.TableDepartment).Where("hospital_id in ? or uid in ?", hosIds, uids).Find(&existList).Error
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]xytmodel.Department, len(existList))
+	for _, dept := range existList {
+		existing[dept.UID] = dept
+	}
+
+	pending := make(map[string]xytmodel.Department, len(parsed))
+	checked := parsed[:0]
+	for _, item := range parsed {
+		dept := item.value
+		if !slices.Contains(found, dept.HospitalID) {
+			report.fail(item.row, item.key, "医院不存在")
+			continue
+		}
+		if old, ok := existing[dept.UID]; ok {
+			if old.HospitalID != dept.HospitalID {
+				report.fail(item.row, item.key, app.ErrDepartmentMismatch.Error())
+				continue
+			}
+			if old.ParentID != dept.ParentID {
+				report.fail(item.row, item.key, "已存在的科室不能通过导入调整上级科室")
+				continue
+			}
+		}
+		pending[dept.UID] = dept
+		checked = append(checked, item)
+	}
+
+	levels := resolveDepartmentLevels(pending, existing)
+	items := make([]importItem[xytmodel.Department], 0, len(checked))
+	for _, item := range checked {
+		level, ok := levels[item.key]
+		if !ok {
+			report.fail(item.row, item.key, "上级科室不存在, 不属于该医院或者形成循环")
+			continue
+		}
+		item.value.Level = level
+		items = append(items, item)
+	}
+	// 先写上级科室
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].value.Level < items[j].value.Level
+	})
+
+	done := upsertImportItems(ctx, im.db, im.batchSize, items, "uid", departmentImportColumns, report)
+	changed := map[string]bool{}
+	for _, item := range done {
+		changed[item.value.HospitalID] = true
+	}
+	for hosId := range changed {
+		if err := im.deptCache.Delete(ctx, hosId); err != nil {
+			log.Println("delete department cache:", err)
+		}
+	}
+	return nil
+}
+
+// resolveDepartmentLevels 计算待导入科室的层级, 上级科室不存在, 属于其他医院或者形成循环的科室不在返回值中
+func resolveDepartmentLevels(pending, existing map[string]xytmodel.Department) map[string]int {
+	levels := make(map[string]int, len(pending))
+	visiting := map[string]bool{}
+	var resolve func(uid string) (xytmodel.Department, int)
+	resolve = func(uid string) (xytmodel.Department, int) {
+		dept, ok := pending[uid]
+		if !ok {
+			// 只在数据库中的科室层级不会变化
+			dept, ok = existing[uid]
+			if !ok {
+				return dept, 0
+			}
+			return dept, dept.Level
+		}
+		if level, ok := levels[uid]; ok {
+			return dept, level
+		}
+		if visiting[uid] {
+			return dept, 0
+		}
+		visiting[uid] = true
+		level := 1
+		if dept.ParentID != "" {
+			parent, parentLevel := resolve(dept.ParentID)
+			if parentLevel == 0 || parent.HospitalID != dept.HospitalID {
+				level = 0
+			} else {
+				level = parentLevel + 1
+			}
+		}
+		visiting[uid] = false
+		levels[uid] = level
+		return dept, level
+	}
+	for uid := range pending {
+		resolve(uid)
+	}
+	for uid, level := range levels {
+		if level == 0 {
+			delete(levels, uid)
+		}
+	}
+	return levels
+}
+
+// importDoctors 列名为 id, name, rank, hos_id, dept_id, profile, specialty, phone, email, 科室必须已存在
+func (im *Importer) importDoctors(ctx context.Context, records []importRecord, report *ImportReport) error {
+	keys := importKeys{}
+	parsed := make([]importItem[xytmodel.Doctor], 0, len(records))
+	deptIds := make([]string, 0, len(records))
+	for _, rec := range records {
+		doctor := xytmodel.Doctor{
+			Id:        rec.get("id"),
+			Name:      rec.get("name"),
+			Rank:      rec.get("rank"),
+			HosId:     rec.get("hos_id"),
+			DeptId:    rec.get("dept_id"),
+			Profile:   rec.get("profile"),
+			Specialty: rec.get("specialty"),
+			Phone:     rec.get("phone"),
+			Email:     rec.get("email"),
+		}
+		if doctor.Id == "" || doctor.Name == "" || doctor.HosId == "" || doctor.DeptId == "" {
+			report.fail(rec.row, doctor.Id, "id, name, hos_id 和 dept_id 不能为空")
+			continue
+		}
+		if len(doctor.Id) > 24 {
+			report.fail(rec.row, doctor.Id, "id 不能超过 24 个字符")
+			continue
+		}
+		if keys.duplicate(rec, doctor.Id, report) {
+			continue
+		}
+		parsed = append(parsed, importItem[xytmodel.Doctor]{row: rec.row, key: doctor.Id, value: doctor})
+		deptIds = append(deptIds, doctor.DeptId)
+	}
+	if len(parsed) == 0 {
+		return nil
+	}
+
+	slices.Sort(deptIds)
+	deptIds = slices.Compact(deptIds)
+	var deptList []xytmodel.Department
+	err := im.db.WithContext(ctx).Table(xytmodel.TableDepartment).Select("uid, hospital_id").
+		Where("uid in ?", deptIds).Find(&deptList).Error
+	if err != nil {
+		return err
+	}
+	depts := make(map[string]string, len(deptList))
+	for _, dept := range deptList {
+		depts[dept.UID] = dept.HospitalID
+	}
+
+	items := parsed[:0]
+	for _, item := range parsed {
+		hosId, ok := depts[item.value.DeptId]
+		if !ok {
+			report.fail(item.row, item.key, "科室不存在")
+			continue
+		}
+		if hosId != item.value.HosId {
+			report.fail(item.row, item.key, app.ErrDepartmentMismatch.Error())
+			continue
+		}
+		items = append(items, item)
+	}
+	upsertImportItems(ctx, im.db, im.batchSize, items, "id", doctorImportColumns, report)
+	return nil
+}
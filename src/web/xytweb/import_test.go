@@ -0,0 +1,141 @@
+package xytweb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestReadImportRecords(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format ImportFormat
+		data   string
+
+		wantRecords []importRecord
+		wantErr     bool
+	}{
+		{
+			name:   "csv带BOM",
+			format: FormatCSV,
+			data:   "\ufeffuid, name\nd1,内科\nd2\n",
+			wantRecords: []importRecord{
+				{row: 1, fields: map[string]string{"uid": "d1", "name": "内科"}},
+				{row: 2, fields: map[string]string{"uid": "d2"}, err: "有 1 列, 表头有 2 列"},
+			},
+		},
+		{
+			name:   "json对象数组",
+			format: FormatJSON,
+			data:   `[{"uid":"h1","longitude":116.4,"is_medical_insurance":true,"address":null},{"uid":["h2"]},1]`,
+			wantRecords: []importRecord{
+				{row: 1, fields: map[string]string{"uid": "h1", "longitude": "116.4", "is_medical_insurance": "true", "address": ""}},
+				{row: 2, fields: map[string]string{}, err: "字段 uid 类型错误"},
+				{row: 3, fields: map[string]string{}, err: "不是 json 对象"},
+			},
+		},
+		{
+			name:    "json不是数组",
+			format:  FormatJSON,
+			data:    `{"uid":"h1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "空csv",
+			format:  FormatCSV,
+			data:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := readImportRecords(tc.format, strings.NewReader(tc.data))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRecords, records)
+		})
+	}
+}
+
+func TestResolveDepartmentLevels(t *testing.T) {
+	existing := map[string]xytmodel.Department{
+		"d1": {UID: "d1", HospitalID: "h1", Level: 1},
+		"d9": {UID: "d9", HospitalID: "h2", Level: 1},
+	}
+	pending := map[string]xytmodel.Department{
+		// 下级科室在文件中出现在上级科室之前
+		"d3": {UID: "d3", HospitalID: "h1", ParentID: "d2"},
+		"d2": {UID: "d2", HospitalID: "h1", ParentID: "d1"},
+		"d4": {UID: "d4", HospitalID: "h1"},
+		// 上级科室属于其他医院
+		"d5": {UID: "d5", HospitalID: "h1", ParentID: "d9"},
+		// 上级科室不存在
+		"d6": {UID: "d6", HospitalID: "h1", ParentID: "d0"},
+		// 循环
+		"d7": {UID: "d7", HospitalID: "h1", ParentID: "d8"},
+		"d8": {UID: "d8", HospitalID: "h1", ParentID: "d7"},
+		// 上级科室无效时下级科室也无效
+		"d10": {UID: "d10", HospitalID: "h1", ParentID: "d6"},
+	}
+
+	levels := resolveDepartmentLevels(pending, existing)
+	assert.Equal(t, map[string]int{"d2": 2, "d3": 3, "d4": 1}, levels)
+}
+
+func TestImporter_ImportHospitals(t *testing.T) {
+	const data = "uid,full_name,province_code,city_code,district_code,grade_code,longitude,is_medical_insurance\n" +
+		"h1,北京协和医院,11,1101,110101,3A,116.41,是\n" +
+		"h2,天津医院,12,1101,,,,\n" +
+		"h1,北京协和医院,11,1101,,,,\n" +
+		"h3,,11,1101,,,,\n" +
+		"h4,北京医院,11,1101,,,200,\n"
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT \\* FROM `province`").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name"}).AddRow("11", "北京市").AddRow("12", "天津市"))
+	mock.ExpectQuery("SELECT \\* FROM `city`").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name", "province_code"}).AddRow("1101", "市辖区", "11"))
+	mock.ExpectQuery("SELECT \\* FROM `district`").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name", "city_code"}).AddRow("110101", "东城区", "1101"))
+	mock.ExpectQuery("SELECT \\* FROM `hospital_grade`").
+		WillReturnRows(sqlmock.NewRows([]string{"grade_code", "grade_name"}).AddRow("3A", "三级甲等"))
+	mock.ExpectExec("INSERT INTO `hospital` .* ON DUPLICATE KEY UPDATE .*`full_name`=VALUES\\(`full_name`\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+
+	report, err := NewImporter(db, nil, 0).Import(context.Background(), ImportHospital, FormatCSV, strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, ImportReport{
+		Kind:     ImportHospital,
+		Total:    5,
+		Imported: 1,
+		Failed:   4,
+		Errors: []ImportRowError{
+			{Row: 2, Key: "h2", Msg: "城市编码不存在或不属于该省份"},
+			{Row: 3, Key: "h1", Msg: "与第 1 行重复"},
+			{Row: 4, Key: "h3", Msg: "uid 和 full_name 不能为空"},
+			{Row: 5, Key: "h4", Msg: "经度格式错误"},
+		},
+	}, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
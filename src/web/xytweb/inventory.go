@@ -0,0 +1,384 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+const (
+	inventoryExpiration   = 48 * time.Hour
+	idempotencyExpiration = 24 * time.Hour
+	reconcileInterval     = time.Minute
+	// 预扣后超过这个时间还没有落库, 对账时当作已经丢失的预扣
+	pendingStaleAfter = 10 * time.Minute
+
+	bookingWorkers = 4
+	bookingBatch   = 16
+	// 落库队列中的订单读取后超过这个时间没有确认会被重新落库
+	bookingRetryAfter = 30 * time.Second
+	// 读取落库队列失败后等待的时间
+	bookingBackoff = time.Second
+)
+
+// OrderBooker 热门排班的预约入口
+// 号源先在 redis 中预扣, 预扣成功的订单和预扣在同一个 lua 脚本里写入 redis 的落库队列,
+// 由落库协程写入数据库, 落库失败的订单留在队列里重试; 号源售罄的请求不会打到数据库,
+// redis 不可用时降级为直接写数据库
+type OrderBooker struct {
+	db       *gorm.DB
+	cache    cache.InventoryCache
+	orderSvc service.OrderService
+	waitlist *Waitlist
+	guard    *BookingGuard
+}
+
+func NewOrderBooker(db *gorm.DB, cache cache.InventoryCache, orderSvc service.OrderService) *OrderBooker {
+	return &OrderBooker{
+		db:       db,
+		cache:    cache,
+		orderSvc: orderSvc,
+	}
+}
+
+// UseWaitlist 释放号源时先递补给候补队列
+func (b *OrderBooker) UseWaitlist(waitlist *Waitlist) {
+	b.waitlist = waitlist
+}
+
+// UseGuard 下单前检查封禁和预约规则
+func (b *OrderBooker) UseGuard(guard *BookingGuard) {
+	b.guard = guard
+}
+
+// Start 启动落库协程和定时对账, ctx 结束后退出
+func (b *OrderBooker) Start(ctx context.Context) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "booker"
+	}
+	for i := 0; i < bookingWorkers; i++ {
+		go b.persistLoop(ctx, fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i))
+	}
+	go b.reconcileLoop(ctx)
+}
+
+func (b *OrderBooker) Book(ctx context.Context, req service.OrderReq) (string, error) {
+	xytorder, err := b.orderSvc.Prepare(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if xytorder.IdempotencyKey.Valid {
+		orderId, err := b.cache.BindIdempotencyKey(ctx, xytorder.UserId, xytorder.IdempotencyKey.String, xytorder.OrderId, idempotencyExpiration)
+		if err != nil {
+			log.Println("bind idempotency key:", err)
+			return b.fallback(ctx, xytorder)
+		}
+		if orderId != xytorder.OrderId {
+			return orderId, nil
+		}
+	}
+
+	// 重试的请求在上面已经返回了, 不会被重复预约的规则拦住
+	if err = b.check(ctx, xytorder); err != nil {
+		b.unbind(ctx, xytorder)
+		return "", err
+	}
+
+	payload, err := json.Marshal(queuedOrder{Order: xytorder, IdempotencyKey: xytorder.IdempotencyKey.String})
+	if err != nil {
+		b.unbind(ctx, xytorder)
+		return "", err
+	}
+	err = b.deduct(ctx, cache.Booking{
+		ScheId:  xytorder.ScheId,
+		UserId:  xytorder.UserId,
+		OrderId: xytorder.OrderId,
+		Order:   payload,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, cache.ErrInventorySoldOut):
+		b.unbind(ctx, xytorder)
+		return "", app.ErrScheduleFull
+	default:
+		// redis 出问题了, 降级走数据库
+		log.Println("deduct inventory:", err)
+		b.unbind(ctx, xytorder)
+		return b.orderSvc.Create(ctx, xytorder, b.checkTx()...)
+	}
+
+	// 订单已经在落库队列里了, 落库前可以通过 Status 查询
+	return xytorder.OrderId, nil
+}
+
+// Status 查询还没有落库的订单, 在落库队列中的返回 ErrOrderQueued, 不能落库的返回 ErrOrderFailed,
+// 都不是时返回 gorm.ErrRecordNotFound
+func (b *OrderBooker) Status(ctx context.Context, userId, orderId string) error {
+	reason, err := b.cache.BookingStatus(ctx, userId, orderId)
+	switch {
+	case errors.Is(err, cache.ErrKeyNotExist):
+		return gorm.ErrRecordNotFound
+	case err != nil:
+		return err
+	case reason == "":
+		return app.ErrOrderQueued
+	default:
+		return fmt.Errorf("%w: %s", app.ErrOrderFailed, reason)
+	}
+}
+
+// fallback redis 不可用时直接走数据库下单
+func (b *OrderBooker) fallback(ctx context.Context, xytorder xytmodel.RegisterOrder) (string, error) {
+	if xytorder.IdempotencyKey.Valid {
+		orderId, err := b.orderSvc.FindIdByIdempotencyKey(ctx, xytorder.UserId, xytorder.IdempotencyKey.String)
+		if err == nil {
+			return orderId, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+	}
+	if err := b.check(ctx, xytorder); err != nil {
+		return "", err
+	}
+	return b.orderSvc.Create(ctx, xytorder, b.checkTx()...)
+}
+
+func (b *OrderBooker) check(ctx context.Context, xytorder xytmodel.RegisterOrder) error {
+	if b.guard == nil {
+		return nil
+	}
+	return b.guard.Check(ctx, xytorder)
+}
+
+// checkTx 下单前的检查和占号不在同一个事务里, 占号时再检查一次依赖已有订单的规则
+func (b *OrderBooker) checkTx() []service.OrderCheck {
+	if b.guard == nil {
+		return nil
+	}
+	return []service.OrderCheck{b.guard.CheckTx}
+}
+
+// Release 订单取消后把号源递补给候补队列, 没有候补时还给 redis
+func (b *OrderBooker) Release(ctx context.Context, scheId string) {
+	if b.waitlist != nil {
+		promoted, err := b.waitlist.Promote(ctx, scheId)
+		if err != nil {
+			log.Println("promote waitlist:", err)
+		}
+		if promoted {
+			return
+		}
+	}
+	if err := b.cache.Release(ctx, scheId, ""); err != nil {
+		// 对账会修正
+		log.Println("release inventory:", err)
+	}
+}
+
+// Reconcile 用数据库中未来排班的剩余号源修正 redis, 清理超过 pendingStaleAfter 还没有落库的预扣,
+// 返回修正的排班数
+func (b *OrderBooker) Reconcile(ctx context.Context) (int, error) {
+	var schedules []xytmodel.Schedule
+	err := b.db.WithContext(ctx).Table(xytmodel.TableSchedule).
+		Select("sche_id", "max_patients", "registered").
+		Where("work_date >= ?", time.Now().Format(time.DateOnly)).
+		Find(&schedules).Error
+	if err != nil {
+		return 0, err
+	}
+	var staleBefore = time.Now().Add(-pendingStaleAfter)
+	var repaired = 0
+	for _, sche := range schedules {
+		ok, err := b.cache.Reconcile(ctx, sche.ScheId, sche.MaxPatients-sche.Registered, staleBefore)
+		if err != nil {
+			return repaired, err
+		}
+		if ok {
+			repaired++
+		}
+	}
+	return repaired, nil
+}
+
+func (b *OrderBooker) deduct(ctx context.Context, booking cache.Booking) error {
+	err := b.cache.Deduct(ctx, booking)
+	if !errors.Is(err, cache.ErrInventoryNotLoaded) {
+		return err
+	}
+	var schedule xytmodel.Schedule
+	err = b.db.WithContext(ctx).Table(xytmodel.TableSchedule).Where("sche_id = ?", booking.ScheId).Take(&schedule).Error
+	if err != nil {
+		return err
+	}
+	err = b.cache.Load(ctx, booking.ScheId, schedule.MaxPatients-schedule.Registered, inventoryExpiration)
+	if err != nil {
+		return err
+	}
+	return b.cache.Deduct(ctx, booking)
+}
+
+// queuedOrder 落库队列中的订单, 幂等键不会序列化到订单的 json 里, 单独保存
+type queuedOrder struct {
+	Order          xytmodel.RegisterOrder `json:"order"`
+	IdempotencyKey string                 `json:"idempotencyKey"`
+}
+
+// Persist 从落库队列读取一批订单写入数据库, 返回确认的订单数;
+// 数据库暂时不可用等错误不确认, 超过 bookingRetryAfter 后重新落库
+func (b *OrderBooker) Persist(ctx context.Context, consumer string) (int, error) {
+	bookings, err := b.cache.ReadBookings(ctx, consumer, bookingBatch, bookingRetryAfter)
+	if err != nil {
+		return 0, err
+	}
+	var acked = 0
+	for _, booking := range bookings {
+		if err = b.persist(ctx, booking); err != nil {
+			log.Printf("persist booking %s: %v", booking.Id, err)
+			continue
+		}
+		if err = b.cache.AckBooking(ctx, booking.Id); err != nil {
+			// 重新落库时会发现订单已经处理过了
+			log.Printf("ack booking %s: %v", booking.Id, err)
+			continue
+		}
+		acked++
+	}
+	return acked, nil
+}
+
+// persist 落库一个订单, 返回 nil 表示订单已经处理完, 可以确认
+func (b *OrderBooker) persist(ctx context.Context, booking cache.QueuedBooking) error {
+	var queued queuedOrder
+	if err := json.Unmarshal(booking.Order, &queued); err != nil {
+		// 重试也解析不了, 号源等对账修正
+		log.Printf("decode booking %s: %v", booking.Id, err)
+		return nil
+	}
+	xytorder := queued.Order
+	xytorder.IdempotencyKey = sql.NullString{String: queued.IdempotencyKey, Valid: queued.IdempotencyKey != ""}
+
+	// 上次落库成功后没来得及确认
+	_, err := b.orderSvc.Find(ctx, xytorder.UserId, xytorder.OrderId)
+	switch {
+	case err == nil:
+		b.release(ctx, xytorder, false)
+		return nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	orderId, err := b.orderSvc.Create(ctx, xytorder, b.checkTx()...)
+	switch {
+	case err == nil && orderId == xytorder.OrderId:
+		b.release(ctx, xytorder, false)
+	case err == nil:
+		// 幂等键已经有订单了, 这次预扣作废
+		b.release(ctx, xytorder, true)
+		b.fail(ctx, xytorder, app.ErrDuplicateOrder)
+	case errors.Is(err, app.ErrScheduleFull):
+		// redis 比数据库多了号源, 不归还, 等对账修正
+		b.release(ctx, xytorder, false)
+		b.unbind(ctx, xytorder)
+		b.fail(ctx, xytorder, err)
+	case bookingRejected(err):
+		b.release(ctx, xytorder, true)
+		b.unbind(ctx, xytorder)
+		b.fail(ctx, xytorder, err)
+	default:
+		return err
+	}
+	return nil
+}
+
+// bookingRejected 重试也不能落库的错误
+func bookingRejected(err error) bool {
+	return errors.Is(err, app.ErrBookingRejected) ||
+		errors.Is(err, app.ErrPatientBanned) ||
+		errors.Is(err, app.ErrDuplicateOrder) ||
+		errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// fail 记录订单不能落库的原因, 用户查询订单时返回
+func (b *OrderBooker) fail(ctx context.Context, xytorder xytmodel.RegisterOrder, reason error) {
+	err := b.cache.FailBooking(ctx, xytorder.UserId, xytorder.OrderId, reason.Error())
+	if err != nil {
+		log.Println("fail booking:", err)
+	}
+}
+
+// release 作废订单的预扣, restore 表示把号源还回去
+func (b *OrderBooker) release(ctx context.Context, xytorder xytmodel.RegisterOrder, restore bool) {
+	var err error
+	if restore {
+		err = b.cache.Release(ctx, xytorder.ScheId, xytorder.OrderId)
+	} else {
+		err = b.cache.Confirm(ctx, xytorder.ScheId, xytorder.OrderId)
+	}
+	if err != nil {
+		log.Println("release inventory:", err)
+	}
+}
+
+func (b *OrderBooker) unbind(ctx context.Context, xytorder xytmodel.RegisterOrder) {
+	if !xytorder.IdempotencyKey.Valid {
+		return
+	}
+	err := b.cache.UnbindIdempotencyKey(ctx, xytorder.UserId, xytorder.IdempotencyKey.String)
+	if err != nil {
+		log.Println("unbind idempotency key:", err)
+	}
+}
+
+func (b *OrderBooker) persistLoop(ctx context.Context, consumer string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		_, err := b.Persist(ctx, consumer)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		log.Println("read bookings:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bookingBackoff):
+		}
+	}
+}
+
+func (b *OrderBooker) reconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			repaired, err := b.Reconcile(ctx)
+			if err != nil {
+				log.Println("reconcile inventory:", err)
+				continue
+			}
+			if repaired > 0 {
+				log.Printf("reconcile inventory: repaired %d schedules", repaired)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/cache"
+	cachemocks "github.com/solunara/isb/src/repository/cache/mocks"
+	svcmocks "github.com/solunara/isb/src/service/mocks"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+)
+
+func TestOrderBooker_Reconcile(t *testing.T) {
+	// 对账时把超过 pendingStaleAfter 还没有落库的预扣当作丢失
+	staleBefore := gomock.Cond(func(x any) bool {
+		before, ok := x.(time.Time)
+		return ok && time.Since(before) >= pendingStaleAfter && time.Since(before) < pendingStaleAfter+time.Minute
+	})
+	testCases := []struct {
+		name  string
+		cache func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache
+
+		wantRepaired int
+	}{
+		{
+			name: "清理泄漏的预扣",
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().Reconcile(gomock.Any(), "s1", 15, staleBefore).Return(true, nil)
+				c.EXPECT().Reconcile(gomock.Any(), "s2", 0, staleBefore).Return(false, nil)
+				return c
+			},
+			wantRepaired: 1,
+		},
+		{
+			name: "无需修正",
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().Reconcile(gomock.Any(), "s1", 15, staleBefore).Return(false, nil)
+				c.EXPECT().Reconcile(gomock.Any(), "s2", 0, staleBefore).Return(false, nil)
+				return c
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			mock.ExpectQuery("SELECT `sche_id`,`max_patients`,`registered` FROM `schedule` WHERE work_date >= \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"sche_id", "max_patients", "registered"}).
+					AddRow("s1", 20, 5).
+					AddRow("s2", 10, 10))
+
+			db := newQueueTestDB(t, sqlDB)
+			b := NewOrderBooker(db, tc.cache(ctrl), newTestOrderService(db))
+			repaired, err := b.Reconcile(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRepaired, repaired)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOrderBooker_Persist(t *testing.T) {
+	order := xytmodel.RegisterOrder{UserId: "u1", OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStatePending}
+	payload, err := json.Marshal(queuedOrder{Order: order, IdempotencyKey: "k1"})
+	require.NoError(t, err)
+	// 幂等键不在订单的 json 里, 落库时要还原
+	keyed := order
+	keyed.IdempotencyKey = sql.NullString{String: "k1", Valid: true}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService)
+
+		wantAcked int
+	}{
+		{
+			name: "落库成功",
+			mock: func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService) {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().ReadBookings(gomock.Any(), "c1", int64(bookingBatch), bookingRetryAfter).
+					Return([]cache.QueuedBooking{{Id: "1-0", Order: payload}}, nil)
+				c.EXPECT().Confirm(gomock.Any(), "s1", "o1").Return(nil)
+				c.EXPECT().AckBooking(gomock.Any(), "1-0").Return(nil)
+				orderSvc := svcmocks.NewMockOrderService(ctrl)
+				orderSvc.EXPECT().Find(gomock.Any(), "u1", "o1").Return(xytmodel.RegisterOrder{}, gorm.ErrRecordNotFound)
+				orderSvc.EXPECT().Create(gomock.Any(), keyed).Return("o1", nil)
+				return c, orderSvc
+			},
+			wantAcked: 1,
+		},
+		{
+			name: "上次落库后没有确认",
+			mock: func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService) {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().ReadBookings(gomock.Any(), "c1", int64(bookingBatch), bookingRetryAfter).
+					Return([]cache.QueuedBooking{{Id: "1-0", Order: payload}}, nil)
+				c.EXPECT().Confirm(gomock.Any(), "s1", "o1").Return(nil)
+				c.EXPECT().AckBooking(gomock.Any(), "1-0").Return(nil)
+				orderSvc := svcmocks.NewMockOrderService(ctrl)
+				orderSvc.EXPECT().Find(gomock.Any(), "u1", "o1").Return(order, nil)
+				return c, orderSvc
+			},
+			wantAcked: 1,
+		},
+		{
+			name: "数据库错误留在队列里重试",
+			mock: func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService) {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().ReadBookings(gomock.Any(), "c1", int64(bookingBatch), bookingRetryAfter).
+					Return([]cache.QueuedBooking{{Id: "1-0", Order: payload}}, nil)
+				orderSvc := svcmocks.NewMockOrderService(ctrl)
+				orderSvc.EXPECT().Find(gomock.Any(), "u1", "o1").Return(xytmodel.RegisterOrder{}, gorm.ErrRecordNotFound)
+				orderSvc.EXPECT().Create(gomock.Any(), keyed).Return("", errors.New("数据库错误"))
+				return c, orderSvc
+			},
+		},
+		{
+			name: "预约受限时归还号源",
+			mock: func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService) {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().ReadBookings(gomock.Any(), "c1", int64(bookingBatch), bookingRetryAfter).
+					Return([]cache.QueuedBooking{{Id: "1-0", Order: payload}}, nil)
+				c.EXPECT().Release(gomock.Any(), "s1", "o1").Return(nil)
+				c.EXPECT().UnbindIdempotencyKey(gomock.Any(), "u1", "k1").Return(nil)
+				c.EXPECT().FailBooking(gomock.Any(), "u1", "o1", app.ErrBookingRejected.Error()).Return(nil)
+				c.EXPECT().AckBooking(gomock.Any(), "1-0").Return(nil)
+				orderSvc := svcmocks.NewMockOrderService(ctrl)
+				orderSvc.EXPECT().Find(gomock.Any(), "u1", "o1").Return(xytmodel.RegisterOrder{}, gorm.ErrRecordNotFound)
+				orderSvc.EXPECT().Create(gomock.Any(), keyed).Return("", app.ErrBookingRejected)
+				return c, orderSvc
+			},
+			wantAcked: 1,
+		},
+		{
+			name: "已约满时不归还号源",
+			mock: func(ctrl *gomock.Controller) (cache.InventoryCache, *svcmocks.MockOrderService) {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().ReadBookings(gomock.Any(), "c1", int64(bookingBatch), bookingRetryAfter).
+					Return([]cache.QueuedBooking{{Id: "1-0", Order: payload}}, nil)
+				c.EXPECT().Confirm(gomock.Any(), "s1", "o1").Return(nil)
+				c.EXPECT().UnbindIdempotencyKey(gomock.Any(), "u1", "k1").Return(nil)
+				c.EXPECT().FailBooking(gomock.Any(), "u1", "o1", app.ErrScheduleFull.Error()).Return(nil)
+				c.EXPECT().AckBooking(gomock.Any(), "1-0").Return(nil)
+				orderSvc := svcmocks.NewMockOrderService(ctrl)
+				orderSvc.EXPECT().Find(gomock.Any(), "u1", "o1").Return(xytmodel.RegisterOrder{}, gorm.ErrRecordNotFound)
+				orderSvc.EXPECT().Create(gomock.Any(), keyed).Return("", app.ErrScheduleFull)
+				return c, orderSvc
+			},
+			wantAcked: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c, orderSvc := tc.mock(ctrl)
+			b := NewOrderBooker(nil, c, orderSvc)
+			acked, err := b.Persist(context.Background(), "c1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAcked, acked)
+		})
+	}
+}
+
+func TestOrderBooker_Status(t *testing.T) {
+	testCases := []struct {
+		name   string
+		reason string
+		err    error
+
+		wantErr error
+	}{
+		{name: "在落库队列中", wantErr: app.ErrOrderQueued},
+		{name: "不能落库", reason: app.ErrScheduleFull.Error(), wantErr: app.ErrOrderFailed},
+		{name: "没有预扣过", err: cache.ErrKeyNotExist, wantErr: gorm.ErrRecordNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			c := cachemocks.NewMockInventoryCache(ctrl)
+			c.EXPECT().BookingStatus(gomock.Any(), "u1", "o1").Return(tc.reason, tc.err)
+			err := NewOrderBooker(nil, c, nil).Status(context.Background(), "u1", "o1")
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
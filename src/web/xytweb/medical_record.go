@@ -0,0 +1,514 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxRecordAttachmentSize = 10 << 20
+	maxDiagnosisLength      = 4096
+)
+
+var recordAttachmentTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// 就诊中或已完成就诊的订单才能填写就诊记录
+var recordableOrderStates = []int8{xytmodel.OrderStateCalling, xytmodel.OrderStateCompleted}
+
+// 就诊人在医生处有这些状态的订单时, 医生可以查看就诊人以往的就诊记录
+var treatingOrderStates = []int8{
+	xytmodel.OrderStatePaid,
+	xytmodel.OrderStateCheckedIn,
+	xytmodel.OrderStateCalling,
+	xytmodel.OrderStateCompleted,
+}
+
+type MedicalRecordReq struct {
+	OrderId       string                  `json:"orderId"`
+	Diagnosis     string                  `json:"diagnosis"`
+	Prescriptions []xytmodel.Prescription `json:"prescriptions"`
+	Advice        string                  `json:"advice"`
+}
+
+func validMedicalRecordReq(req MedicalRecordReq) bool {
+	if req.OrderId == "" || strings.TrimSpace(req.Diagnosis) == "" || len(req.Diagnosis) > maxDiagnosisLength {
+		return false
+	}
+	for _, p := range req.Prescriptions {
+		if strings.TrimSpace(p.Drug) == "" || p.Quantity < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// MedicalRecords 医生填写就诊记录, 就诊人查看和导出自己的就诊记录
+type MedicalRecords struct {
+	db      *gorm.DB
+	storage ObjectStorage
+}
+
+func NewMedicalRecords(db *gorm.DB, storage ObjectStorage) *MedicalRecords {
+	return &MedicalRecords{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Save 填写就诊记录, 已经填写过时覆盖诊断, 处方和医嘱; 只能填写 docId 接诊的订单
+func (m *MedicalRecords) Save(ctx context.Context, author, docId string, req MedicalRecordReq) (xytmodel.MedicalRecord, error) {
+	order, err := findOrder(m.db.WithContext(ctx), req.OrderId)
+	if err != nil {
+		return xytmodel.MedicalRecord{}, err
+	}
+	if order.DocId != docId {
+		return xytmodel.MedicalRecord{}, app.ErrRecordScope
+	}
+	if !slices.Contains(recordableOrderStates, order.State) {
+		return xytmodel.MedicalRecord{}, app.ErrRecordNotAllowed
+	}
+	if req.Prescriptions == nil {
+		req.Prescriptions = []xytmodel.Prescription{}
+	}
+	record := xytmodel.MedicalRecord{
+		OrderId:       order.OrderId,
+		UserId:        order.UserId,
+		PatientId:     order.PatientId,
+		PatientName:   order.PatientName,
+		HosName:       order.HosName,
+		DeptName:      order.DeptName,
+		DocId:         order.DocId,
+		DocName:       order.DocName,
+		VisitTime:     order.VisitTime,
+		Diagnosis:     strings.TrimSpace(req.Diagnosis),
+		Prescriptions: req.Prescriptions,
+		Advice:        strings.TrimSpace(req.Advice),
+		Author:        author,
+	}
+	err = m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"diagnosis", "prescriptions", "advice", "author", "updated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return xytmodel.MedicalRecord{}, err
+	}
+	return m.Find(ctx, order.OrderId)
+}
+
+// Find 订单的就诊记录和附件
+func (m *MedicalRecords) Find(ctx context.Context, orderId string) (xytmodel.MedicalRecord, error) {
+	var record xytmodel.MedicalRecord
+	err := m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecord).Where("order_id = ?", orderId).Take(&record).Error
+	if err != nil {
+		return record, err
+	}
+	records := []xytmodel.MedicalRecord{record}
+	err = m.loadAttachments(ctx, records)
+	return records[0], err
+}
+
+// History 就诊人的全部就诊记录, 最近的在前
+func (m *MedicalRecords) History(ctx context.Context, patientId string) ([]xytmodel.MedicalRecord, error) {
+	var records = []xytmodel.MedicalRecord{}
+	err := m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecord).Where("patient_id = ?", patientId).
+		Order("visit_time desc, id desc").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, m.loadAttachments(ctx, records)
+}
+
+// CheckTreated 就诊人必须在 docId 处有过预约
+func (m *MedicalRecords) CheckTreated(ctx context.Context, docId, patientId string) error {
+	var count int64
+	err := m.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("doc_id = ? and patient_id = ? and state in ?", docId, patientId, treatingOrderStates).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return app.ErrRecordScope
+	}
+	return nil
+}
+
+func (m *MedicalRecords) loadAttachments(ctx context.Context, records []xytmodel.MedicalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var ids []int
+	for _, record := range records {
+		ids = append(ids, record.Id)
+	}
+	var attachments []xytmodel.MedicalRecordAttachment
+	err := m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecordAttachment).Where("record_id in ?", ids).
+		Order("id").Find(&attachments).Error
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		records[i].Attachments = []xytmodel.MedicalRecordAttachment{}
+		for _, a := range attachments {
+			if a.RecordId == records[i].Id {
+				records[i].Attachments = append(records[i].Attachments, a)
+			}
+		}
+	}
+	return nil
+}
+
+// AddAttachment 给 docId 接诊的订单已经填写的就诊记录上传附件
+func (m *MedicalRecords) AddAttachment(ctx context.Context, author, docId, orderId, name string, data []byte) (xytmodel.MedicalRecordAttachment, error) {
+	// 以文件内容判断类型, 不信任客户端的文件名和 Content-Type
+	contentType := http.DetectContentType(data)
+	ext, ok := recordAttachmentTypes[contentType]
+	if !ok || len(data) == 0 || len(data) > maxRecordAttachmentSize {
+		return xytmodel.MedicalRecordAttachment{}, app.ErrRecordAttachment
+	}
+	var record xytmodel.MedicalRecord
+	err := m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecord).Select("id", "doc_id").Where("order_id = ?", orderId).Take(&record).Error
+	if err != nil {
+		return xytmodel.MedicalRecordAttachment{}, err
+	}
+	if record.DocId != docId {
+		return xytmodel.MedicalRecordAttachment{}, app.ErrRecordScope
+	}
+	attachment := xytmodel.MedicalRecordAttachment{
+		RecordId:    record.Id,
+		Name:        name,
+		ObjectKey:   "medical_record/" + orderId + "/" + uuid.NewString() + ext,
+		ContentType: contentType,
+		Size:        len(data),
+		CreatedBy:   author,
+	}
+	if err = m.storage.Put(ctx, attachment.ObjectKey, data, contentType); err != nil {
+		return xytmodel.MedicalRecordAttachment{}, err
+	}
+	err = m.db.WithContext(ctx).Create(&attachment).Error
+	return attachment, err
+}
+
+// Attachment 附件和所属的就诊记录, 不包含文件内容
+func (m *MedicalRecords) Attachment(ctx context.Context, id int) (xytmodel.MedicalRecordAttachment, xytmodel.MedicalRecord, error) {
+	var attachment xytmodel.MedicalRecordAttachment
+	var record xytmodel.MedicalRecord
+	err := m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecordAttachment).Where("id = ?", id).Take(&attachment).Error
+	if err != nil {
+		return attachment, record, err
+	}
+	err = m.db.WithContext(ctx).Table(xytmodel.TableMedicalRecord).Where("id = ?", attachment.RecordId).Take(&record).Error
+	return attachment, record, err
+}
+
+// MedicalHistoryText 纯文本格式的就诊记录摘要, 用于导出
+func MedicalHistoryText(patientName string, records []xytmodel.MedicalRecord, exportedAt time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "就诊人: %s\n", patientName)
+	fmt.Fprintf(&sb, "导出时间: %s\n", exportedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&sb, "共 %d 次就诊\n", len(records))
+	for i, record := range records {
+		fmt.Fprintf(&sb, "\n[%d] %s %s %s %s医生\n", i+1, record.VisitTime, record.HosName, record.DeptName, record.DocName)
+		fmt.Fprintf(&sb, "诊断: %s\n", record.Diagnosis)
+		if len(record.Prescriptions) > 0 {
+			sb.WriteString("处方:\n")
+			for _, p := range record.Prescriptions {
+				fmt.Fprintf(&sb, "  - %s", p.Drug)
+				if p.Spec != "" {
+					fmt.Fprintf(&sb, " %s", p.Spec)
+				}
+				fmt.Fprintf(&sb, " x%d%s", p.Quantity, p.Unit)
+				if p.Usage != "" {
+					fmt.Fprintf(&sb, ", %s", p.Usage)
+				}
+				sb.WriteString("\n")
+			}
+		}
+		if record.Advice != "" {
+			fmt.Fprintf(&sb, "医嘱: %s\n", record.Advice)
+		}
+		if len(record.Attachments) > 0 {
+			names := make([]string, 0, len(record.Attachments))
+			for _, a := range record.Attachments {
+				names = append(names, a.Name)
+			}
+			fmt.Fprintf(&sb, "附件: %s\n", strings.Join(names, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// XytMedicalRecordHandler 医生填写就诊记录, 用户查看自己就诊人的就诊记录
+type XytMedicalRecordHandler struct {
+	records *MedicalRecords
+}
+
+func NewXytMedicalRecordHandler(records *MedicalRecords) *XytMedicalRecordHandler {
+	return &XytMedicalRecordHandler{
+		records: records,
+	}
+}
+
+func (xh *XytMedicalRecordHandler) RegisterRoutes(group *gin.RouterGroup) {
+	rg := group.Group("/user/record")
+	rg.GET("", xh.getRecord)
+	rg.GET("/list", xh.history)
+	rg.GET("/attachment", xh.attachment)
+	rg.GET("/export", xh.export)
+}
+
+// RegisterDoctorRoutes group 为只有医生可以访问的路由组
+func (xh *XytMedicalRecordHandler) RegisterDoctorRoutes(group *gin.RouterGroup) {
+	rg := group.Group("/record")
+	rg.GET("", xh.doctorGetRecord)
+	rg.POST("", xh.save)
+	rg.GET("/history", xh.doctorHistory)
+	rg.POST("/attachment", xh.upload)
+	rg.GET("/attachment", xh.doctorAttachment)
+}
+
+// ownRecord 就诊记录的就诊人必须属于当前用户
+func (xh *XytMedicalRecordHandler) ownRecord(ctx *gin.Context, record xytmodel.MedicalRecord) bool {
+	_, err := FindUserPatient(ctx, xh.records.db, ctx.GetString(config.USER_ID), record.PatientId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return false
+	}
+	return true
+}
+
+// clinicDoctor 当前医生账号绑定的医生, 失败时已经写入响应
+func (xh *XytMedicalRecordHandler) clinicDoctor(ctx *gin.Context) (string, bool) {
+	docId, err := findStationDoctor(xh.records.db.WithContext(ctx), ctx.GetString(config.USER_ID))
+	if err == nil && docId == "" {
+		err = app.ErrRecordScope
+	}
+	if err != nil {
+		recordErr(ctx, err)
+		return "", false
+	}
+	return docId, true
+}
+
+// treatedRecord 就诊记录的就诊人必须在当前医生处有过预约
+func (xh *XytMedicalRecordHandler) treatedRecord(ctx *gin.Context, record xytmodel.MedicalRecord) bool {
+	docId, ok := xh.clinicDoctor(ctx)
+	if !ok {
+		return false
+	}
+	if err := xh.records.CheckTreated(ctx, docId, record.PatientId); err != nil {
+		recordErr(ctx, err)
+		return false
+	}
+	return true
+}
+
+func (xh *XytMedicalRecordHandler) getRecord(ctx *gin.Context) {
+	record, err := xh.records.Find(ctx, ctx.Query("orderId"))
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if !xh.ownRecord(ctx, record) {
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(record))
+}
+
+func (xh *XytMedicalRecordHandler) history(ctx *gin.Context) {
+	patient, err := FindUserPatient(ctx, xh.records.db, ctx.GetString(config.USER_ID), ctx.Query("patientId"))
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	records, err := xh.records.History(ctx, patient.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(records))
+}
+
+func (xh *XytMedicalRecordHandler) attachment(ctx *gin.Context) {
+	xh.sendAttachment(ctx, xh.ownRecord)
+}
+
+func (xh *XytMedicalRecordHandler) doctorAttachment(ctx *gin.Context) {
+	xh.sendAttachment(ctx, xh.treatedRecord)
+}
+
+func (xh *XytMedicalRecordHandler) sendAttachment(ctx *gin.Context, allowed func(*gin.Context, xytmodel.MedicalRecord) bool) {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	attachment, record, err := xh.records.Attachment(ctx, id)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if !allowed(ctx, record) {
+		return
+	}
+	data, err := xh.records.storage.Get(ctx, attachment.ObjectKey)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Content-Disposition", "inline; filename*=UTF-8''"+url.PathEscape(attachment.Name))
+	ctx.Data(http.StatusOK, attachment.ContentType, data)
+}
+
+type medicalHistoryExport struct {
+	PatientName string                   `json:"patientName"`
+	ExportedAt  int64                    `json:"exportedAt"`
+	Records     []xytmodel.MedicalRecord `json:"records"`
+}
+
+// export format 为 json 或 text, 默认 json
+func (xh *XytMedicalRecordHandler) export(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "text" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	patient, err := FindUserPatient(ctx, xh.records.db, ctx.GetString(config.USER_ID), ctx.Query("patientId"))
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	records, err := xh.records.History(ctx, patient.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	now := time.Now()
+	filename := "medical_history_" + now.Format("20060102")
+	ctx.Header("Cache-Control", "no-store")
+	if format == "text" {
+		ctx.Header("Content-Disposition", "attachment; filename="+filename+".txt")
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(MedicalHistoryText(patient.Name, records, now)))
+		return
+	}
+	ctx.Header("Content-Disposition", "attachment; filename="+filename+".json")
+	ctx.JSON(http.StatusOK, medicalHistoryExport{PatientName: patient.Name, ExportedAt: now.UnixMilli(), Records: records})
+}
+
+func (xh *XytMedicalRecordHandler) doctorGetRecord(ctx *gin.Context) {
+	record, err := xh.records.Find(ctx, ctx.Query("orderId"))
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if !xh.treatedRecord(ctx, record) {
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(record))
+}
+
+// doctorHistory 医生查看在自己处预约过的就诊人以往的就诊记录
+func (xh *XytMedicalRecordHandler) doctorHistory(ctx *gin.Context) {
+	patientId := ctx.Query("patientId")
+	if patientId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	if !xh.treatedRecord(ctx, xytmodel.MedicalRecord{PatientId: patientId}) {
+		return
+	}
+	records, err := xh.records.History(ctx, patientId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(records))
+}
+
+func (xh *XytMedicalRecordHandler) save(ctx *gin.Context) {
+	var req MedicalRecordReq
+	if err := ctx.Bind(&req); err != nil || !validMedicalRecordReq(req) {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	docId, ok := xh.clinicDoctor(ctx)
+	if !ok {
+		return
+	}
+	record, err := xh.records.Save(ctx, ctx.GetString(config.USER_ID), docId, req)
+	if err != nil {
+		recordErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(record))
+}
+
+// upload 表单字段 orderId 和 file
+func (xh *XytMedicalRecordHandler) upload(ctx *gin.Context) {
+	orderId := ctx.PostForm("orderId")
+	fh, err := ctx.FormFile("file")
+	if err != nil || orderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if fh.Size > maxRecordAttachmentSize {
+		recordErr(ctx, app.ErrRecordAttachment)
+		return
+	}
+	file, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxRecordAttachmentSize+1))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	docId, ok := xh.clinicDoctor(ctx)
+	if !ok {
+		return
+	}
+	attachment, err := xh.records.AddAttachment(ctx, ctx.GetString(config.USER_ID), docId, orderId, fh.Filename, data)
+	if err != nil {
+		recordErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(attachment))
+}
+
+func recordErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrRecordAttachment):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrRecordNotAllowed), errors.Is(err, app.ErrRecordScope), errors.Is(err, app.ErrStationScope):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
@@ -0,0 +1,194 @@
+package xytweb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMedicalRecords_Save(t *testing.T) {
+	orderRows := func(state int8) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"order_id", "user_id", "patient_id", "doc_id", "visit_time", "state"}).
+			AddRow("o1", "u1", "p1", "d1", "2024-06-18 上午", state)
+	}
+	req := MedicalRecordReq{
+		OrderId:       "o1",
+		Diagnosis:     " 上呼吸道感染 ",
+		Prescriptions: []xytmodel.Prescription{{Drug: "阿莫西林胶囊", Quantity: 2, Unit: "盒"}},
+	}
+	testCases := []struct {
+		name  string
+		docId string
+		mock  func(mock sqlmock.Sqlmock)
+
+		wantErr error
+	}{
+		{
+			name:  "已完成就诊的订单",
+			docId: "d1",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStateCompleted))
+				mock.ExpectExec("INSERT INTO `medical_record` .* ON DUPLICATE KEY UPDATE `diagnosis`=VALUES\\(`diagnosis`\\)").
+					WithArgs("o1", "u1", "p1", "", "", "", "d1", "", "2024-06-18 上午", "上呼吸道感染",
+						`[{"drug":"阿莫西林胶囊","spec":"","usage":"","quantity":2,"unit":"盒"}]`, "", "doc", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("SELECT \\* FROM `medical_record` WHERE order_id = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "diagnosis"}).AddRow(1, "o1", "上呼吸道感染"))
+				mock.ExpectQuery("SELECT \\* FROM `medical_record_attachment` WHERE record_id in \\(\\?\\)").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "record_id", "name"}).AddRow(1, 1, "血常规.pdf"))
+			},
+		},
+		{
+			name:  "还没有就诊的订单",
+			docId: "d1",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStatePaid))
+			},
+			wantErr: app.ErrRecordNotAllowed,
+		},
+		{
+			name:  "不是自己接诊的订单",
+			docId: "d2",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStateCompleted))
+			},
+			wantErr: app.ErrRecordScope,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			m := NewMedicalRecords(newQueueTestDB(t, sqlDB), memObjectStorage{})
+
+			record, err := m.Save(context.Background(), "doc", tc.docId, req)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				assert.Equal(t, "o1", record.OrderId)
+				assert.Len(t, record.Attachments, 1)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMedicalRecords_AddAttachment(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n%test\n")
+	testCases := []struct {
+		name  string
+		docId string
+		data  []byte
+		mock  func(mock sqlmock.Sqlmock)
+
+		wantErr    error
+		wantStored int
+	}{
+		{
+			name:  "上传 pdf",
+			docId: "d1",
+			data:  pdf,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT `id`,`doc_id` FROM `medical_record` WHERE order_id = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "doc_id"}).AddRow(1, "d1"))
+				mock.ExpectExec("INSERT INTO `medical_record_attachment`").
+					WithArgs(1, "血常规.pdf", sqlmock.AnyArg(), "application/pdf", len(pdf), "doc", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantStored: 1,
+		},
+		{
+			name:    "不支持的文件类型",
+			data:    []byte("plain text"),
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: app.ErrRecordAttachment,
+		},
+		{
+			name:  "不是自己接诊的订单",
+			docId: "d2",
+			data:  pdf,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT `id`,`doc_id` FROM `medical_record` WHERE order_id = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "doc_id"}).AddRow(1, "d1"))
+			},
+			wantErr: app.ErrRecordScope,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			storage := memObjectStorage{}
+			m := NewMedicalRecords(newQueueTestDB(t, sqlDB), storage)
+
+			attachment, err := m.AddAttachment(context.Background(), "doc", tc.docId, "o1", "血常规.pdf", tc.data)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Len(t, storage, tc.wantStored)
+			if err == nil {
+				assert.Equal(t, tc.data, storage[attachment.ObjectKey])
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMedicalRecords_CheckTreated(t *testing.T) {
+	testCases := []struct {
+		name  string
+		count int
+
+		wantErr error
+	}{
+		{name: "在医生处预约过", count: 1},
+		{name: "没有在医生处预约过", count: 0, wantErr: app.ErrRecordScope},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order` WHERE doc_id = \\? and patient_id = \\? and state in").
+				WithArgs("d1", "p1", xytmodel.OrderStatePaid, xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling, xytmodel.OrderStateCompleted).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.count))
+			m := NewMedicalRecords(newQueueTestDB(t, sqlDB), memObjectStorage{})
+
+			err = m.CheckTreated(context.Background(), "d1", "p1")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMedicalHistoryText(t *testing.T) {
+	records := []xytmodel.MedicalRecord{
+		{
+			VisitTime: "2024-06-18 上午", HosName: "协和医院", DeptName: "内科", DocName: "李四",
+			Diagnosis:     "上呼吸道感染",
+			Prescriptions: []xytmodel.Prescription{{Drug: "阿莫西林胶囊", Spec: "0.25g*24粒", Usage: "口服 一次2粒 一日3次", Quantity: 2, Unit: "盒"}},
+			Advice:        "多喝水",
+			Attachments:   []xytmodel.MedicalRecordAttachment{{Name: "血常规.pdf"}},
+		},
+		{VisitTime: "2024-05-02 下午", HosName: "协和医院", DeptName: "骨科", DocName: "王五", Diagnosis: "踝关节扭伤"},
+	}
+	text := MedicalHistoryText("张三", records, time.Date(2024, 6, 20, 10, 0, 0, 0, time.Local))
+	assert.Equal(t, `就诊人: 张三
+导出时间: 2024-06-20 10:00
+共 2 次就诊
+
+[1] 2024-06-18 上午 协和医院 内科 李四医生
+诊断: 上呼吸道感染
+处方:
+  - 阿莫西林胶囊 0.25g*24粒 x2盒, 口服 一次2粒 一日3次
+医嘱: 多喝水
+附件: 血常规.pdf
+
+[2] 2024-05-02 下午 协和医院 骨科 王五医生
+诊断: 踝关节扭伤
+`, text)
+}
@@ -0,0 +1,580 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service/sms"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	notifyInterval = 30 * time.Second
+	notifyBatch    = 100
+	// 启动时补扫最近这段时间的订单和状态变更, 重启期间的通知不会丢, 已经生成过的按 dedup_key 忽略
+	notifyLookback = time.Hour
+	// 自增 id 小的记录可能晚提交, 每次都重扫最近这段时间的记录, 已经生成过的按 dedup_key 忽略
+	notifyOverlap     = 5 * time.Minute
+	notifyMaxAttempts = 3
+	notifyRetryDelay  = 5 * time.Minute
+	// 就诊前一天晚上提醒的时间
+	remindEveAt         = "20:00"
+	defaultRemindBefore = 2 * time.Hour
+
+	SmsTplOrderCreated   = "order_created"
+	SmsTplOrderPaid      = "order_paid"
+	SmsTplOrderCancelled = "order_cancelled"
+	SmsTplOrderRefunded  = "order_refunded"
+	SmsTplVisitReminder  = "visit_reminder"
+)
+
+// 订单迁移到这些状态时通知用户
+var transitionNotifyKinds = map[int8]string{
+	xytmodel.OrderStatePaid:      xytmodel.NotifyOrderPaid,
+	xytmodel.OrderStateCancelled: xytmodel.NotifyOrderCancelled,
+	xytmodel.OrderStateRefunded:  xytmodel.NotifyOrderRefunded,
+}
+
+// 各类通知使用的短信模板, 参数都是 就诊人, 医院, 科室, 医生, 就诊时间
+var notifySmsTemplates = map[string]string{
+	xytmodel.NotifyOrderCreated:   SmsTplOrderCreated,
+	xytmodel.NotifyOrderPaid:      SmsTplOrderPaid,
+	xytmodel.NotifyOrderCancelled: SmsTplOrderCancelled,
+	xytmodel.NotifyOrderRefunded:  SmsTplOrderRefunded,
+	xytmodel.NotifyRemindEve:      SmsTplVisitReminder,
+	xytmodel.NotifyRemindSoon:     SmsTplVisitReminder,
+}
+
+func isReminder(kind string) bool {
+	return kind == xytmodel.NotifyRemindEve || kind == xytmodel.NotifyRemindSoon
+}
+
+func DefaultNotificationPreference(userId string) xytmodel.NotificationPreference {
+	return xytmodel.NotificationPreference{
+		UserId:      userId,
+		SmsReminder: true,
+		SmsOrder:    true,
+		QuietStart:  "22:00",
+		QuietEnd:    "08:00",
+	}
+}
+
+// clockOn 返回 day 当天 hhmm 的时间
+func clockOn(day time.Time, hhmm string) (time.Time, error) {
+	clock, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location()), nil
+}
+
+// validQuietHours 免打扰时段要么都为空, 要么都是 15:04 格式
+func validQuietHours(start, end string) bool {
+	if start == "" && end == "" {
+		return true
+	}
+	_, err1 := time.Parse("15:04", start)
+	_, err2 := time.Parse("15:04", end)
+	return err1 == nil && err2 == nil
+}
+
+// quietUntil now 在免打扰时段内时返回时段的结束时间, 开始时间晚于结束时间表示跨过零点
+func quietUntil(pref xytmodel.NotificationPreference, now time.Time) (time.Time, bool) {
+	if pref.QuietStart == pref.QuietEnd {
+		return time.Time{}, false
+	}
+	start, err := clockOn(now, pref.QuietStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := clockOn(now, pref.QuietEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch {
+	case start.Before(end):
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	case !now.Before(start):
+		return end.AddDate(0, 0, 1), true
+	case now.Before(end):
+		return end, true
+	}
+	return time.Time{}, false
+}
+
+// NotificationCenter 生成订单通知和就诊提醒, 写入站内信并按用户的设置发送短信
+// 定时扫描新订单和订单状态变更记录生成通知, 同一订单的同一类通知按 dedup_key 只会生成一条
+type NotificationCenter struct {
+	db           *gorm.DB
+	smsSvc       sms.Service
+	remindBefore time.Duration
+
+	// 已经扫描过并且早于 notifyOverlap 的订单和状态变更记录的 id, 只在定时任务中使用
+	scanned     bool
+	orderMark   int
+	historyMark int
+}
+
+func NewNotificationCenter(db *gorm.DB, smsSvc sms.Service, remindBefore time.Duration) *NotificationCenter {
+	if remindBefore <= 0 {
+		remindBefore = defaultRemindBefore
+	}
+	return &NotificationCenter{
+		db:           db,
+		smsSvc:       smsSvc,
+		remindBefore: remindBefore,
+	}
+}
+
+func (c *NotificationCenter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(notifyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Collect(ctx); err != nil {
+					log.Println("collect notifications:", err)
+				}
+				sent, err := c.Dispatch(ctx)
+				if err != nil {
+					log.Println("dispatch notifications:", err)
+					continue
+				}
+				if sent > 0 {
+					log.Printf("dispatch notifications: sent %d sms", sent)
+				}
+			}
+		}
+	}()
+}
+
+// Collect 为新订单和新的状态变更生成通知, 支付成功时同时安排就诊提醒
+func (c *NotificationCenter) Collect(ctx context.Context) error {
+	db := c.db.WithContext(ctx)
+	if !c.scanned {
+		since := time.Now().Add(-notifyLookback)
+		err := db.Table(xytmodel.TableOrder).Where("created_at < ?", since).
+			Select("coalesce(max(id), 0)").Scan(&c.orderMark).Error
+		if err != nil {
+			return err
+		}
+		err = db.Table(xytmodel.TableOrderHistory).Where("created_at < ?", since).
+			Select("coalesce(max(id), 0)").Scan(&c.historyMark).Error
+		if err != nil {
+			return err
+		}
+		c.scanned = true
+	}
+
+	// 只把标记推进到早于 cutoff 的连续记录, 之后的记录下次继续扫描
+	cutoff := time.Now().Add(-notifyOverlap)
+	settled, cursor := true, c.orderMark
+	for {
+		var orders []xytmodel.RegisterOrder
+		err := db.Table(xytmodel.TableOrder).Where("id > ?", cursor).Order("id").Limit(notifyBatch).Find(&orders).Error
+		if err != nil {
+			return err
+		}
+		var ns []xytmodel.Notification
+		for _, order := range orders {
+			// 候补递补的订单在递补时已经单独发了短信
+			if order.ConfirmDeadline == 0 {
+				ns = append(ns, orderNotification(order, xytmodel.NotifyOrderCreated, order.CreatedAt))
+			}
+		}
+		if err = c.enqueue(ctx, ns); err != nil {
+			return err
+		}
+		for _, order := range orders {
+			settled = settled && order.CreatedAt.Before(cutoff)
+			if settled {
+				c.orderMark = order.Id
+			}
+		}
+		if len(orders) > 0 {
+			cursor = orders[len(orders)-1].Id
+		}
+		if len(orders) < notifyBatch {
+			break
+		}
+	}
+
+	settled, cursor = true, c.historyMark
+	for {
+		var history []xytmodel.OrderHistory
+		err := db.Table(xytmodel.TableOrderHistory).Where("id > ?", cursor).Order("id").Limit(notifyBatch).Find(&history).Error
+		if err != nil {
+			return err
+		}
+		var orderIds []string
+		for _, h := range history {
+			orderIds = append(orderIds, h.OrderId)
+		}
+		var orders []xytmodel.RegisterOrder
+		if len(orderIds) > 0 {
+			err = db.Table(xytmodel.TableOrder).Where("order_id in ?", orderIds).Find(&orders).Error
+			if err != nil {
+				return err
+			}
+		}
+		var orderMap = make(map[string]xytmodel.RegisterOrder, len(orders))
+		for _, order := range orders {
+			orderMap[order.OrderId] = order
+		}
+
+		var ns []xytmodel.Notification
+		for _, h := range history {
+			kind, ok := transitionNotifyKinds[h.ToState]
+			order, found := orderMap[h.OrderId]
+			// 退款失败回到已支付时不再通知
+			if !ok || !found || (h.ToState == xytmodel.OrderStatePaid && h.FromState != xytmodel.OrderStatePending) {
+				continue
+			}
+			ns = append(ns, orderNotification(order, kind, h.CreatedAt))
+			if h.ToState == xytmodel.OrderStatePaid {
+				ns = append(ns, c.reminders(order, time.Now())...)
+			}
+		}
+		if err = c.enqueue(ctx, ns); err != nil {
+			return err
+		}
+		for _, h := range history {
+			settled = settled && h.CreatedAt.Before(cutoff)
+			if settled {
+				c.historyMark = h.Id
+			}
+		}
+		if len(history) > 0 {
+			cursor = history[len(history)-1].Id
+		}
+		if len(history) < notifyBatch {
+			return nil
+		}
+	}
+}
+
+// reminders 就诊前一天晚上和就诊前 remindBefore 各提醒一次, 已经过去的时间不再提醒
+func (c *NotificationCenter) reminders(order xytmodel.RegisterOrder, now time.Time) []xytmodel.Notification {
+	start, err := VisitStartTime(order)
+	if err != nil {
+		log.Printf("remind order %s: %v", order.OrderId, err)
+		return nil
+	}
+	eve, err := clockOn(start.AddDate(0, 0, -1), remindEveAt)
+	if err != nil {
+		return nil
+	}
+	var ns []xytmodel.Notification
+	for _, r := range []struct {
+		kind string
+		at   time.Time
+	}{
+		{xytmodel.NotifyRemindEve, eve},
+		{xytmodel.NotifyRemindSoon, start.Add(-c.remindBefore)},
+	} {
+		if !r.at.After(now) || !r.at.Before(start) {
+			continue
+		}
+		n := orderNotification(order, r.kind, r.at)
+		n.ExpiresAt = start.UnixMilli()
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func visitDesc(order xytmodel.RegisterOrder) string {
+	if order.VisitPeriod != "" {
+		return order.VisitPeriod
+	}
+	return order.VisitTime
+}
+
+func orderNotification(order xytmodel.RegisterOrder, kind string, at time.Time) xytmodel.Notification {
+	desc := fmt.Sprintf("%s %s %s医生, 就诊时间 %s", order.HosName, order.DeptName, order.DocName, visitDesc(order))
+	var title, content string
+	switch kind {
+	case xytmodel.NotifyOrderCreated:
+		title, content = "预约成功, 待支付", fmt.Sprintf("%s 预约了%s, 请尽快完成支付, 超时未支付的订单将自动取消", order.PatientName, desc)
+	case xytmodel.NotifyOrderPaid:
+		title, content = "挂号成功", fmt.Sprintf("%s 已成功挂号%s, 请按时就诊", order.PatientName, desc)
+	case xytmodel.NotifyOrderCancelled:
+		title, content = "订单已取消", fmt.Sprintf("%s 预约的%s已取消", order.PatientName, desc)
+	case xytmodel.NotifyOrderRefunded:
+		title, content = "退号成功", fmt.Sprintf("%s 预约的%s已退号, 退款将原路退回", order.PatientName, desc)
+	default:
+		title, content = "就诊提醒", fmt.Sprintf("%s 您好, 您预约了%s, 请提前到医院签到", order.PatientName, desc)
+	}
+	return xytmodel.Notification{
+		UserId:   order.UserId,
+		OrderId:  order.OrderId,
+		Kind:     kind,
+		Title:    title,
+		Content:  content,
+		DedupKey: kind + ":" + order.OrderId,
+		NotifyAt: at.UnixMilli(),
+		SmsAt:    at.UnixMilli(),
+	}
+}
+
+// enqueue 写入通知, dedup_key 已经存在的忽略
+func (c *NotificationCenter) enqueue(ctx context.Context, ns []xytmodel.Notification) error {
+	if len(ns) == 0 {
+		return nil
+	}
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&ns).Error
+}
+
+// Dispatch 发送到期的短信, 返回发送成功的数量
+func (c *NotificationCenter) Dispatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	var ns []xytmodel.Notification
+	err := c.db.WithContext(ctx).Table(xytmodel.TableNotification).
+		Where("sms_state = ? and sms_at <= ?", xytmodel.NotifySmsPending, now.UnixMilli()).
+		Order("sms_at").Limit(notifyBatch).Find(&ns).Error
+	if err != nil {
+		return 0, err
+	}
+	var prefs = make(map[string]xytmodel.NotificationPreference)
+	var sent = 0
+	for _, n := range ns {
+		pref, ok := prefs[n.UserId]
+		if !ok {
+			pref, err = c.Preference(ctx, n.UserId)
+			if err != nil {
+				return sent, err
+			}
+			prefs[n.UserId] = pref
+		}
+		ok, err = c.sendSms(ctx, n, pref, now)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendSms 按用户的设置发送一条通知的短信, 真正发出短信时返回 true
+func (c *NotificationCenter) sendSms(ctx context.Context, n xytmodel.Notification, pref xytmodel.NotificationPreference, now time.Time) (bool, error) {
+	if n.ExpiresAt > 0 && now.UnixMilli() >= n.ExpiresAt {
+		return false, c.skipSms(ctx, n.Id)
+	}
+	if isReminder(n.Kind) && !pref.SmsReminder || !isReminder(n.Kind) && !pref.SmsOrder {
+		return false, c.skipSms(ctx, n.Id)
+	}
+	if until, ok := quietUntil(pref, now); ok {
+		if n.ExpiresAt > 0 && until.UnixMilli() >= n.ExpiresAt {
+			return false, c.skipSms(ctx, n.Id)
+		}
+		return false, c.db.WithContext(ctx).Model(&xytmodel.Notification{}).
+			Where("id = ? and sms_state = ?", n.Id, xytmodel.NotifySmsPending).
+			Update("sms_at", until.UnixMilli()).Error
+	}
+
+	order, err := findOrder(c.db.WithContext(ctx), n.OrderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, c.skipSms(ctx, n.Id)
+	}
+	if err != nil {
+		return false, err
+	}
+	// 提醒发送前订单已经退号的不再提醒
+	if isReminder(n.Kind) && order.State != xytmodel.OrderStatePaid {
+		return false, c.skipSms(ctx, n.Id)
+	}
+	var patient xytmodel.Patient
+	err = c.db.WithContext(ctx).Table(xytmodel.TablePatient).Select("phone").Where("id = ?", order.PatientId).Take(&patient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && patient.Phone == "" {
+		return false, c.skipSms(ctx, n.Id)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// 先改为发送中, 多个实例只有一个能发送, 发送后进程退出也不会重复发送
+	res := c.db.WithContext(ctx).Model(&xytmodel.Notification{}).
+		Where("id = ? and sms_state = ?", n.Id, xytmodel.NotifySmsPending).
+		Updates(map[string]any{"sms_state": xytmodel.NotifySmsSending, "sms_attempts": gorm.Expr("sms_attempts + 1")})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	args := []string{order.PatientName, order.HosName, order.DeptName, order.DocName, visitDesc(order)}
+	err = c.smsSvc.Send(ctx, notifySmsTemplates[n.Kind], args, patient.Phone)
+	if err != nil {
+		log.Printf("send notification %d: %v", n.Id, err)
+		updates := map[string]any{"sms_state": xytmodel.NotifySmsPending, "sms_at": now.Add(notifyRetryDelay).UnixMilli()}
+		if n.SmsAttempts+1 >= notifyMaxAttempts {
+			updates = map[string]any{"sms_state": xytmodel.NotifySmsFailed}
+		}
+		return false, c.db.WithContext(ctx).Model(&xytmodel.Notification{}).Where("id = ?", n.Id).Updates(updates).Error
+	}
+	return true, c.db.WithContext(ctx).Model(&xytmodel.Notification{}).Where("id = ?", n.Id).
+		Update("sms_state", xytmodel.NotifySmsSent).Error
+}
+
+func (c *NotificationCenter) skipSms(ctx context.Context, id int) error {
+	return c.db.WithContext(ctx).Model(&xytmodel.Notification{}).
+		Where("id = ? and sms_state = ?", id, xytmodel.NotifySmsPending).
+		Update("sms_state", xytmodel.NotifySmsSkipped).Error
+}
+
+type NotificationPage struct {
+	List   []xytmodel.Notification `json:"list"`
+	Total  int64                   `json:"total"`
+	Unread int64                   `json:"unread"`
+}
+
+// Inbox 站内信, 还没到通知时间的提醒不显示
+func (c *NotificationCenter) Inbox(ctx context.Context, userId string, offset, limit int) (NotificationPage, error) {
+	var page = NotificationPage{List: []xytmodel.Notification{}}
+	visible := func() *gorm.DB {
+		return c.db.WithContext(ctx).Table(xytmodel.TableNotification).
+			Where("user_id = ? and notify_at <= ?", userId, time.Now().UnixMilli())
+	}
+	if err := visible().Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+	if err := visible().Where("read_at = 0").Count(&page.Unread).Error; err != nil {
+		return page, err
+	}
+	if page.Total < 1 || offset > int(page.Total) {
+		return page, nil
+	}
+	err := visible().Order("notify_at desc, id desc").Offset(offset).Limit(limit).Find(&page.List).Error
+	return page, err
+}
+
+// MarkRead ids 为空时标记全部已读
+func (c *NotificationCenter) MarkRead(ctx context.Context, userId string, ids []int) error {
+	query := c.db.WithContext(ctx).Model(&xytmodel.Notification{}).
+		Where("user_id = ? and read_at = 0 and notify_at <= ?", userId, time.Now().UnixMilli())
+	if len(ids) > 0 {
+		query = query.Where("id in ?", ids)
+	}
+	return query.Update("read_at", time.Now().UnixMilli()).Error
+}
+
+func (c *NotificationCenter) Preference(ctx context.Context, userId string) (xytmodel.NotificationPreference, error) {
+	var pref xytmodel.NotificationPreference
+	err := c.db.WithContext(ctx).Table(xytmodel.TableNotificationPreference).Where("user_id = ?", userId).Take(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultNotificationPreference(userId), nil
+	}
+	return pref, err
+}
+
+func (c *NotificationCenter) SavePreference(ctx context.Context, pref xytmodel.NotificationPreference) error {
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&pref).Error
+}
+
+type XytNotificationHandler struct {
+	center *NotificationCenter
+}
+
+func NewXytNotificationHandler(center *NotificationCenter) *XytNotificationHandler {
+	return &XytNotificationHandler{
+		center: center,
+	}
+}
+
+func (xh *XytNotificationHandler) RegisterRoutes(group *gin.RouterGroup) {
+	ng := group.Group("/user/notification")
+	ng.GET("/list", xh.list)
+	ng.POST("/read", xh.read)
+	ng.GET("/preference", xh.getPreference)
+	ng.POST("/preference", xh.savePreference)
+}
+
+func (xh *XytNotificationHandler) list(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	pageNo, _ := strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("pageSize", "10"))
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 10
+	}
+	page, err := xh.center.Inbox(ctx, userid.(string), (pageNo-1)*pageSize, pageSize)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(page))
+}
+
+type readNotificationReq struct {
+	Ids []int `json:"ids"`
+}
+
+func (xh *XytNotificationHandler) read(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req readNotificationReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.center.MarkRead(ctx, userid.(string), req.Ids); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytNotificationHandler) getPreference(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	pref, err := xh.center.Preference(ctx, userid.(string))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(pref))
+}
+
+func (xh *XytNotificationHandler) savePreference(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var pref xytmodel.NotificationPreference
+	if err := ctx.Bind(&pref); err != nil || !validQuietHours(pref.QuietStart, pref.QuietEnd) {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	pref.UserId = userid.(string)
+	if err := xh.center.SavePreference(ctx, pref); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(pref))
+}
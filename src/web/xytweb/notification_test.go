@@ -0,0 +1,241 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	smsmock "github.com/solunara/isb/src/service/sms/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestQuietUntil(t *testing.T) {
+	day := time.Date(2024, 6, 18, 0, 0, 0, 0, time.Local)
+	at := func(d int, hhmm string) time.Time {
+		tm, err := clockOn(day.AddDate(0, 0, d), hhmm)
+		require.NoError(t, err)
+		return tm
+	}
+	testCases := []struct {
+		name  string
+		start string
+		end   string
+		now   time.Time
+
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{
+			name:  "跨零点, 当天晚上",
+			start: "22:00", end: "08:00", now: at(0, "23:30"),
+			wantQuiet: true, wantUntil: at(1, "08:00"),
+		},
+		{
+			name:  "跨零点, 第二天早上",
+			start: "22:00", end: "08:00", now: at(0, "07:59"),
+			wantQuiet: true, wantUntil: at(0, "08:00"),
+		},
+		{
+			name:  "跨零点, 白天不在时段内",
+			start: "22:00", end: "08:00", now: at(0, "08:00"),
+		},
+		{
+			name:  "不跨零点",
+			start: "12:00", end: "14:00", now: at(0, "12:00"),
+			wantQuiet: true, wantUntil: at(0, "14:00"),
+		},
+		{
+			name:  "不跨零点, 不在时段内",
+			start: "12:00", end: "14:00", now: at(0, "14:30"),
+		},
+		{
+			name: "没有设置",
+			now:  at(0, "23:30"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			until, quiet := quietUntil(xytmodel.NotificationPreference{QuietStart: tc.start, QuietEnd: tc.end}, tc.now)
+			assert.Equal(t, tc.wantQuiet, quiet)
+			assert.Equal(t, tc.wantUntil, until)
+		})
+	}
+}
+
+func TestNotificationCenter_reminders(t *testing.T) {
+	c := NewNotificationCenter(nil, nil, 2*time.Hour)
+	order := xytmodel.RegisterOrder{OrderId: "o1", UserId: "u1", VisitTime: "2024-06-18 上午", VisitPeriod: "2024-06-18 09:00-09:10"}
+	at := func(s string) int64 {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		require.NoError(t, err)
+		return tm.UnixMilli()
+	}
+	testCases := []struct {
+		name string
+		now  string
+
+		wantKinds []string
+		wantAt    []int64
+	}{
+		{
+			name:      "提前几天支付",
+			now:       "2024-06-15 10:00",
+			wantKinds: []string{xytmodel.NotifyRemindEve, xytmodel.NotifyRemindSoon},
+			wantAt:    []int64{at("2024-06-17 20:00"), at("2024-06-18 07:00")},
+		},
+		{
+			name:      "前一天晚上提醒时间已过",
+			now:       "2024-06-17 21:00",
+			wantKinds: []string{xytmodel.NotifyRemindSoon},
+			wantAt:    []int64{at("2024-06-18 07:00")},
+		},
+		{
+			name: "快到就诊时间才支付",
+			now:  "2024-06-18 08:00",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ns := c.reminders(order, time.UnixMilli(at(tc.now)))
+			var kinds []string
+			var ats []int64
+			for _, n := range ns {
+				kinds = append(kinds, n.Kind)
+				ats = append(ats, n.NotifyAt)
+				assert.Equal(t, n.Kind+":o1", n.DedupKey)
+				assert.Equal(t, at("2024-06-18 09:00"), n.ExpiresAt)
+			}
+			assert.Equal(t, tc.wantKinds, kinds)
+			assert.Equal(t, tc.wantAt, ats)
+		})
+	}
+}
+
+func TestNotificationCenter_Dispatch(t *testing.T) {
+	notificationRows := func(kind string, attempts int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id", "order_id", "kind", "sms_state", "sms_attempts"}).
+			AddRow(1, "u1", "o1", kind, xytmodel.NotifySmsPending, attempts)
+	}
+	preferenceRows := func(smsReminder, smsOrder bool) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"user_id", "sms_reminder", "sms_order", "quiet_start", "quiet_end"}).
+			AddRow("u1", smsReminder, smsOrder, "", "")
+	}
+	orderRows := func(state int8) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"order_id", "patient_id", "patient_name", "hos_name", "dept_name", "doc_name", "visit_time", "state"}).
+			AddRow("o1", "p1", "张三", "协和医院", "内科", "李四", "2024-06-18 上午", state)
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) *smsmock.MockService
+
+		wantSent int
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) *smsmock.MockService {
+				mock.ExpectQuery("SELECT \\* FROM `notification` WHERE sms_state = \\?").WillReturnRows(notificationRows(xytmodel.NotifyOrderPaid, 0))
+				mock.ExpectQuery("SELECT \\* FROM `notification_preference`").WillReturnRows(preferenceRows(true, true))
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStatePaid))
+				mock.ExpectQuery("SELECT `phone` FROM `patient`").WillReturnRows(sqlmock.NewRows([]string{"phone"}).AddRow("13800000000"))
+				mock.ExpectExec("UPDATE `notification` SET `sms_attempts`=sms_attempts \\+ 1,`sms_state`=\\?").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `notification` SET `sms_state`=\\?").
+					WithArgs(xytmodel.NotifySmsSent, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				smsSvc := smsmock.NewMockService(ctrl)
+				smsSvc.EXPECT().Send(gomock.Any(), SmsTplOrderPaid, []string{"张三", "协和医院", "内科", "李四", "2024-06-18 上午"}, "13800000000").Return(nil)
+				return smsSvc
+			},
+			wantSent: 1,
+		},
+		{
+			name: "用户关闭了订单短信",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) *smsmock.MockService {
+				mock.ExpectQuery("SELECT \\* FROM `notification` WHERE sms_state = \\?").WillReturnRows(notificationRows(xytmodel.NotifyOrderPaid, 0))
+				mock.ExpectQuery("SELECT \\* FROM `notification_preference`").WillReturnRows(preferenceRows(true, false))
+				mock.ExpectExec("UPDATE `notification` SET `sms_state`=\\?").
+					WithArgs(xytmodel.NotifySmsSkipped, sqlmock.AnyArg(), 1, xytmodel.NotifySmsPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return smsmock.NewMockService(ctrl)
+			},
+		},
+		{
+			name: "订单已经退号不再提醒",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) *smsmock.MockService {
+				mock.ExpectQuery("SELECT \\* FROM `notification` WHERE sms_state = \\?").WillReturnRows(notificationRows(xytmodel.NotifyRemindSoon, 0))
+				mock.ExpectQuery("SELECT \\* FROM `notification_preference`").WillReturnRows(preferenceRows(true, true))
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStateRefunded))
+				mock.ExpectExec("UPDATE `notification` SET `sms_state`=\\?").
+					WithArgs(xytmodel.NotifySmsSkipped, sqlmock.AnyArg(), 1, xytmodel.NotifySmsPending).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				return smsmock.NewMockService(ctrl)
+			},
+		},
+		{
+			name: "最后一次重试失败",
+			mock: func(ctrl *gomock.Controller, mock sqlmock.Sqlmock) *smsmock.MockService {
+				mock.ExpectQuery("SELECT \\* FROM `notification` WHERE sms_state = \\?").WillReturnRows(notificationRows(xytmodel.NotifyOrderPaid, notifyMaxAttempts-1))
+				mock.ExpectQuery("SELECT \\* FROM `notification_preference`").WillReturnRows(preferenceRows(true, true))
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(orderRows(xytmodel.OrderStatePaid))
+				mock.ExpectQuery("SELECT `phone` FROM `patient`").WillReturnRows(sqlmock.NewRows([]string{"phone"}).AddRow("13800000000"))
+				mock.ExpectExec("UPDATE `notification` SET `sms_attempts`=sms_attempts \\+ 1,`sms_state`=\\?").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `notification` SET `sms_state`=\\?").
+					WithArgs(xytmodel.NotifySmsFailed, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				smsSvc := smsmock.NewMockService(ctrl)
+				smsSvc.EXPECT().Send(gomock.Any(), SmsTplOrderPaid, gomock.Any(), "13800000000").Return(errors.New("sms error"))
+				return smsSvc
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			c := NewNotificationCenter(newQueueTestDB(t, sqlDB), tc.mock(ctrl, mock), 0)
+
+			sent, err := c.Dispatch(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantSent, sent)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestNotificationCenter_Collect(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	old, recent := time.Now().Add(-2*notifyOverlap), time.Now()
+	orderCols := []string{"id", "order_id", "user_id", "created_at"}
+	historyCols := []string{"id", "order_id", "from_state", "to_state", "created_at"}
+
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE id > \\?").WithArgs(10, notifyBatch).
+		WillReturnRows(sqlmock.NewRows(orderCols).AddRow(11, "o1", "u1", old).AddRow(12, "o2", "u1", recent).AddRow(13, "o3", "u1", old))
+	mock.ExpectExec("INSERT INTO `notification`").WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectQuery("SELECT \\* FROM `register_order_history` WHERE id > \\?").WithArgs(20, notifyBatch).
+		WillReturnRows(sqlmock.NewRows(historyCols).
+			AddRow(21, "o1", xytmodel.OrderStatePending, xytmodel.OrderStateCancelled, old).
+			AddRow(22, "o2", xytmodel.OrderStatePending, xytmodel.OrderStateCancelled, recent))
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id in").
+		WillReturnRows(sqlmock.NewRows(orderCols).AddRow(11, "o1", "u1", old).AddRow(12, "o2", "u1", recent))
+	mock.ExpectExec("INSERT INTO `notification`").WillReturnResult(sqlmock.NewResult(1, 2))
+	// 最近的记录下次重新扫描, 晚提交的记录不会漏掉
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE id > \\?").WithArgs(11, notifyBatch).
+		WillReturnRows(sqlmock.NewRows(orderCols))
+	mock.ExpectQuery("SELECT \\* FROM `register_order_history` WHERE id > \\?").WithArgs(21, notifyBatch).
+		WillReturnRows(sqlmock.NewRows(historyCols))
+
+	c := NewNotificationCenter(newQueueTestDB(t, sqlDB), nil, 0)
+	c.scanned, c.orderMark, c.historyMark = true, 10, 20
+	require.NoError(t, c.Collect(context.Background()))
+	assert.Equal(t, 11, c.orderMark)
+	assert.Equal(t, 21, c.historyMark)
+	require.NoError(t, c.Collect(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
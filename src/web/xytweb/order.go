@@ -0,0 +1,89 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPayTimeout   = 15 * time.Minute
+	orderExpireInterval = 30 * time.Second
+	orderExpireBatch    = 100
+)
+
+// OrderExpirer 定时取消超过支付时限的待支付订单, 候补递补的订单按各自的确认时限取消
+type OrderExpirer struct {
+	db      *gorm.DB
+	orders  service.OrderService
+	booker  *OrderBooker
+	timeout time.Duration
+}
+
+func NewOrderExpirer(db *gorm.DB, orders service.OrderService, booker *OrderBooker, timeout time.Duration) *OrderExpirer {
+	if timeout <= 0 {
+		timeout = defaultPayTimeout
+	}
+	return &OrderExpirer{
+		db:      db,
+		orders:  orders,
+		booker:  booker,
+		timeout: timeout,
+	}
+}
+
+func (e *OrderExpirer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(orderExpireInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cancelled, err := e.Expire(ctx)
+				if err != nil {
+					log.Println("expire orders:", err)
+					continue
+				}
+				if cancelled > 0 {
+					log.Printf("expire orders: cancelled %d orders", cancelled)
+				}
+			}
+		}
+	}()
+}
+
+// Expire 取消一批支付超时的订单, 返回取消的数量
+func (e *OrderExpirer) Expire(ctx context.Context) (int, error) {
+	var orders []xytmodel.RegisterOrder
+	err := e.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("state = ?", xytmodel.OrderStatePending).
+		// 候补递补的订单只看确认时限, 不受下单时间影响
+		Where("(confirm_deadline = 0 and created_at < ?) or (confirm_deadline > 0 and confirm_deadline < ?)", time.Now().Add(-e.timeout), time.Now().UnixMilli()).
+		Order("id").Limit(orderExpireBatch).
+		Find(&orders).Error
+	if err != nil {
+		return 0, err
+	}
+	var cancelled = 0
+	for _, order := range orders {
+		err = e.orders.Cancel(ctx, order, xytmodel.OrderActorSystem, "支付超时")
+		if err != nil {
+			// 用户刚好在这期间支付或取消了
+			if errors.Is(err, app.ErrOrderStateChanged) {
+				continue
+			}
+			return cancelled, err
+		}
+		e.booker.Release(ctx, order.ScheId)
+		cancelled++
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,99 @@
+package xytweb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	cachemocks "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+)
+
+// newTestOrderService 只用到订单相关方法的 OrderService
+func newTestOrderService(db *gorm.DB) service.OrderService {
+	return service.NewOrderService(repository.NewOrderRepository(dao.NewOrderDAO(db)), nil, nil, nil)
+}
+
+func TestOrderExpirer_Expire(t *testing.T) {
+	const expireQuery = "SELECT \\* FROM `register_order` WHERE state = \\? AND " +
+		"\\(\\(confirm_deadline = 0 and created_at < \\?\\) or \\(confirm_deadline > 0 and confirm_deadline < \\?\\)\\)"
+	timeout := 15 * time.Minute
+	testCases := []struct {
+		name  string
+		mock  func(mock sqlmock.Sqlmock)
+		cache func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache
+
+		wantCancelled int
+	}{
+		{
+			name: "普通订单支付超时",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expireQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"order_id", "sche_id", "state", "confirm_deadline", "created_at"}).
+						AddRow("o1", "s1", xytmodel.OrderStatePending, 0, time.Now().Add(-time.Hour)))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE `schedule` SET `registered`=registered - 1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().Release(gomock.Any(), "s1", "").Return(nil)
+				return c
+			},
+			wantCancelled: 1,
+		},
+		{
+			// 下单时间早于支付时限, 但确认时限还没到, 查询条件不会选中
+			name: "候补递补的订单还在确认时限内",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expireQuery).
+					WithArgs(xytmodel.OrderStatePending, sqlmock.AnyArg(), sqlmock.AnyArg(), orderExpireBatch).
+					WillReturnRows(sqlmock.NewRows([]string{"order_id", "sche_id", "state", "confirm_deadline", "created_at"}))
+			},
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				return cachemocks.NewMockInventoryCache(ctrl)
+			},
+		},
+		{
+			name: "用户刚好支付了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(expireQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"order_id", "sche_id", "state", "confirm_deadline", "created_at"}).
+						AddRow("o1", "s1", xytmodel.OrderStatePending, 0, time.Now().Add(-time.Hour)))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				return cachemocks.NewMockInventoryCache(ctrl)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db := newQueueTestDB(t, sqlDB)
+			orderSvc := newTestOrderService(db)
+			e := NewOrderExpirer(db, orderSvc, NewOrderBooker(db, tc.cache(ctrl), orderSvc), timeout)
+
+			cancelled, err := e.Expire(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantCancelled, cancelled)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
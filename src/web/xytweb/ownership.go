@@ -0,0 +1,34 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+)
+
+// 访问其他用户的资源和资源不存在一样返回 404, 不暴露资源是否存在
+
+// FindUserOrder 查询属于 userId 的订单
+func FindUserOrder(ctx context.Context, db *gorm.DB, userId, orderId string) (xytmodel.RegisterOrder, error) {
+	return dao.NewOrderDAO(db).FindById(ctx, userId, orderId)
+}
+
+// FindUserPatient 查询属于 userId 的就诊人
+func FindUserPatient(ctx context.Context, db *gorm.DB, userId, patientId string) (xytmodel.Patient, error) {
+	return dao.NewPatientDAO(db).FindById(ctx, userId, patientId)
+}
+
+// abortFindErr 把 FindUserXxx 的错误写入响应
+func abortFindErr(ctx *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ErrInternalServer)
+}
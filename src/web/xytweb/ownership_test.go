@@ -0,0 +1,168 @@
+package xytweb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/repository/cache"
+	cachemocks "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 其他用户的订单和就诊人对当前用户来说都是不存在的
+func TestOwnership_CrossUser(t *testing.T) {
+	const userId = "u1"
+	testCases := []struct {
+		name       string
+		mock       func(t *testing.T) *sql.DB
+		reqBuilder func(t *testing.T) *http.Request
+
+		wantBody app.ResponseType
+	}{
+		{
+			name: "查看其他用户的订单",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = \\? and user_id = \\?").
+					WithArgs("o2", userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "/xyt/hos/order?orderId=o2", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantBody: *app.ErrNotFound,
+		},
+		{
+			name: "取消其他用户的订单",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = \\? and user_id = \\?").
+					WithArgs("o2", userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				return jsonRequest(t, "/xyt/hos/cancel/order", `{"orderId":"o2"}`)
+			},
+			wantBody: *app.ErrNotFound,
+		},
+		{
+			name: "为其他用户的就诊人预约",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient` WHERE id = \\? and user_id = \\?").
+					WithArgs("p2", userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				return jsonRequest(t, "/xyt/hos/add/order", `{"patientId":"p2","scheId":"s1"}`)
+			},
+			wantBody: *app.ErrNotFound,
+		},
+		{
+			name: "删除其他用户的就诊人",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient` WHERE id = \\? and user_id = \\?").
+					WithArgs("p2", userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				return jsonRequest(t, "/xyt/user/delete/patient", `{"patientId":"p2"}`)
+			},
+			wantBody: *app.ErrNotFound,
+		},
+		{
+			name: "修改其他用户的就诊人",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient` WHERE id = \\? and user_id = \\?").
+					WithArgs("p2", userId, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			reqBuilder: func(t *testing.T) *http.Request {
+				return jsonRequest(t, "/xyt/user/update/patient", `{"id":"p2","name":"张三","addressSelected":["11","1101","110101"]}`)
+			},
+			wantBody: *app.ErrNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				ctx.Set(config.USER_ID, userId)
+			})
+			hospitalCtrl, userCtrl := newTestHandlers(t, db)
+			group := server.Group("/xyt")
+			hospitalCtrl.RegisterRoutes(group)
+			userCtrl.RegisterRoutes(group)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, tc.reqBuilder(t))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var respBody app.ResponseType
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &respBody))
+			assert.Equal(t, tc.wantBody, respBody)
+		})
+	}
+}
+
+func jsonRequest(t *testing.T, url, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// newTestHandlers 和 InitRouters 一样在 db 上组装 service, redis 里没有落库中的订单
+func newTestHandlers(t *testing.T, db *gorm.DB) (*XytHospitalHandler, *XytUserHandler) {
+	inventory := cachemocks.NewMockInventoryCache(gomock.NewController(t))
+	inventory.EXPECT().BookingStatus(gomock.Any(), gomock.Any(), gomock.Any()).Return("", cache.ErrKeyNotExist).AnyTimes()
+	hospitalRepo := repository.NewHospitalRepository(dao.NewHospitalDAO(db))
+	patientRepo := repository.NewPatientRepository(dao.NewPatientDAO(db))
+	scheduleRepo := repository.NewScheduleRepository(dao.NewScheduleDAO(db))
+	scheduleSvc := service.NewScheduleService(scheduleRepo, hospitalRepo)
+	pricingSvc := service.NewPricingService(repository.NewPricingRepository(dao.NewPricingDAO(db)), scheduleRepo)
+	orderSvc := service.NewOrderService(repository.NewOrderRepository(dao.NewOrderDAO(db)), patientRepo, scheduleSvc, pricingSvc)
+	hospitalCtrl := NewXytHospitalHandler(service.NewHospitalService(hospitalRepo), scheduleSvc, orderSvc, pricingSvc,
+		NewOrderBooker(db, inventory, orderSvc), nil, nil)
+	userCtrl := NewXytUserlHandler(nil, db, service.NewPatientService(patientRepo, 5), orderSvc)
+	return hospitalCtrl, userCtrl
+}
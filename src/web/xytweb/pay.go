@@ -0,0 +1,188 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type XytPayHandler struct {
+	db     *gorm.DB
+	paySvc payment.Service
+}
+
+func NewXytPayHandler(db *gorm.DB, paySvc payment.Service) *XytPayHandler {
+	return &XytPayHandler{
+		db:     db,
+		paySvc: paySvc,
+	}
+}
+
+func (xh *XytPayHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.POST("/hos/order/pay", xh.payOrder)
+	// 支付渠道的异步通知, 不需要登录
+	group.POST("/pay/notify", xh.payNotify)
+}
+
+type payOrderReq struct {
+	OrderId string `json:"orderId"`
+}
+
+func (xh *XytPayHandler) payOrder(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+
+	var req payOrderReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	order, err := FindUserOrder(ctx, xh.db, userid.(string), req.OrderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if order.State != xytmodel.OrderStatePending {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, app.ErrOrderTransition.Error()))
+		return
+	}
+
+	pay, err := xh.paySvc.Create(ctx, payment.CreateRequest{
+		OutTradeNo:  order.OrderId,
+		Amount:      orderAmountInFen(order),
+		Description: fmt.Sprintf("%s-%s-%s 挂号费", order.HosName, order.DeptName, order.DocName),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	err = xh.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"trade_no", "updated_at"}),
+	}).Create(&xytmodel.OrderPayment{
+		OrderId:  order.OrderId,
+		Provider: xh.paySvc.Name(),
+		TradeNo:  pay.TradeNo,
+		Amount:   pay.Amount,
+		Status:   payment.StatusPending,
+	}).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(pay))
+}
+
+func (xh *XytPayHandler) payNotify(ctx *gin.Context) {
+	notify, err := xh.paySvc.VerifyNotify(ctx, ctx.Request)
+	if err != nil {
+		log.Println("verify pay notify:", err)
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if notify.Status != payment.StatusSuccess {
+		ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+		return
+	}
+
+	err = ConfirmOrderPaid(ctx, xh.db, xh.paySvc, notify)
+	if err != nil {
+		log.Printf("confirm order %s paid: %v", notify.OutTradeNo, err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+			return
+		}
+		// 返回失败让渠道重试通知
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+// ConfirmOrderPaid 处理验签后的支付成功通知, 重复的通知只会让订单变为已支付一次
+// 订单已经因为超时被取消时, 原路退回这笔支付
+func ConfirmOrderPaid(ctx context.Context, db *gorm.DB, paySvc payment.Service, notify payment.Notify) error {
+	var order xytmodel.RegisterOrder
+	err := db.WithContext(ctx).Table(xytmodel.TableOrder).Where("order_id = ?", notify.OutTradeNo).Take(&order).Error
+	if err != nil {
+		return err
+	}
+	if notify.Amount != orderAmountInFen(order) {
+		return app.ErrPayAmountMismatch
+	}
+
+	paidAt := time.Now().UnixMilli()
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := dao.NewOrderDAO(tx).Transit(ctx, order.OrderId, xytmodel.OrderStatePending, xytmodel.OrderStatePaid, paySvc.Name(), "支付成功")
+		if err != nil {
+			return err
+		}
+		return savePayment(tx, paySvc.Name(), notify, payment.StatusSuccess, paidAt)
+	})
+	if !errors.Is(err, app.ErrOrderStateChanged) {
+		return err
+	}
+
+	// 订单已经不是待支付了, 看一下是重复通知还是需要退款
+	err = db.WithContext(ctx).Table(xytmodel.TableOrder).Where("order_id = ?", order.OrderId).Take(&order).Error
+	if err != nil {
+		return err
+	}
+	if order.State != xytmodel.OrderStateCancelled {
+		return nil
+	}
+	var paid xytmodel.OrderPayment
+	err = db.WithContext(ctx).Table(xytmodel.TableOrderPayment).Where("order_id = ?", order.OrderId).Take(&paid).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if paid.Status == payment.StatusRefunded {
+		return nil
+	}
+	_, err = paySvc.Refund(ctx, payment.RefundRequest{
+		OutTradeNo:  notify.OutTradeNo,
+		OutRefundNo: notify.OutTradeNo,
+		Amount:      notify.Amount,
+		Reason:      "订单已取消",
+	})
+	if err != nil {
+		return err
+	}
+	return savePayment(db.WithContext(ctx), paySvc.Name(), notify, payment.StatusRefunded, paidAt)
+}
+
+func savePayment(db *gorm.DB, provider string, notify payment.Notify, status string, paidAt int64) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"trade_no", "status", "paid_at", "updated_at"}),
+	}).Create(&xytmodel.OrderPayment{
+		OrderId:  notify.OutTradeNo,
+		Provider: provider,
+		TradeNo:  notify.TradeNo,
+		Amount:   notify.Amount,
+		Status:   status,
+		PaidAt:   paidAt,
+	}).Error
+}
+
+// 订单金额以元为单位, 支付渠道以分为单位
+func orderAmountInFen(order xytmodel.RegisterOrder) int64 {
+	return int64(order.Amount) * 100
+}
@@ -0,0 +1,70 @@
+package xytweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/service/payment/localpay"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 渠道重复推送同一条支付成功通知, 订单只会从待支付变为已支付一次
+func TestXytPayHandler_RepeatedNotify(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+
+	orderRows := func(state int8) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"order_id", "sche_id", "amount", "state"}).
+			AddRow("123", "456", 10, state)
+	}
+	// 第一次通知: 待支付 -> 已支付
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = .*").WillReturnRows(orderRows(0))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `register_order_payment` .* ON DUPLICATE KEY UPDATE .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// 第二次通知: 订单已经是已支付, 不再变更
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = .*").WillReturnRows(orderRows(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE order_id = .*").WillReturnRows(orderRows(1))
+
+	paySvc := localpay.NewService("secret")
+	_, err = paySvc.Create(t.Context(), payment.CreateRequest{OutTradeNo: "123", Amount: 1000})
+	require.NoError(t, err)
+
+	server := gin.Default()
+	NewXytPayHandler(db, paySvc).RegisterRoutes(server.Group("/xyt"))
+
+	for i := 0; i < 2; i++ {
+		req, err := paySvc.Pay("123", "/xyt/pay/notify")
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var body app.ResponseType
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, app.ResponseOK(nil), body)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
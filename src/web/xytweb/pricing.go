@@ -0,0 +1,153 @@
+package xytweb
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+)
+
+// XytPricingHandler 预约前查看挂号费, 管理员配置医院的挂号类型和挂号费
+type XytPricingHandler struct {
+	pricing   service.PricingService
+	schedules service.ScheduleService
+	patients  service.PatientService
+}
+
+func NewXytPricingHandler(pricing service.PricingService, schedules service.ScheduleService, patients service.PatientService) *XytPricingHandler {
+	return &XytPricingHandler{
+		pricing:   pricing,
+		schedules: schedules,
+		patients:  patients,
+	}
+}
+
+func (xh *XytPricingHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/hos/order/price", xh.quote)
+}
+
+func (xh *XytPricingHandler) RegisterAdminRoutes(group *gin.RouterGroup) {
+	pg := group.Group("/pricing")
+	pg.GET("/types", xh.listTypes)
+	pg.POST("/type", xh.saveType)
+	pg.GET("/fees", xh.listFees)
+	pg.POST("/fee", xh.saveFee)
+	pg.POST("/fee/delete", xh.deleteFee)
+}
+
+// quote 按就诊人计算医保报销后的挂号费, 没有指定就诊人时使用默认就诊人
+func (xh *XytPricingHandler) quote(ctx *gin.Context) {
+	userid := ctx.GetString(config.USER_ID)
+	detail, err := xh.schedules.Detail(ctx, ctx.Query("scheId"))
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	var patient xytmodel.Patient
+	if patientId := ctx.Query("patientId"); patientId != "" {
+		patient, err = xh.patients.Find(ctx, userid, patientId)
+	} else {
+		patient, err = xh.patients.Default(ctx, userid)
+	}
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	price, err := xh.pricing.Quote(ctx, detail, &patient)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(price))
+}
+
+func (xh *XytPricingHandler) listTypes(ctx *gin.Context) {
+	hosId := ctx.Query("hosId")
+	if hosId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	types, err := xh.pricing.Types(ctx, hosId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(types))
+}
+
+// saveType id 为 0 时新增, 否则修改
+func (xh *XytPricingHandler) saveType(ctx *gin.Context) {
+	var t xytmodel.RegistrationType
+	if err := ctx.Bind(&t); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if t.HosId == "" || t.Name == "" || t.Fee < 0 || t.InsuranceCover < 0 {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	t, err := xh.pricing.SaveType(ctx, t)
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(t))
+}
+
+func (xh *XytPricingHandler) listFees(ctx *gin.Context) {
+	regTypeId, err := strconv.ParseUint(ctx.Query("regTypeId"), 10, 64)
+	if err != nil || ctx.Query("hosId") == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	fees, err := xh.pricing.Fees(ctx, ctx.Query("hosId"), uint(regTypeId))
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(fees))
+}
+
+// saveFee 按医生或按职称配置挂号费, 两者至少填一个
+func (xh *XytPricingHandler) saveFee(ctx *gin.Context) {
+	var fee xytmodel.RegistrationFee
+	if err := ctx.Bind(&fee); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	fee.Rank = strings.TrimSpace(fee.Rank)
+	if fee.HosId == "" || fee.RegTypeId == 0 || fee.Rank == "" && fee.DocId == "" || fee.Fee < 0 {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	fee, err := xh.pricing.SaveFee(ctx, fee)
+	if err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(fee))
+}
+
+type deleteFeeReq struct {
+	HosId string `json:"hosId"`
+	Id    uint   `json:"id"`
+}
+
+func (xh *XytPricingHandler) deleteFee(ctx *gin.Context) {
+	var req deleteFeeReq
+	if err := ctx.Bind(&req); err != nil || req.HosId == "" || req.Id == 0 {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if err := xh.pricing.DeleteFee(ctx, req.HosId, req.Id); err != nil {
+		adminErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
@@ -0,0 +1,724 @@
+package xytweb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/hllmodel"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// 就诊时间结束后还可以签到的时间, 超过后标记为爽约
+	defaultCheckinGrace = 30 * time.Minute
+	noShowInterval      = time.Minute
+	noShowBatch         = 100
+	// 患者端实时排队位置的刷新间隔
+	queuePollInterval = 3 * time.Second
+)
+
+// 排队中的订单状态, 患者端可以查看前面还有几人
+var queueingStates = []int8{xytmodel.OrderStatePaid, xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling}
+
+// VisitQueue 就诊当天的签到和叫号
+// 已支付的订单签到后进入排班的候诊队列, 按号序叫号, 过号的就诊人排到没有过号的后面
+type VisitQueue struct {
+	db     *gorm.DB
+	secret []byte
+	grace  time.Duration
+}
+
+func NewVisitQueue(db *gorm.DB, secret string, grace time.Duration) *VisitQueue {
+	if grace <= 0 {
+		grace = defaultCheckinGrace
+	}
+	return &VisitQueue{
+		db:     db,
+		secret: []byte(secret),
+		grace:  grace,
+	}
+}
+
+// VisitEndTime 解析订单的就诊结束时间, 优先使用分配的号段 "2024-06-18 08:20-08:30",
+// 没有号段的旧订单使用时段的结束时间
+func VisitEndTime(order xytmodel.RegisterOrder) (time.Time, error) {
+	const layout = "2006-01-02 15:04"
+	if date, period, ok := strings.Cut(order.VisitPeriod, " "); ok {
+		if _, end, ok := strings.Cut(period, "-"); ok {
+			return time.ParseInLocation(layout, date+" "+end, time.Local)
+		}
+	}
+	date, slot, ok := strings.Cut(order.VisitTime, " ")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid visit time: %s", order.VisitTime)
+	}
+	end, ok := service.TimeSlotEnd[slot]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time slot: %s", slot)
+	}
+	return time.ParseInLocation(layout, date+" "+end, time.Local)
+}
+
+// CheckinDeadline 签到截止时间, 超过后订单会被标记为爽约
+func (q *VisitQueue) CheckinDeadline(order xytmodel.RegisterOrder) (time.Time, error) {
+	end, err := VisitEndTime(order)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return end.Add(q.grace), nil
+}
+
+// CheckIn 就诊当天签到, 已经签到的订单直接返回
+func (q *VisitQueue) CheckIn(ctx context.Context, order xytmodel.RegisterOrder, actor string) error {
+	switch order.State {
+	case xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling:
+		return nil
+	case xytmodel.OrderStatePaid:
+	default:
+		return app.ErrOrderTransition
+	}
+	start, err := VisitStartTime(order)
+	if err != nil {
+		return err
+	}
+	deadline, err := q.CheckinDeadline(order)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch {
+	case now.Before(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())):
+		return app.ErrCheckinNotOpen
+	case now.After(deadline):
+		return app.ErrCheckinClosed
+	}
+	return q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := dao.NewOrderDAO(tx).Transit(ctx, order.OrderId, xytmodel.OrderStatePaid, xytmodel.OrderStateCheckedIn, actor, "签到")
+		if err != nil {
+			return err
+		}
+		return tx.Table(xytmodel.TableOrder).Where("order_id = ?", order.OrderId).
+			Update("checkin_at", now.UnixMilli()).Error
+	})
+}
+
+// CheckinToken 生成签到二维码的内容 "订单号.过期时间.签名", 签到截止前有效
+func (q *VisitQueue) CheckinToken(order xytmodel.RegisterOrder) (string, time.Time, error) {
+	if order.State != xytmodel.OrderStatePaid {
+		return "", time.Time{}, app.ErrOrderTransition
+	}
+	deadline, err := q.CheckinDeadline(order)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload := order.OrderId + "." + strconv.FormatInt(deadline.Unix(), 10)
+	return payload + "." + q.sign(payload), deadline, nil
+}
+
+// CheckInByToken 工作站扫描签到二维码签到, 返回签到后的订单; docId 不为空时只能签到这个医生的订单
+func (q *VisitQueue) CheckInByToken(ctx context.Context, token, docId, actor string) (xytmodel.RegisterOrder, error) {
+	orderId, err := q.parseToken(token)
+	if err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+	order, err := findOrder(q.db.WithContext(ctx), orderId)
+	if err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+	if docId != "" && order.DocId != docId {
+		return xytmodel.RegisterOrder{}, app.ErrStationScope
+	}
+	if err = q.CheckIn(ctx, order, actor); err != nil {
+		return xytmodel.RegisterOrder{}, err
+	}
+	return findOrder(q.db.WithContext(ctx), orderId)
+}
+
+func (q *VisitQueue) sign(payload string) string {
+	mac := hmac.New(sha256.New, q.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (q *VisitQueue) parseToken(token string) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", app.ErrCheckinToken
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(q.sign(payload))) {
+		return "", app.ErrCheckinToken
+	}
+	orderId, exp, _ := strings.Cut(payload, ".")
+	expiresAt, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", app.ErrCheckinToken
+	}
+	return orderId, nil
+}
+
+// QueueEntry 候诊队列中的一个就诊人
+type QueueEntry struct {
+	OrderId     string `json:"orderId"`
+	SeqNo       int    `json:"seqNo"`
+	PatientName string `json:"patientName"`
+	VisitPeriod string `json:"visitPeriod"`
+	SkipCount   int    `json:"skipCount"`
+	CheckinAt   int64  `json:"checkinAt"`
+	State       int8   `json:"state"`
+}
+
+func toQueueEntry(order xytmodel.RegisterOrder) QueueEntry {
+	return QueueEntry{
+		OrderId:     order.OrderId,
+		SeqNo:       order.SeqNo,
+		PatientName: order.PatientName,
+		VisitPeriod: order.VisitPeriod,
+		SkipCount:   order.SkipCount,
+		CheckinAt:   order.CheckinAt,
+		State:       order.State,
+	}
+}
+
+// ScheduleQueue 医生一个出诊时段的队列
+type ScheduleQueue struct {
+	ScheId    string       `json:"scheId"`
+	Calling   *QueueEntry  `json:"calling"`
+	Waiting   []QueueEntry `json:"waiting"`   // 按叫号顺序排列
+	Unchecked int64        `json:"unchecked"` // 已支付还没有签到的人数
+}
+
+func (q *VisitQueue) Queue(ctx context.Context, scheId string) (ScheduleQueue, error) {
+	var result = ScheduleQueue{ScheId: scheId, Waiting: []QueueEntry{}}
+	var orders []xytmodel.RegisterOrder
+	err := q.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("sche_id = ? and state in ?", scheId, []int8{xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling}).
+		Order("skip_count, seq_no").Find(&orders).Error
+	if err != nil {
+		return result, err
+	}
+	for _, order := range orders {
+		entry := toQueueEntry(order)
+		if order.State == xytmodel.OrderStateCalling {
+			result.Calling = &entry
+			continue
+		}
+		result.Waiting = append(result.Waiting, entry)
+	}
+	err = q.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("sche_id = ? and state = ?", scheId, xytmodel.OrderStatePaid).
+		Count(&result.Unchecked).Error
+	return result, err
+}
+
+// CallNext 叫下一位候诊的就诊人, 上一位还在就诊时需要先完成或过号; docId 不为空时只能叫这个医生的排班
+func (q *VisitQueue) CallNext(ctx context.Context, scheId, docId, actor string) (QueueEntry, error) {
+	var next xytmodel.RegisterOrder
+	err := q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住排班, 同一诊室重复点击叫号时串行执行
+		var schedule xytmodel.Schedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table(xytmodel.TableSchedule).
+			Select("sche_id", "doc_id").Where("sche_id = ?", scheId).Take(&schedule).Error
+		if err != nil {
+			return err
+		}
+		if docId != "" && schedule.DocId != docId {
+			return app.ErrStationScope
+		}
+		var calling int64
+		err = tx.Table(xytmodel.TableOrder).
+			Where("sche_id = ? and state = ?", scheId, xytmodel.OrderStateCalling).Count(&calling).Error
+		if err != nil {
+			return err
+		}
+		if calling > 0 {
+			return app.ErrQueueCalling
+		}
+		err = tx.Table(xytmodel.TableOrder).
+			Where("sche_id = ? and state = ?", scheId, xytmodel.OrderStateCheckedIn).
+			Order("skip_count, seq_no").Take(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return app.ErrQueueEmpty
+		}
+		if err != nil {
+			return err
+		}
+		return dao.NewOrderDAO(tx).Transit(ctx, next.OrderId, xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling, actor, "叫号")
+	})
+	if err != nil {
+		return QueueEntry{}, err
+	}
+	next.State = xytmodel.OrderStateCalling
+	return toQueueEntry(next), nil
+}
+
+// Skip 叫号后就诊人没有到诊室, 回到候诊队列排在没有过号的就诊人后面
+func (q *VisitQueue) Skip(ctx context.Context, order xytmodel.RegisterOrder, actor string) error {
+	return q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := dao.NewOrderDAO(tx).Transit(ctx, order.OrderId, xytmodel.OrderStateCalling, xytmodel.OrderStateCheckedIn, actor, "过号")
+		if err != nil {
+			return err
+		}
+		return tx.Table(xytmodel.TableOrder).Where("order_id = ?", order.OrderId).
+			Update("skip_count", gorm.Expr("skip_count + 1")).Error
+	})
+}
+
+func (q *VisitQueue) Complete(ctx context.Context, order xytmodel.RegisterOrder, actor string) error {
+	return q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dao.NewOrderDAO(tx).Transit(ctx, order.OrderId, xytmodel.OrderStateCalling, xytmodel.OrderStateCompleted, actor, "就诊完成")
+	})
+}
+
+// QueuePosition 患者端看到的排队情况
+type QueuePosition struct {
+	OrderId      string `json:"orderId"`
+	State        int8   `json:"state"`
+	SeqNo        int    `json:"seqNo"`
+	Ahead        int64  `json:"ahead"`        // 前面还有几人, 只对已支付和候诊中的订单有效
+	CallingSeqNo int    `json:"callingSeqNo"` // 正在就诊的号序, 0 表示没有人在就诊
+}
+
+// Position 没有签到的订单按号序计算, 签到后就会排在前面还没到的人之前
+func (q *VisitQueue) Position(ctx context.Context, orderId string) (QueuePosition, error) {
+	order, err := findOrder(q.db.WithContext(ctx), orderId)
+	if err != nil {
+		return QueuePosition{}, err
+	}
+	var pos = QueuePosition{
+		OrderId: order.OrderId,
+		State:   order.State,
+		SeqNo:   order.SeqNo,
+	}
+	var calling xytmodel.RegisterOrder
+	err = q.db.WithContext(ctx).Table(xytmodel.TableOrder).Select("seq_no").
+		Where("sche_id = ? and state = ?", order.ScheId, xytmodel.OrderStateCalling).Take(&calling).Error
+	switch {
+	case err == nil:
+		pos.CallingSeqNo = calling.SeqNo
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return pos, err
+	}
+	if order.State != xytmodel.OrderStatePaid && order.State != xytmodel.OrderStateCheckedIn {
+		return pos, nil
+	}
+	err = q.db.WithContext(ctx).Table(xytmodel.TableOrder).
+		Where("sche_id = ? and state in ?", order.ScheId, []int8{xytmodel.OrderStateCheckedIn, xytmodel.OrderStateCalling}).
+		Where("state = ? or skip_count < ? or (skip_count = ? and seq_no < ?)",
+			xytmodel.OrderStateCalling, order.SkipCount, order.SkipCount, order.SeqNo).
+		Count(&pos.Ahead).Error
+	return pos, err
+}
+
+func (q *VisitQueue) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(noShowInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				marked, err := q.MarkNoShows(ctx)
+				if err != nil {
+					log.Println("mark no-shows:", err)
+					continue
+				}
+				if marked > 0 {
+					log.Printf("mark no-shows: marked %d orders", marked)
+				}
+			}
+		}
+	}()
+}
+
+// MarkNoShows 把超过签到截止时间仍未签到的已支付订单标记为爽约, 返回标记的数量
+func (q *VisitQueue) MarkNoShows(ctx context.Context) (int, error) {
+	// 就诊日期在明天之前的才可能已经过了截止时间
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	var marked, lastId = 0, 0
+	for {
+		var orders []xytmodel.RegisterOrder
+		err := q.db.WithContext(ctx).Table(xytmodel.TableOrder).
+			Where("state = ? and visit_time < ? and id > ?", xytmodel.OrderStatePaid, tomorrow, lastId).
+			Order("id").Limit(noShowBatch).Find(&orders).Error
+		if err != nil {
+			return marked, err
+		}
+		for _, order := range orders {
+			deadline, err := q.CheckinDeadline(order)
+			if err != nil {
+				log.Printf("mark no-shows: order %s: %v", order.OrderId, err)
+				continue
+			}
+			if time.Now().Before(deadline) {
+				continue
+			}
+			err = q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return dao.NewOrderDAO(tx).Transit(ctx, order.OrderId, xytmodel.OrderStatePaid, xytmodel.OrderStateNoShow,
+					xytmodel.OrderActorSystem, "超过就诊时间未签到")
+			})
+			if err != nil {
+				// 用户刚好在这期间签到或退号了
+				if errors.Is(err, app.ErrOrderStateChanged) {
+					continue
+				}
+				return marked, err
+			}
+			marked++
+		}
+		if len(orders) < noShowBatch {
+			return marked, nil
+		}
+		lastId = orders[len(orders)-1].Id
+	}
+}
+
+func findOrder(db *gorm.DB, orderId string) (xytmodel.RegisterOrder, error) {
+	var order xytmodel.RegisterOrder
+	err := db.Table(xytmodel.TableOrder).Where("order_id = ?", orderId).Take(&order).Error
+	return order, err
+}
+
+// XytQueueHandler 患者签到和查看排队, 以及诊室工作站叫号
+type XytQueueHandler struct {
+	queue  *VisitQueue
+	orders service.OrderService
+}
+
+func NewXytQueueHandler(queue *VisitQueue, orders service.OrderService) *XytQueueHandler {
+	return &XytQueueHandler{
+		queue:  queue,
+		orders: orders,
+	}
+}
+
+func (xh *XytQueueHandler) RegisterRoutes(group *gin.RouterGroup) {
+	og := group.Group("/hos/order")
+	og.POST("/checkin", xh.checkin)
+	og.GET("/checkin/code", xh.checkinCode)
+	og.GET("/queue", xh.position)
+	og.GET("/queue/stream", xh.streamPosition)
+}
+
+// RegisterStationRoutes group 为诊室工作站可以访问的路由组
+func (xh *XytQueueHandler) RegisterStationRoutes(group *gin.RouterGroup) {
+	group.GET("/queue", xh.scheduleQueue)
+	group.POST("/checkin", xh.stationCheckin)
+	group.POST("/call", xh.callNext)
+	group.POST("/skip", xh.skip)
+	group.POST("/complete", xh.complete)
+}
+
+type queueOrderReq struct {
+	OrderId string `json:"orderId"`
+}
+
+func (xh *XytQueueHandler) checkin(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req queueOrderReq
+	if err := ctx.Bind(&req); err != nil || req.OrderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	order, err := xh.orders.Find(ctx, userid.(string), req.OrderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if err = xh.queue.CheckIn(ctx, order, userid.(string)); err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	pos, err := xh.queue.Position(ctx, order.OrderId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(pos))
+}
+
+type CheckinCode struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"` // 毫秒
+}
+
+// checkinCode 返回签到二维码的内容, 由前端生成二维码在诊室或自助机扫码签到
+func (xh *XytQueueHandler) checkinCode(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	orderId := ctx.Query("orderId")
+	if orderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	order, err := xh.orders.Find(ctx, userid.(string), orderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	token, expiresAt, err := xh.queue.CheckinToken(order)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(CheckinCode{Token: token, ExpiresAt: expiresAt.UnixMilli()}))
+}
+
+func (xh *XytQueueHandler) position(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	orderId := ctx.Query("orderId")
+	if orderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	if _, err := xh.orders.Find(ctx, userid.(string), orderId); err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	pos, err := xh.queue.Position(ctx, orderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(pos))
+}
+
+// streamPosition 用 SSE 推送排队情况, 有变化时推送 position 事件, 离开队列后结束
+func (xh *XytQueueHandler) streamPosition(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	orderId := ctx.Query("orderId")
+	if orderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	if _, err := xh.orders.Find(ctx, userid.(string), orderId); err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	var last *QueuePosition
+	ctx.Stream(func(w io.Writer) bool {
+		pos, err := xh.queue.Position(ctx.Request.Context(), orderId)
+		if err != nil {
+			ctx.SSEvent("error", app.ErrInternalServer.Msg)
+			return false
+		}
+		if last == nil || *last != pos {
+			ctx.SSEvent("position", pos)
+			last = &pos
+		}
+		if !isQueueing(pos.State) {
+			return false
+		}
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+}
+
+// findStationDoctor 工作站登录用户绑定的医生, 管理员不限制返回空字符串,
+// 没有绑定医生的医生账号不能操作任何排班
+func findStationDoctor(db *gorm.DB, userId string) (string, error) {
+	var user hllmodel.HllUser
+	err := db.Table(hllmodel.TableHllUser).Select("role", "doc_id").Where("user_id = ?", userId).Take(&user).Error
+	if err != nil {
+		return "", err
+	}
+	if user.Role == hllmodel.RoleAdmin {
+		return "", nil
+	}
+	if user.DocId == "" {
+		return "", app.ErrStationScope
+	}
+	return user.DocId, nil
+}
+
+// checkScheduleDoctor docId 不为空时排班必须是这个医生出诊的
+func checkScheduleDoctor(db *gorm.DB, scheId, docId string) error {
+	if docId == "" {
+		return nil
+	}
+	var schedule xytmodel.Schedule
+	err := db.Table(xytmodel.TableSchedule).Select("doc_id").Where("sche_id = ?", scheId).Take(&schedule).Error
+	if err != nil {
+		return err
+	}
+	if schedule.DocId != docId {
+		return app.ErrStationScope
+	}
+	return nil
+}
+
+func isQueueing(state int8) bool {
+	for _, s := range queueingStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (xh *XytQueueHandler) scheduleQueue(ctx *gin.Context) {
+	scheId := ctx.Query("scheId")
+	if scheId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequestQuery)
+		return
+	}
+	docId, err := findStationDoctor(xh.queue.db.WithContext(ctx), ctx.GetString(config.USER_ID))
+	if err == nil {
+		err = checkScheduleDoctor(xh.queue.db.WithContext(ctx), scheId, docId)
+	}
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	queue, err := xh.queue.Queue(ctx, scheId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(queue))
+}
+
+type stationCheckinReq struct {
+	Token string `json:"token"`
+}
+
+func (xh *XytQueueHandler) stationCheckin(ctx *gin.Context) {
+	var req stationCheckinReq
+	if err := ctx.Bind(&req); err != nil || req.Token == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	userId := ctx.GetString(config.USER_ID)
+	docId, err := findStationDoctor(xh.queue.db.WithContext(ctx), userId)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	order, err := xh.queue.CheckInByToken(ctx, req.Token, docId, userId)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(toQueueEntry(order)))
+}
+
+type callNextReq struct {
+	ScheId string `json:"scheId"`
+}
+
+func (xh *XytQueueHandler) callNext(ctx *gin.Context) {
+	var req callNextReq
+	if err := ctx.Bind(&req); err != nil || req.ScheId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	userId := ctx.GetString(config.USER_ID)
+	docId, err := findStationDoctor(xh.queue.db.WithContext(ctx), userId)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	entry, err := xh.queue.CallNext(ctx, req.ScheId, docId, userId)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(entry))
+}
+
+func (xh *XytQueueHandler) skip(ctx *gin.Context) {
+	xh.finishCalling(ctx, xh.queue.Skip)
+}
+
+func (xh *XytQueueHandler) complete(ctx *gin.Context) {
+	xh.finishCalling(ctx, xh.queue.Complete)
+}
+
+// finishCalling 结束当前叫号的就诊人, 过号或者完成就诊
+func (xh *XytQueueHandler) finishCalling(ctx *gin.Context, finish func(context.Context, xytmodel.RegisterOrder, string) error) {
+	var req queueOrderReq
+	if err := ctx.Bind(&req); err != nil || req.OrderId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	userId := ctx.GetString(config.USER_ID)
+	docId, err := findStationDoctor(xh.queue.db.WithContext(ctx), userId)
+	if err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	order, err := findOrder(xh.queue.db.WithContext(ctx), req.OrderId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+	if docId != "" && order.DocId != docId {
+		queueErr(ctx, app.ErrStationScope)
+		return
+	}
+	if order.State != xytmodel.OrderStateCalling {
+		queueErr(ctx, app.ErrOrderTransition)
+		return
+	}
+	if err = finish(ctx, order, userId); err != nil {
+		queueErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func queueErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+	case errors.Is(err, app.ErrCheckinToken):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrCheckinNotOpen), errors.Is(err, app.ErrCheckinClosed), errors.Is(err, app.ErrOrderTransition),
+		errors.Is(err, app.ErrStationScope):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, err.Error()))
+	case errors.Is(err, app.ErrOrderStateChanged), errors.Is(err, app.ErrQueueCalling), errors.Is(err, app.ErrQueueEmpty):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
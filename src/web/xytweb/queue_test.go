@@ -0,0 +1,325 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// visitOrder 就诊时间段为 now+from 到 now+to 的已支付订单
+func visitOrder(from, to time.Duration) xytmodel.RegisterOrder {
+	start, end := time.Now().Add(from), time.Now().Add(to)
+	return xytmodel.RegisterOrder{
+		OrderId:     "o1",
+		ScheId:      "s1",
+		State:       xytmodel.OrderStatePaid,
+		SeqNo:       3,
+		VisitTime:   start.Format(time.DateOnly) + " 上午",
+		VisitPeriod: start.Format("2006-01-02 15:04") + "-" + end.Format("15:04"),
+	}
+}
+
+func TestVisitEndTime(t *testing.T) {
+	testCases := []struct {
+		name  string
+		order xytmodel.RegisterOrder
+
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "使用号段的结束时间",
+			order: xytmodel.RegisterOrder{VisitTime: "2024-06-18 上午", VisitPeriod: "2024-06-18 08:20-08:30"},
+			want:  "2024-06-18 08:30",
+		},
+		{
+			name:  "没有号段的旧订单使用时段的结束时间",
+			order: xytmodel.RegisterOrder{VisitTime: "2024-06-18 下午"},
+			want:  "2024-06-18 17:30",
+		},
+		{
+			name:    "时段错误",
+			order:   xytmodel.RegisterOrder{VisitTime: "2024-06-18 凌晨"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			end, err := VisitEndTime(tc.order)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, end.Format("2006-01-02 15:04"))
+		})
+	}
+}
+
+func TestVisitQueue_CheckinToken(t *testing.T) {
+	q := NewVisitQueue(nil, "secret", time.Minute)
+	token, expiresAt, err := q.CheckinToken(visitOrder(time.Hour, 2*time.Hour))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour+time.Minute), expiresAt, time.Minute)
+
+	orderId, err := q.parseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "o1", orderId)
+
+	// 其他密钥签发的和篡改过的签到码都无效
+	_, err = NewVisitQueue(nil, "other", time.Minute).parseToken(token)
+	assert.ErrorIs(t, err, app.ErrCheckinToken)
+	_, err = q.parseToken(strings.Replace(token, "o1", "o2", 1))
+	assert.ErrorIs(t, err, app.ErrCheckinToken)
+
+	expired, _, err := q.CheckinToken(visitOrder(-3*time.Hour, -2*time.Hour))
+	require.NoError(t, err)
+	_, err = q.parseToken(expired)
+	assert.ErrorIs(t, err, app.ErrCheckinToken)
+
+	_, _, err = q.CheckinToken(xytmodel.RegisterOrder{OrderId: "o1", State: xytmodel.OrderStatePending})
+	assert.ErrorIs(t, err, app.ErrOrderTransition)
+}
+
+func TestVisitQueue_CheckIn(t *testing.T) {
+	testCases := []struct {
+		name  string
+		order xytmodel.RegisterOrder
+		mock  func(mock sqlmock.Sqlmock)
+
+		wantErr error
+	}{
+		{
+			name:  "签到成功",
+			order: visitOrder(time.Hour, 2*time.Hour),
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+					WithArgs(xytmodel.OrderStateCheckedIn, "o1", xytmodel.OrderStatePaid).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE `register_order` SET `checkin_at`=.*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:  "已经签到",
+			order: xytmodel.RegisterOrder{OrderId: "o1", State: xytmodel.OrderStateCheckedIn},
+			mock:  func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			name:    "还没到就诊日期",
+			order:   visitOrder(48*time.Hour, 49*time.Hour),
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: app.ErrCheckinNotOpen,
+		},
+		{
+			name:    "已过签到时间",
+			order:   visitOrder(-3*time.Hour, -2*time.Hour),
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: app.ErrCheckinClosed,
+		},
+		{
+			name:    "未支付的订单",
+			order:   xytmodel.RegisterOrder{OrderId: "o1", State: xytmodel.OrderStatePending},
+			mock:    func(mock sqlmock.Sqlmock) {},
+			wantErr: app.ErrOrderTransition,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			q := NewVisitQueue(newQueueTestDB(t, sqlDB), "secret", 30*time.Minute)
+
+			err = q.CheckIn(context.Background(), tc.order, "u1")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestVisitQueue_CallNext(t *testing.T) {
+	scheduleRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"sche_id", "doc_id"}).AddRow("s1", "d1")
+	}
+	countRows := func(n int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"count"}).AddRow(n)
+	}
+	testCases := []struct {
+		name  string
+		docId string
+		mock  func(mock sqlmock.Sqlmock)
+
+		wantErr   error
+		wantOrder string
+	}{
+		{
+			name:  "按过号次数和号序叫号",
+			docId: "d1",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `sche_id`,`doc_id` FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order`").WillReturnRows(countRows(0))
+				mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE sche_id = \\? and state = \\? ORDER BY skip_count, seq_no").
+					WithArgs("s1", xytmodel.OrderStateCheckedIn, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"order_id", "seq_no", "state"}).AddRow("o2", 2, xytmodel.OrderStateCheckedIn))
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+					WithArgs(xytmodel.OrderStateCalling, "o2", xytmodel.OrderStateCheckedIn).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantOrder: "o2",
+		},
+		{
+			name: "上一位还在就诊",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `sche_id`,`doc_id` FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order`").WillReturnRows(countRows(1))
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrQueueCalling,
+		},
+		{
+			name: "没有候诊的就诊人",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `sche_id`,`doc_id` FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `register_order`").WillReturnRows(countRows(0))
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrQueueEmpty,
+		},
+		{
+			name:  "不是自己出诊的排班",
+			docId: "d2",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT `sche_id`,`doc_id` FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectRollback()
+			},
+			wantErr: app.ErrStationScope,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			q := NewVisitQueue(newQueueTestDB(t, sqlDB), "secret", 0)
+
+			entry, err := q.CallNext(context.Background(), "s1", tc.docId, "doc")
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				assert.Equal(t, tc.wantOrder, entry.OrderId)
+				assert.Equal(t, xytmodel.OrderStateCalling, entry.State)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestVisitQueue_MarkNoShows(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	due, notDue := visitOrder(-3*time.Hour, -2*time.Hour), visitOrder(-time.Hour, time.Hour)
+	due.Id, due.OrderId = 1, "o1"
+	notDue.Id, notDue.OrderId = 2, "o2"
+	mock.ExpectQuery("SELECT \\* FROM `register_order` WHERE state = \\? and visit_time < \\? and id > \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "state", "visit_time", "visit_period"}).
+			AddRow(due.Id, due.OrderId, due.State, due.VisitTime, due.VisitPeriod).
+			AddRow(notDue.Id, notDue.OrderId, notDue.State, notDue.VisitTime, notDue.VisitPeriod))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").
+		WithArgs(xytmodel.OrderStateNoShow, "o1", xytmodel.OrderStatePaid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	q := NewVisitQueue(newQueueTestDB(t, sqlDB), "secret", 30*time.Minute)
+	marked, err := q.MarkNoShows(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, marked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindStationDoctor(t *testing.T) {
+	testCases := []struct {
+		name  string
+		role  string
+		docId string
+
+		wantDocId string
+		wantErr   error
+	}{
+		{name: "管理员不限制", role: "admin"},
+		{name: "绑定了医生的医生账号", role: "doctor", docId: "d1", wantDocId: "d1"},
+		{name: "没有绑定医生", role: "doctor", wantErr: app.ErrStationScope},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			mock.ExpectQuery("SELECT `role`,`doc_id` FROM `hll_user` WHERE user_id = \\?").
+				WithArgs("u1", 1).
+				WillReturnRows(sqlmock.NewRows([]string{"role", "doc_id"}).AddRow(tc.role, tc.docId))
+
+			docId, err := findStationDoctor(newQueueTestDB(t, sqlDB), "u1")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantDocId, docId)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOrderFilter(t *testing.T) {
+	checkedIn, noShow := xytmodel.OrderStateCheckedIn, xytmodel.OrderStateNoShow
+	testCases := []struct {
+		name  string
+		state string
+
+		wantState *int8
+	}{
+		{name: "已签到", state: "5", wantState: &checkedIn},
+		{name: "爽约", state: "7", wantState: &noShow},
+		{name: "不存在的状态", state: "8"},
+		{name: "不筛选", state: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/user/order/list?state="+tc.state, nil)
+			filter := orderFilter(ctx, "u1")
+			assert.Equal(t, "u1", filter.UserId)
+			assert.Equal(t, tc.wantState, filter.State)
+		})
+	}
+}
+
+func newQueueTestDB(t *testing.T, sqlDB *sql.DB) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return db
+}
@@ -0,0 +1,238 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/types/app"
+)
+
+// RefundPolicy 已支付订单的退号规则
+// 开诊前 FullBefore 以前退号全额退款, 之后到开诊前按 PartialPercent% 退款, 开诊后不能退号
+type RefundPolicy struct {
+	FullBefore     time.Duration
+	PartialPercent int
+}
+
+func DefaultRefundPolicy() RefundPolicy {
+	return RefundPolicy{
+		FullBefore:     24 * time.Hour,
+		PartialPercent: 50,
+	}
+}
+
+// RefundAmount 计算可以退回的金额, 单位和 paid 一致
+func (p RefundPolicy) RefundAmount(paid int64, visitStart, now time.Time) int64 {
+	switch {
+	case !now.Before(visitStart):
+		return 0
+	case visitStart.Sub(now) >= p.FullBefore:
+		return paid
+	default:
+		return paid * int64(p.PartialPercent) / 100
+	}
+}
+
+func (p RefundPolicy) String() string {
+	return fmt.Sprintf("开诊前%s以前退号全额退款, 之后退还%d%%, 开诊后不可退号", p.FullBefore, p.PartialPercent)
+}
+
+// VisitStartTime 解析订单的就诊开始时间, 优先使用分配的号段 "2024-06-18 08:20-08:30",
+// 没有号段的旧订单使用 VisitTime "2024-06-18 上午"
+func VisitStartTime(order xytmodel.RegisterOrder) (time.Time, error) {
+	const layout = "2006-01-02 15:04"
+	if len(order.VisitPeriod) > len(layout) {
+		return time.ParseInLocation(layout, order.VisitPeriod[:len(layout)], time.Local)
+	}
+	date, slot, ok := strings.Cut(order.VisitTime, " ")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid visit time: %s", order.VisitTime)
+	}
+	start, ok := service.TimeSlotStart[slot]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time slot: %s", slot)
+	}
+	return time.ParseInLocation(layout, date+" "+start, time.Local)
+}
+
+type RefundPreview struct {
+	OrderId      string `json:"orderId"`
+	PaidAmount   int64  `json:"paidAmount"`   // 单位: 分
+	RefundAmount int64  `json:"refundAmount"` // 单位: 分
+	Refundable   bool   `json:"refundable"`
+	Rule         string `json:"rule"`
+}
+
+const (
+	refundReconcileInterval = time.Minute
+	refundReconcileBatch    = 100
+	// 退款中超过这个时间的订单由对账任务向支付渠道查询退款结果
+	refundStaleAfter = 5 * time.Minute
+)
+
+// OrderRefunder 已支付订单的退号退款
+type OrderRefunder struct {
+	orders service.OrderService
+	paySvc payment.Service
+	booker *OrderBooker
+	policy RefundPolicy
+}
+
+func NewOrderRefunder(orders service.OrderService, paySvc payment.Service, booker *OrderBooker, policy RefundPolicy) *OrderRefunder {
+	return &OrderRefunder{
+		orders: orders,
+		paySvc: paySvc,
+		booker: booker,
+		policy: policy,
+	}
+}
+
+func (r *OrderRefunder) Preview(ctx context.Context, order xytmodel.RegisterOrder) (RefundPreview, error) {
+	var preview = RefundPreview{
+		OrderId: order.OrderId,
+		Rule:    r.policy.String(),
+	}
+	if order.State != xytmodel.OrderStatePaid {
+		return preview, nil
+	}
+
+	paid, err := r.orders.FindPayment(ctx, order.OrderId)
+	if err != nil {
+		return preview, err
+	}
+	visitStart, err := VisitStartTime(order)
+	if err != nil {
+		return preview, err
+	}
+	preview.PaidAmount = paid.Amount
+	preview.RefundAmount = r.policy.RefundAmount(paid.Amount, visitStart, time.Now())
+	preview.Refundable = preview.RefundAmount > 0
+	return preview, nil
+}
+
+// Refund 按退号规则退款, 退款成功后释放排班号源;
+// 渠道受理了退款或不确定是否受理了退款时返回 ErrRefundProcessing, 由对账任务完成退款
+func (r *OrderRefunder) Refund(ctx context.Context, order xytmodel.RegisterOrder, actor string) (RefundPreview, error) {
+	preview, err := r.Preview(ctx, order)
+	if err != nil {
+		return preview, err
+	}
+	if !preview.Refundable {
+		return preview, app.ErrNotRefundable
+	}
+	return preview, r.refund(ctx, order, preview.RefundAmount, actor, "用户退号")
+}
+
+// RefundFull 不按退号规则全额退款, 用于医生停诊等医院原因取消的订单, 返回退款金额
+func (r *OrderRefunder) RefundFull(ctx context.Context, order xytmodel.RegisterOrder, actor, reason string) (int64, error) {
+	paid, err := r.orders.FindPayment(ctx, order.OrderId)
+	if err != nil {
+		return 0, err
+	}
+	return paid.Amount, r.refund(ctx, order, paid.Amount, actor, reason)
+}
+
+func (r *OrderRefunder) refund(ctx context.Context, order xytmodel.RegisterOrder, amount int64, actor, reason string) error {
+	// 先进入退款中, 防止同一订单被重复退款
+	err := r.orders.Transit(ctx, order.OrderId, xytmodel.OrderStatePaid, xytmodel.OrderStateRefunding, actor, reason)
+	if err != nil {
+		return err
+	}
+
+	refund, err := r.paySvc.Refund(ctx, payment.RefundRequest{
+		OutTradeNo:  order.OrderId,
+		OutRefundNo: order.OrderId,
+		Amount:      amount,
+		Reason:      reason,
+	})
+	switch {
+	case errors.Is(err, payment.ErrTradeNotFound), errors.Is(err, payment.ErrRefundRejected):
+		// 渠道明确拒绝了退款, 回到已支付
+		rollbackErr := r.orders.Transit(ctx, order.OrderId, xytmodel.OrderStateRefunding, xytmodel.OrderStatePaid, xytmodel.OrderActorSystem, "退款失败")
+		if rollbackErr != nil {
+			return fmt.Errorf("refund: %w, rollback: %v", err, rollbackErr)
+		}
+		return err
+	case err != nil:
+		// 超时等错误不知道渠道是否受理了, 留在退款中由对账任务查询退款结果
+		return fmt.Errorf("%w: %v", app.ErrRefundProcessing, err)
+	case refund.Status != payment.StatusSuccess:
+		// 渠道受理了但还没有退款成功
+		return app.ErrRefundProcessing
+	}
+
+	if err = r.finish(ctx, order, refund); err != nil {
+		return fmt.Errorf("%w: %v", app.ErrRefundProcessing, err)
+	}
+	return nil
+}
+
+// finish 渠道退款成功后更新订单和支付单, 释放排班号源
+func (r *OrderRefunder) finish(ctx context.Context, order xytmodel.RegisterOrder, refund payment.Refund) error {
+	err := r.orders.FinishRefund(ctx, order, r.paySvc.Name(), refund.RefundNo, refund.Amount)
+	if err != nil {
+		return err
+	}
+	r.booker.Release(ctx, order.ScheId)
+	return nil
+}
+
+// Start 定时处理卡在退款中的订单, ctx 结束后退出
+func (r *OrderRefunder) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(refundReconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				handled, err := r.Reconcile(ctx)
+				if err != nil {
+					log.Println("reconcile refunds:", err)
+					continue
+				}
+				if handled > 0 {
+					log.Printf("reconcile refunds: handled %d orders", handled)
+				}
+			}
+		}
+	}()
+}
+
+// Reconcile 向支付渠道查询退款中超过 refundStaleAfter 的订单, 渠道退款成功的完成退款,
+// 渠道没有收到退款的回到已支付, 返回处理的订单数
+func (r *OrderRefunder) Reconcile(ctx context.Context) (int, error) {
+	orders, err := r.orders.StaleRefunding(ctx, time.Now().Add(-refundStaleAfter), refundReconcileBatch)
+	if err != nil {
+		return 0, err
+	}
+	var handled = 0
+	for _, order := range orders {
+		refund, err := r.paySvc.QueryRefund(ctx, order.OrderId)
+		switch {
+		case err == nil && refund.Status == payment.StatusSuccess:
+			err = r.finish(ctx, order, refund)
+		case err == nil:
+			// 渠道还在处理
+			continue
+		case errors.Is(err, payment.ErrRefundNotFound):
+			err = r.orders.Transit(ctx, order.OrderId, xytmodel.OrderStateRefunding, xytmodel.OrderStatePaid, xytmodel.OrderActorSystem, "退款失败")
+		}
+		if errors.Is(err, app.ErrOrderStateChanged) {
+			continue
+		}
+		if err != nil {
+			return handled, err
+		}
+		handled++
+	}
+	return handled, nil
+}
@@ -0,0 +1,251 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	cachemocks "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/solunara/isb/src/service/payment"
+	"github.com/solunara/isb/src/service/payment/localpay"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRefundPolicy_RefundAmount(t *testing.T) {
+	policy := RefundPolicy{FullBefore: 24 * time.Hour, PartialPercent: 50}
+	visitStart := time.Date(2030, 1, 2, 8, 0, 0, 0, time.Local)
+	testCases := []struct {
+		name string
+		now  time.Time
+		want int64
+	}{
+		{name: "提前两天全额退款", now: visitStart.Add(-48 * time.Hour), want: 3000},
+		{name: "恰好提前24小时全额退款", now: visitStart.Add(-24 * time.Hour), want: 3000},
+		{name: "24小时以内部分退款", now: visitStart.Add(-2 * time.Hour), want: 1500},
+		{name: "开诊后不能退款", now: visitStart, want: 0},
+		{name: "就诊结束后不能退款", now: visitStart.Add(5 * time.Hour), want: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, policy.RefundAmount(3000, visitStart, tc.now))
+		})
+	}
+}
+
+func TestVisitStartTime(t *testing.T) {
+	testCases := []struct {
+		name        string
+		visitTime   string
+		visitPeriod string
+		want        time.Time
+		wantErr     bool
+	}{
+		{name: "上午", visitTime: "2030-01-02 上午", want: time.Date(2030, 1, 2, 8, 0, 0, 0, time.Local)},
+		{name: "下午", visitTime: "2030-01-02 下午", want: time.Date(2030, 1, 2, 13, 30, 0, 0, time.Local)},
+		{name: "未知时段", visitTime: "2030-01-02 凌晨", wantErr: true},
+		{name: "格式错误", visitTime: "2030-01-02", wantErr: true},
+		{name: "按号段", visitTime: "2030-01-02 上午", visitPeriod: "2030-01-02 08:20-08:30", want: time.Date(2030, 1, 2, 8, 20, 0, 0, time.Local)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := VisitStartTime(xytmodel.RegisterOrder{VisitTime: tc.visitTime, VisitPeriod: tc.visitPeriod})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tc.want.Equal(got))
+		})
+	}
+}
+
+// newPaidOrder 在本地支付渠道创建一笔已支付的支付单
+func newPaidOrder(t *testing.T, paySvc *localpay.Service, orderId string, amount int64) {
+	_, err := paySvc.Create(context.Background(), payment.CreateRequest{OutTradeNo: orderId, Amount: amount})
+	require.NoError(t, err)
+	_, err = paySvc.Pay(orderId, "/xyt/pay/notify")
+	require.NoError(t, err)
+}
+
+func TestOrderRefunder_Refund(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	paySvc := localpay.NewService("secret")
+	newPaidOrder(t, paySvc, "o1", 3000)
+	order := xytmodel.RegisterOrder{OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStatePaid, VisitTime: "2030-01-02 上午"}
+
+	mock.ExpectQuery("SELECT \\* FROM `register_order_payment`").
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "amount"}).AddRow("o1", 3000))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunding, "o1", xytmodel.OrderStatePaid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// 渠道退款成功后订单更新失败
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WillReturnError(errors.New("数据库错误"))
+	mock.ExpectRollback()
+
+	db := newQueueTestDB(t, sqlDB)
+	orderSvc := newTestOrderService(db)
+	r := NewOrderRefunder(orderSvc, paySvc, NewOrderBooker(db, cachemocks.NewMockInventoryCache(ctrl), orderSvc), DefaultRefundPolicy())
+	preview, err := r.Refund(context.Background(), order, "u1")
+	assert.ErrorIs(t, err, app.ErrRefundProcessing)
+	assert.EqualValues(t, 3000, preview.RefundAmount)
+	refund, err := paySvc.QueryRefund(context.Background(), "o1")
+	require.NoError(t, err)
+	assert.Equal(t, payment.StatusSuccess, refund.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// refundErrService 发起退款返回指定错误的支付渠道
+type refundErrService struct {
+	*localpay.Service
+	err error
+}
+
+func (s refundErrService) Refund(ctx context.Context, req payment.RefundRequest) (payment.Refund, error) {
+	return payment.Refund{}, s.err
+}
+
+func TestOrderRefunder_RefundFull(t *testing.T) {
+	testCases := []struct {
+		name      string
+		refundErr error
+		mock      func(mock sqlmock.Sqlmock)
+
+		wantErr error
+	}{
+		{
+			name:      "渠道拒绝退款",
+			refundErr: payment.ErrRefundRejected,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStatePaid, "o1", xytmodel.OrderStateRefunding).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantErr: payment.ErrRefundRejected,
+		},
+		{
+			name:      "请求超时留在退款中",
+			refundErr: context.DeadlineExceeded,
+			mock:      func(mock sqlmock.Sqlmock) {},
+			wantErr:   app.ErrRefundProcessing,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			order := xytmodel.RegisterOrder{OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStatePaid, VisitTime: "2030-01-02 上午"}
+
+			mock.ExpectQuery("SELECT \\* FROM `register_order_payment`").
+				WillReturnRows(sqlmock.NewRows([]string{"order_id", "amount"}).AddRow("o1", 3000))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunding, "o1", xytmodel.OrderStatePaid).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			tc.mock(mock)
+
+			db := newQueueTestDB(t, sqlDB)
+			orderSvc := newTestOrderService(db)
+			paySvc := refundErrService{Service: localpay.NewService("secret"), err: tc.refundErr}
+			r := NewOrderRefunder(orderSvc, paySvc, NewOrderBooker(db, cachemocks.NewMockInventoryCache(ctrl), orderSvc), DefaultRefundPolicy())
+			amount, err := r.RefundFull(context.Background(), order, "admin", "医生停诊")
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.EqualValues(t, 3000, amount)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOrderRefunder_Reconcile(t *testing.T) {
+	const staleQuery = "SELECT \\* FROM `register_order` WHERE state = \\? and order_id in " +
+		"\\(SELECT order_id FROM `register_order_history` WHERE to_state = \\? and created_at < \\?\\)"
+	orderRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"order_id", "sche_id", "state"}).AddRow("o1", "s1", xytmodel.OrderStateRefunding)
+	}
+	testCases := []struct {
+		name   string
+		refund bool
+		mock   func(mock sqlmock.Sqlmock)
+		cache  func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache
+
+		wantHandled int
+	}{
+		{
+			name:   "渠道已经退款",
+			refund: true,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(staleQuery).WillReturnRows(orderRows())
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunded, "o1", xytmodel.OrderStateRefunding).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE `register_order_payment` SET .*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `schedule` SET `registered`=registered - 1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				c := cachemocks.NewMockInventoryCache(ctrl)
+				c.EXPECT().Release(gomock.Any(), "s1", "").Return(nil)
+				return c
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "渠道没有收到退款",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(staleQuery).WillReturnRows(orderRows())
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStatePaid, "o1", xytmodel.OrderStateRefunding).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			cache: func(ctrl *gomock.Controller) *cachemocks.MockInventoryCache {
+				return cachemocks.NewMockInventoryCache(ctrl)
+			},
+			wantHandled: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			paySvc := localpay.NewService("secret")
+			newPaidOrder(t, paySvc, "o1", 3000)
+			if tc.refund {
+				_, err = paySvc.Refund(context.Background(), payment.RefundRequest{OutTradeNo: "o1", OutRefundNo: "o1", Amount: 3000})
+				require.NoError(t, err)
+			}
+			db := newQueueTestDB(t, sqlDB)
+			orderSvc := newTestOrderService(db)
+			r := NewOrderRefunder(orderSvc, paySvc, NewOrderBooker(db, tc.cache(ctrl), orderSvc), DefaultRefundPolicy())
+
+			handled, err := r.Reconcile(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantHandled, handled)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package xytweb
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/service/region"
+	"github.com/solunara/isb/src/types/app"
+)
+
+const maxRegionFileSize = 10 << 20
+
+// XytRegionAdminHandler 管理后台导入新版本的行政区划数据
+type XytRegionAdminHandler struct {
+	svc *region.Service
+}
+
+func NewXytRegionAdminHandler(svc *region.Service) *XytRegionAdminHandler {
+	return &XytRegionAdminHandler{
+		svc: svc,
+	}
+}
+
+func (xh *XytRegionAdminHandler) RegisterRoutes(group *gin.RouterGroup) {
+	rg := group.Group("/region")
+	rg.GET("/versions", xh.versions)
+	rg.POST("/diff", xh.diff)
+	rg.POST("/apply", xh.apply)
+}
+
+func (xh *XytRegionAdminHandler) versions(ctx *gin.Context) {
+	versions, err := xh.svc.Versions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(versions))
+}
+
+// diff 表单字段 file 为数据文件, version 为文件中没有版本号时使用的版本号
+func (xh *XytRegionAdminHandler) diff(ctx *gin.Context) {
+	ds, ok := xh.dataset(ctx)
+	if !ok {
+		return
+	}
+	diff, err := xh.svc.Diff(ctx, ds)
+	if err != nil {
+		regionErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(diff))
+}
+
+func (xh *XytRegionAdminHandler) apply(ctx *gin.Context) {
+	userId, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	ds, ok := xh.dataset(ctx)
+	if !ok {
+		return
+	}
+	diff, err := xh.svc.Apply(ctx, ds, userId.(string))
+	if err != nil {
+		regionErr(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(diff))
+}
+
+func (xh *XytRegionAdminHandler) dataset(ctx *gin.Context) (region.Dataset, bool) {
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return region.Dataset{}, false
+	}
+	if fh.Size > maxRegionFileSize {
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, "文件不能超过 10MB"))
+		return region.Dataset{}, false
+	}
+	file, err := fh.Open()
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return region.Dataset{}, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxRegionFileSize))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return region.Dataset{}, false
+	}
+	ds, err := region.LoadDataset(data, ctx.PostForm("version"))
+	if err != nil {
+		regionErr(ctx, err)
+		return region.Dataset{}, false
+	}
+	return ds, true
+}
+
+func regionErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, app.ErrRegionDataset), errors.Is(err, app.ErrRegionRetired):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+	case errors.Is(err, app.ErrRegionVersionApplied):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+	default:
+		log.Println("region:", err)
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+	}
+}
@@ -0,0 +1,513 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/service/sms"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/solunara/isb/src/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// 停诊/替诊通知的短信模板
+	SmsTplScheduleSuspended   = "schedule_suspended"
+	SmsTplScheduleSubstituted = "schedule_substituted"
+
+	rosterGenerateInterval = 24 * time.Hour
+)
+
+// RosterGenerator 按出诊模板提前生成未来 days 天的排班
+type RosterGenerator struct {
+	db   *gorm.DB
+	days int
+}
+
+func NewRosterGenerator(db *gorm.DB, days int) *RosterGenerator {
+	if days <= 0 {
+		days = MaxSchedulerDays
+	}
+	return &RosterGenerator{
+		db:   db,
+		days: days,
+	}
+}
+
+// Start 启动时生成一次, 之后每天生成一次
+func (g *RosterGenerator) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(rosterGenerateInterval)
+		defer ticker.Stop()
+		for {
+			created, err := g.Generate(ctx, time.Now())
+			if err != nil {
+				log.Println("generate schedules:", err)
+			} else if created > 0 {
+				log.Printf("generate schedules: created %d schedules", created)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Generate 为 from 开始的 days 天生成排班, 已经生成过的模板和日期会跳过, 返回新建的排班数
+func (g *RosterGenerator) Generate(ctx context.Context, from time.Time) (int, error) {
+	var templates []xytmodel.RosterTemplate
+	err := g.db.WithContext(ctx).Table(xytmodel.TableRosterTemplate).Where("enabled = ?", true).Find(&templates).Error
+	if err != nil {
+		return 0, err
+	}
+	schedules := MaterializeRoster(templates, from, g.days)
+	if len(schedules) == 0 {
+		return 0, nil
+	}
+
+	var existing []xytmodel.Schedule
+	err = g.db.WithContext(ctx).Table(xytmodel.TableSchedule).
+		Select("template_id", "work_date").
+		Where("template_id > 0 and work_date >= ? and work_date <= ?", schedules[0].WorkDate, from.AddDate(0, 0, g.days-1).Format(time.DateOnly)).
+		Find(&existing).Error
+	if err != nil {
+		return 0, err
+	}
+	type key struct {
+		templateId int
+		workDate   string
+	}
+	var generated = make(map[key]bool, len(existing))
+	for _, sche := range existing {
+		generated[key{sche.TemplateId, sche.WorkDate}] = true
+	}
+
+	var created []xytmodel.Schedule
+	for _, sche := range schedules {
+		if generated[key{sche.TemplateId, sche.WorkDate}] {
+			continue
+		}
+		sche.ScheId = utils.GenerateUinqueID()
+		created = append(created, sche)
+	}
+	if len(created) == 0 {
+		return 0, nil
+	}
+	err = g.db.WithContext(ctx).Table(xytmodel.TableSchedule).CreateInBatches(created, 100).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(created), nil
+}
+
+// MaterializeRoster 把出诊模板展开为 from 开始 days 天内的排班, 不生成 ScheId
+func MaterializeRoster(templates []xytmodel.RosterTemplate, from time.Time, days int) []xytmodel.Schedule {
+	var schedules []xytmodel.Schedule
+	for i := 0; i < days; i++ {
+		day := from.AddDate(0, 0, i)
+		for _, tpl := range templates {
+			if !tpl.Enabled || tpl.Weekday != int(day.Weekday()) {
+				continue
+			}
+			schedules = append(schedules, xytmodel.Schedule{
+				DocId:        tpl.DocId,
+				HosID:        tpl.HosID,
+				DeptID:       tpl.DeptID,
+				WorkDate:     day.Format(time.DateOnly),
+				TimeSlot:     tpl.TimeSlot,
+				Amount:       tpl.Amount,
+				WorkWeek:     int(day.Weekday()),
+				MaxPatients:  tpl.MaxPatients,
+				TemplateId:   tpl.Id,
+				RegTypeId:    tpl.RegTypeId,
+				Status:       xytmodel.ScheduleStatusNormal,
+				SlotMinutes:  tpl.SlotMinutes,
+				SlotPatients: tpl.SlotPatients,
+			})
+		}
+	}
+	return schedules
+}
+
+// XytRosterHandler 医院管理员维护医生出诊模板, 停诊和替诊
+type XytRosterHandler struct {
+	db        *gorm.DB
+	smsSvc    sms.Service
+	generator *RosterGenerator
+	orders    service.OrderService
+	refunder  *OrderRefunder
+}
+
+func NewXytRosterHandler(db *gorm.DB, smsSvc sms.Service, generator *RosterGenerator, orders service.OrderService, refunder *OrderRefunder) *XytRosterHandler {
+	return &XytRosterHandler{
+		db:        db,
+		smsSvc:    smsSvc,
+		generator: generator,
+		orders:    orders,
+		refunder:  refunder,
+	}
+}
+
+// RegisterRoutes group 为管理后台的路由组
+func (xh *XytRosterHandler) RegisterRoutes(group *gin.RouterGroup) {
+	rg := group.Group("/roster")
+	rg.GET("/template", xh.listTemplate)
+	rg.POST("/template", xh.saveTemplate)
+	rg.POST("/template/delete", xh.deleteTemplate)
+	rg.POST("/generate", xh.generate)
+	rg.POST("/suspend", xh.suspend)
+	rg.POST("/suspend/refund", xh.refundSuspended)
+	rg.POST("/substitute", xh.substitute)
+}
+
+func (xh *XytRosterHandler) listTemplate(ctx *gin.Context) {
+	dbQuery := xh.db.Table(xytmodel.TableRosterTemplate)
+	if docId := ctx.Query("docId"); docId != "" {
+		dbQuery = dbQuery.Where("doc_id = ?", docId)
+	}
+	if hosId := ctx.Query("hosId"); hosId != "" {
+		dbQuery = dbQuery.Where("hos_id = ?", hosId)
+	}
+	var templates []xytmodel.RosterTemplate
+	err := dbQuery.Order("doc_id, weekday, time_slot").Find(&templates).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(templates))
+}
+
+// 新建或按 (docId, weekday, timeSlot) 覆盖出诊模板
+func (xh *XytRosterHandler) saveTemplate(ctx *gin.Context) {
+	var req xytmodel.RosterTemplate
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	if _, ok := service.TimeSlotStart[req.TimeSlot]; !ok || req.Weekday < 0 || req.Weekday > 6 || req.MaxPatients <= 0 || req.Amount < 0 || req.SlotMinutes < 0 || req.SlotPatients < 0 {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	var doctor xytmodel.Doctor
+	err := xh.db.Table(xytmodel.TableDoctor).Where("id = ?", req.DocId).Take(&doctor).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+			return
+		}
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	req.Id = 0
+	req.HosID = doctor.HosId
+	req.DeptID = doctor.DeptId
+
+	err = xh.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "doc_id"}, {Name: "weekday"}, {Name: "time_slot"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_patients", "amount", "reg_type_id", "slot_minutes", "slot_patients", "enabled", "updated_at"}),
+	}).Create(&req).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+type deleteTemplateReq struct {
+	Id int `json:"id"`
+}
+
+// 删除模板不影响已经生成的排班
+func (xh *XytRosterHandler) deleteTemplate(ctx *gin.Context) {
+	var req deleteTemplateReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	err := xh.db.Where("id = ?", req.Id).Delete(&xytmodel.RosterTemplate{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytRosterHandler) generate(ctx *gin.Context) {
+	created, err := xh.generator.Generate(ctx, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(gin.H{"created": created}))
+}
+
+type suspendReq struct {
+	DocId           string `json:"docId"`
+	WorkDate        string `json:"workDate"`
+	SubstituteDocId string `json:"substituteDocId"`
+	Reason          string `json:"reason"`
+}
+
+// 医生某天停诊, 取消待支付订单, 已支付订单全额退款, 已预约的患者会收到短信通知
+func (xh *XytRosterHandler) suspend(ctx *gin.Context) {
+	var req suspendReq
+	if err := ctx.Bind(&req); err != nil || req.DocId == "" || req.WorkDate == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	var orders []xytmodel.RegisterOrder
+	err := xh.db.Transaction(func(tx *gorm.DB) error {
+		// 停诊前查询, 停诊后排班不再是正常出诊
+		err := findAffectedOrders(tx, req.DocId, req.WorkDate, xytmodel.ScheduleStatusNormal, &orders)
+		if err != nil {
+			return err
+		}
+		res := tx.Table(xytmodel.TableSchedule).
+			Where("doc_id = ? and work_date = ? and status = ?", req.DocId, req.WorkDate, xytmodel.ScheduleStatusNormal).
+			Update("status", xytmodel.ScheduleStatusSuspended)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return invalidateScheduleWaitlist(tx, req.DocId, req.WorkDate)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+			return
+		}
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	xh.notify(ctx, orders, SmsTplScheduleSuspended, func(order xytmodel.RegisterOrder) []string {
+		return []string{order.PatientName, order.VisitTime, order.DocName, req.Reason}
+	})
+	cancelled, refunded, failed := xh.cancelSuspended(ctx, orders, ctx.GetString(config.USER_ID))
+	ctx.JSON(http.StatusOK, app.ResponseOK(gin.H{
+		"notified":  len(orders),
+		"cancelled": cancelled,
+		"refunded":  refunded,
+		"failed":    failed,
+	}))
+}
+
+// 重试停诊时退款失败的订单
+func (xh *XytRosterHandler) refundSuspended(ctx *gin.Context) {
+	var req suspendReq
+	if err := ctx.Bind(&req); err != nil || req.DocId == "" || req.WorkDate == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	var orders []xytmodel.RegisterOrder
+	err := findAffectedOrders(xh.db.WithContext(ctx), req.DocId, req.WorkDate, xytmodel.ScheduleStatusSuspended, &orders)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	cancelled, refunded, failed := xh.cancelSuspended(ctx, orders, ctx.GetString(config.USER_ID))
+	ctx.JSON(http.StatusOK, app.ResponseOK(gin.H{
+		"cancelled": cancelled,
+		"refunded":  refunded,
+		"failed":    failed,
+	}))
+}
+
+// cancelSuspended 取消停诊排班的待支付订单, 已支付订单全额退款, 返回退款失败的订单号;
+// 渠道已经受理的退款由退款对账任务完成, 按退款成功计算
+func (xh *XytRosterHandler) cancelSuspended(ctx context.Context, orders []xytmodel.RegisterOrder, actor string) (cancelled, refunded int, failed []string) {
+	failed = []string{}
+	for _, order := range orders {
+		if order.State == xytmodel.OrderStatePending {
+			err := xh.orders.Cancel(ctx, order, actor, "医生停诊")
+			if err == nil {
+				cancelled++
+				continue
+			}
+			if !errors.Is(err, app.ErrOrderStateChanged) {
+				log.Printf("cancel suspended order %s: %v", order.OrderId, err)
+				failed = append(failed, order.OrderId)
+				continue
+			}
+			// 取消前用户完成了支付, 按已支付订单退款
+			latest, err := findOrder(xh.db.WithContext(ctx), order.OrderId)
+			if err != nil {
+				log.Printf("cancel suspended order %s: %v", order.OrderId, err)
+				failed = append(failed, order.OrderId)
+				continue
+			}
+			if latest.State != xytmodel.OrderStatePaid {
+				continue
+			}
+			order = latest
+		}
+		_, err := xh.refunder.RefundFull(ctx, order, actor, "医生停诊")
+		if err != nil && !errors.Is(err, app.ErrRefundProcessing) {
+			log.Printf("refund suspended order %s: %v", order.OrderId, err)
+			failed = append(failed, order.OrderId)
+			continue
+		}
+		refunded++
+	}
+	return cancelled, refunded, failed
+}
+
+// 医生某天由其他医生替诊, 已预约的订单转到替诊医生名下并通知患者
+func (xh *XytRosterHandler) substitute(ctx *gin.Context) {
+	var req suspendReq
+	if err := ctx.Bind(&req); err != nil || req.DocId == "" || req.WorkDate == "" || req.SubstituteDocId == "" || req.SubstituteDocId == req.DocId {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	var substitute xytmodel.Doctor
+	err := xh.db.Table(xytmodel.TableDoctor).Where("id = ?", req.SubstituteDocId).Take(&substitute).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+			return
+		}
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	var orders []xytmodel.RegisterOrder
+	err = xh.db.Transaction(func(tx *gorm.DB) error {
+		var schedules []xytmodel.Schedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table(xytmodel.TableSchedule).
+			Where("doc_id = ? and work_date = ? and status = ?", req.DocId, req.WorkDate, xytmodel.ScheduleStatusNormal).
+			Find(&schedules).Error
+		if err != nil {
+			return err
+		}
+		if len(schedules) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err = checkSubstitute(tx, substitute, schedules); err != nil {
+			return err
+		}
+		err = findAffectedOrders(tx, req.DocId, req.WorkDate, xytmodel.ScheduleStatusNormal, &orders)
+		if err != nil {
+			return err
+		}
+		var scheIds = make([]string, 0, len(schedules))
+		for _, sche := range schedules {
+			scheIds = append(scheIds, sche.ScheId)
+		}
+		err = tx.Table(xytmodel.TableSchedule).Where("sche_id in ?", scheIds).
+			Updates(map[string]any{
+				"doc_id":      substitute.Id,
+				"orig_doc_id": req.DocId,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+		var orderIds = make([]string, 0, len(orders))
+		for _, order := range orders {
+			orderIds = append(orderIds, order.OrderId)
+		}
+		return tx.Table(xytmodel.TableOrder).Where("order_id in ?", orderIds).Updates(map[string]any{
+			"doc_id":   substitute.Id,
+			"doc_name": substitute.Name,
+		}).Error
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusOK, app.ErrNotFound)
+		return
+	case errors.Is(err, app.ErrSubstituteMismatch):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+		return
+	case errors.Is(err, app.ErrSubstituteConflict):
+		ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+		return
+	default:
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+
+	xh.notify(ctx, orders, SmsTplScheduleSubstituted, func(order xytmodel.RegisterOrder) []string {
+		return []string{order.PatientName, order.VisitTime, order.DocName, substitute.Name, req.Reason}
+	})
+	ctx.JSON(http.StatusOK, app.ResponseOK(gin.H{"notified": len(orders)}))
+}
+
+// checkSubstitute 替诊医生必须和排班属于同一医院科室, 且在这些排班的时段没有自己的排班
+func checkSubstitute(tx *gorm.DB, substitute xytmodel.Doctor, schedules []xytmodel.Schedule) error {
+	var slots = make([]string, 0, len(schedules))
+	for _, sche := range schedules {
+		if sche.HosID != substitute.HosId || sche.DeptID != substitute.DeptId {
+			return app.ErrSubstituteMismatch
+		}
+		slots = append(slots, sche.TimeSlot)
+	}
+	var count int64
+	err := tx.Table(xytmodel.TableSchedule).
+		Where("doc_id = ? and work_date = ? and status = ?", substitute.Id, schedules[0].WorkDate, xytmodel.ScheduleStatusNormal).
+		Where("time_slot in ?", slots).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return app.ErrSubstituteConflict
+	}
+	return nil
+}
+
+// 查询医生某天状态为 status 的排班下待支付和已支付的订单
+func findAffectedOrders(tx *gorm.DB, docId, workDate string, status int8, orders *[]xytmodel.RegisterOrder) error {
+	return tx.Table(xytmodel.TableOrder).
+		Where("state in ?", []int8{xytmodel.OrderStatePending, xytmodel.OrderStatePaid}).
+		Where("sche_id in (?)", tx.Table(xytmodel.TableSchedule).Select("sche_id").
+			Where("doc_id = ? and work_date = ? and status = ?", docId, workDate, status)).
+		Find(orders).Error
+}
+
+// 通知失败只记录日志, 不影响停诊和替诊
+func (xh *XytRosterHandler) notify(ctx context.Context, orders []xytmodel.RegisterOrder, tplId string, args func(xytmodel.RegisterOrder) []string) {
+	if len(orders) == 0 {
+		return
+	}
+	var patientIds = make([]string, 0, len(orders))
+	for _, order := range orders {
+		patientIds = append(patientIds, order.PatientId)
+	}
+	var patients []xytmodel.Patient
+	err := xh.db.Table(xytmodel.TablePatient).Select("id", "phone").Where("id in ?", patientIds).Find(&patients).Error
+	if err != nil {
+		log.Println("find patients to notify:", err)
+		return
+	}
+	var phones = make(map[string]string, len(patients))
+	for _, patient := range patients {
+		phones[patient.Id] = patient.Phone
+	}
+	for _, order := range orders {
+		phone, ok := phones[order.PatientId]
+		if !ok || phone == "" {
+			continue
+		}
+		if err := xh.smsSvc.Send(ctx, tplId, args(order), phone); err != nil {
+			log.Printf("notify order %s: %v", order.OrderId, err)
+		}
+	}
+}
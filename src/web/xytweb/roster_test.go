@@ -0,0 +1,210 @@
+package xytweb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/model/xytmodel"
+	cachemocks "github.com/solunara/isb/src/repository/cache/mocks"
+	"github.com/solunara/isb/src/service/payment/localpay"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMaterializeRoster(t *testing.T) {
+	// 2030-01-07 是周一
+	from := time.Date(2030, 1, 7, 0, 0, 0, 0, time.Local)
+	monday := xytmodel.RosterTemplate{Id: 1, DocId: "d1", HosID: "h1", DeptID: "dp1", Weekday: 1, TimeSlot: "上午", MaxPatients: 20, Amount: 50, RegTypeId: 2, Enabled: true}
+	sunday := xytmodel.RosterTemplate{Id: 2, DocId: "d1", HosID: "h1", DeptID: "dp1", Weekday: 0, TimeSlot: "下午", MaxPatients: 10, Amount: 80, Enabled: true}
+	disabled := xytmodel.RosterTemplate{Id: 3, DocId: "d2", Weekday: 1, TimeSlot: "晚上", MaxPatients: 10, Enabled: false}
+
+	testCases := []struct {
+		name      string
+		templates []xytmodel.RosterTemplate
+		days      int
+		wantDates []string
+	}{
+		{name: "没有模板", days: 7},
+		{name: "一周内只生成一次", templates: []xytmodel.RosterTemplate{monday}, days: 7, wantDates: []string{"2030-01-07"}},
+		{name: "两周生成两次", templates: []xytmodel.RosterTemplate{monday}, days: 14, wantDates: []string{"2030-01-07", "2030-01-14"}},
+		{name: "按日期顺序生成", templates: []xytmodel.RosterTemplate{sunday, monday}, days: 7, wantDates: []string{"2030-01-07", "2030-01-13"}},
+		{name: "停用的模板不生成", templates: []xytmodel.RosterTemplate{disabled}, days: 7},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedules := MaterializeRoster(tc.templates, from, tc.days)
+			var dates []string
+			for _, sche := range schedules {
+				dates = append(dates, sche.WorkDate)
+			}
+			assert.Equal(t, tc.wantDates, dates)
+		})
+	}
+
+	schedules := MaterializeRoster([]xytmodel.RosterTemplate{monday}, from, 1)
+	assert.Equal(t, []xytmodel.Schedule{{
+		DocId:       "d1",
+		HosID:       "h1",
+		DeptID:      "dp1",
+		WorkDate:    "2030-01-07",
+		TimeSlot:    "上午",
+		Amount:      50,
+		WorkWeek:    1,
+		MaxPatients: 20,
+		TemplateId:  1,
+		RegTypeId:   2,
+		Status:      xytmodel.ScheduleStatusNormal,
+	}}, schedules)
+}
+
+func TestXytRosterHandler_cancelSuspended(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	paySvc := localpay.NewService("secret")
+	newPaidOrder(t, paySvc, "o2", 3000)
+	// 一小时后就诊, 按退号规则只能退一半
+	visitTime := time.Now().Add(time.Hour).Format("2006-01-02 15:04") + "-" + time.Now().Add(70*time.Minute).Format("15:04")
+	orders := []xytmodel.RegisterOrder{
+		{OrderId: "o1", ScheId: "s1", State: xytmodel.OrderStatePending},
+		{OrderId: "o2", ScheId: "s1", State: xytmodel.OrderStatePaid, VisitPeriod: visitTime},
+		{OrderId: "o3", ScheId: "s1", State: xytmodel.OrderStatePaid, VisitPeriod: visitTime},
+	}
+
+	// 取消待支付订单
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateCancelled, "o1", xytmodel.OrderStatePending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `schedule` SET `registered`=registered - 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// 已支付订单全额退款
+	mock.ExpectQuery("SELECT \\* FROM `register_order_payment`").
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "amount"}).AddRow("o2", 3000))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunding, "o2", xytmodel.OrderStatePaid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunded, "o2", xytmodel.OrderStateRefunding).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE `register_order_payment` SET .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `schedule` SET `registered`=registered - 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// 渠道退款失败, 订单回到已支付
+	mock.ExpectQuery("SELECT \\* FROM `register_order_payment`").
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "amount"}).AddRow("o3", 3000))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStateRefunding, "o3", xytmodel.OrderStatePaid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `register_order` SET `state`=.*").WithArgs(xytmodel.OrderStatePaid, "o3", xytmodel.OrderStateRefunding).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `register_order_history` .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	cache := cachemocks.NewMockInventoryCache(ctrl)
+	cache.EXPECT().Release(gomock.Any(), "s1", "").Return(nil)
+	db := newQueueTestDB(t, sqlDB)
+	orderSvc := newTestOrderService(db)
+	xh := NewXytRosterHandler(db, nil, nil, orderSvc, NewOrderRefunder(orderSvc, paySvc, NewOrderBooker(db, cache, orderSvc), DefaultRefundPolicy()))
+
+	cancelled, refunded, failed := xh.cancelSuspended(context.Background(), orders, "admin")
+	assert.Equal(t, 1, cancelled)
+	assert.Equal(t, 1, refunded)
+	assert.Equal(t, []string{"o3"}, failed)
+	refund, err := paySvc.QueryRefund(context.Background(), "o2")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3000, refund.Amount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestXytRosterHandler_substitute(t *testing.T) {
+	const body = `{"docId":"d1","workDate":"2030-01-07","substituteDocId":"d2","reason":"出差"}`
+	doctorRows := func(deptId string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "hos_id", "dept_id"}).AddRow("d2", "李医生", "h1", deptId)
+	}
+	scheduleRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"sche_id", "doc_id", "hos_id", "dept_id", "work_date", "time_slot"}).
+			AddRow("s1", "d1", "h1", "dp1", "2030-01-07", "上午").
+			AddRow("s2", "d1", "h1", "dp1", "2030-01-07", "下午")
+	}
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+
+		wantBody app.ResponseType
+	}{
+		{
+			name: "替诊医生不在同一科室",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `doctor`").WillReturnRows(doctorRows("dp2"))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectRollback()
+			},
+			wantBody: app.ResponseErr(app.ErrCodeBadRequest, app.ErrSubstituteMismatch.Error()),
+		},
+		{
+			name: "替诊医生同一时段已有排班",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `doctor`").WillReturnRows(doctorRows("dp1"))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `schedule`").
+					WithArgs("d2", "2030-01-07", xytmodel.ScheduleStatusNormal, "上午", "下午").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantBody: app.ResponseErr(app.ErrCodeConflict, app.ErrSubstituteConflict.Error()),
+		},
+		{
+			name: "替诊成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `doctor`").WillReturnRows(doctorRows("dp1"))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule` .* FOR UPDATE").WillReturnRows(scheduleRows())
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `schedule`").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery("SELECT \\* FROM `register_order`").WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+				mock.ExpectExec("UPDATE `schedule` SET .*").WithArgs("d2", "d1", "s1", "s2").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			wantBody: app.ResponseOK(map[string]any{"notified": float64(0)}),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+
+			server := gin.New()
+			NewXytRosterHandler(newQueueTestDB(t, sqlDB), nil, nil, nil, nil).RegisterRoutes(server.Group("/xyt/admin"))
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, jsonRequest(t, "/xyt/admin/roster/substitute", body))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var respBody app.ResponseType
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &respBody))
+			assert.Equal(t, tc.wantBody, respBody)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package xytweb
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/service/search"
+	"github.com/solunara/isb/src/types/app"
+)
+
+// XytSearchHandler 医院搜索, 支持关键字, 附近的医院和分面过滤
+type XytSearchHandler struct {
+	svc    search.Service
+	syncer *search.Syncer
+}
+
+func NewXytSearchHandler(svc search.Service, syncer *search.Syncer) *XytSearchHandler {
+	return &XytSearchHandler{
+		svc:    svc,
+		syncer: syncer,
+	}
+}
+
+func (xh *XytSearchHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/hos/search", xh.searchHospital)
+	group.GET("/hos/doctor/search", xh.searchDoctor)
+}
+
+// RegisterAdminRoutes group 为管理后台的路由组
+func (xh *XytSearchHandler) RegisterAdminRoutes(group *gin.RouterGroup) {
+	group.POST("/search/reindex", xh.reindex)
+}
+
+func (xh *XytSearchHandler) searchHospital(ctx *gin.Context) {
+	query, ok := parseHospitalQuery(ctx)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+	result, err := xh.svc.SearchHospitals(ctx, query)
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(result))
+}
+
+func (xh *XytSearchHandler) searchDoctor(ctx *gin.Context) {
+	pageNo, pageSize := searchPage(ctx)
+	result, err := xh.svc.SearchDoctors(ctx, search.DoctorQuery{
+		Keyword: ctx.Query("keyword"),
+		Rank:    ctx.Query("rank"),
+		HosId:   ctx.Query("hosId"),
+		DeptId:  ctx.Query("deptId"),
+		From:    (pageNo - 1) * pageSize,
+		Size:    pageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(result))
+}
+
+func (xh *XytSearchHandler) reindex(ctx *gin.Context) {
+	if err := xh.syncer.Reindex(ctx); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func parseHospitalQuery(ctx *gin.Context) (search.HospitalQuery, bool) {
+	query := search.HospitalQuery{
+		Keyword:        ctx.Query("keyword"),
+		GradeCode:      ctx.Query("gradeCode"),
+		TypeCode:       ctx.Query("typeCode"),
+		CityCode:       ctx.Query("cityCode"),
+		DistrictCode:   ctx.Query("districtCode"),
+		SortByDistance: ctx.Query("sort") == "distance",
+	}
+	lat, lon := ctx.Query("lat"), ctx.Query("lon")
+	if lat != "" || lon != "" {
+		var loc search.GeoPoint
+		var err error
+		if loc.Lat, err = strconv.ParseFloat(lat, 64); err != nil || loc.Lat < -90 || loc.Lat > 90 {
+			return query, false
+		}
+		if loc.Lon, err = strconv.ParseFloat(lon, 64); err != nil || loc.Lon < -180 || loc.Lon > 180 {
+			return query, false
+		}
+		query.Location = &loc
+	}
+	if radius := ctx.Query("radius"); radius != "" {
+		km, err := strconv.ParseFloat(radius, 64)
+		if err != nil || km < 0 || query.Location == nil {
+			return query, false
+		}
+		query.RadiusKm = km
+	}
+	if query.SortByDistance && query.Location == nil {
+		return query, false
+	}
+	if insurance := ctx.Query("insurance"); insurance != "" {
+		v, err := strconv.ParseBool(insurance)
+		if err != nil {
+			return query, false
+		}
+		query.Insurance = &v
+	}
+
+	pageNo, pageSize := searchPage(ctx)
+	query.From = (pageNo - 1) * pageSize
+	query.Size = pageSize
+	return query, true
+}
+
+func searchPage(ctx *gin.Context) (pageNo, pageSize int) {
+	pageNo, _ = strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
+	pageSize, _ = strconv.Atoi(ctx.DefaultQuery("pageSize", "10"))
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > 30 {
+		pageSize = 30
+	}
+	return pageNo, pageSize
+}
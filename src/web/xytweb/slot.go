@@ -0,0 +1,54 @@
+package xytweb
+
+import (
+	"context"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository/dao"
+	"github.com/solunara/isb/src/service"
+	"gorm.io/gorm"
+)
+
+// SubSlot 排班内的一个号段
+type SubSlot struct {
+	Index    int    `json:"index"` // 从 1 开始
+	Start    string `json:"start"` // 08:00
+	End      string `json:"end"`   // 08:10
+	Capacity int    `json:"capacity"`
+	Remain   int    `json:"remain"`
+}
+
+// ScheduleSubSlots 把排班切分为号段, taken 为已经分配出去的号序
+func ScheduleSubSlots(sche xytmodel.Schedule, taken []int) []SubSlot {
+	_, patients := service.SlotSize(sche)
+	var used = make(map[int]bool, len(taken))
+	for _, seq := range taken {
+		used[seq] = true
+	}
+
+	var slots []SubSlot
+	for seq := 1; seq <= sche.MaxPatients; seq++ {
+		index := (seq-1)/patients + 1
+		if len(slots) < index {
+			start, end, err := service.SeqVisitPeriod(sche, seq)
+			if err != nil {
+				return nil
+			}
+			slots = append(slots, SubSlot{
+				Index: index,
+				Start: start.Format("15:04"),
+				End:   end.Format("15:04"),
+			})
+		}
+		slots[index-1].Capacity++
+		if !used[seq] && sche.Status == xytmodel.ScheduleStatusNormal {
+			slots[index-1].Remain++
+		}
+	}
+	return slots
+}
+
+// findTakenSeqs 查询排班已经分配出去的号序, 按 sche_id 分组
+func findTakenSeqs(ctx context.Context, db *gorm.DB, scheIds []string) (map[string][]int, error) {
+	return dao.NewScheduleDAO(db).TakenSeqs(ctx, scheIds)
+}
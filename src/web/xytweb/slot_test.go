@@ -0,0 +1,22 @@
+package xytweb
+
+import (
+	"testing"
+
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleSubSlots(t *testing.T) {
+	sche := xytmodel.Schedule{WorkDate: "2030-01-02", TimeSlot: "上午", MaxPatients: 5, SlotMinutes: 20, SlotPatients: 2}
+	assert.Equal(t, []SubSlot{
+		{Index: 1, Start: "08:00", End: "08:20", Capacity: 2, Remain: 1},
+		{Index: 2, Start: "08:20", End: "08:40", Capacity: 2, Remain: 0},
+		{Index: 3, Start: "08:40", End: "09:00", Capacity: 1, Remain: 1},
+	}, ScheduleSubSlots(sche, []int{2, 3, 4}))
+
+	sche.Status = xytmodel.ScheduleStatusSuspended
+	for _, slot := range ScheduleSubSlots(sche, nil) {
+		assert.Equal(t, 0, slot.Remain)
+	}
+}
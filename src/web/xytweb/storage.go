@@ -0,0 +1,76 @@
+package xytweb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ecodeclub/ekit"
+)
+
+// ObjectStorage 保存不公开访问的文件, 例如证件照片, 只能通过需要权限的接口读取
+type ObjectStorage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// S3ObjectStorage 保存在兼容 S3 的对象存储中, bucket 需要是私有读写的
+type S3ObjectStorage struct {
+	oss    *s3.S3
+	bucket string
+}
+
+func NewS3ObjectStorage(oss *s3.S3, bucket string) *S3ObjectStorage {
+	return &S3ObjectStorage{
+		oss:    oss,
+		bucket: bucket,
+	}
+}
+
+func (s *S3ObjectStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.oss.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      ekit.ToPtr[string](s.bucket),
+		Key:         ekit.ToPtr[string](key),
+		Body:        bytes.NewReader(data),
+		ContentType: ekit.ToPtr[string](contentType),
+	})
+	return err
+}
+
+func (s *S3ObjectStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.oss.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: ekit.ToPtr[string](s.bucket),
+		Key:    ekit.ToPtr[string](key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// LocalObjectStorage 本地开发时保存在本地目录, 这个目录不能作为静态文件目录
+type LocalObjectStorage struct {
+	dir string
+}
+
+func NewLocalObjectStorage(dir string) *LocalObjectStorage {
+	return &LocalObjectStorage{
+		dir: dir,
+	}
+}
+
+func (s *LocalObjectStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	file := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o600)
+}
+
+func (s *LocalObjectStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+}
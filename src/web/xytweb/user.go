@@ -1,6 +1,7 @@
 package xytweb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -14,21 +15,25 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/solunara/isb/src/config"
 	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
 	"github.com/solunara/isb/src/types/app"
 	"github.com/solunara/isb/src/types/jwtoken"
-	"github.com/solunara/isb/src/utils"
 	"gorm.io/gorm"
 )
 
 type XytUserHandler struct {
-	cache redis.Cmdable
-	db    *gorm.DB
+	cache    redis.Cmdable
+	db       *gorm.DB
+	patients service.PatientService
+	orders   service.OrderService
 }
 
-func NewXytUserlHandler(cache redis.Cmdable, db *gorm.DB) *XytUserHandler {
+func NewXytUserlHandler(cache redis.Cmdable, db *gorm.DB, patients service.PatientService, orders service.OrderService) *XytUserHandler {
 	return &XytUserHandler{
-		cache: cache,
-		db:    db,
+		cache:    cache,
+		db:       db,
+		patients: patients,
+		orders:   orders,
 	}
 }
 
@@ -39,13 +44,13 @@ func (xh *XytUserHandler) RegisterRoutes(group *gin.RouterGroup) {
 	ug.POST("/login/phone", xh.loginByPhone)
 	ug.GET("/login/wechat/param", xh.wechatParam)
 	ug.GET("/info", xh.getUser)
-	ug.POST("/certification", xh.certification)
 	ug.GET("/patient/list", xh.getPatients)
 	ug.GET("/order/states", xh.getOrderStates)
 	ug.GET("/order/list", xh.getOrderList)
 	ug.POST("/add/patient", xh.addPatient)
 	ug.POST("/update/patient", xh.updatePatient)
 	ug.POST("/delete/patient", xh.deletePatient)
+	ug.POST("/default/patient", xh.setDefaultPatient)
 }
 
 type AddOrUpdateUser struct {
@@ -64,6 +69,31 @@ type AddOrUpdateUser struct {
 	ContactsCertificatesType uint8    `json:"contactsCertificatesType"`
 	ContactsCertificatesNo   string   `json:"contactsCertificatesNo"`
 	ContactsPhone            string   `json:"contactsPhone"`
+	Relation                 uint8    `json:"relation"`
+}
+
+func (req AddOrUpdateUser) toPatient(userId string) xytmodel.Patient {
+	return xytmodel.Patient{
+		Id:                       req.Id,
+		Name:                     req.Name,
+		UserId:                   userId,
+		ProvinceCode:             req.AddressSelected[0],
+		CityCode:                 req.AddressSelected[1],
+		DistrictCode:             req.AddressSelected[2],
+		CertificatesNo:           req.CertificatesNo,
+		Address:                  req.Address,
+		ContactsName:             req.ContactsName,
+		ContactsCertificatesNo:   req.ContactsCertificatesNo,
+		ContactsPhone:            req.ContactsPhone,
+		Birthday:                 req.Birthdate,
+		Phone:                    req.Phone,
+		CertificatesType:         uint8(req.CertificatesType),
+		ContactsCertificatesType: req.ContactsCertificatesType,
+		Sex:                      req.Sex,
+		IsMarry:                  req.IsMarry,
+		IsInsure:                 req.IsInsure,
+		Relation:                 req.Relation,
+	}
 }
 
 type DeleteUser struct {
@@ -84,6 +114,23 @@ type OrderStatus struct {
 	State string `json:"state"`
 }
 
+// isPatientInvalid 就诊人信息校验失败, 错误信息可以直接返回给用户
+func isPatientInvalid(err error) bool {
+	return errors.Is(err, app.ErrIdNumberInvalid) ||
+		errors.Is(err, app.ErrIdNumberMismatch) ||
+		errors.Is(err, app.ErrBirthdayInvalid) ||
+		errors.Is(err, app.ErrPhoneInvalid) ||
+		errors.Is(err, app.ErrPatientRelation)
+}
+
+// isPatientConflict 就诊人数量超限或者实名号已经绑定
+func isPatientConflict(err error) bool {
+	return errors.Is(err, app.ErrPatientLimit) ||
+		errors.Is(err, app.ErrPatientExists) ||
+		errors.Is(err, app.ErrPatientBound) ||
+		errors.Is(err, app.ErrPatientSelfExists)
+}
+
 func (xh *XytUserHandler) addPatient(ctx *gin.Context) {
 	userid, ok := ctx.Get(config.USER_ID)
 	if !ok {
@@ -92,19 +139,25 @@ func (xh *XytUserHandler) addPatient(ctx *gin.Context) {
 	}
 
 	var req AddOrUpdateUser
-	if err := ctx.Bind(&req); err != nil {
-		fmt.Println("err: ", err)
+	if err := ctx.Bind(&req); err != nil || len(req.AddressSelected) < 3 {
 		ctx.JSON(http.StatusOK, app.ErrBadRequest)
 		return
 	}
 
-	fmt.Println("req: ", req)
-	err := CreatePatient(xh.db, userid.(string), req)
+	_, err := xh.patients.Create(ctx, req.toPatient(userid.(string)))
 	if err != nil {
 		if errors.Is(err, app.ErrUserNotFound) {
 			ctx.JSON(http.StatusOK, app.ErrNotFound)
 			return
 		}
+		if isPatientInvalid(err) {
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+			return
+		}
+		if isPatientConflict(err) {
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+			return
+		}
 		ctx.JSON(http.StatusOK, app.ErrInternalServer)
 		return
 	}
@@ -120,17 +173,25 @@ func (xh *XytUserHandler) updatePatient(ctx *gin.Context) {
 	}
 
 	var req AddOrUpdateUser
-	if err := ctx.Bind(&req); err != nil {
+	if err := ctx.Bind(&req); err != nil || len(req.AddressSelected) < 3 {
 		ctx.JSON(http.StatusOK, app.ErrBadRequest)
 		return
 	}
 
-	err := UpdatePatient(xh.db, userid.(string), req)
+	err := xh.patients.Update(ctx, req.toPatient(userid.(string)))
 	if err != nil {
-		if errors.Is(err, app.ErrUserNotFound) {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			ctx.JSON(http.StatusOK, app.ErrNotFound)
 			return
 		}
+		if isPatientInvalid(err) {
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeBadRequest, err.Error()))
+			return
+		}
+		if isPatientConflict(err) {
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+			return
+		}
 		ctx.JSON(http.StatusOK, app.ErrInternalServer)
 		return
 	}
@@ -151,45 +212,47 @@ func (xh *XytUserHandler) deletePatient(ctx *gin.Context) {
 		return
 	}
 
-	err := DeletePatient(xh.db, userid.(string), req.PatientId)
+	err := xh.patients.Delete(ctx, userid.(string), req.PatientId)
 	if err != nil {
-		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		abortFindErr(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
 }
 
-func (xh *XytUserHandler) getOrderList(ctx *gin.Context) {
+func (xh *XytUserHandler) setDefaultPatient(ctx *gin.Context) {
 	userid, ok := ctx.Get(config.USER_ID)
 	if !ok {
 		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
 		return
 	}
 
-	queries := ctx.Request.URL.Query()
-	dbQuery := xh.db.Model(&xytmodel.RegisterOrder{})
-	dbQuery.Where("user_id = ?", userid.(string))
-	for k, v := range queries {
-		switch k {
-		case "patientId":
-			if len(v) > 0 && v[0] != "" {
-				dbQuery.Where("patient_id = ?", v[0])
-			}
-		case "state":
-			if len(v) > 0 && v[0] != "" {
-				st, err := strconv.Atoi(v[0])
-				if err == nil {
-					if st == -1 || st == 0 || st == 1 || st == 2 {
-						dbQuery.Where("state = ?", v[0])
-					}
-				}
-			}
-		case "pageNo", "pageSize", "timeStamp":
-			continue
-		}
+	var req DeleteUser
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	err := xh.patients.SetDefault(ctx, userid.(string), req.PatientId)
+	if err != nil {
+		abortFindErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytUserHandler) getOrderList(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
 	}
 
+	filter := orderFilter(ctx, userid.(string))
+	filter.PatientId = ctx.Query("patientId")
+
 	pageNo, _ := strconv.Atoi(ctx.DefaultQuery("pageNo", "1"))
 	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("pageSize", "1"))
 	if pageNo < 1 {
@@ -202,8 +265,7 @@ func (xh *XytUserHandler) getOrderList(ctx *gin.Context) {
 		pageSize = 30
 	}
 	offset := (pageNo - 1) * pageSize
-	var total int64
-	err := dbQuery.Count(&total).Error
+	orderlist, total, err := xh.orders.List(ctx, filter, offset, pageSize)
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
@@ -218,13 +280,6 @@ func (xh *XytUserHandler) getOrderList(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, app.ResponsePageData(0, []xytmodel.RegisterOrder{}))
 		return
 	}
-
-	var orderlist []xytmodel.RegisterOrder
-	err = dbQuery.Limit(pageSize).Offset(offset).Find(&orderlist).Error
-	if err != nil {
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
 	ctx.JSON(http.StatusOK, app.ResponsePageData(total, orderlist))
 }
 
@@ -240,6 +295,11 @@ func (xh *XytUserHandler) getOrderStates(ctx *gin.Context) {
 		{0, "待支付"},
 		{1, "已支付"},
 		{2, "已完成"},
+		{3, "退款中"},
+		{4, "已退款"},
+		{5, "已签到"},
+		{6, "就诊中"},
+		{7, "爽约"},
 	}))
 }
 
@@ -250,62 +310,15 @@ func (xh *XytUserHandler) getPatients(ctx *gin.Context) {
 		return
 	}
 
-	var patients []xytmodel.Patient
-	err := xh.db.Table(xytmodel.TablePatient).Where("user_id = ?", userid.(string)).Find(&patients).Error
+	patients, err := xh.patients.List(ctx, userid.(string))
 	if err != nil {
 		ctx.JSON(200, app.ErrInternalServer)
 		return
 	}
-	ctx.JSON(http.StatusOK, app.ResponseOK(patients))
-}
-
-type CertificationReq struct {
-	Name     string `json:"name"`
-	Code     string `json:"code"`
-	CodeType string `json:"codeType"`
-	Image    string `json:"image"`
-}
-
-func (xh *XytUserHandler) certification(ctx *gin.Context) {
-	userid, ok := ctx.Get(config.USER_ID)
-	if !ok {
-		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
-		return
-	}
-
-	var req CertificationReq
-	if err := ctx.Bind(&req); err != nil {
-		ctx.JSON(http.StatusOK, app.ErrBadRequest)
-		return
+	for i := range patients {
+		patients[i] = service.MaskPatient(patients[i])
 	}
-
-	var xytuser xytmodel.XytUser
-	err := xh.db.Table(xytmodel.TableXytUser).Where("user_id = ?", userid.(string)).Take(&xytuser).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(200, app.ErrNotFound)
-			return
-		}
-		ctx.JSON(200, app.ErrInternalServer)
-		return
-	}
-
-	if xytuser.IdNumber != "" && xytuser.IdTyper != "" {
-		ctx.JSON(http.StatusOK, app.ResponseOK(true))
-		return
-	}
-
-	err = xh.db.Table(xytmodel.TableXytUser).Where("user_id = ?", userid.(string)).Updates(&xytmodel.XytUser{
-		Name:     req.Name,
-		IdNumber: req.Code,
-		IdTyper:  req.CodeType,
-		Image:    []byte(req.Image),
-	}).Error
-	if err != nil {
-		ctx.JSON(http.StatusOK, app.ErrInternalServer)
-		return
-	}
-	ctx.JSON(http.StatusOK, app.ResponseOK(true))
+	ctx.JSON(http.StatusOK, app.ResponseOK(patients))
 }
 
 func (xh *XytUserHandler) getUser(ctx *gin.Context) {
@@ -330,7 +343,7 @@ func (xh *XytUserHandler) getUser(ctx *gin.Context) {
 		Email:    xytuser.Email.String,
 		Phone:    xytuser.Phone.String,
 		Profile:  xytuser.Profile,
-		IdNumber: xytuser.IdNumber,
+		IdNumber: service.MaskMiddle(xytuser.IdNumber, 3, 4),
 		Birthday: xytuser.Birthday,
 	}))
 }
@@ -431,160 +444,23 @@ func FindOrCreateByPhone(db *gorm.DB, phone string) (xytmodel.XytUser, error) {
 	return xytuser, nil
 }
 
-func CreatePatient(db *gorm.DB, userId string, data AddOrUpdateUser) error {
-	if len(data.AddressSelected) < 3 {
-		return errors.New(app.ErrMissingData)
-	}
-	var xytpatient = xytmodel.Patient{
-		Id:                       utils.GenerateUinqueID(),
-		Name:                     data.Name,
-		UserId:                   userId,
-		ProvinceCode:             data.AddressSelected[0],
-		CityCode:                 data.AddressSelected[1],
-		DistrictCode:             data.AddressSelected[2],
-		CertificatesNo:           data.CertificatesNo,
-		Address:                  data.Address,
-		ContactsName:             data.ContactsName,
-		ContactsCertificatesNo:   data.ContactsCertificatesNo,
-		ContactsPhone:            data.ContactsPhone,
-		Birthday:                 data.Birthdate,
-		Phone:                    data.Phone,
-		CertificatesType:         uint8(data.CertificatesType),
-		ContactsCertificatesType: uint8(data.ContactsCertificatesType),
-		Sex:                      uint8(data.Sex),
-		IsMarry:                  data.IsMarry,
-		IsInsure:                 data.IsInsure,
-	}
-	var user xytmodel.XytUser
-	err := db.Table(xytmodel.TableXytUser).Where("user_id = ?", userId).Take(&user).Error
-	if err != nil {
-		return app.ErrUserNotFound
-	}
-	err = db.Table(xytmodel.TablePatient).Create(&xytpatient).Error
-	if err != nil {
-		if !errors.Is(err, gorm.ErrDuplicatedKey) {
-			return err
-		}
-		xytpatient.UserId = uuid.NewString()
-		return db.Table(xytmodel.TablePatient).Create(&xytpatient).Error
-	}
-	return nil
-}
-
-func UpdatePatient(db *gorm.DB, userId string, data AddOrUpdateUser) error {
-	if len(data.AddressSelected) < 3 {
-		return errors.New(app.ErrMissingData)
-	}
-	var user xytmodel.XytUser
-	err := db.Table(xytmodel.TableXytUser).Where("user_id = ?", userId).Take(&user).Error
-	if err != nil {
-		return app.ErrUserNotFound
-	}
-	var patient xytmodel.Patient
-	err = db.Table(xytmodel.TablePatient).Where("id = ?", data.Id).Take(&patient).Error
-	if err != nil {
-		return app.ErrUserNotFound
-	}
-	return db.Table(xytmodel.TablePatient).Where("id = ?", data.Id).Updates(&xytmodel.Patient{
-		Name:                     data.Name,
-		UserId:                   userId,
-		ProvinceCode:             data.AddressSelected[0],
-		CityCode:                 data.AddressSelected[1],
-		DistrictCode:             data.AddressSelected[2],
-		CertificatesNo:           data.CertificatesNo,
-		Address:                  data.Address,
-		ContactsName:             data.ContactsName,
-		ContactsCertificatesNo:   data.ContactsCertificatesNo,
-		ContactsPhone:            data.ContactsPhone,
-		Birthday:                 data.Birthdate,
-		Phone:                    data.Phone,
-		CertificatesType:         uint8(data.CertificatesType),
-		ContactsCertificatesType: uint8(data.ContactsCertificatesType),
-		Sex:                      uint8(data.Sex),
-		IsMarry:                  data.IsMarry,
-		IsInsure:                 data.IsInsure,
-	}).Error
-}
-
-func DeletePatient(db *gorm.DB, userId string, id string) error {
-	var patient xytmodel.Patient
-	fmt.Println(id)
-	fmt.Println(userId)
-	err := db.Table(xytmodel.TablePatient).Where("id = ? and user_id = ?", id, userId).Take(&patient).Error
-	if err != nil {
-		fmt.Println("err1: ", err)
-		return nil
-	}
-	err = db.Delete(&patient).Error
-	if err != nil {
-		fmt.Println("err2: ", err)
-		return err
-	}
-	return nil
-}
-
-func CreateOrder(db *gorm.DB, data AddOrderReq) (string, error) {
-	var patient xytmodel.Patient
-	err := db.Table(xytmodel.TablePatient).Where("id = ?", data.PatientId).Take(&patient).Error
-	if err != nil {
-		return "", err
-	}
-
-	var schedule xytmodel.Schedule
-	err = db.Table(xytmodel.TableSchedule).Where("sche_id = ?", data.ScheId).Take(&schedule).Error
-	if err != nil {
-		return "", err
-	}
-
-	if schedule.Registered+1 > schedule.MaxPatients {
-		return "", errors.New("已约满")
-	}
-
-	var hospital xytmodel.Hospital
-	err = db.Table(xytmodel.TableHospital).Where("uid = ?", schedule.HosID).Take(&hospital).Error
+// CreateOrder 不经过 redis 预扣, 直接在数据库中占号下单
+func CreateOrder(ctx context.Context, orderSvc service.OrderService, req service.OrderReq) (string, error) {
+	xytorder, err := orderSvc.Prepare(ctx, req)
 	if err != nil {
 		return "", err
 	}
 
-	var dept xytmodel.Department
-	err = db.Table(xytmodel.TableDepartment).Where("uid = ?", schedule.DeptID).Take(&dept).Error
-	if err != nil {
-		return "", err
-	}
-
-	var doctor xytmodel.Doctor
-	err = db.Table(xytmodel.TableDoctor).Where("id = ?", schedule.DocId).Take(&doctor).Error
-	if err != nil {
-		return "", err
-	}
-
-	var xytorder = xytmodel.RegisterOrder{
-		UserId:       patient.UserId,
-		OrderId:      utils.GenerateUinqueID(),
-		ScheId:       data.ScheId,
-		PatientId:    data.PatientId,
-		HosID:        schedule.HosID,
-		DeptID:       schedule.DeptID,
-		DocId:        schedule.DocId,
-		HosName:      hospital.FullName,
-		DeptName:     dept.Name,
-		DocName:      doctor.Name,
-		PatientName:  patient.Name,
-		VisitTime:    schedule.WorkDate + " " + schedule.TimeSlot,
-		Amount:       schedule.Amount,
-		State:        0,
-		RegisterTime: time.Now().Format(time.DateTime),
-	}
-
-	err = db.Table(xytmodel.TableOrder).Create(&xytorder).Error
-	if err != nil {
-		return "", err
-	}
-
-	err = db.Table(xytmodel.TableSchedule).Where("sche_id = ?", schedule.ScheId).Update("registered", schedule.Registered+1).Error
-	if err != nil {
-		return xytorder.OrderId, err
+	// 重试的请求直接返回第一次创建的订单
+	if xytorder.IdempotencyKey.Valid {
+		orderId, err := orderSvc.FindIdByIdempotencyKey(ctx, xytorder.UserId, xytorder.IdempotencyKey.String)
+		if err == nil {
+			return orderId, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
 	}
 
-	return xytorder.OrderId, nil
+	return orderSvc.Create(ctx, xytorder)
 }
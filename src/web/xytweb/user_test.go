@@ -0,0 +1,70 @@
+package xytweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/pkg/fieldcrypt"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 数据库中是密文, 列表返回解密后脱敏的值
+func TestXytUserHandler_GetPatients(t *testing.T) {
+	keyring, err := fieldcrypt.NewKeyring("k2", map[string]string{"k1": "old-secret", "k2": "new-secret"}, "index")
+	require.NoError(t, err)
+	fieldcrypt.SetDefault(keyring)
+	t.Cleanup(func() { fieldcrypt.SetDefault(nil) })
+	oldKeyring, err := fieldcrypt.NewKeyring("k1", map[string]string{"k1": "old-secret"}, "index")
+	require.NoError(t, err)
+	certNo, err := oldKeyring.Encrypt("11010519491231002X")
+	require.NoError(t, err)
+	phone, err := keyring.Encrypt("13800138000")
+	require.NoError(t, err)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT \\* FROM `patient` WHERE user_id = \\?").
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "certificates_no", "phone", "contacts_phone", "address"}).
+			AddRow("p1", "张三", certNo, phone, "", "明文地址"))
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+
+	server := gin.New()
+	server.Use(func(ctx *gin.Context) {
+		ctx.Set(config.USER_ID, "u1")
+	})
+	_, userCtrl := newTestHandlers(t, db)
+	userCtrl.RegisterRoutes(server.Group("/xyt"))
+	req, err := http.NewRequest(http.MethodGet, "/xyt/user/patient/list", nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+
+	var body struct {
+		Code int                `json:"code"`
+		Data []xytmodel.Patient `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "110***********002X", body.Data[0].CertificatesNo)
+	assert.Equal(t, "138****8000", body.Data[0].Phone)
+	assert.Equal(t, "", body.Data[0].ContactsPhone)
+	assert.Equal(t, "明文地址", body.Data[0].Address)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
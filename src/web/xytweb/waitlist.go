@@ -0,0 +1,333 @@
+package xytweb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/solunara/isb/src/config"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/repository"
+	"github.com/solunara/isb/src/service"
+	"github.com/solunara/isb/src/service/sms"
+	"github.com/solunara/isb/src/types/app"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// 每个用户同时候补的排班数上限
+	MaxWaitlistPerUser = 3
+	// 递补订单的默认确认时限
+	defaultWaitlistConfirmWindow = 30 * time.Minute
+
+	SmsTplWaitlistPromoted = "waitlist_promoted"
+)
+
+// Waitlist 约满排班的候补队列, 有号源释放时按加入顺序递补为待支付订单
+type Waitlist struct {
+	db            *gorm.DB
+	orderSvc      service.OrderService
+	smsSvc        sms.Service
+	guard         *BookingGuard
+	confirmWindow time.Duration
+}
+
+func NewWaitlist(db *gorm.DB, orderSvc service.OrderService, smsSvc sms.Service, confirmWindow time.Duration) *Waitlist {
+	if confirmWindow <= 0 {
+		confirmWindow = defaultWaitlistConfirmWindow
+	}
+	return &Waitlist{
+		db:            db,
+		orderSvc:      orderSvc,
+		smsSvc:        smsSvc,
+		confirmWindow: confirmWindow,
+	}
+}
+
+// UseGuard 递补时在占号的事务里检查预约规则, 和直接预约一样
+func (w *Waitlist) UseGuard(guard *BookingGuard) {
+	w.guard = guard
+}
+
+type WaitlistView struct {
+	xytmodel.WaitlistEntry
+	VisitTime string `json:"visitTime"`
+	Position  int64  `json:"position"` // 排在第几位, 只对候补中的记录有效
+}
+
+// Join 排班约满时加入候补, 同一就诊人对同一排班只能候补一次
+func (w *Waitlist) Join(ctx context.Context, userId, patientId, scheId string) (xytmodel.WaitlistEntry, error) {
+	_, err := FindUserPatient(ctx, w.db, userId, patientId)
+	if err != nil {
+		return xytmodel.WaitlistEntry{}, err
+	}
+	var schedule xytmodel.Schedule
+	err = w.db.WithContext(ctx).Table(xytmodel.TableSchedule).Where("sche_id = ?", scheId).Take(&schedule).Error
+	if err != nil {
+		return xytmodel.WaitlistEntry{}, err
+	}
+	switch {
+	case schedule.Status == xytmodel.ScheduleStatusSuspended:
+		return xytmodel.WaitlistEntry{}, app.ErrScheduleSuspended
+	case schedule.Registered < schedule.MaxPatients:
+		return xytmodel.WaitlistEntry{}, app.ErrScheduleAvailable
+	}
+
+	var entry = xytmodel.WaitlistEntry{
+		ScheId:    scheId,
+		UserId:    userId,
+		PatientId: patientId,
+		State:     xytmodel.WaitlistStateWaiting,
+	}
+	err = w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住用户的候补记录, 防止并发加入超过上限
+		var waiting []xytmodel.WaitlistEntry
+		err := tx.Table(xytmodel.TableWaitlist).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? and state = ?", userId, xytmodel.WaitlistStateWaiting).
+			Find(&waiting).Error
+		if err != nil {
+			return err
+		}
+		for _, e := range waiting {
+			if e.ScheId == scheId && e.PatientId == patientId {
+				return app.ErrWaitlistJoined
+			}
+		}
+		if len(waiting) >= MaxWaitlistPerUser {
+			return app.ErrWaitlistLimit
+		}
+		return tx.Create(&entry).Error
+	})
+	return entry, err
+}
+
+// Leave 退出候补, 已经递补的记录不能退出, 需要取消订单
+func (w *Waitlist) Leave(ctx context.Context, userId string, id int) error {
+	res := w.db.WithContext(ctx).Table(xytmodel.TableWaitlist).
+		Where("id = ? and user_id = ? and state = ?", id, userId, xytmodel.WaitlistStateWaiting).
+		Update("state", xytmodel.WaitlistStateLeft)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// List 用户的候补记录, 候补中的记录带上当前排位
+func (w *Waitlist) List(ctx context.Context, userId string) ([]WaitlistView, error) {
+	var entries []xytmodel.WaitlistEntry
+	err := w.db.WithContext(ctx).Table(xytmodel.TableWaitlist).Where("user_id = ?", userId).Order("id desc").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	var views = make([]WaitlistView, 0, len(entries))
+	for _, entry := range entries {
+		view := WaitlistView{WaitlistEntry: entry}
+		var schedule xytmodel.Schedule
+		err = w.db.WithContext(ctx).Table(xytmodel.TableSchedule).Select("work_date", "time_slot").Where("sche_id = ?", entry.ScheId).Take(&schedule).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		view.VisitTime = schedule.WorkDate + " " + schedule.TimeSlot
+		if entry.State == xytmodel.WaitlistStateWaiting {
+			err = w.db.WithContext(ctx).Table(xytmodel.TableWaitlist).
+				Where("sche_id = ? and state = ? and id < ?", entry.ScheId, xytmodel.WaitlistStateWaiting, entry.Id).
+				Count(&view.Position).Error
+			if err != nil {
+				return nil, err
+			}
+			view.Position++
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Promote 把排班释放出来的号源递补给最早加入候补的就诊人, 返回是否递补成功
+// 递补成功时号源直接被新订单占用, 不需要再归还
+func (w *Waitlist) Promote(ctx context.Context, scheId string) (bool, error) {
+	for {
+		var entry xytmodel.WaitlistEntry
+		err := w.db.WithContext(ctx).Table(xytmodel.TableWaitlist).
+			Where("sche_id = ? and state = ?", scheId, xytmodel.WaitlistStateWaiting).
+			Order("id").Take(&entry).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		xytorder, err := w.orderSvc.Prepare(ctx, service.OrderReq{UserId: entry.UserId, PatientId: entry.PatientId, ScheId: scheId})
+		switch {
+		case err == nil:
+		case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, app.ErrScheduleSuspended):
+			// 就诊人被删除或排班已停诊, 作废这条候补继续下一个
+			err = w.invalidate(ctx, entry.Id)
+			if err != nil {
+				return false, err
+			}
+			continue
+		default:
+			return false, err
+		}
+		xytorder.ConfirmDeadline = time.Now().Add(w.confirmWindow).UnixMilli()
+
+		// 候补记录和订单在同一个事务里更新, 用户同时退出候补时不会留下订单
+		checks := []service.OrderCheck{func(ctx context.Context, repo repository.OrderRepository, order xytmodel.RegisterOrder) error {
+			return repo.PromoteWaitlist(ctx, entry.Id, order.OrderId)
+		}}
+		if w.guard != nil {
+			checks = append(checks, w.guard.CheckTx)
+		}
+		_, err = w.orderSvc.Create(ctx, xytorder, checks...)
+		switch {
+		case err == nil:
+			w.notify(ctx, xytorder)
+			return true, nil
+		case errors.Is(err, app.ErrBookingRejected), errors.Is(err, gorm.ErrRecordNotFound):
+			// 候补期间就诊人预约了别的号或被删除了, 作废这条候补继续下一个
+			err = w.invalidate(ctx, entry.Id)
+			if err != nil {
+				return false, err
+			}
+			continue
+		case errors.Is(err, app.ErrWaitlistChanged):
+			// 用户刚好退出了候补
+			continue
+		case errors.Is(err, app.ErrScheduleFull):
+			// 号源被直接预约抢走了
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
+
+// 医生某天停诊时作废这些排班上的候补
+func invalidateScheduleWaitlist(tx *gorm.DB, docId, workDate string) error {
+	return tx.Table(xytmodel.TableWaitlist).
+		Where("sche_id in (?)", tx.Table(xytmodel.TableSchedule).Select("sche_id").Where("doc_id = ? and work_date = ?", docId, workDate)).
+		Where("state = ?", xytmodel.WaitlistStateWaiting).
+		Update("state", xytmodel.WaitlistStateInvalid).Error
+}
+
+func (w *Waitlist) invalidate(ctx context.Context, id int) error {
+	return w.db.WithContext(ctx).Table(xytmodel.TableWaitlist).
+		Where("id = ? and state = ?", id, xytmodel.WaitlistStateWaiting).
+		Update("state", xytmodel.WaitlistStateInvalid).Error
+}
+
+// 通知失败只记录日志, 用户也可以在订单列表里看到递补的订单
+func (w *Waitlist) notify(ctx context.Context, xytorder xytmodel.RegisterOrder) {
+	var patient xytmodel.Patient
+	err := w.db.WithContext(ctx).Table(xytmodel.TablePatient).Select("phone").Where("id = ?", xytorder.PatientId).Take(&patient).Error
+	if err != nil || patient.Phone == "" {
+		log.Printf("notify waitlist order %s: no phone, %v", xytorder.OrderId, err)
+		return
+	}
+	deadline := time.UnixMilli(xytorder.ConfirmDeadline).Format(time.DateTime)
+	err = w.smsSvc.Send(ctx, SmsTplWaitlistPromoted, []string{xytorder.PatientName, xytorder.VisitTime, xytorder.DocName, deadline}, patient.Phone)
+	if err != nil {
+		log.Printf("notify waitlist order %s: %v", xytorder.OrderId, err)
+	}
+}
+
+type XytWaitlistHandler struct {
+	waitlist *Waitlist
+}
+
+func NewXytWaitlistHandler(waitlist *Waitlist) *XytWaitlistHandler {
+	return &XytWaitlistHandler{
+		waitlist: waitlist,
+	}
+}
+
+func (xh *XytWaitlistHandler) RegisterRoutes(group *gin.RouterGroup) {
+	wg := group.Group("/hos/waitlist")
+	wg.GET("", xh.list)
+	wg.POST("/join", xh.join)
+	wg.POST("/leave", xh.leave)
+}
+
+type joinWaitlistReq struct {
+	PatientId string `json:"patientId"`
+	ScheId    string `json:"scheId"`
+}
+
+func (xh *XytWaitlistHandler) join(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req joinWaitlistReq
+	if err := ctx.Bind(&req); err != nil || req.PatientId == "" || req.ScheId == "" {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	entry, err := xh.waitlist.Join(ctx, userid.(string), req.PatientId, req.ScheId)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+		case errors.Is(err, app.ErrScheduleSuspended), errors.Is(err, app.ErrScheduleAvailable), errors.Is(err, app.ErrWaitlistJoined):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeConflict, err.Error()))
+		case errors.Is(err, app.ErrWaitlistLimit):
+			ctx.JSON(http.StatusOK, app.ResponseErr(app.ErrCodeForbidden, err.Error()))
+		default:
+			ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(entry))
+}
+
+type leaveWaitlistReq struct {
+	Id int `json:"id"`
+}
+
+func (xh *XytWaitlistHandler) leave(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	var req leaveWaitlistReq
+	if err := ctx.Bind(&req); err != nil {
+		ctx.JSON(http.StatusOK, app.ErrBadRequest)
+		return
+	}
+
+	err := xh.waitlist.Leave(ctx, userid.(string), req.Id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, app.ErrNotFound)
+			return
+		}
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(nil))
+}
+
+func (xh *XytWaitlistHandler) list(ctx *gin.Context) {
+	userid, ok := ctx.Get(config.USER_ID)
+	if !ok {
+		ctx.JSON(http.StatusOK, app.ErrUnauthorized)
+		return
+	}
+	views, err := xh.waitlist.List(ctx, userid.(string))
+	if err != nil {
+		ctx.JSON(http.StatusOK, app.ErrInternalServer)
+		return
+	}
+	ctx.JSON(http.StatusOK, app.ResponseOK(views))
+}
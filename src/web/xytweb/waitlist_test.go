@@ -0,0 +1,205 @@
+package xytweb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/solunara/isb/src/model/xytmodel"
+	"github.com/solunara/isb/src/service"
+	svcmocks "github.com/solunara/isb/src/service/mocks"
+	"github.com/solunara/isb/src/types/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestWaitlist_Join(t *testing.T) {
+	patientRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "user_id"}).AddRow("p1", "u1")
+	}
+	scheduleRows := func(registered int, status int8) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"sche_id", "max_patients", "registered", "status"}).AddRow("s1", 20, registered, status)
+	}
+	waitingRows := func(scheIds ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"id", "sche_id", "user_id", "patient_id", "state"})
+		for i, scheId := range scheIds {
+			rows.AddRow(i+1, scheId, "u1", "p1", 0)
+		}
+		return rows
+	}
+
+	testCases := []struct {
+		name string
+		mock func(t *testing.T) *sql.DB
+
+		wantErr error
+	}{
+		{
+			name: "加入成功",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(patientRows())
+				mock.ExpectQuery("SELECT \\* FROM `schedule`.*").WillReturnRows(scheduleRows(20, 0))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule_waitlist` .* FOR UPDATE").WillReturnRows(waitingRows("s2"))
+				mock.ExpectExec("INSERT INTO `schedule_waitlist` .*").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+				return db
+			},
+		},
+		{
+			name: "就诊人不属于当前用户",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				return db
+			},
+			wantErr: gorm.ErrRecordNotFound,
+		},
+		{
+			name: "还有号源",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(patientRows())
+				mock.ExpectQuery("SELECT \\* FROM `schedule`.*").WillReturnRows(scheduleRows(19, 0))
+				return db
+			},
+			wantErr: app.ErrScheduleAvailable,
+		},
+		{
+			name: "医生已停诊",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(patientRows())
+				mock.ExpectQuery("SELECT \\* FROM `schedule`.*").WillReturnRows(scheduleRows(20, 1))
+				return db
+			},
+			wantErr: app.ErrScheduleSuspended,
+		},
+		{
+			name: "重复加入",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(patientRows())
+				mock.ExpectQuery("SELECT \\* FROM `schedule`.*").WillReturnRows(scheduleRows(20, 0))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule_waitlist` .* FOR UPDATE").WillReturnRows(waitingRows("s1"))
+				mock.ExpectRollback()
+				return db
+			},
+			wantErr: app.ErrWaitlistJoined,
+		},
+		{
+			name: "超过候补上限",
+			mock: func(t *testing.T) *sql.DB {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				mock.ExpectQuery("SELECT \\* FROM `patient`.*").WillReturnRows(patientRows())
+				mock.ExpectQuery("SELECT \\* FROM `schedule`.*").WillReturnRows(scheduleRows(20, 0))
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `schedule_waitlist` .* FOR UPDATE").WillReturnRows(waitingRows("s2", "s3", "s4"))
+				mock.ExpectRollback()
+				return db
+			},
+			wantErr: app.ErrWaitlistLimit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			w := NewWaitlist(db, nil, nil, 0)
+			entry, err := w.Join(context.Background(), "u1", "p1", "s1")
+			assert.Equal(t, tc.wantErr, err)
+			if err == nil {
+				assert.Equal(t, 2, entry.Id)
+				assert.Equal(t, "s1", entry.ScheId)
+			}
+		})
+	}
+}
+
+func TestWaitlist_Promote(t *testing.T) {
+	const entryQuery = "SELECT \\* FROM `schedule_waitlist` WHERE sche_id = \\? and state = \\? ORDER BY id"
+	entryRows := func(id int, patientId string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "sche_id", "user_id", "patient_id", "state"}).AddRow(id, "s1", "u1", patientId, 0)
+	}
+	rejected := &RuleViolation{Rule: "duplicate_visit", Reason: "已经预约过该医生或科室"}
+	testCases := []struct {
+		name   string
+		mock   func(mock sqlmock.Sqlmock)
+		create []error
+
+		wantPromoted bool
+	}{
+		{
+			name: "就诊人不满足预约规则时递补下一个",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(entryQuery).WillReturnRows(entryRows(1, "p1"))
+				mock.ExpectExec("UPDATE `schedule_waitlist` SET `state`=\\?").
+					WithArgs(xytmodel.WaitlistStateInvalid, 1, xytmodel.WaitlistStateWaiting).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(entryQuery).WillReturnRows(entryRows(2, "p2"))
+				// 通知时查不到手机号, 只记录日志
+				mock.ExpectQuery("SELECT `phone` FROM `patient`").WillReturnRows(sqlmock.NewRows([]string{"phone"}))
+			},
+			create:       []error{rejected, nil},
+			wantPromoted: true,
+		},
+		{
+			name: "号源被直接预约抢走了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(entryQuery).WillReturnRows(entryRows(1, "p1"))
+			},
+			create: []error{app.ErrScheduleFull},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tc.mock(mock)
+			db := newQueueTestDB(t, sqlDB)
+
+			orderSvc := svcmocks.NewMockOrderService(ctrl)
+			orderSvc.EXPECT().Prepare(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, req service.OrderReq) (xytmodel.RegisterOrder, error) {
+					return xytmodel.RegisterOrder{OrderId: "o-" + req.PatientId, UserId: req.UserId, PatientId: req.PatientId, ScheId: req.ScheId}, nil
+				}).Times(len(tc.create))
+			for _, createErr := range tc.create {
+				orderSvc.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, order xytmodel.RegisterOrder, checks ...service.OrderCheck) (string, error) {
+						// 候补记录的更新和预约规则的检查都在下单的事务里
+						assert.Len(t, checks, 2)
+						return order.OrderId, createErr
+					})
+			}
+
+			w := NewWaitlist(db, orderSvc, nil, 0)
+			w.UseGuard(NewBookingGuard(db))
+			promoted, err := w.Promote(context.Background(), "s1")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantPromoted, promoted)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}